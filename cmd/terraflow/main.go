@@ -17,16 +17,40 @@ func printHelp() {
 Usage: terraflow [global options] <subcommand> [args]
 
 Available commands:
-  help     Show this help output, or the help for a specified subcommand
-  version  Show the current Terraflow version
-  console  Try Terraform expressions at an interactive command prompt
+`)
+	for _, c := range cli.Commands() {
+		fmt.Printf("  %-12s%s\n", c.Name, c.Synopsis)
+	}
+	fmt.Print(`
+Global options (use these before the subcommand, if any):
+  -help       Show this help output
+  -no-color   Disable color in Terraflow's own output, like NO_COLOR
+  -trace      Print every command Terraflow runs, with its arguments and
+              duration, to stderr
 `)
 }
 
+// exitBelowVersionFloor exits with an error when the installed Terraform is too
+// old for state synthesis to work at all.
+func exitBelowVersionFloor() {
+	if err := terraform.CheckVersionFloor(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
 func main() {
 	flag.Usage = printHelp
 	flagHelp := flag.Bool("help", false, "Show help")
+	flagNoColor := flag.Bool("no-color", false, "Disable color in Terraflow's own output")
+	flagTrace := flag.Bool("trace", false, "Print every command Terraflow runs")
 	flag.Parse()
+	if *flagNoColor {
+		cli.DisableColor()
+	}
+	if *flagTrace {
+		terraform.SetTrace(os.Stderr)
+	}
 
 	args := flag.Args()
 
@@ -40,11 +64,20 @@ func main() {
 		os.Exit(0)
 	}
 
-	if args[0] == "console" {
-		// Warn-only Terraform version check before starting console
-		terraform.CheckVersionWarn()
-		// defer to the CLI console handler
-		cli.RunConsoleCommand(args[1:])
+	for _, c := range cli.Commands() {
+		if c.Name != args[0] || c.Run == nil {
+			continue
+		}
+		if c.VersionFloor {
+			exitBelowVersionFloor()
+		}
+		if err := c.Run(args[1:]); err != nil {
+			if err == flag.ErrHelp {
+				os.Exit(0)
+			}
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}
 
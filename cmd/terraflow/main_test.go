@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestMain lets tests run the real main in a subprocess to observe its exit code.
+func TestMain(m *testing.M) {
+	if os.Getenv("TERRAFLOW_TEST_MAIN") == "1" {
+		os.Args = append([]string{"terraflow"}, strings.Fields(os.Getenv("TERRAFLOW_TEST_ARGS"))...)
+		main()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func TestConsole_RefusesTerraformBelowFloor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho \"Terraform v0.11.14\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "terraform"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0])
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "TERRAFLOW_TEST_MAIN=1", "TERRAFLOW_TEST_ARGS=console", "PATH="+bin)
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() == 0 {
+		t.Fatalf("expected non-zero exit, got %v: %s", err, out)
+	}
+	if !strings.Contains(string(out), "unsupported Terraform/OpenTofu 0.11.14: terraflow requires 0.12.0 or newer") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+// checkOptions holds the flags of the check command.
+type checkOptions struct {
+	varFiles multiStringFlag
+	strict   *bool
+}
+
+// newCheckFlagSet defines the flags and usage of the check command.
+func newCheckFlagSet() (*flag.FlagSet, *checkOptions) {
+	opts := &checkOptions{}
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		if _, err := fmt.Fprint(fs.Output(), `Usage: terraflow [global options] check [options]
+
+  Evaluates every resource attribute of the configuration the way the console
+  does and reports those that could not be resolved, grouped by resource and
+  reason. Resources declared more than once in a module are reported first.
+
+Options:
+
+  -strict               Exit with a non-zero status if any attribute could
+                        not be resolved or any address is declared twice.
+
+  -var-file=path        Set variables in the Terraform configuration from
+                        a file. If "terraform.tfvars" or any ".auto.tfvars"
+                        files are present, they will be automatically loaded.
+`); err != nil {
+			fmt.Fprintln(os.Stderr, "error printing usage:", err)
+		}
+	}
+	fs.Var(&opts.varFiles, "var-file", "Path to a .tfvars file (repeatable).")
+	opts.strict = fs.Bool("strict", false, "Fail when any attribute could not be resolved")
+	return fs, opts
+}
+
+// RunCheckCommand implements `terraflow check`: it evaluates every resource
+// attribute without starting the console and reports the ones that could not be
+// resolved, after any duplicate addresses. With -strict either is returned as an
+// error.
+func RunCheckCommand(args []string) error {
+	fs, opts := newCheckFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cwd, _ := os.Getwd()
+	if err := checkProjectDir(cwd); err != nil {
+		return err
+	}
+	dups, err := terraform.FindDuplicateAddresses(cwd)
+	if err != nil {
+		return err
+	}
+	workDir, statePath := consoleWorkspace(cwd)
+	checked, unresolved, err := terraform.CheckConfig(cwd, workDir, statePath, normalizeVarFiles(workDir, []string(opts.varFiles)))
+	terraform.ResetAllPersistentEvaluators()
+	if err != nil {
+		return err
+	}
+	writeDuplicateReport(os.Stdout, dups)
+	writeCheckReport(os.Stdout, checked, unresolved)
+	if *opts.strict && len(dups) > 0 {
+		return fmt.Errorf("%d addresses are declared more than once", len(dups))
+	}
+	if *opts.strict && len(unresolved) > 0 {
+		return fmt.Errorf("%d of %d attributes could not be resolved", len(unresolved), checked)
+	}
+	return nil
+}
+
+// consoleWorkspace returns the directory and state file to evaluate in for
+// the configuration in cwd. The console's scratch workspace and state are
+// reused when they exist, so references to already synthesized resources
+// resolve too; otherwise cwd is used without state.
+func consoleWorkspace(cwd string) (workDir, statePath string) {
+	workDir = cwd
+	scratchDir := filepath.Join(cwd, ".terraflow")
+	if fi, err := os.Stat(scratchDir); err == nil && fi.IsDir() {
+		workDir = scratchDir
+		if _, err := os.Stat(filepath.Join(scratchDir, "terraform.tfstate")); err == nil {
+			statePath = filepath.Join(scratchDir, "terraform.tfstate")
+		}
+	}
+	return workDir, statePath
+}
+
+// writeDuplicateReport prints every duplicate address with the file and line of
+// each declaration. It prints nothing when there are none.
+func writeDuplicateReport(w io.Writer, dups []terraform.DuplicateAddress) {
+	for _, d := range dups {
+		fmt.Fprintf(w, "%s is declared %d times:\n", d.Address, len(d.Ranges))
+		for _, r := range d.Ranges {
+			fmt.Fprintf(w, "  %s:%d\n", r.Filename, r.Start.Line)
+		}
+	}
+}
+
+// writeCheckReport prints unresolved attributes grouped by resource, then by
+// reason, followed by a summary line. Entries arrive sorted by resource.
+func writeCheckReport(w io.Writer, checked int, unresolved []terraform.UnresolvedAttr) {
+	for i := 0; i < len(unresolved); {
+		res := unresolved[i].Resource
+		fmt.Fprintln(w, res)
+		byReason := map[string][]terraform.UnresolvedAttr{}
+		var reasons []string
+		for ; i < len(unresolved) && unresolved[i].Resource == res; i++ {
+			u := unresolved[i]
+			if _, ok := byReason[u.Reason]; !ok {
+				reasons = append(reasons, u.Reason)
+			}
+			byReason[u.Reason] = append(byReason[u.Reason], u)
+		}
+		for _, reason := range reasons {
+			fmt.Fprintf(w, "  %s:\n", reason)
+			for _, u := range byReason[reason] {
+				fmt.Fprintf(w, "    %s (%s)\n", u.Attr, u.Detail)
+			}
+		}
+	}
+	if len(unresolved) == 0 {
+		fmt.Fprintf(w, "All %d attributes resolved.\n", checked)
+		return
+	}
+	fmt.Fprintf(w, "%d of %d attributes could not be resolved.\n", len(unresolved), checked)
+}
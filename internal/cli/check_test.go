@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestWriteCheckReport_GroupsByResourceAndReason(t *testing.T) {
+	unresolved := []terraform.UnresolvedAttr{
+		{Resource: "aws_instance.web", Attr: "ami", Reason: terraform.ReasonUnresolvedReference, Detail: "data.aws_ami.ubuntu.id"},
+		{Resource: "aws_instance.web", Attr: "arn", Reason: terraform.ReasonMissingProvider, Detail: "provider::aws::arn_parse"},
+		{Resource: "aws_instance.web", Attr: "user_data", Reason: terraform.ReasonUnresolvedReference, Detail: "local.script"},
+		{Resource: "module.net.aws_subnet.a", Attr: "cidr_block", Reason: terraform.ReasonUnknownFunction, Detail: "timestamp"},
+	}
+	var buf bytes.Buffer
+	writeCheckReport(&buf, 10, unresolved)
+	want := `aws_instance.web
+  unresolved reference:
+    ami (data.aws_ami.ubuntu.id)
+    user_data (local.script)
+  missing provider:
+    arn (provider::aws::arn_parse)
+module.net.aws_subnet.a
+  unknown function:
+    cidr_block (timestamp)
+4 of 10 attributes could not be resolved.
+`
+	if buf.String() != want {
+		t.Fatalf("report:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteDuplicateReport_ListsEachDeclaration(t *testing.T) {
+	dups := []terraform.DuplicateAddress{{
+		Address: "null_resource.ex",
+		Ranges: []hcl.Range{
+			{Filename: "extra.tf", Start: hcl.Pos{Line: 5}},
+			{Filename: "main.tf", Start: hcl.Pos{Line: 1}},
+		},
+	}}
+	var buf bytes.Buffer
+	writeDuplicateReport(&buf, dups)
+	want := `null_resource.ex is declared 2 times:
+  extra.tf:5
+  main.tf:1
+`
+	if buf.String() != want {
+		t.Fatalf("report:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"os"
+	"strings"
+)
+
+// theme holds the escape sequences used to color console output. An empty
+// field leaves that element unstyled.
+type theme struct {
+	ghost    string // history suggestions, unselected completions and notes
+	selected string // the selected completion
+	err      string // evaluation errors
+}
+
+// defaultTheme keeps the console's original look: dim ghosts, everything else plain.
+var defaultTheme = theme{ghost: ansiDim}
+
+// activeTheme styles REPL output; RunREPL loads it from the environment.
+var activeTheme = defaultTheme
+
+// colorDisabled is set by the global -no-color flag.
+var colorDisabled bool
+
+// DisableColor turns off the colors terraflow adds to its own output, the
+// same as setting NO_COLOR. Terraform itself always runs with -no-color.
+func DisableColor() {
+	colorDisabled = true
+}
+
+// themeOverrides maps the environment variables that override a theme color
+// to the field they set.
+func themeOverrides(t *theme) map[string]*string {
+	return map[string]*string{
+		"TERRAFLOW_COLOR_GHOST":    &t.ghost,
+		"TERRAFLOW_COLOR_SELECTED": &t.selected,
+		"TERRAFLOW_COLOR_ERROR":    &t.err,
+	}
+}
+
+// loadTheme returns the theme for the current environment. Colors are off
+// entirely with -no-color, when NO_COLOR is set or when stdout is not a
+// terminal, so no escape sequences end up in piped or captured output.
+func loadTheme(stdoutTTY bool) theme {
+	if !stdoutTTY || colorDisabled || os.Getenv("NO_COLOR") != "" {
+		return theme{}
+	}
+	t := defaultTheme
+	for env, field := range themeOverrides(&t) {
+		if v, ok := os.LookupEnv(env); ok {
+			if seq, ok := sgrSequence(v); ok {
+				*field = seq
+			}
+		}
+	}
+	return t
+}
+
+// sgrSequence converts SGR parameters such as "2" or "1;31" into an escape
+// sequence; "none" or an empty value disables the color. Anything else is
+// rejected so arbitrary control sequences cannot be injected.
+func sgrSequence(v string) (string, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" || strings.EqualFold(v, "none") {
+		return "", true
+	}
+	for _, r := range v {
+		if (r < '0' || r > '9') && r != ';' {
+			return "", false
+		}
+	}
+	return "\x1b[" + v + "m", true
+}
+
+// paint wraps s in the color seq, resetting afterwards.
+func paint(seq, s string) string {
+	if seq == "" || s == "" {
+		return s
+	}
+	return seq + s + ansiReset
+}
+
+// stdoutIsTerminal reports whether stdout is attached to a terminal.
+func stdoutIsTerminal() bool {
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadTheme_NoColorEmitsNoANSI(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	t.Setenv("TERRAFLOW_COLOR_ERROR", "31")
+	if got := loadTheme(true); got != (theme{}) {
+		t.Fatalf("NO_COLOR should disable every color, got %#v", got)
+	}
+	defer func(orig theme) { activeTheme = orig }(activeTheme)
+	activeTheme = loadTheme(true)
+
+	ev := &recordingEvaluator{stdout: "\"x\"\n", stderr: "Error: Invalid reference\n"}
+	got := captureStdout(t, func() {
+		orig := os.Stderr
+		os.Stderr = os.Stdout
+		defer func() { os.Stderr = orig }()
+		evaluateSubmitted(ev, "var.x", "var.x", outputMode{echo: true}, defaultEvalTimeout)
+	})
+	if !strings.Contains(got, "Invalid reference") {
+		t.Fatalf("missing evaluation output: %q", got)
+	}
+	if strings.Contains(got, "\x1b") {
+		t.Fatalf("ANSI escape in output with NO_COLOR: %q", got)
+	}
+}
+
+func TestDisableColor_ErrorsEmitNoANSI(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERRAFLOW_COLOR_GHOST", "2")
+	t.Setenv("TERRAFLOW_COLOR_ERROR", "31")
+	defer func(orig bool) { colorDisabled = orig }(colorDisabled)
+	DisableColor()
+	if got := loadTheme(true); got != (theme{}) {
+		t.Fatalf("-no-color should disable every color, got %#v", got)
+	}
+	defer func(orig theme) { activeTheme = orig }(activeTheme)
+	activeTheme = loadTheme(true)
+
+	ev := &recordingEvaluator{stderr: "Error: Invalid reference\n"}
+	got := captureStdout(t, func() {
+		orig := os.Stderr
+		os.Stderr = os.Stdout
+		defer func() { os.Stderr = orig }()
+		evaluateSubmitted(ev, "var.x", "var.x", outputMode{echo: true}, defaultEvalTimeout)
+	})
+	if !strings.Contains(got, "Invalid reference") || strings.Contains(got, "\x1b") {
+		t.Fatalf("error rendering with -no-color: %q", got)
+	}
+}
+
+func TestLoadTheme_Overrides(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERRAFLOW_COLOR_GHOST", "none")
+	t.Setenv("TERRAFLOW_COLOR_SELECTED", "1;36")
+	t.Setenv("TERRAFLOW_COLOR_ERROR", "\x1b]0;title\a")
+	want := theme{ghost: "", selected: "\x1b[1;36m", err: ""}
+	if got := loadTheme(true); got != want {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+	// Piped stdout never gets colors
+	if got := loadTheme(false); got != (theme{}) {
+		t.Fatalf("non-terminal stdout should disable colors, got %#v", got)
+	}
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"flag"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+// Command describes a terraflow subcommand for the help output and shell
+// completion, and how main runs it.
+type Command struct {
+	Name     string
+	Synopsis string
+	// Args are the words accepted as the first argument, such as the
+	// export and import actions of history
+	Args []string
+	// Run runs the command with the arguments after its name; nil for help
+	// and version, which main handles itself
+	Run func(args []string) error
+	// VersionFloor refuses Terraform below the version floor before Run
+	VersionFloor bool
+	// flagSet returns the command's flags; nil when it takes none
+	flagSet func() *flag.FlagSet
+}
+
+// Flags returns the flags of the command in lexical order.
+func (c Command) Flags() []*flag.Flag {
+	if c.flagSet == nil {
+		return nil
+	}
+	var out []*flag.Flag
+	c.flagSet().VisitAll(func(f *flag.Flag) {
+		out = append(out, f)
+	})
+	return out
+}
+
+// Commands lists the subcommands of terraflow in the order help shows them.
+func Commands() []Command {
+	return []Command{
+		{Name: "help", Synopsis: "Show this help output, or the help for a specified subcommand"},
+		{Name: "version", Synopsis: "Show the current Terraflow version"},
+		{Name: "console", Synopsis: "Try Terraform expressions at an interactive command prompt", Run: runConsole, VersionFloor: true, flagSet: func() *flag.FlagSet {
+			fs, _ := newConsoleFlagSet()
+			return fs
+		}},
+		{Name: "history", Synopsis: "Export or import console history", Args: historySubcommands, Run: RunHistoryCommand, flagSet: func() *flag.FlagSet {
+			fs, _ := newHistoryFlagSet()
+			return fs
+		}},
+		{Name: "check", Synopsis: "Report resource attributes terraflow cannot resolve", Run: RunCheckCommand, VersionFloor: true, flagSet: func() *flag.FlagSet {
+			fs, _ := newCheckFlagSet()
+			return fs
+		}},
+		{Name: "eval", Synopsis: "Evaluate the expressions of a file and print their values", Run: RunEvalCommand, VersionFloor: true, flagSet: func() *flag.FlagSet {
+			fs, _ := newEvalFlagSet()
+			return fs
+		}},
+		{Name: "replay", Synopsis: "Re-evaluate the console history and print a transcript", Run: RunReplayCommand, VersionFloor: true, flagSet: func() *flag.FlagSet {
+			fs, _ := newReplayFlagSet()
+			return fs
+		}},
+		{Name: "config", Synopsis: "Print the effective settings of the console", Run: RunConfigCommand, flagSet: func() *flag.FlagSet {
+			fs, _, _ := newConfigFlagSet()
+			return fs
+		}},
+		{Name: "completion", Synopsis: "Print a shell completion script for bash, zsh or fish", Args: completionShells, Run: RunCompletionCommand},
+	}
+}
+
+// runConsole warns below the recommended Terraform version, which console
+// alone depends on, and runs the console.
+func runConsole(args []string) error {
+	terraform.CheckVersionWarn()
+	RunConsoleCommand(args)
+	return nil
+}
+
+// isBoolFlag reports whether f takes no value, like the flag package decides.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
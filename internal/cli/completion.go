@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// completionShells are the shells `terraflow completion` writes scripts for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// RunCompletionCommand implements `terraflow completion bash|zsh|fish`: it
+// prints a script completing terraflow's subcommands and flags in that shell,
+// to be sourced from the shell's startup file.
+func RunCompletionCommand(args []string) error {
+	if len(args) != 1 {
+		fmt.Print(`Usage: terraflow completion <bash|zsh|fish>
+
+  Prints a script completing terraflow's subcommands and flags. Load it in
+  the current shell, or add the same line to the shell's startup file:
+
+    bash  source <(terraflow completion bash)
+    zsh   source <(terraflow completion zsh)
+    fish  terraflow completion fish | source
+`)
+		if len(args) == 0 {
+			return errors.New("missing shell name")
+		}
+		return errors.New("expected exactly one shell name")
+	}
+	return writeCompletionScript(os.Stdout, args[0], Commands())
+}
+
+// writeCompletionScript writes the completion script of shell for cmds to w.
+func writeCompletionScript(w io.Writer, shell string, cmds []Command) error {
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion(cmds)
+	case "zsh":
+		script = zshCompletion(cmds)
+	case "fish":
+		script = fishCompletion(cmds)
+	default:
+		return fmt.Errorf("unsupported shell %q; use one of %s", shell, strings.Join(completionShells, ", "))
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// commandWords returns the names of cmds and, per command, its flags with the
+// leading dash.
+func commandWords(cmds []Command) (names []string, flags map[string][]string) {
+	flags = map[string][]string{}
+	for _, c := range cmds {
+		names = append(names, c.Name)
+		for _, f := range c.Flags() {
+			flags[c.Name] = append(flags[c.Name], "-"+f.Name)
+		}
+	}
+	return names, flags
+}
+
+// bashCompletion completes subcommands first, then a command's flags when the
+// word starts with a dash and its fixed arguments as the second word. Anything
+// else falls back to file names.
+func bashCompletion(cmds []Command) string {
+	names, flags := commandWords(cmds)
+	var b strings.Builder
+	b.WriteString(`# bash completion for terraflow
+# Load with: source <(terraflow completion bash)
+_terraflow() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "` + strings.Join(names, " ") + `" -- "$cur"))
+        return
+    fi
+    local words=""
+    case ${COMP_WORDS[1]} in
+`)
+	for _, c := range cmds {
+		if len(flags[c.Name]) == 0 && len(c.Args) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "    %s)\n", c.Name)
+		b.WriteString("        if [[ $cur == -* ]]; then\n")
+		fmt.Fprintf(&b, "            words=%q\n", strings.Join(flags[c.Name], " "))
+		if len(c.Args) > 0 {
+			b.WriteString("        elif [[ $COMP_CWORD -eq 2 ]]; then\n")
+			fmt.Fprintf(&b, "            words=%q\n", strings.Join(c.Args, " "))
+		}
+		b.WriteString("        fi\n        ;;\n")
+	}
+	b.WriteString(`    esac
+    COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}
+complete -o default -F _terraflow terraflow
+`)
+	return b.String()
+}
+
+// zshCompletion completes like bashCompletion, with each subcommand described
+// by its synopsis.
+func zshCompletion(cmds []Command) string {
+	_, flags := commandWords(cmds)
+	var b strings.Builder
+	b.WriteString(`#compdef terraflow
+# zsh completion for terraflow; needs compinit
+# Load with: source <(terraflow completion zsh)
+_terraflow() {
+  if (( CURRENT == 2 )); then
+    local -a commands
+    commands=(
+`)
+	for _, c := range cmds {
+		fmt.Fprintf(&b, "      %s\n", shellQuote(c.Name+":"+strings.ReplaceAll(c.Synopsis, ":", `\:`)))
+	}
+	b.WriteString(`    )
+    _describe 'command' commands
+    return
+  fi
+  case ${words[2]} in
+`)
+	for _, c := range cmds {
+		if len(flags[c.Name]) == 0 && len(c.Args) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s)\n", c.Name)
+		if len(flags[c.Name]) > 0 {
+			fmt.Fprintf(&b, "    if [[ $PREFIX == -* ]]; then compadd -- %s; return; fi\n", strings.Join(flags[c.Name], " "))
+		}
+		if len(c.Args) > 0 {
+			fmt.Fprintf(&b, "    if (( CURRENT == 3 )); then compadd -- %s; return; fi\n", strings.Join(c.Args, " "))
+		}
+		b.WriteString("    ;;\n")
+	}
+	b.WriteString(`  esac
+  _files
+}
+compdef _terraflow terraflow
+`)
+	return b.String()
+}
+
+// fishCompletion declares subcommands, fixed arguments and flags with their
+// descriptions; flags taking a value complete file names.
+func fishCompletion(cmds []Command) string {
+	var b strings.Builder
+	b.WriteString(`# fish completion for terraflow
+# Load with: terraflow completion fish | source
+`)
+	for _, c := range cmds {
+		fmt.Fprintf(&b, "complete -c terraflow -n __fish_use_subcommand -f -a %s -d %s\n", c.Name, shellQuote(c.Synopsis))
+	}
+	for _, c := range cmds {
+		cond := shellQuote("__fish_seen_subcommand_from " + c.Name)
+		if len(c.Args) > 0 {
+			fmt.Fprintf(&b, "complete -c terraflow -n %s -a %s\n", cond, shellQuote(strings.Join(c.Args, " ")))
+		}
+		for _, f := range c.Flags() {
+			value := ""
+			if !isBoolFlag(f) {
+				value = " -r -F"
+			}
+			fmt.Fprintf(&b, "complete -c terraflow -n %s -o %s%s -d %s\n", cond, f.Name, value, shellQuote(f.Usage))
+		}
+	}
+	return b.String()
+}
+
+// shellQuote quotes s in single quotes for bash, zsh and fish.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteCompletionScript_ContainsCommandsAndFlags(t *testing.T) {
+	for _, shell := range completionShells {
+		var b strings.Builder
+		if err := writeCompletionScript(&b, shell, Commands()); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		script := b.String()
+		for _, want := range []string{"console", "history", "check", "version", "completion", "export", "import", "var-file", "strict", "merge-state", "global"} {
+			if !strings.Contains(script, want) {
+				t.Errorf("%s script lacks %q", shell, want)
+			}
+		}
+	}
+	if err := writeCompletionScript(&strings.Builder{}, "powershell", Commands()); err == nil {
+		t.Fatal("expected an error for an unsupported shell")
+	}
+}
+
+func TestWriteCompletionScript_ParsesInShell(t *testing.T) {
+	for _, shell := range completionShells {
+		bin, err := exec.LookPath(shell)
+		if err != nil {
+			continue
+		}
+		var b strings.Builder
+		if err := writeCompletionScript(&b, shell, Commands()); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "terraflow."+shell)
+		if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command(bin, "-n", path).CombinedOutput(); err != nil {
+			t.Errorf("%s -n: %v\n%s", shell, err, out)
+		}
+	}
+}
+
+func TestCommands_FlagsMatchParsers(t *testing.T) {
+	flags := map[string][]string{}
+	for _, c := range Commands() {
+		for _, f := range c.Flags() {
+			flags[c.Name] = append(flags[c.Name], f.Name)
+		}
+	}
+	if got := strings.Join(flags["check"], " "); got != "strict var-file" {
+		t.Fatalf("check flags = %q", got)
+	}
+	if got := strings.Join(flags["history"], " "); got != "global" {
+		t.Fatalf("history flags = %q", got)
+	}
+	if len(flags["console"]) < 10 || len(flags["version"]) != 0 {
+		t.Fatalf("unexpected flags %v", flags)
+	}
+}
@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/flowave-io/terraflow/internal/monitor"
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+// effectiveConfig is what a console started with the same options would use.
+type effectiveConfig struct {
+	Terraform         string   `json:"terraform"`
+	ProjectDir        string   `json:"project_dir"`
+	ScratchDir        string   `json:"scratch_dir"`
+	DataDir           string   `json:"data_dir"`
+	ConfigFile        string   `json:"config_file,omitempty"`
+	Profiles          []string `json:"profiles"`
+	Workspace         string   `json:"workspace"`
+	VarFiles          []string `json:"var_files"`
+	BackendConfigs    []string `json:"backend_configs"`
+	Engine            string   `json:"engine"`
+	EvalTimeout       string   `json:"eval_timeout"`
+	IdleTimeout       string   `json:"idle_timeout"`
+	Parallelism       int      `json:"parallelism"`
+	MaxTerraformProcs int      `json:"max_terraform_procs"`
+	Debounce          string   `json:"debounce"`
+	PluginCache       string   `json:"plugin_cache"`
+	MaxModuleDepth    int      `json:"max_module_depth"`
+	Focus             []string `json:"focus"`
+	PullRemoteState   bool     `json:"pull_remote_state"`
+	TerragruntInputs  bool     `json:"terragrunt_inputs"`
+	KeepWarm          bool     `json:"keep_warm"`
+	ReproducibleState bool     `json:"reproducible_state"`
+	RegistryFetch     bool     `json:"registry_fetch"`
+	GlobalHistory     bool     `json:"global_history"`
+	Quiet             bool     `json:"quiet"`
+	Debug             bool     `json:"debug"`
+}
+
+// newConfigFlagSet defines the flags and usage of the config command: the
+// options of the console, whose effect it shows, and -json.
+func newConfigFlagSet() (*flag.FlagSet, *consoleOptions, *bool) {
+	fs, opts := newConsoleFlagSet()
+	fs.Init("config", flag.ContinueOnError)
+	fs.Usage = func() {
+		if _, err := fmt.Fprint(fs.Output(), `Usage: terraflow [global options] config [options] [console options]
+
+  Prints the settings a console started with the same options would use,
+  after applying flags, environment variables and .terraflow.hcl. Nothing is
+  started or written.
+
+Options:
+
+  -json                 Print the settings as a JSON object.
+
+  Any option of terraflow console is accepted; see terraflow console -help.
+`); err != nil {
+			fmt.Fprintln(os.Stderr, "error printing usage:", err)
+		}
+	}
+	asJSON := fs.Bool("json", false, "Print the settings as JSON")
+	return fs, opts, asJSON
+}
+
+// RunConfigCommand implements `terraflow config`.
+func RunConfigCommand(args []string) error {
+	fs, opts, asJSON := newConfigFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cwd, _ := os.Getwd()
+	cfg, err := resolveEffectiveConfig(opts, cwd)
+	if err != nil {
+		return err
+	}
+	return writeEffectiveConfig(os.Stdout, cfg, *asJSON)
+}
+
+// resolveEffectiveConfig applies opts the way RunConsoleCommand does, for a
+// console started in cwd, and reads back the resulting settings.
+func resolveEffectiveConfig(opts *consoleOptions, cwd string) (effectiveConfig, error) {
+	engine, err := terraform.ParseEngine(*opts.engine)
+	if err != nil {
+		return effectiveConfig{}, err
+	}
+	if _, err := terraform.ParseFocus([]string(opts.focusAddrs)); err != nil {
+		return effectiveConfig{}, err
+	}
+	terraform.SetParallelism(*opts.parallelism)
+	terraform.SetEvaluatorIdleTimeout(*opts.idleTimeout)
+
+	projectDir := cwd
+	if *opts.chdir != "" {
+		projectDir = *opts.chdir
+		if !filepath.IsAbs(projectDir) {
+			projectDir = filepath.Join(cwd, projectDir)
+		}
+	}
+	scratchDir := filepath.Join(projectDir, ".terraflow")
+	cfg := effectiveConfig{
+		Terraform:         "terraform (not found on PATH)",
+		ProjectDir:        projectDir,
+		ScratchDir:        scratchDir,
+		DataDir:           terraform.DataDir(projectDir),
+		Profiles:          []string{},
+		Workspace:         currentWorkspace(projectDir),
+		VarFiles:          append(autoVarFiles(projectDir), normalizeVarFiles(scratchDir, []string(opts.varFiles))...),
+		BackendConfigs:    append([]string{}, opts.backendConfigs...),
+		Engine:            string(engine),
+		EvalTimeout:       defaultEvalTimeout.String(),
+		IdleTimeout:       terraform.EvaluatorIdleTimeout().String(),
+		Parallelism:       terraform.Parallelism(),
+		MaxTerraformProcs: terraform.MaxTerraformProcs(),
+		Debounce:          monitor.Debounce.String(),
+		PluginCache:       terraform.PluginCacheDir(),
+		MaxModuleDepth:    *opts.maxModuleDepth,
+		Focus:             append([]string{}, opts.focusAddrs...),
+		PullRemoteState:   *opts.pullRemoteState,
+		TerragruntInputs:  *opts.terragruntInputs,
+		KeepWarm:          *opts.keepWarm,
+		ReproducibleState: *opts.reproducible,
+		RegistryFetch:     !noRegistryFetchRequested(*opts.noRegistryFetch),
+		GlobalHistory:     *opts.globalHistory,
+		Quiet:             quietRequested(*opts.quiet),
+		Debug:             *opts.debug,
+	}
+	if p, err := exec.LookPath("terraform"); err == nil {
+		cfg.Terraform = p
+	}
+	if cfg.VarFiles == nil {
+		cfg.VarFiles = []string{}
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, configFileName)); err == nil {
+		cfg.ConfigFile = filepath.Join(projectDir, configFileName)
+		profiles, err := loadProfiles(projectDir)
+		if err != nil {
+			return effectiveConfig{}, err
+		}
+		for name := range profiles {
+			cfg.Profiles = append(cfg.Profiles, name)
+		}
+		sort.Strings(cfg.Profiles)
+	}
+	return cfg, nil
+}
+
+// currentWorkspace returns the Terraform workspace selected for dir:
+// TF_WORKSPACE, else the one recorded by terraform workspace select in its
+// data directory, else "default".
+func currentWorkspace(dir string) string {
+	if ws := strings.TrimSpace(os.Getenv("TF_WORKSPACE")); ws != "" {
+		return ws
+	}
+	if b, err := os.ReadFile(filepath.Join(terraform.DataDir(dir), "environment")); err == nil {
+		if ws := strings.TrimSpace(string(b)); ws != "" {
+			return ws
+		}
+	}
+	return "default"
+}
+
+// autoVarFiles returns the var-files Terraform loads from dir without being
+// asked, in the order it loads them.
+func autoVarFiles(dir string) []string {
+	var out []string
+	for _, name := range []string{"terraform.tfvars", "terraform.tfvars.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			out = append(out, filepath.Join(dir, name))
+		}
+	}
+	var auto []string
+	for _, pattern := range []string{"*.auto.tfvars", "*.auto.tfvars.json"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		auto = append(auto, matches...)
+	}
+	sort.Strings(auto)
+	return append(out, auto...)
+}
+
+// writeEffectiveConfig prints cfg as aligned key/value lines, or as a JSON
+// object with asJSON.
+func writeEffectiveConfig(w io.Writer, cfg effectiveConfig, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cfg)
+	}
+	list := func(vs []string) string {
+		if len(vs) == 0 {
+			return "-"
+		}
+		return strings.Join(vs, ", ")
+	}
+	orNone := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	rows := [][2]string{
+		{"terraform", cfg.Terraform},
+		{"project dir", cfg.ProjectDir},
+		{"scratch dir", cfg.ScratchDir},
+		{"data dir", cfg.DataDir},
+		{"config file", orNone(cfg.ConfigFile)},
+		{"profiles", list(cfg.Profiles)},
+		{"workspace", cfg.Workspace},
+		{"var files", list(cfg.VarFiles)},
+		{"backend config", list(cfg.BackendConfigs)},
+		{"engine", cfg.Engine},
+		{"eval timeout", cfg.EvalTimeout},
+		{"idle timeout", cfg.IdleTimeout},
+		{"parallelism", fmt.Sprint(cfg.Parallelism)},
+		{"max terraform procs", fmt.Sprint(cfg.MaxTerraformProcs)},
+		{"debounce", cfg.Debounce},
+		{"plugin cache", orNone(cfg.PluginCache)},
+		{"max module depth", fmt.Sprint(cfg.MaxModuleDepth)},
+		{"focus", list(cfg.Focus)},
+		{"pull remote state", fmt.Sprint(cfg.PullRemoteState)},
+		{"terragrunt inputs", fmt.Sprint(cfg.TerragruntInputs)},
+		{"keep warm", fmt.Sprint(cfg.KeepWarm)},
+		{"reproducible state", fmt.Sprint(cfg.ReproducibleState)},
+		{"registry fetch", fmt.Sprint(cfg.RegistryFetch)},
+		{"global history", fmt.Sprint(cfg.GlobalHistory)},
+		{"quiet", fmt.Sprint(cfg.Quiet)},
+		{"debug", fmt.Sprint(cfg.Debug)},
+	}
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\n", r[0], r[1])
+	}
+	return tw.Flush()
+}
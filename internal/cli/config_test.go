@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+func TestResolveEffectiveConfig_FlagOverridesShowUp(t *testing.T) {
+	t.Setenv("TERRAFLOW_PARALLELISM", "2")
+	t.Setenv("TF_WORKSPACE", "")
+	defer terraform.SetParallelism(0)
+	defer terraform.SetEvaluatorIdleTimeout(terraform.DefaultEvaluatorIdleTimeout)
+	dir := t.TempDir()
+	for _, name := range []string{"main.tf", "terraform.tfvars", "b.auto.tfvars", "a.auto.tfvars"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, opts, asJSON := newConfigFlagSet()
+	if err := fs.Parse([]string{"-parallelism=7", "-engine=inprocess", "-idle-timeout=1m", "-var-file=/abs/prod.tfvars", "-json"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := resolveEffectiveConfig(opts, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Parallelism != 7 {
+		t.Fatalf("parallelism = %d, want the flag's 7 over TERRAFLOW_PARALLELISM", cfg.Parallelism)
+	}
+	if cfg.Engine != "inprocess" || cfg.IdleTimeout != "1m0s" || cfg.Workspace != "default" {
+		t.Fatalf("engine = %q, idle timeout = %q, workspace = %q", cfg.Engine, cfg.IdleTimeout, cfg.Workspace)
+	}
+	wantVarFiles := []string{
+		filepath.Join(dir, "terraform.tfvars"),
+		filepath.Join(dir, "a.auto.tfvars"),
+		filepath.Join(dir, "b.auto.tfvars"),
+		"/abs/prod.tfvars",
+	}
+	if strings.Join(cfg.VarFiles, ",") != strings.Join(wantVarFiles, ",") {
+		t.Fatalf("var files = %v, want %v", cfg.VarFiles, wantVarFiles)
+	}
+
+	var buf bytes.Buffer
+	if err := writeEffectiveConfig(&buf, cfg, *asJSON); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if decoded["parallelism"] != float64(7) || decoded["engine"] != "inprocess" {
+		t.Fatalf("JSON = %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeEffectiveConfig(&buf, cfg, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "parallelism          7\n") {
+		t.Fatalf("text output:\n%s", buf.String())
+	}
+}
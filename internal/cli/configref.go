@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"io"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+// configRefEvaluator expands references into the config namespace
+// (config.aws_instance.web.tags) into the configured values before
+// evaluating, see terraform.ExpandConfigReferences.
+type configRefEvaluator struct {
+	ev      lineEvaluator
+	rootDir string
+}
+
+// Evaluate implements lineEvaluator. A reference to a resource the
+// configuration does not declare is reported on stderr like a Terraform error.
+func (c *configRefEvaluator) Evaluate(line string, timeout time.Duration) (string, string, error) {
+	expanded, err := terraform.ExpandConfigReferences(c.rootDir, line)
+	if err != nil {
+		return "", "Error: " + err.Error() + "\n", nil
+	}
+	return c.ev.Evaluate(expanded, timeout)
+}
+
+// EvaluateStream implements streamEvaluator.
+func (c *configRefEvaluator) EvaluateStream(line string, timeout time.Duration, w io.Writer) (string, string, error) {
+	expanded, err := terraform.ExpandConfigReferences(c.rootDir, line)
+	if err != nil {
+		return "", "Error: " + err.Error() + "\n", nil
+	}
+	return evaluateStream(c.ev, expanded, timeout, w)
+}
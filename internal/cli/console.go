@@ -3,11 +3,13 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/flowave-io/terraflow/internal/monitor"
 	"github.com/flowave-io/terraflow/internal/terraform"
@@ -28,7 +30,33 @@ func (m *multiStringFlag) Set(v string) error {
 	return nil
 }
 
-func RunConsoleCommand(args []string) {
+// consoleOptions holds the flags of the console command.
+type consoleOptions struct {
+	varFiles         multiStringFlag
+	backendConfigs   multiStringFlag
+	focusAddrs       multiStringFlag
+	mergeStateSpecs  multiStringFlag
+	mockFiles        multiStringFlag
+	execs            multiStringFlag
+	pullRemoteState  *bool
+	globalHistory    *bool
+	maxModuleDepth   *int
+	parallelism      *int
+	engine           *string
+	idleTimeout      *time.Duration
+	quiet            *bool
+	debug            *bool
+	refreshFunctions *bool
+	terragruntInputs *bool
+	keepWarm         *bool
+	reproducible     *bool
+	noRegistryFetch  *bool
+	chdir            *string
+}
+
+// newConsoleFlagSet defines the flags and usage of the console command.
+func newConsoleFlagSet() (*flag.FlagSet, *consoleOptions) {
+	opts := &consoleOptions{}
 	fs := flag.NewFlagSet("console", flag.ContinueOnError)
 	fs.SetOutput(os.Stdout)
 	fs.Usage = func() {
@@ -51,7 +79,82 @@ Options:
                         times. The backend type must be in the configuration
                         itself.
 
-  -pull-remote-state    Pull the state from its location.
+  -chdir=dir            Switch to a different working directory before
+                        starting the console.
+
+  -debug                Write debug logs and a timestamped transcript of
+                        every evaluated expression and its result to
+                        .terraflow/terraflow.log.
+
+  -engine=name          Evaluate only with this engine: inprocess,
+                        persistent (the long-running terraform console) or
+                        subprocess (a terraform console per expression).
+                        The default, auto, tries them in that order.
+                        Results are then printed as JSON.
+
+  -exec=expression      Evaluate an expression or run a :command once the
+                        console has started, printing its result before
+                        the first prompt. Can be specified multiple times;
+                        they run in order.
+
+  -focus=address        Only synthesize state for the given resource
+                        (aws_instance.web) or module (module.db). Can be
+                        specified multiple times.
+
+  -global-history       Share console history across projects through a
+                        file in the home directory.
+
+  -idle-timeout=time    Close the long-running terraform console of a
+                        workspace after it has been unused this long
+                        (default 5m); 0 keeps it for the whole session.
+
+  -keep-warm            Reuse the scratch workspace from a previous run
+                        without re-initializing it when neither the
+                        configuration nor .terraform changed since then.
+
+  -max-module-depth=n   Stop following nested module calls below this depth
+                        (default 32), with a warning.
+
+  -merge-state=path     Union the resources of another state file into the
+                        console state so references across components
+                        resolve. Prefix with a module address
+                        (module.net=path) to nest them under that module.
+                        Can be specified multiple times; later files win
+                        for duplicate addresses.
+
+  -mock=path            Write stub values for attributes only known after
+                        apply into the console state, from mock blocks
+                        such as mock "aws_instance.web" { id = "i-123" }.
+                        Can be specified multiple times.
+
+  -no-registry-fetch    Do not download registry modules to complete their
+                        outputs before terraform init. Also enabled by
+                        TERRAFLOW_NO_REGISTRY_FETCH.
+
+  -parallelism=n        Scan this many modules or files at once (default 3,
+                        at most the number of CPUs). Also read from
+                        TERRAFLOW_PARALLELISM.
+
+  -pull-remote-state    Pull the state from its location. Only the backend
+                        is initialized for this, without downloading
+                        providers or modules.
+
+  -quiet                Suppress informational and warning logs; errors are
+                        still printed. Also enabled by TERRAFLOW_QUIET.
+
+  -refresh-functions    Refetch the list of Terraform functions used for
+                        completion in the background; it is applied on the
+                        next start. The list is also refreshed every 30 days
+                        and when the Terraform version changes.
+
+  -reproducible-state   Derive the state lineage from the project directory
+                        and keep its serial, so the same configuration
+                        always synthesizes byte-identical state.
+
+  -terragrunt-inputs    Apply the inputs of terragrunt.hcl like a -var-file,
+                        before any other -var-file. Best-effort: inputs
+                        using Terragrunt functions or dependencies are
+                        skipped.
 
   -var-file=path        Set variables in the Terraform configuration from
                         a file. If "terraform.tfvars" or any ".auto.tfvars"
@@ -61,80 +164,237 @@ Options:
 		}
 	}
 	// Support multiple -var-file flags similar to Terraform
-	var varFiles multiStringFlag
-	fs.Var(&varFiles, "var-file", "Path to a .tfvars file (repeatable). Passed through to terraform console.")
+	fs.Var(&opts.varFiles, "var-file", "Path to a .tfvars file (repeatable). Passed through to terraform console.")
 	// Support partial backend configuration like Terraform's -backend-config (repeatable)
-	var backendConfigs multiStringFlag
-	fs.Var(&backendConfigs, "backend-config", "Partial backend config (KEY=VALUE or file). Repeatable. Triggers terraform init.")
-	pullRemoteState := fs.Bool("pull-remote-state", false, "Pull remote state")
+	fs.Var(&opts.backendConfigs, "backend-config", "Partial backend config (KEY=VALUE or file). Repeatable. Triggers terraform init.")
+	opts.pullRemoteState = fs.Bool("pull-remote-state", false, "Pull remote state")
+	opts.globalHistory = fs.Bool("global-history", false, "Share console history across projects")
+	opts.maxModuleDepth = fs.Int("max-module-depth", terraform.DefaultMaxModuleDepth, "Maximum depth of nested module calls to follow")
+	opts.engine = fs.String("engine", string(terraform.EngineAuto), "Evaluation engine: auto, inprocess, persistent or subprocess")
+	opts.idleTimeout = fs.Duration("idle-timeout", terraform.DefaultEvaluatorIdleTimeout, "Close persistent terraform consoles unused this long (0 to keep them)")
+	opts.parallelism = fs.Int("parallelism", 0, "Number of modules or files scanned at once (0 for the default)")
+	opts.quiet = fs.Bool("quiet", false, "Suppress informational and warning logs")
+	opts.debug = fs.Bool("debug", false, "Write debug logs and an evaluation transcript to .terraflow/terraflow.log")
+	opts.refreshFunctions = fs.Bool("refresh-functions", false, "Refetch the cached list of Terraform functions")
+	opts.terragruntInputs = fs.Bool("terragrunt-inputs", false, "Use the inputs of terragrunt.hcl as variables")
+	opts.keepWarm = fs.Bool("keep-warm", false, "Reuse an up-to-date scratch workspace without re-initializing it")
+	opts.reproducible = fs.Bool("reproducible-state", false, "Synthesize byte-identical state for the same configuration")
+	opts.noRegistryFetch = fs.Bool("no-registry-fetch", false, "Do not download registry modules for completion")
+	opts.chdir = fs.String("chdir", "", "Switch to a different working directory before starting")
+	// Restrict scanning/patching to a subtree of the configuration (repeatable)
+	fs.Var(&opts.focusAddrs, "focus", "Resource or module address to synthesize state for (repeatable).")
+	// Additional state files to union into the synthesized state (repeatable)
+	fs.Var(&opts.mergeStateSpecs, "merge-state", "State file to merge into the console state, optionally module.name=path (repeatable).")
+	// Stub values for computed attributes (repeatable)
+	fs.Var(&opts.mockFiles, "mock", "File of mock blocks with stub attribute values (repeatable).")
+	// Commands submitted before the first prompt (repeatable)
+	fs.Var(&opts.execs, "exec", "Expression or :command to run on startup (repeatable).")
+	return fs, opts
+}
+
+// RunConsoleCommand implements `terraflow console`.
+func RunConsoleCommand(args []string) {
+	fs, opts := newConsoleFlagSet()
 	if err := fs.Parse(args); err != nil {
 		if err == flag.ErrHelp {
 			os.Exit(0)
 		}
 		os.Exit(2)
 	}
+	focus, err := terraform.ParseFocus([]string(opts.focusAddrs))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logger := consoleLogger(quietRequested(*opts.quiet), os.Stderr)
+	terraform.SetLogger(logger)
+	terraform.SetFocus(focus)
+	terraform.SetMaxModuleDepth(*opts.maxModuleDepth)
+	terraform.SetParallelism(*opts.parallelism)
+	engine, err := terraform.ParseEngine(*opts.engine)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	terraform.SetEngine(engine)
+	terraform.SetEvaluatorIdleTimeout(*opts.idleTimeout)
+	terraform.SetReproducibleState(*opts.reproducible)
+	terraform.SetRegistryFetch(!noRegistryFetchRequested(*opts.noRegistryFetch))
+	mergeStates, err := terraform.ParseMergeState([]string(opts.mergeStateSpecs))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	log.Println("Starting terraflow console...")
-
+	if *opts.chdir != "" {
+		if err := os.Chdir(*opts.chdir); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
 	cwd, _ := os.Getwd()
+	if err := checkProjectDir(cwd); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	mocks, err := terraform.LoadMocks([]string(opts.mockFiles))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	logger.Println("Starting terraflow console...")
+
 	scratchDir := filepath.Join(cwd, ".terraflow")
 	statePath := filepath.Join(scratchDir, "terraform.tfstate")
 
+	var debugLog *log.Logger
+	if *opts.debug {
+		l, f, err := openDebugLog(scratchDir)
+		if err != nil {
+			logger.Printf("[warn] unable to open debug log: %v\n", err)
+		} else {
+			defer func() { _ = f.Close() }()
+			debugLog = l
+			terraform.SetDebugLog(l)
+			terraform.EnableStateProvenance()
+			logger.Printf("Writing debug log to %s\n", f.Name())
+		}
+	}
+
 	// If any -backend-config is specified, run a full terraform init in the project directory first
-	if len(backendConfigs) > 0 && !*pullRemoteState {
-		if err := terraform.InitWithBackendConfig(cwd, []string(backendConfigs)); err != nil {
-			log.Fatalf("terraform init with backend-config failed: %v", err)
+	if len(opts.backendConfigs) > 0 && !*opts.pullRemoteState {
+		if err := terraform.InitWithBackendConfig(cwd, []string(opts.backendConfigs)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: terraform init with backend-config failed:", err)
+			os.Exit(1)
 		}
 	}
 
 	// Optional: pull remote state into the scratch state file BEFORE init
-	if *pullRemoteState {
-		if err := pullRemoteStateOnce(cwd, statePath, []string(backendConfigs)); err != nil {
-			log.Printf("[warn] unable to pull remote state: %v\n", err)
+	if *opts.pullRemoteState {
+		if err := pullRemoteStateOnce(logger, cwd, statePath, []string(opts.backendConfigs)); err != nil {
+			logger.Printf("[warn] unable to pull remote state: %v\n", err)
 		}
 	}
 
 	// Prepare scratch workspace
-	if _, _, err := terraform.SyncToScratch(cwd, scratchDir); err != nil {
-		log.Printf("[warn] sync to scratch: %v\n", err)
+	skippedInit, err := terraform.PrepareScratch(cwd, scratchDir, *opts.keepWarm)
+	if err != nil {
+		logger.Printf("[warn] prepare scratch: %v\n", err)
 	}
-	if err := terraform.InitTerraformInDir(scratchDir); err != nil {
-		log.Printf("[warn] terraform init in scratch: %v\n", err)
+	if skippedInit {
+		logger.Println("Scratch workspace is up to date; skipping terraform init.")
 	}
 
-	// Ensure functions cache exists once
-	if err := terraform.EnsureFunctionsCached(scratchDir); err != nil {
-		log.Printf("[warn] unable to cache Terraform functions: %v\n", err)
+	// Ensure functions cache exists; stale caches are refreshed in the background
+	if err := terraform.EnsureFunctionsCached(scratchDir, *opts.refreshFunctions); err != nil {
+		logger.Printf("[warn] unable to cache Terraform functions: %v\n", err)
 	}
 
 	// Normalize var-file paths early (used for startup hydration and session)
-	normVarFiles := normalizeVarFiles(scratchDir, []string(varFiles))
+	normVarFiles := normalizeVarFiles(scratchDir, []string(opts.varFiles))
+	if *opts.terragruntInputs {
+		normVarFiles = withTerragruntInputs(logger, cwd, scratchDir, normVarFiles)
+	}
 
 	// Ensure local state exists and reflect current config into it before starting console
 	if err := terraform.EnsureStateInitialized(statePath); err != nil {
-		log.Printf("[warn] ensure local state: %v\n", err)
+		logger.Printf("[warn] ensure local state: %v\n", err)
 	} else {
 		// Use fast evaluated patch to hydrate non-literals on startup (with normalized var-files)
 		if err := terraform.PatchStateFromConfigEvaluatedFast(scratchDir, scratchDir, statePath, normVarFiles); err != nil {
-			log.Printf("[warn] patch state from config (evaluated): %v\n", err)
+			logger.Printf("[warn] patch state from config (evaluated): %v\n", err)
+		}
+		if err := terraform.MergeStates(statePath, mergeStates); err != nil {
+			logger.Printf("[warn] merge state: %v\n", err)
+		}
+		if err := terraform.ApplyMocks(statePath, mocks); err != nil {
+			logger.Printf("[warn] apply mocks: %v\n", err)
 		}
 	}
 
-	refreshCh := make(chan struct{}, 1)
+	refreshCh := make(chan []string, 1)
 	session := terraform.StartConsoleSession(scratchDir, statePath, normVarFiles)
 	idx, err := terraform.BuildSymbolIndex(cwd)
 	if err != nil {
-		log.Println("[warn] building symbol index:", err)
+		logger.Println("[warn] building symbol index:", err)
 		idx = &terraform.SymbolIndex{}
 	}
-	log.Println("Terraform console started.")
+	// Provider schemas loaded with the index name computed attributes the
+	// startup patch could not know about
+	if err := terraform.SeedComputedAttributes(statePath); err != nil {
+		logger.Printf("[warn] seed computed attributes: %v\n", err)
+	}
+	for _, ln := range strings.Split(idx.Summary(), "\n") {
+		logger.Println(ln)
+	}
+	logger.Println("Terraform console started.")
 	monitor.WatchTerraformFilesNotifying(".", refreshCh)
-	RunREPL(session, idx, refreshCh, scratchDir, normVarFiles)
+	RunREPL(session, idx, refreshCh, scratchDir, normVarFiles, mergeStates, mocks, *opts.globalHistory, debugLog, []string(opts.execs))
+}
+
+// withTerragruntInputs prepends a var-file holding the inputs of terragrunt.hcl
+// so explicit -var-file flags still take precedence.
+func withTerragruntInputs(logger *log.Logger, cwd, scratchDir string, varFiles []string) []string {
+	if _, err := os.Stat(filepath.Join(cwd, terraform.TerragruntConfigFile)); err != nil {
+		logger.Printf("[warn] -terragrunt-inputs: no %s in %s\n", terraform.TerragruntConfigFile, cwd)
+		return varFiles
+	}
+	path, err := terraform.WriteTerragruntVarFile(cwd, scratchDir)
+	if err != nil {
+		logger.Printf("[warn] unable to read terragrunt inputs: %v\n", err)
+		return varFiles
+	}
+	return append([]string{path}, varFiles...)
 }
 
-// pullRemoteStateOnce ensures the project at workDir is initialized and pulls remote state
-// via `terraform state pull`, writing it to statePath. Parent dir is 0700; state file 0600.
-func pullRemoteStateOnce(workDir, statePath string, backendConfigs []string) error {
+// quietRequested reports whether logging should be suppressed, either by the
+// -quiet flag or a non-empty TERRAFLOW_QUIET environment variable.
+func quietRequested(flagSet bool) bool {
+	return flagSet || os.Getenv("TERRAFLOW_QUIET") != ""
+}
+
+// noRegistryFetchRequested reports whether registry modules should not be
+// downloaded for completion, either by the -no-registry-fetch flag or by
+// TERRAFLOW_NO_REGISTRY_FETCH.
+func noRegistryFetchRequested(flagSet bool) bool {
+	return flagSet || os.Getenv("TERRAFLOW_NO_REGISTRY_FETCH") != ""
+}
+
+// consoleLogger returns the logger for startup progress and warnings, writing
+// to w unless quiet. Errors bypass it and always reach stderr.
+func consoleLogger(quiet bool, w io.Writer) *log.Logger {
+	if quiet {
+		w = io.Discard
+	}
+	return log.New(w, "", log.LstdFlags)
+}
+
+// checkProjectDir returns a descriptive error when dir contains no Terraform
+// configuration files, so running in the wrong directory fails clearly instead
+// of surfacing an obscure terraform console error later.
+func checkProjectDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", dir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := strings.ToLower(e.Name())
+		if strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json") {
+			return nil
+		}
+	}
+	return fmt.Errorf("no .tf files found under %s; are you in the right directory? use -chdir to point at a Terraform configuration", dir)
+}
+
+// pullRemoteStateOnce pulls remote state via `terraform state pull`, writing it to
+// statePath. Parent dir is 0700; state file 0600. A backend-only init is tried
+// first so no providers or modules are downloaded; if that fails the project is
+// fully initialized and the state pulled from workDir.
+func pullRemoteStateOnce(logger *log.Logger, workDir, statePath string, backendConfigs []string) error {
 	if workDir == "" {
 		wd, _ := os.Getwd()
 		workDir = wd
@@ -144,16 +404,21 @@ func pullRemoteStateOnce(workDir, statePath string, backendConfigs []string) err
 	if err := os.MkdirAll(dir, 0o700); err != nil {
 		return fmt.Errorf("create state dir: %w", err)
 	}
-	// Initialize the project so backend config is available for state pull
-	if err := terraform.InitWithBackendConfig(workDir, backendConfigs); err != nil {
-		return err
-	}
-	// Pull remote state
-	pullCmd := exec.Command("terraform", "state", "pull", "-no-color")
-	pullCmd.Dir = workDir
-	out, err := pullCmd.Output()
+	out, err := terraform.PullRemoteStateBackendOnly(workDir, backendConfigs)
 	if err != nil {
-		return fmt.Errorf("terraform state pull: %w", err)
+		logger.Printf("[warn] backend-only state pull: %v; falling back to a full init\n", err)
+		// Initialize the project so backend config is available for state pull
+		if err := terraform.InitWithBackendConfig(workDir, backendConfigs); err != nil {
+			return err
+		}
+		pullCmd := exec.Command("terraform", "state", "pull", "-no-color")
+		pullCmd.Dir = workDir
+		done := terraform.TraceCommand(pullCmd)
+		out, err = pullCmd.Output()
+		done(err)
+		if err != nil {
+			return fmt.Errorf("terraform state pull: %w", err)
+		}
 	}
 	tmp := statePath + ".tmp"
 	if err := os.WriteFile(tmp, out, 0o600); err != nil {
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+func TestCheckProjectDir_EmptyDir(t *testing.T) {
+	dir := t.TempDir()
+	// Nested configuration does not make the directory itself a root module
+	if err := os.MkdirAll(filepath.Join(dir, "modules", "x"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "modules", "x", "main.tf"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err := checkProjectDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "no .tf files found under "+dir) {
+		t.Fatalf("expected helpful error for empty project, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main.tf.json"), []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkProjectDir(dir); err != nil {
+		t.Fatalf("unexpected error with main.tf.json present: %v", err)
+	}
+}
+
+func TestConsoleLogger_QuietSuppressesInfo(t *testing.T) {
+	// No terraform on PATH: the pull logs a warning, then fails with an error
+	t.Setenv("PATH", t.TempDir())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(dir, ".terraflow", "terraform.tfstate")
+	defer terraform.SetLogger(log.Default())
+
+	for _, quiet := range []bool{false, true} {
+		var buf bytes.Buffer
+		logger := consoleLogger(quiet, &buf)
+		terraform.SetLogger(logger)
+		logger.Println("Starting terraflow console...")
+		if err := pullRemoteStateOnce(logger, dir, statePath, nil); err == nil {
+			t.Fatalf("quiet=%v: expected the pull to fail", quiet)
+		}
+		if quiet && buf.Len() != 0 {
+			t.Fatalf("quiet mode logged %q", buf.String())
+		}
+		if !quiet && !strings.Contains(buf.String(), "[warn] backend-only state pull") {
+			t.Fatalf("expected info and warn logs, got %q", buf.String())
+		}
+	}
+}
+
+func TestQuietRequested_Env(t *testing.T) {
+	t.Setenv("TERRAFLOW_QUIET", "")
+	if quietRequested(false) || !quietRequested(true) {
+		t.Fatal("flag should decide when TERRAFLOW_QUIET is unset")
+	}
+	t.Setenv("TERRAFLOW_QUIET", "1")
+	if !quietRequested(false) {
+		t.Fatal("TERRAFLOW_QUIET should enable quiet mode")
+	}
+}
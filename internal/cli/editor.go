@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// errNoEditor is returned when neither VISUAL nor EDITOR is set.
+var errNoEditor = errors.New("set $VISUAL or $EDITOR to edit the expression in an editor")
+
+// editorCommand returns the command line of the user's editor, preferring
+// VISUAL over EDITOR like bash does, or "" when neither is set.
+func editorCommand() string {
+	if v := strings.TrimSpace(os.Getenv("VISUAL")); v != "" {
+		return v
+	}
+	return strings.TrimSpace(os.Getenv("EDITOR"))
+}
+
+// editBuffer opens text in editor on a temporary .tf file and returns the saved
+// contents without the trailing newline editors add. editor is split on spaces,
+// so arguments such as "code --wait" work. The terminal must be in its normal
+// mode while the editor runs. When the editor fails, text is returned unchanged
+// with the error.
+func editBuffer(editor, text string) (string, error) {
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		return text, errNoEditor
+	}
+	f, err := os.CreateTemp("", "terraflow-*.tf")
+	if err != nil {
+		return text, fmt.Errorf("create temp file: %w", err)
+	}
+	path := f.Name()
+	defer func() { _ = os.Remove(path) }()
+	if _, err := f.WriteString(text + "\n"); err != nil {
+		_ = f.Close()
+		return text, fmt.Errorf("write temp file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return text, fmt.Errorf("write temp file: %w", err)
+	}
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return text, fmt.Errorf("editor %s: %w", args[0], err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return text, fmt.Errorf("read edited expression: %w", err)
+	}
+	s := strings.ReplaceAll(string(b), "\r\n", "\n")
+	return strings.TrimRight(s, "\n"), nil
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeEditor writes a shell script standing in for an editor and returns its
+// path.
+func fakeEditor(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake editor is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "editor")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEditBuffer_RoundTrip(t *testing.T) {
+	// Wraps the buffer in upper() across lines, as an editor save would
+	editor := fakeEditor(t, "printf 'upper(\\n  %s\\n)\\n' \"$(cat \"$1\")\" > \"$1\"\n")
+	got, err := editBuffer(editor, "var.name")
+	if err != nil {
+		t.Fatalf("editBuffer: %v", err)
+	}
+	if want := "upper(\n  var.name\n)"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestEditBuffer_EditorArguments(t *testing.T) {
+	editor := fakeEditor(t, "[ \"$1\" = --wait ] || exit 1\nprintf 'local.x' > \"$2\"\n")
+	got, err := editBuffer(editor+" --wait", "")
+	if err != nil || got != "local.x" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+func TestEditBuffer_EditorFailureKeepsBuffer(t *testing.T) {
+	editor := fakeEditor(t, "printf 'garbage' > \"$1\"\nexit 3\n")
+	got, err := editBuffer(editor, "var.name")
+	if err == nil {
+		t.Fatal("expected an error from a failing editor")
+	}
+	if got != "var.name" {
+		t.Fatalf("buffer changed to %q", got)
+	}
+	if _, err := editBuffer("", "var.name"); err != errNoEditor {
+		t.Fatalf("empty editor: got %v", err)
+	}
+}
+
+func TestEditorCommand_PrefersVisual(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "vi")
+	if got := editorCommand(); got != "vi" {
+		t.Fatalf("got %q, want vi", got)
+	}
+	t.Setenv("VISUAL", "code --wait")
+	if got := editorCommand(); got != "code --wait" {
+		t.Fatalf("got %q, want VISUAL", got)
+	}
+}
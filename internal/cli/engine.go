@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+// engineEvaluator sends lines to terraform console unless an engine is forced
+// with -engine or :engine. Then they go through terraform.EvalJSON, which
+// keeps to that engine, and results are printed as JSON like :reveal does,
+// so they read the same whichever engine produced them. With the persistent
+// engine, lines go back to terraform console once it keeps failing.
+type engineEvaluator struct {
+	ev         lineEvaluator
+	meta       *metaContext       // for the current state, var-files and output mode
+	persistent *fallbackEvaluator // created on the first line for the persistent engine
+}
+
+// Evaluate implements lineEvaluator.
+func (e *engineEvaluator) Evaluate(line string, timeout time.Duration) (string, string, error) {
+	return e.EvaluateStream(line, timeout, io.Discard)
+}
+
+// EvaluateStream implements streamEvaluator.
+func (e *engineEvaluator) EvaluateStream(line string, timeout time.Duration, w io.Writer) (string, string, error) {
+	switch terraform.CurrentEngine() {
+	case terraform.EngineAuto:
+		return evaluateStream(e.ev, line, timeout, w)
+	case terraform.EnginePersistent:
+		if e.persistent == nil {
+			e.persistent = newFallbackEvaluator(&forcedEngineEvaluator{meta: e.meta}, e.ev)
+		}
+		return e.persistent.EvaluateStream(line, timeout, w)
+	}
+	return evaluateStream(&forcedEngineEvaluator{meta: e.meta}, line, timeout, w)
+}
+
+// forcedEngineEvaluator evaluates lines through terraform.EvalJSON and prints
+// the results as JSON. Terraform's diagnostics are returned as stderr; a
+// persistent console that gave no answer is returned as the error, so
+// fallbackEvaluator counts it as a failure.
+type forcedEngineEvaluator struct {
+	meta *metaContext
+}
+
+// Evaluate implements lineEvaluator.
+func (f *forcedEngineEvaluator) Evaluate(line string, timeout time.Duration) (string, string, error) {
+	mc := f.meta
+	v, evalErr := terraform.EvalJSON(mc.scratchDir, mc.statePath, mc.currentVarFiles(), line, timeout)
+	if evalErr != nil {
+		if errors.Is(evalErr, terraform.ErrPersistentNoValue) {
+			return "", "", evalErr
+		}
+		return "", "Error: " + evalErr.Error() + "\n", nil
+	}
+	var b []byte
+	var err error
+	if mc.output.compact {
+		b, err = json.Marshal(terraform.Redacted(v))
+	} else {
+		b, err = json.MarshalIndent(terraform.Redacted(v), "", "  ")
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return string(b) + "\n", "", nil
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+// evalOptions holds the flags of the eval command.
+type evalOptions struct {
+	fromFile *string
+	asJSON   *bool
+	varFiles multiStringFlag
+}
+
+// newEvalFlagSet defines the flags and usage of the eval command.
+func newEvalFlagSet() (*flag.FlagSet, *evalOptions) {
+	opts := &evalOptions{}
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		if _, err := fmt.Fprint(fs.Output(), `Usage: terraflow [global options] eval -from-file=path [options]
+
+  Evaluates each expression of a file the way the console does and prints
+  "expression => value", or the error. Exits with a non-zero status when any
+  expression fails, for checking in CI that expressions still produce the
+  expected values.
+
+Options:
+
+  -from-file=path       File with one expression per line. Empty lines and
+                        lines starting with # or // are skipped.
+
+  -json                 Print the results as a JSON array of objects with
+                        expression, value and error.
+
+  -var-file=path        Set variables in the Terraform configuration from
+                        a file. If "terraform.tfvars" or any ".auto.tfvars"
+                        files are present, they will be automatically loaded.
+`); err != nil {
+			fmt.Fprintln(os.Stderr, "error printing usage:", err)
+		}
+	}
+	opts.fromFile = fs.String("from-file", "", "File with one expression per line")
+	opts.asJSON = fs.Bool("json", false, "Print the results as JSON")
+	fs.Var(&opts.varFiles, "var-file", "Path to a .tfvars file (repeatable).")
+	return fs, opts
+}
+
+// RunEvalCommand implements `terraflow eval -from-file=path`. It returns an
+// error when any expression could not be evaluated.
+func RunEvalCommand(args []string) error {
+	fs, opts := newEvalFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *opts.fromFile == "" {
+		fs.Usage()
+		return errors.New("eval: -from-file is required")
+	}
+	exprs, err := readExpressionFile(*opts.fromFile)
+	if err != nil {
+		return err
+	}
+	cwd, _ := os.Getwd()
+	if err := checkProjectDir(cwd); err != nil {
+		return err
+	}
+	workDir, statePath := consoleWorkspace(cwd)
+	results := evalExpressions(workDir, statePath, normalizeVarFiles(workDir, []string(opts.varFiles)), exprs, defaultEvalTimeout)
+	terraform.ResetAllPersistentEvaluators()
+	if err := writeEvalResults(os.Stdout, results, *opts.asJSON); err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d expressions failed", failed, len(results))
+	}
+	return nil
+}
+
+// readExpressionFile returns the expressions of path, one per line, skipping
+// empty lines and comment lines.
+func readExpressionFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var out []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out, sc.Err()
+}
+
+// evalResult is the outcome of evaluating one expression; Error and Diagnostic
+// are empty on success. Error is Terraform's output as printed by the console,
+// Diagnostic the same failure broken into its fields.
+type evalResult struct {
+	Expression string               `json:"expression"`
+	Value      any                  `json:"value"`
+	Error      string               `json:"error,omitempty"`
+	Diagnostic *terraform.EvalError `json:"diagnostic,omitempty"`
+}
+
+// evalExpressions evaluates exprs through the same in-process, persistent and
+// one-shot evaluators as state synthesis. When none produces a value, the
+// expression is run through terraform console once more to report its error.
+func evalExpressions(workDir, statePath string, varFiles []string, exprs []string, timeout time.Duration) []evalResult {
+	session := terraform.StartConsoleSession(workDir, statePath, varFiles)
+	out := make([]evalResult, 0, len(exprs))
+	for _, expr := range exprs {
+		expanded, err := terraform.ExpandConfigReferences(workDir, expr)
+		if err != nil {
+			out = append(out, evalResult{Expression: expr, Error: err.Error(), Diagnostic: &terraform.EvalError{Summary: err.Error()}})
+			continue
+		}
+		v, evalErr := terraform.EvalJSON(workDir, statePath, varFiles, expanded, timeout)
+		if evalErr == nil {
+			out = append(out, evalResult{Expression: expr, Value: v})
+			continue
+		}
+		_, stderr, err := session.Evaluate(expanded, timeout)
+		msg := strings.TrimSpace(stderr)
+		if msg == "" && err != nil {
+			msg = err.Error()
+		}
+		if diag := terraform.ParseEvalError(stderr); diag != nil {
+			evalErr = diag
+		}
+		if msg == "" {
+			msg = evalErr.Error()
+		}
+		out = append(out, evalResult{Expression: expr, Error: msg, Diagnostic: evalErr})
+	}
+	return out
+}
+
+// writeEvalResults prints results as "expression => value" lines, or as a JSON
+// array with asJSON.
+func writeEvalResults(w io.Writer, results []evalResult, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			if _, err := fmt.Fprintf(w, "%s => error: %s\n", r.Expression, strings.ReplaceAll(r.Error, "\n", "\n  ")); err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := json.Marshal(r.Value)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s => %s\n", r.Expression, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
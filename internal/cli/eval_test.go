@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeEvalProject writes a configuration and an expression file with two
+// resolvable expressions and one referencing an undeclared variable.
+func writeEvalProject(t *testing.T) (dir, exprFile string) {
+	t.Helper()
+	// Without terraform on PATH only the in-process evaluator answers
+	t.Setenv("PATH", t.TempDir())
+	dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte("variable \"name\" {\n  default = \"web\"\n}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	exprFile = filepath.Join(dir, "exprs.txt")
+	src := "# expected values\nupper(var.name)\n\n// arithmetic\n1 + 2\nvar.missing\n"
+	if err := os.WriteFile(exprFile, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir, exprFile
+}
+
+func TestEvalExpressions_FromFile(t *testing.T) {
+	dir, exprFile := writeEvalProject(t)
+	exprs, err := readExpressionFile(exprFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(exprs, "|") != "upper(var.name)|1 + 2|var.missing" {
+		t.Fatalf("expressions = %q", exprs)
+	}
+	results := evalExpressions(dir, "", nil, exprs, 5*time.Second)
+
+	var text strings.Builder
+	if err := writeEvalResults(&text, results, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(text.String(), "\n")
+	if lines[0] != `upper(var.name) => "WEB"` || lines[1] != "1 + 2 => 3" || !strings.HasPrefix(lines[2], "var.missing => error: ") {
+		t.Fatalf("unexpected output:\n%s", text.String())
+	}
+
+	var js strings.Builder
+	if err := writeEvalResults(&js, results, true); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	if err := json.Unmarshal([]byte(js.String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0]["value"] != "WEB" || got[1]["value"] != float64(3) || got[2]["error"] == nil || got[2]["diagnostic"] == nil || got[0]["error"] != nil {
+		t.Fatalf("unexpected JSON: %s", js.String())
+	}
+}
+
+func TestRunEvalCommand_FailsWhenAnyExpressionFails(t *testing.T) {
+	dir, exprFile := writeEvalProject(t)
+	t.Chdir(dir)
+	err := RunEvalCommand([]string{"-from-file", exprFile})
+	if err == nil || err.Error() != "1 of 3 expressions failed" {
+		t.Fatalf("err = %v", err)
+	}
+	if err := RunEvalCommand(nil); err == nil {
+		t.Fatal("expected an error without -from-file")
+	}
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxEvaluatorFailures is how many evaluations in a row may come back empty
+// before the REPL stops using its primary evaluator.
+const maxEvaluatorFailures = 3
+
+// errorReporter is implemented by evaluators that can explain their last
+// failure, such as the persistent terraform console evaluator.
+type errorReporter interface {
+	LastError() error
+}
+
+// fallbackEvaluator sends lines to a long-lived primary evaluator and switches
+// to the one-shot ConsoleSession path for the rest of the session once the
+// primary fails maxEvaluatorFailures times in a row, so a dead evaluator does
+// not leave every evaluation without output.
+type fallbackEvaluator struct {
+	primary  lineEvaluator
+	fallback lineEvaluator
+	failures int
+	degraded bool
+}
+
+func newFallbackEvaluator(primary, fallback lineEvaluator) *fallbackEvaluator {
+	return &fallbackEvaluator{primary: primary, fallback: fallback}
+}
+
+// Evaluate implements lineEvaluator. The evaluation that trips the fallback is
+// retried on the fallback path, with a note about the switch on stderr.
+func (f *fallbackEvaluator) Evaluate(line string, timeout time.Duration) (string, string, error) {
+	return f.EvaluateStream(line, timeout, io.Discard)
+}
+
+// EvaluateStream implements streamEvaluator.
+func (f *fallbackEvaluator) EvaluateStream(line string, timeout time.Duration, w io.Writer) (string, string, error) {
+	if f.degraded {
+		return evaluateStream(f.fallback, line, timeout, w)
+	}
+	stdout, stderr, err := f.primary.Evaluate(line, timeout)
+	if stdout != "" || (stderr != "" && err == nil) {
+		f.failures = 0
+		_, _ = io.WriteString(w, stdout)
+		return stdout, stderr, err
+	}
+	f.failures++
+	if f.failures < maxEvaluatorFailures {
+		return stdout, stderr, err
+	}
+	f.degraded = true
+	note := fmt.Sprintf("The evaluator failed %d times in a row", f.failures)
+	if cause := f.lastError(err); cause != nil {
+		note += " (last error: " + cause.Error() + ")"
+	}
+	note += "; using one-shot terraform console for the rest of the session.\n"
+	stdout, stderr, err = evaluateStream(f.fallback, line, timeout, w)
+	return stdout, note + stderr, err
+}
+
+// lastError prefers the primary's own explanation over the error it returned.
+func (f *fallbackEvaluator) lastError(err error) error {
+	if r, ok := f.primary.(errorReporter); ok {
+		if lerr := r.LastError(); lerr != nil {
+			return lerr
+		}
+	}
+	if err != nil && strings.TrimSpace(err.Error()) != "" {
+		return err
+	}
+	return nil
+}
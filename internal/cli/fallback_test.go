@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+// dyingEvaluator returns nothing, like a persistent console that has exited.
+type dyingEvaluator struct {
+	recordingEvaluator
+}
+
+func (d *dyingEvaluator) LastError() error { return errors.New("terraform console exited") }
+
+func TestFallbackEvaluator_SwitchesAfterRepeatedFailures(t *testing.T) {
+	primary := &dyingEvaluator{}
+	session := &recordingEvaluator{stdout: "\"ok\"\n"}
+	ev := newFallbackEvaluator(primary, session)
+
+	for i := 1; i < maxEvaluatorFailures; i++ {
+		if stdout, stderr, _ := ev.Evaluate("var.x", time.Second); stdout != "" || stderr != "" {
+			t.Fatalf("failure %d: got (%q, %q) before the fallback kicked in", i, stdout, stderr)
+		}
+	}
+	stdout, stderr, err := ev.Evaluate("var.x", time.Second)
+	if err != nil || stdout != "\"ok\"\n" {
+		t.Fatalf("tripping evaluation was not retried on the fallback: (%q, %v)", stdout, err)
+	}
+	if !strings.Contains(stderr, "failed 3 times in a row (last error: terraform console exited)") {
+		t.Fatalf("last evaluator error not surfaced: %q", stderr)
+	}
+	if _, stderr, _ := ev.Evaluate("local.y", time.Second); stderr != "" {
+		t.Fatalf("switch reported more than once: %q", stderr)
+	}
+	if len(primary.calls) != maxEvaluatorFailures || len(session.calls) != 2 {
+		t.Fatalf("primary calls = %v, fallback calls = %v", primary.calls, session.calls)
+	}
+}
+
+func TestFallbackEvaluator_SuccessResetsFailures(t *testing.T) {
+	primary := &recordingEvaluator{}
+	session := &recordingEvaluator{stdout: "1\n"}
+	ev := newFallbackEvaluator(primary, session)
+	for i := 0; i < 2*maxEvaluatorFailures; i++ {
+		// Alternate empty and real answers; errors printed by Terraform count as answers
+		primary.stdout, primary.stderr = "", ""
+		if i%2 == 1 {
+			primary.stderr = "Error: Reference to undeclared input variable\n"
+		}
+		ev.Evaluate("var.x", time.Second)
+	}
+	if len(session.calls) != 0 {
+		t.Fatalf("fell back although the primary kept answering: %v", session.calls)
+	}
+}
+
+func TestEngineEvaluator_PersistentFallsBackToConsole(t *testing.T) {
+	// Without terraform on PATH the persistent console never answers
+	t.Setenv("PATH", t.TempDir())
+	terraform.SetEngine(terraform.EnginePersistent)
+	t.Cleanup(func() { terraform.SetEngine(terraform.EngineAuto) })
+	session := &recordingEvaluator{stdout: "2\n"}
+	ev := &engineEvaluator{ev: session, meta: &metaContext{scratchDir: t.TempDir()}}
+
+	for i := 1; i < maxEvaluatorFailures; i++ {
+		if _, _, err := ev.Evaluate("1 + 1", time.Second); err == nil || !strings.Contains(err.Error(), "persistent terraform console returned no value") {
+			t.Fatalf("failure %d: err = %v", i, err)
+		}
+	}
+	stdout, stderr, err := ev.Evaluate("1 + 1", time.Second)
+	if err != nil || stdout != "2\n" || !strings.Contains(stderr, "failed 3 times in a row (last error: the persistent terraform console returned no value") {
+		t.Fatalf("fallback: (%q, %q, %v)", stdout, stderr, err)
+	}
+	if len(session.calls) != 1 {
+		t.Fatalf("terraform console calls = %q", session.calls)
+	}
+}
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const historyFileName = ".terraflow_history"
+
+// historyExport is the portable on-disk format used by `terraflow history export`.
+type historyExport struct {
+	Version int      `json:"version"`
+	Entries []string `json:"entries"`
+}
+
+// globalHistoryPath returns the per-user history file shared across projects.
+func globalHistoryPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("locate home directory: %w", err)
+	}
+	return filepath.Join(home, historyFileName), nil
+}
+
+// readHistoryFile loads newline-separated history entries, oldest first.
+// A missing file yields no entries.
+func readHistoryFile(path string) []string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, ln := range strings.Split(string(b), "\n") {
+		ln = strings.TrimRight(ln, "\r")
+		if strings.TrimSpace(ln) == "" {
+			continue
+		}
+		out = append(out, ln)
+	}
+	return out
+}
+
+// mergeHistory combines older and newer histories (oldest first) into one list
+// ordered by most recent use, keeping only the latest occurrence of each entry.
+func mergeHistory(older, newer []string) []string {
+	all := append(append([]string{}, older...), newer...)
+	seen := make(map[string]struct{}, len(all))
+	out := make([]string, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		if _, ok := seen[all[i]]; ok {
+			continue
+		}
+		seen[all[i]] = struct{}{}
+		out = append(out, all[i])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// exportHistory writes the entries of historyPath to dest in the portable format.
+func exportHistory(historyPath, dest string) (int, error) {
+	entries := readHistoryFile(historyPath)
+	if entries == nil {
+		entries = []string{}
+	}
+	b, err := json.MarshalIndent(historyExport{Version: 1, Entries: entries}, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(dest, append(b, '\n'), 0o600); err != nil {
+		return 0, fmt.Errorf("write %s: %w", dest, err)
+	}
+	return len(entries), nil
+}
+
+// importHistory merges the entries exported to src into historyPath, treating
+// the existing entries as more recent. Plain newline-separated history files are
+// accepted too. Returns the number of entries in the resulting history.
+func importHistory(historyPath, src string) (int, error) {
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return 0, fmt.Errorf("read %s: %w", src, err)
+	}
+	var imported []string
+	var exp historyExport
+	if json.Unmarshal(b, &exp) == nil {
+		if exp.Version != 1 {
+			return 0, fmt.Errorf("%s: unsupported history format version %d", src, exp.Version)
+		}
+		imported = exp.Entries
+	} else {
+		imported = readHistoryFile(src)
+	}
+	merged := mergeHistory(imported, readHistoryFile(historyPath))
+	if err := os.MkdirAll(filepath.Dir(historyPath), 0o700); err != nil {
+		return 0, err
+	}
+	var sb strings.Builder
+	for _, h := range merged {
+		sb.WriteString(h)
+		sb.WriteByte('\n')
+	}
+	tmp := fmt.Sprintf("%s.tmp-%d", historyPath, os.Getpid())
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0o600); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, historyPath); err != nil {
+		return 0, err
+	}
+	return len(merged), nil
+}
+
+// historySubcommands are the actions of the history command.
+var historySubcommands = []string{"export", "import"}
+
+// newHistoryFlagSet defines the flags and usage of the history command; global
+// selects the history shared across projects.
+func newHistoryFlagSet() (fs *flag.FlagSet, global *bool) {
+	fs = flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		if _, err := fmt.Fprint(fs.Output(), `Usage: terraflow [global options] history <export|import> [options] <file>
+
+  Export the console history of the current project to a portable file, or
+  merge a previously exported file into it.
+
+Options:
+
+  -global               Use the history shared across all projects, stored in
+                        the home directory, instead of the project history.
+`); err != nil {
+			fmt.Fprintln(os.Stderr, "error printing usage:", err)
+		}
+	}
+	global = fs.Bool("global", false, "Use the history shared across projects")
+	return fs, global
+}
+
+// RunHistoryCommand implements `terraflow history export|import <file>`.
+func RunHistoryCommand(args []string) error {
+	fs, global := newHistoryFlagSet()
+	// Flags may come before the subcommand (history -global export f) or
+	// after any argument
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(rest) == 0 {
+		fs.Usage()
+		return errors.New("missing history subcommand")
+	}
+	sub := rest[0]
+	if len(rest) != 2 {
+		fs.Usage()
+		return fmt.Errorf("history %s: expected exactly one file argument", sub)
+	}
+	file := rest[1]
+
+	historyPath := ""
+	if *global {
+		p, err := globalHistoryPath()
+		if err != nil {
+			return err
+		}
+		historyPath = p
+	} else {
+		cwd, _ := os.Getwd()
+		historyPath = filepath.Join(cwd, ".terraflow", historyFileName)
+	}
+
+	switch sub {
+	case "export":
+		n, err := exportHistory(historyPath, file)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d history entries to %s\n", n, file)
+	case "import":
+		n, err := importHistory(historyPath, file)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("History now has %d entries\n", n)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown history subcommand %q", sub)
+	}
+	return nil
+}
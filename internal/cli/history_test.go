@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHistoryExportImport_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a", historyFileName)
+	if err := os.MkdirAll(filepath.Dir(src), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, []byte("var.a\nlocal.b\n{ x = 1 }\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	exported := filepath.Join(dir, "history.json")
+	if n, err := exportHistory(src, exported); err != nil || n != 3 {
+		t.Fatalf("export: n=%d err=%v", n, err)
+	}
+
+	// Importing into another project keeps its own entries as the most recent
+	dst := filepath.Join(dir, "b", historyFileName)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, []byte("var.a\nvar.z\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importHistory(dst, exported); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	want := []string{"local.b", "{ x = 1 }", "var.a", "var.z"}
+	if got := readHistoryFile(dst); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Importing into an empty history reproduces the export exactly
+	fresh := filepath.Join(dir, "c", historyFileName)
+	if _, err := importHistory(fresh, exported); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if got, want := readHistoryFile(fresh), readHistoryFile(src); !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip: got %q, want %q", got, want)
+	}
+}
+
+func TestMergeHistory_GlobalThenLocalMRU(t *testing.T) {
+	global := []string{"var.g1", "var.shared", "var.g2"}
+	local := []string{"var.shared", "var.l1"}
+	got := mergeHistory(global, local)
+	want := []string{"var.g1", "var.g2", "var.shared", "var.l1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestRunHistoryCommand_FlagsBeforeSubcommand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	if err := os.WriteFile(filepath.Join(home, historyFileName), []byte("var.shared\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	for file, args := range map[string][]string{
+		"before.json":     {"-global", "export", "before.json"},
+		"after-sub.json":  {"export", "-global", "after-sub.json"},
+		"after-file.json": {"export", "after-file.json", "-global"},
+	} {
+		var err error
+		captureStdout(t, func() { err = RunHistoryCommand(args) })
+		if err != nil {
+			t.Fatalf("%q: %v", args, err)
+		}
+		imported := filepath.Join(t.TempDir(), historyFileName)
+		if _, err := importHistory(imported, file); err != nil {
+			t.Fatalf("%q: import: %v", args, err)
+		}
+		if got := readHistoryFile(imported); !reflect.DeepEqual(got, []string{"var.shared"}) {
+			t.Fatalf("%q exported %q, want the global history", args, got)
+		}
+	}
+}
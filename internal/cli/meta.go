@@ -0,0 +1,289 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+// metaContext carries the session details that REPL meta-commands operate on.
+type metaContext struct {
+	projectDir string // where .terraflow.hcl is read from
+	scratchDir string
+	statePath  string
+	// varFiles changes with :profile while the background refresh reads it
+	varFilesMu sync.Mutex
+	varFiles   []string
+	profile    string // active :profile, if any
+	session    *terraform.ConsoleSession
+	index      *terraform.SymbolIndex // current symbol index, for :schema
+	output     outputMode
+	timeout    time.Duration // per-evaluation timeout, adjusted by :timeout
+	cache      *resultCache  // REPL result cache, toggled by :cache
+	// mergeStates and mocks are re-applied after the state is reset.
+	mergeStates []terraform.MergeStateSource
+	mocks       []terraform.Mock
+	// unresolved is the last :unresolved listing, which :unresolved <n> indexes.
+	unresolved []terraform.UnresolvedAttr
+	// refreshing, when set, is held while the state is rebuilt so a background
+	// refresh does not patch it at the same time.
+	refreshing *refreshGate
+}
+
+// currentVarFiles returns the var-files of the active profile.
+func (mc *metaContext) currentVarFiles() []string {
+	mc.varFilesMu.Lock()
+	defer mc.varFilesMu.Unlock()
+	return mc.varFiles
+}
+
+func (mc *metaContext) setVarFiles(varFiles []string) {
+	mc.varFilesMu.Lock()
+	mc.varFiles = varFiles
+	mc.varFilesMu.Unlock()
+}
+
+// holdRefresh waits for a running background refresh and keeps new ones from
+// starting until the returned func is called.
+func (mc *metaContext) holdRefresh() func() {
+	if mc.refreshing == nil {
+		return func() {}
+	}
+	mc.refreshing.start()
+	return mc.refreshing.finish
+}
+
+// outputMode controls how evaluation results are printed.
+type outputMode struct {
+	compact bool // collapse multi-line results onto a single line
+	echo    bool // print the normalized expression before its result
+}
+
+// parseMetaCommand splits a REPL meta-command such as ":reset-state" into its
+// name and trimmed argument. ok is false when line is a regular expression.
+func parseMetaCommand(line string) (name, arg string, ok bool) {
+	s := strings.TrimSpace(line)
+	if !strings.HasPrefix(s, ":") {
+		return "", "", false
+	}
+	s = strings.TrimSpace(s[1:])
+	if s == "" {
+		return "", "", false
+	}
+	name, arg, _ = strings.Cut(s, " ")
+	return strings.ToLower(name), strings.TrimSpace(arg), true
+}
+
+// runMetaCommand executes a meta-command and returns the message to print.
+func runMetaCommand(mc *metaContext, name, arg string) (string, error) {
+	switch name {
+	case "reset-state":
+		release := mc.holdRefresh()
+		defer release()
+		if err := terraform.ResetState(mc.scratchDir, mc.scratchDir, mc.statePath, mc.currentVarFiles()); err != nil {
+			return "", fmt.Errorf("reset state: %w", err)
+		}
+		if err := terraform.MergeStates(mc.statePath, mc.mergeStates); err != nil {
+			return "", fmt.Errorf("reset state: %w", err)
+		}
+		if err := terraform.ApplyMocks(mc.statePath, mc.mocks); err != nil {
+			return "", fmt.Errorf("reset state: %w", err)
+		}
+		if mc.session != nil {
+			mc.session.Restart()
+		}
+		if mc.cache != nil {
+			mc.cache.invalidate()
+		}
+		return "State reset from current configuration.", nil
+	case "compact":
+		return setToggle(&mc.output.compact, "compact", "Compact output", arg)
+	case "echo":
+		return setToggle(&mc.output.echo, "echo", "Echo of evaluated expressions", arg)
+	case "timeout":
+		return setTimeout(&mc.timeout, arg)
+	case "cache":
+		if mc.cache == nil {
+			return "", fmt.Errorf("result cache is not available")
+		}
+		return setToggle(&mc.cache.enabled, "cache", "Result cache", arg)
+	case "unresolved":
+		return runUnresolved(mc, arg)
+	case "schema":
+		return schemaListing(mc.index, arg)
+	case "profile":
+		return switchProfile(mc, arg)
+	case "reveal":
+		return revealValue(mc, arg)
+	case "engine":
+		return setEngine(mc, arg)
+	default:
+		return "", fmt.Errorf("unknown command :%s", name)
+	}
+}
+
+// setToggle handles the on/off argument of a boolean meta-command; without an
+// argument it reports the current setting.
+func setToggle(v *bool, name, label, arg string) (string, error) {
+	switch strings.ToLower(arg) {
+	case "on":
+		*v = true
+	case "off":
+		*v = false
+	case "":
+	default:
+		return "", fmt.Errorf("usage: :%s [on|off]", name)
+	}
+	if *v {
+		return label + " is on.", nil
+	}
+	return label + " is off.", nil
+}
+
+// setTimeout handles :timeout; the argument is a positive duration such as
+// "60s" or "2m". Without an argument it reports the current timeout.
+func setTimeout(v *time.Duration, arg string) (string, error) {
+	if arg != "" {
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			return "", fmt.Errorf("invalid timeout %q: expected a positive duration such as 60s or 2m", arg)
+		}
+		*v = d
+	}
+	if *v <= 0 {
+		*v = defaultEvalTimeout
+	}
+	return fmt.Sprintf("Evaluation timeout is %s.", *v), nil
+}
+
+// setEngine handles :engine, switching the evaluation engine. Cached results
+// are dropped so the next evaluation runs on the new engine. Without an
+// argument it reports the current engine.
+func setEngine(mc *metaContext, arg string) (string, error) {
+	if arg != "" {
+		e, err := terraform.ParseEngine(arg)
+		if err != nil {
+			return "", err
+		}
+		terraform.SetEngine(e)
+		if mc.cache != nil {
+			mc.cache.invalidate()
+		}
+	}
+	return fmt.Sprintf("Evaluation engine is %s.", terraform.CurrentEngine()), nil
+}
+
+// runUnresolved handles :unresolved. Without an argument it lists the resource
+// attributes the console cannot resolve; with a number it prints the source of
+// that entry from the last listing.
+func runUnresolved(mc *metaContext, arg string) (string, error) {
+	if arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return "", fmt.Errorf("usage: :unresolved [n]")
+		}
+		if n < 1 || n > len(mc.unresolved) {
+			return "", fmt.Errorf("no unresolved entry %d; run :unresolved to list them", n)
+		}
+		return unresolvedSource(mc.scratchDir, mc.unresolved[n-1]), nil
+	}
+	_, unresolved, err := terraform.CheckConfig(mc.scratchDir, mc.scratchDir, mc.statePath, mc.currentVarFiles())
+	if err != nil {
+		return "", fmt.Errorf("unresolved: %w", err)
+	}
+	mc.unresolved = unresolved
+	if len(unresolved) == 0 {
+		return "All attributes resolve.", nil
+	}
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tLOCATION\tATTRIBUTE\tREASON")
+	for i, u := range unresolved {
+		fmt.Fprintf(tw, "%d\t%s:%d\t%s.%s\t%s (%s)\n", i+1, u.Range.Filename, u.Range.Start.Line, u.Resource, u.Attr, u.Reason, u.Detail)
+	}
+	_ = tw.Flush()
+	b.WriteString("Use :unresolved <n> to show an entry's source.")
+	return b.String(), nil
+}
+
+// unresolvedSource renders the source range of u followed by the lines it spans.
+func unresolvedSource(rootDir string, u terraform.UnresolvedAttr) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s.%s)", u.Range, u.Resource, u.Attr)
+	src, err := os.ReadFile(filepath.Join(rootDir, u.Range.Filename))
+	if err != nil {
+		return b.String()
+	}
+	lines := strings.Split(string(src), "\n")
+	for n := u.Range.Start.Line; n <= u.Range.End.Line && n <= len(lines); n++ {
+		fmt.Fprintf(&b, "\n%4d | %s", n, strings.TrimRight(lines[n-1], "\r"))
+	}
+	return b.String()
+}
+
+// revealWarning precedes every value printed by :reveal.
+const revealWarning = "Warning: revealing sensitive values; the result below is not redacted."
+
+// revealValue handles :reveal <expr>, printing the value of expr with its
+// sensitive parts shown. It is only available as a meta-command, so the value
+// never reaches the result cache or the -debug transcript.
+func revealValue(mc *metaContext, arg string) (string, error) {
+	if arg == "" {
+		return "", fmt.Errorf("usage: :reveal <expression>")
+	}
+	timeout := mc.timeout
+	if timeout <= 0 {
+		timeout = defaultEvalTimeout
+	}
+	v, err := terraform.RevealJSON(mc.scratchDir, mc.statePath, mc.currentVarFiles(), arg, timeout)
+	if err != nil {
+		return "", err
+	}
+	var b []byte
+	if mc.output.compact {
+		b, err = json.Marshal(v)
+	} else {
+		b, err = json.MarshalIndent(v, "", "  ")
+	}
+	if err != nil {
+		return "", err
+	}
+	return revealWarning + "\n" + string(b), nil
+}
+
+// schemaListing handles :schema <type>, listing the attributes and nested blocks
+// the provider schema declares for a resource type or, with a data. prefix, a
+// data source.
+func schemaListing(idx *terraform.SymbolIndex, arg string) (string, error) {
+	if arg == "" {
+		return "", fmt.Errorf("usage: :schema <resource type> or :schema data.<data source type>")
+	}
+	var attrs []terraform.SchemaAttribute
+	var ok bool
+	if idx != nil {
+		if typ, isData := strings.CutPrefix(arg, "data."); isData {
+			attrs, ok = idx.DataSchemas[typ]
+		} else {
+			attrs, ok = idx.ResourceSchemas[arg]
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("no provider schema for %s; schemas are read from `terraform providers schema -json` once providers are installed", arg)
+	}
+	var b strings.Builder
+	b.WriteString(arg)
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, a := range attrs {
+		fmt.Fprintf(tw, "\n  %s\t%s\t%s", a.Name, a.Type, a.Usage())
+	}
+	_ = tw.Flush()
+	return b.String(), nil
+}
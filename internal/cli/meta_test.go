@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+func TestParseMetaCommand(t *testing.T) {
+	cases := []struct {
+		in       string
+		name     string
+		arg      string
+		isMetaOK bool
+	}{
+		{":reset-state", "reset-state", "", true},
+		{"  :Timeout   60s ", "timeout", "60s", true},
+		{":", "", "", false},
+		{"var.x", "", "", false},
+		{`{a = ":x"}`, "", "", false},
+	}
+	for _, c := range cases {
+		name, arg, ok := parseMetaCommand(c.in)
+		if ok != c.isMetaOK || name != c.name || arg != c.arg {
+			t.Fatalf("%q: got (%q, %q, %v), want (%q, %q, %v)", c.in, name, arg, ok, c.name, c.arg, c.isMetaOK)
+		}
+	}
+}
+
+func TestRunMetaCommand_Compact(t *testing.T) {
+	mc := &metaContext{}
+	if _, err := runMetaCommand(mc, "compact", "on"); err != nil || !mc.output.compact {
+		t.Fatalf("compact on: err=%v compact=%v", err, mc.output.compact)
+	}
+	if _, err := runMetaCommand(mc, "compact", "off"); err != nil || mc.output.compact {
+		t.Fatalf("compact off: err=%v compact=%v", err, mc.output.compact)
+	}
+	if _, err := runMetaCommand(mc, "compact", "maybe"); err == nil {
+		t.Fatal("expected error for invalid argument")
+	}
+}
+
+func TestRunMetaCommand_Echo(t *testing.T) {
+	mc := &metaContext{}
+	if msg, err := runMetaCommand(mc, "echo", ""); err != nil || mc.output.echo || msg != "Echo of evaluated expressions is off." {
+		t.Fatalf("default: msg=%q err=%v echo=%v", msg, err, mc.output.echo)
+	}
+	if _, err := runMetaCommand(mc, "echo", "on"); err != nil || !mc.output.echo {
+		t.Fatalf("echo on: err=%v echo=%v", err, mc.output.echo)
+	}
+}
+
+func TestRunMetaCommand_TimeoutAppliesToNextEvaluation(t *testing.T) {
+	mc := &metaContext{timeout: defaultEvalTimeout}
+	if msg, err := runMetaCommand(mc, "timeout", "60s"); err != nil || msg != "Evaluation timeout is 1m0s." {
+		t.Fatalf("timeout 60s: msg=%q err=%v", msg, err)
+	}
+	ev := &recordingEvaluator{}
+	captureStdout(t, func() { evaluateSubmitted(ev, "local.big", "local.big", mc.output, mc.timeout) })
+	if len(ev.timeouts) != 1 || ev.timeouts[0] != time.Minute {
+		t.Fatalf("evaluated with %v, want 1m", ev.timeouts)
+	}
+	for _, bad := range []string{"soon", "-5s", "0s", "60"} {
+		if _, err := runMetaCommand(mc, "timeout", bad); err == nil {
+			t.Fatalf("%q: expected an error", bad)
+		}
+	}
+	if msg, _ := runMetaCommand(mc, "timeout", ""); msg != "Evaluation timeout is 1m0s." {
+		t.Fatalf("invalid values must keep the previous timeout, got %q", msg)
+	}
+}
+
+func TestRunMetaCommand_UnresolvedListsComputedAttribute(t *testing.T) {
+	// Without terraform on PATH only the in-process evaluator can resolve
+	t.Setenv("PATH", t.TempDir())
+	defer terraform.ResetAllPersistentEvaluators()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`resource "null_resource" "a" {}
+
+resource "null_resource" "b" {
+  triggers = { upstream = null_resource.a.id }
+}
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := terraform.PatchStateFromConfig(dir, statePath, nil); err != nil {
+		t.Fatal(err)
+	}
+	mc := &metaContext{scratchDir: dir, statePath: statePath}
+
+	// id is only known after apply, so the synthesized state cannot provide it
+	msg, err := runMetaCommand(mc, "unresolved", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msg, "main.tf:4") || !strings.Contains(msg, "null_resource.b.triggers") || !strings.Contains(msg, "unresolved reference (null_resource.a.id)") {
+		t.Fatalf("listing does not show the computed attribute:\n%s", msg)
+	}
+	src, err := runMetaCommand(mc, "unresolved", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(src, "   4 |   triggers = { upstream = null_resource.a.id }") {
+		t.Fatalf("source of entry 1:\n%s", src)
+	}
+	if _, err := runMetaCommand(mc, "unresolved", "2"); err == nil {
+		t.Fatal("expected an error for an entry that does not exist")
+	}
+}
+
+func TestRunMetaCommand_SchemaListsAttributes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	// Stub terraform answering `providers schema -json`
+	bin := t.TempDir()
+	script := `#!/bin/sh
+[ "$1 $2" = "providers schema" ] || exit 1
+cat <<'EOF'
+{"format_version":"1.0","provider_schemas":{"registry.terraform.io/hashicorp/aws":{
+  "resource_schemas":{"aws_instance":{"block":{
+    "attributes":{
+      "ami":{"type":"string","required":true},
+      "instance_type":{"type":"string","optional":true,"computed":true},
+      "tags":{"type":["map","string"],"optional":true},
+      "id":{"type":"string","computed":true}
+    },
+    "block_types":{"ebs_block_device":{"nesting_mode":"set","block":{}}}
+  }}},
+  "data_source_schemas":{"aws_ami":{"block":{"attributes":{"owners":{"type":["list","string"],"required":true}}}}}
+}}}
+EOF
+`
+	if err := os.WriteFile(filepath.Join(bin, "terraform"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`resource "aws_instance" "web" {}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := terraform.BuildSymbolIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc := &metaContext{index: idx}
+
+	msg, err := runMetaCommand(mc, "schema", "aws_instance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ln := range strings.Split(msg, "\n") {
+		got = append(got, strings.Join(strings.Fields(ln), " "))
+	}
+	want := []string{
+		"aws_instance",
+		"ami string required",
+		"ebs_block_device block set optional",
+		"instance_type string optional, computed",
+		"tags map(string) optional",
+		"id string computed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("schema listing:\n%s\nwant lines %q", msg, want)
+	}
+	if msg, err := runMetaCommand(mc, "schema", "data.aws_ami"); err != nil || !strings.Contains(msg, "owners") || !strings.Contains(msg, "list(string)") {
+		t.Fatalf("data source listing: %q (err=%v)", msg, err)
+	}
+	if _, err := runMetaCommand(mc, "schema", "aws_vpc"); err == nil {
+		t.Fatal("expected an error for a type without schema")
+	}
+}
+
+func TestRunMetaCommand_RevealShowsSensitiveValue(t *testing.T) {
+	// Without terraform on PATH only the in-process evaluator can resolve
+	t.Setenv("PATH", t.TempDir())
+	defer terraform.ResetAllPersistentEvaluators()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`variable "token" {
+  default   = "t0ken"
+  sensitive = true
+}
+locals {
+  creds = { user = "admin", password = sensitive("hunter2") }
+}
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(dir, "terraform.tfstate")
+
+	// Plain evaluation redacts both
+	for _, expr := range []string{"var.token", "local.creds"} {
+		v, evalErr := terraform.EvalJSON(dir, statePath, nil, expr, time.Second)
+		if evalErr != nil || !strings.Contains(fmt.Sprint(v), terraform.SensitiveRedacted) {
+			t.Fatalf("%s: expected a redacted value, got %#v", expr, v)
+		}
+	}
+	mc := &metaContext{scratchDir: dir, statePath: statePath, output: outputMode{compact: true}}
+	msg, err := runMetaCommand(mc, "reveal", "var.token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != revealWarning+"\n"+`"t0ken"` {
+		t.Fatalf(":reveal var.token = %q", msg)
+	}
+	msg, err = runMetaCommand(mc, "reveal", "local.creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(msg, `{"password":"hunter2","user":"admin"}`) {
+		t.Fatalf(":reveal local.creds = %q", msg)
+	}
+	if _, err := runMetaCommand(mc, "reveal", ""); err == nil {
+		t.Fatal("expected a usage error without an expression")
+	}
+}
+
+func TestRunMetaCommand_EngineRoutesEvaluation(t *testing.T) {
+	// Without terraform on PATH only the in-process evaluator answers
+	t.Setenv("PATH", t.TempDir())
+	t.Cleanup(func() { terraform.SetEngine(terraform.EngineAuto) })
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte("locals {\n  l = [1, 2]\n}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ev := &recordingEvaluator{}
+	mc := &metaContext{scratchDir: dir, output: outputMode{compact: true}}
+	mc.cache = newResultCache(&engineEvaluator{ev: ev, meta: mc}, "")
+
+	msg, err := runMetaCommand(mc, "engine", "inprocess")
+	if err != nil || msg != "Evaluation engine is inprocess." {
+		t.Fatalf(":engine inprocess = %q, %v", msg, err)
+	}
+	if out, _, err := mc.cache.Evaluate("local.l", time.Second); err != nil || out != "[1,2]\n" {
+		t.Fatalf("inprocess: %q, %v", out, err)
+	}
+	if len(ev.calls) != 0 {
+		t.Fatalf("terraform console was asked for %q", ev.calls)
+	}
+	if _, err := runMetaCommand(mc, "engine", "console"); err == nil {
+		t.Fatal("expected an error for an unknown engine")
+	}
+	if msg, _ := runMetaCommand(mc, "engine", "auto"); msg != "Evaluation engine is auto." {
+		t.Fatalf(":engine auto = %q", msg)
+	}
+	_, _, _ = mc.cache.Evaluate("local.l", time.Second)
+	if len(ev.calls) != 1 {
+		t.Fatalf("auto should use terraform console, got %q", ev.calls)
+	}
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// configFileName is the optional per-project terraflow configuration.
+const configFileName = ".terraflow.hcl"
+
+// loadProfiles reads the named var-file sets declared in .terraflow.hcl under dir:
+//
+//	profile "staging" {
+//	  var_files = ["staging.tfvars"]
+//	}
+//
+// Relative var-file paths are relative to dir. A missing file yields no profiles.
+func loadProfiles(dir string) (map[string][]string, error) {
+	path := filepath.Join(dir, configFileName)
+	src, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("parse %s: %s", configFileName, diags.Error())
+	}
+	body, ok := f.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, nil
+	}
+	profiles := map[string][]string{}
+	for _, b := range body.Blocks {
+		if b.Type != "profile" || len(b.Labels) != 1 {
+			continue
+		}
+		var files []string
+		if attr, ok := b.Body.Attributes["var_files"]; ok {
+			v, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || !v.IsWhollyKnown() || v.IsNull() || !v.CanIterateElements() {
+				return nil, fmt.Errorf("%s: profile %q: var_files must be a list of paths", configFileName, b.Labels[0])
+			}
+			for it := v.ElementIterator(); it.Next(); {
+				_, ev := it.Element()
+				if ev.IsNull() || ev.Type() != cty.String {
+					return nil, fmt.Errorf("%s: profile %q: var_files must be a list of paths", configFileName, b.Labels[0])
+				}
+				files = append(files, ev.AsString())
+			}
+		}
+		profiles[b.Labels[0]] = files
+	}
+	return profiles, nil
+}
+
+// switchProfile handles :profile. With a name it re-applies the profile's
+// var-files: the state is rebuilt from configuration with them and the console
+// session and evaluators are restarted. Without a name it lists the profiles.
+func switchProfile(mc *metaContext, arg string) (string, error) {
+	profiles, err := loadProfiles(mc.projectDir)
+	if err != nil {
+		return "", fmt.Errorf("profile: %w", err)
+	}
+	if len(profiles) == 0 {
+		return "", fmt.Errorf("no profiles defined; declare profile blocks in %s", configFileName)
+	}
+	if arg == "" {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var b strings.Builder
+		tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, name := range names {
+			marker := " "
+			if name == mc.profile {
+				marker = "*"
+			}
+			fmt.Fprintf(tw, "%s %s\t%s\n", marker, name, strings.Join(profiles[name], ", "))
+		}
+		_ = tw.Flush()
+		return strings.TrimRight(b.String(), "\n"), nil
+	}
+	files, ok := profiles[arg]
+	if !ok {
+		return "", fmt.Errorf("unknown profile %q; run :profile to list them", arg)
+	}
+	for i, f := range files {
+		if !filepath.IsAbs(f) {
+			files[i] = filepath.Join(mc.projectDir, f)
+		}
+	}
+	varFiles := normalizeVarFiles(mc.scratchDir, files)
+	release := mc.holdRefresh()
+	defer release()
+	// Evaluators are keyed on their var-files; stop the ones started for the
+	// previous profile rather than leaving them running.
+	terraform.ResetAllPersistentEvaluators()
+	if err := terraform.ResetState(mc.scratchDir, mc.scratchDir, mc.statePath, varFiles); err != nil {
+		return "", fmt.Errorf("profile %s: %w", arg, err)
+	}
+	if err := terraform.MergeStates(mc.statePath, mc.mergeStates); err != nil {
+		return "", fmt.Errorf("profile %s: %w", arg, err)
+	}
+	if err := terraform.ApplyMocks(mc.statePath, mc.mocks); err != nil {
+		return "", fmt.Errorf("profile %s: %w", arg, err)
+	}
+	if mc.session != nil {
+		mc.session.SetVarFiles(varFiles)
+	}
+	mc.setVarFiles(varFiles)
+	mc.profile = arg
+	// Cached results were computed with the previous profile's variables
+	if mc.cache != nil {
+		mc.cache.invalidate()
+	}
+	return fmt.Sprintf("Switched to profile %s.", arg), nil
+}
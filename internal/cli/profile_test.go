@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+)
+
+func TestRunMetaCommand_ProfileSwitchesVarFiles(t *testing.T) {
+	// Without terraform on PATH variables are resolved in-process
+	t.Setenv("PATH", t.TempDir())
+	defer terraform.ResetAllPersistentEvaluators()
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.tf":        "variable \"env\" {\n  default = \"none\"\n}\n",
+		"dev.tfvars":     "env = \"dev\"\n",
+		"staging.tfvars": "env = \"staging\"\n",
+		configFileName: `profile "dev" {
+  var_files = ["dev.tfvars"]
+}
+profile "staging" {
+  var_files = ["staging.tfvars"]
+}
+`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mc := &metaContext{projectDir: dir, scratchDir: dir, statePath: filepath.Join(dir, "terraform.tfstate")}
+	// A reproducible state keeps its serial, so only the switch itself can
+	// tell the result cache that var.env changed
+	terraform.SetReproducibleState(true)
+	defer terraform.SetReproducibleState(false)
+	ev := &recordingEvaluator{stdout: "\"none\"\n"}
+	mc.cache = newResultCache(ev, mc.statePath)
+	envValue := func() any {
+		t.Helper()
+		v, ok := terraform.TryEvalInProcessWithState(mc.scratchDir, mc.statePath, mc.currentVarFiles(), "var.env", time.Second)
+		if !ok {
+			t.Fatal("var.env did not evaluate")
+		}
+		return v
+	}
+
+	for _, profile := range []string{"dev", "staging", "dev"} {
+		if msg, err := runMetaCommand(mc, "profile", profile); err != nil || msg != "Switched to profile "+profile+"." {
+			t.Fatalf("profile %s: msg=%q err=%v", profile, msg, err)
+		}
+		if got := envValue(); got != profile {
+			t.Fatalf("after :profile %s, var.env = %#v", profile, got)
+		}
+		// A result cached under the previous profile must not be reused
+		calls := len(ev.calls)
+		for i := 0; i < 2; i++ {
+			if _, _, err := mc.cache.Evaluate("var.env", time.Second); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(ev.calls) != calls+1 {
+			t.Fatalf("after :profile %s, var.env was evaluated %d times, want once", profile, len(ev.calls)-calls)
+		}
+	}
+	calls := len(ev.calls)
+	if _, err := runMetaCommand(mc, "reset-state", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := mc.cache.Evaluate("var.env", time.Second); err != nil || len(ev.calls) != calls+1 {
+		t.Fatalf(":reset-state should invalidate the cache, evaluated %d times (err=%v)", len(ev.calls)-calls, err)
+	}
+	msg, err := runMetaCommand(mc, "profile", "")
+	if err != nil || !strings.Contains(msg, "* dev") || !strings.Contains(msg, "  staging") {
+		t.Fatalf("listing: %q (err=%v)", msg, err)
+	}
+	if _, err := runMetaCommand(mc, "profile", "prod"); err == nil || mc.profile != "dev" {
+		t.Fatalf("unknown profile: err=%v active=%q", err, mc.profile)
+	}
+}
@@ -1,15 +1,29 @@
 package cli
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/flowave-io/terraflow/internal/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 )
 
+const (
+	ansiDim   = "\x1b[2m"
+	ansiReset = "\x1b[0m"
+)
+
+// defaultEvalTimeout bounds a single interactive evaluation unless changed with :timeout.
+const defaultEvalTimeout = 15 * time.Second
+
 func writeStdout(s string) {
 	if _, err := os.Stdout.WriteString(s); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "stdout write error: %v\n", err)
@@ -25,36 +39,32 @@ func writeStderr(s string) {
 // RunREPL starts the interactive console loop with history and autocompletion.
 // Uses raw TTY on Unix to capture TAB and arrows; gracefully degrades otherwise.
 // scratchDir is the working directory used by terraform console (e.g., .terraflow).
-func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, refreshCh <-chan struct{}, scratchDir string, varFiles []string) {
+// With globalHistory, commands are also shared through the per-user history file.
+// A non-nil debugLog receives a transcript of every evaluation. The execs are
+// submitted in order, as if typed at the prompt, before input is read.
+func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, refreshCh <-chan []string, scratchDir string, varFiles []string, mergeStates []terraform.MergeStateSource, mocks []terraform.Mock, globalHistory bool, debugLog *log.Logger, execs []string) {
 	// Setup persistent history file under scratch directory
 	cwd, _ := os.Getwd()
-	historyPath := filepath.Join(scratchDir, ".terraflow_history")
+	historyPath := filepath.Join(scratchDir, historyFileName)
+	activeTheme = loadTheme(stdoutIsTerminal())
 	tty, restore, _ := acquireTTY()
-	if restore != nil {
-		defer restore()
-	}
-	if tty != nil {
-		defer func() {
+	// tty and restore are replaced when the terminal is re-acquired after
+	// running an editor, so the deferred cleanup reads them late
+	defer func() {
+		if restore != nil {
+			restore()
+		}
+		if tty != nil {
 			if err := tty.Close(); err != nil {
 				_, _ = fmt.Fprintf(os.Stderr, "tty close error: %v\n", err)
 			}
-		}()
-	}
+		}
+	}()
 
 	const prompt = ">> "
 	buf := []rune{}
 	cursor := 0
-	history := []string{}
-	// Re-read file now and append to history (after slice is created)
-	if b, err := os.ReadFile(historyPath); err == nil {
-		for _, ln := range strings.Split(string(b), "\n") {
-			ln = strings.TrimRight(ln, "\r")
-			if strings.TrimSpace(ln) == "" {
-				continue
-			}
-			history = append(history, ln)
-		}
-	}
+	history := append([]string{}, readHistoryFile(historyPath)...)
 	// Open file for appending executed commands
 	historyFile, _ := os.OpenFile(historyPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
 	if historyFile != nil {
@@ -64,7 +74,42 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 			}
 		}()
 	}
+	// Optional shared history: project entries are treated as the most recent
+	var globalHistoryFile *os.File
+	if globalHistory {
+		if gp, err := globalHistoryPath(); err != nil {
+			writeStderr("global history unavailable: " + err.Error() + "\n")
+		} else {
+			history = mergeHistory(readHistoryFile(gp), history)
+			globalHistoryFile, _ = os.OpenFile(gp, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		}
+	}
+	if globalHistoryFile != nil {
+		defer func() {
+			if err := globalHistoryFile.Close(); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "history close error: %v\n", err)
+			}
+		}()
+	}
 	histIdx := -1 // -1 means not navigating
+	// Context for ":"-prefixed meta-commands
+	meta := &metaContext{
+		projectDir:  cwd,
+		scratchDir:  scratchDir,
+		statePath:   filepath.Join(scratchDir, "terraform.tfstate"),
+		varFiles:    varFiles,
+		mergeStates: mergeStates,
+		mocks:       mocks,
+		session:     session,
+		timeout:     defaultEvalTimeout,
+	}
+	// Results of repeated expressions, invalidated by refreshes and state changes
+	meta.cache = newResultCache(&configRefEvaluator{ev: &engineEvaluator{ev: session, meta: meta}, rootDir: scratchDir}, meta.statePath)
+	// With -debug, every evaluation is mirrored to the debug log
+	var submitEv lineEvaluator = meta.cache
+	if debugLog != nil {
+		submitEv = &transcriptEvaluator{ev: meta.cache, log: debugLog}
+	}
 	// TAB-cycle state
 	lastTabCands := []string{}
 	lastTabStart, lastTabEnd := 0, 0
@@ -78,32 +123,28 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 	suppressGhostUntilInput := false
 	// cached ghost suggestion (history-based)
 	ghostCache := ""
-	// minimal ANSI styling support. Ghost = dim; highlight = also dim per request.
-	const ansiDim = "\x1b[2m"
-	const ansiReset = "\x1b[0m"
-	const ansiGhost = ansiDim
-	pendingRefresh := false
-
-	// Best history suggestion for the current full-line prefix
-	bestHistorySuggestion := func(prefix string) string {
+	// held while the background refresh is re-patching state after a file change
+	var refreshing refreshGate
+	meta.refreshing = &refreshing
+
+	// Best history suggestion for the current full-line prefix, with the
+	// number of distinct history entries sharing that prefix
+	bestHistorySuggestion := func(prefix string) (string, int) {
 		if len(history) == 0 {
-			return ""
+			return "", 0
 		}
 		// Only suggest when cursor is at end of line to avoid mid-line confusion
 		if cursor != len(buf) {
-			return ""
+			return "", 0
 		}
 		if strings.TrimSpace(prefix) == "" {
-			return ""
+			return "", 0
 		}
-		// Scan MRU (latest first)
-		for i := len(history) - 1; i >= 0; i-- {
-			h := history[i]
-			if strings.HasPrefix(h, prefix) && h != prefix {
-				return h[len(prefix):]
-			}
+		matches := historyMatches(history, prefix)
+		if len(matches) == 0 {
+			return "", 0
 		}
-		return ""
+		return matches[0][len(prefix):], len(matches)
 	}
 
 	// History candidates are no longer merged into TAB completion. We keep only index-based TAB suggestions.
@@ -223,20 +264,24 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 				}
 			}
 		}
+		// A dim count after a history ghost tells how many entries share the line
+		matchCount := ""
 		if !suppressGhostUntilInput && ghost == "" {
-			ghost = bestHistorySuggestion(line)
+			var n int
+			ghost, n = bestHistorySuggestion(line)
+			if n > 1 {
+				matchCount = fmt.Sprintf(" (%d)", n)
+			}
 		}
 		ghostCache = ghost
 		if ghost != "" {
-			writeStdout(ansiGhost)
-			writeStdout(ghost)
-			writeStdout(ansiReset)
+			writeStdout(paint(activeTheme.ghost, ghost+matchCount))
 		}
 		// Move cursor back over any ghost and the tail from mid-line edits
 		// First account for ghost length if cursor is not at end
 		back := 0
 		if ghost != "" {
-			back += len(ghost)
+			back += len(ghost) + len(matchCount)
 		}
 		tail := len(buf) - cursor
 		back += tail
@@ -244,7 +289,7 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 			writeStdout(fmt.Sprintf("\x1b[%dD", back))
 		}
 		// Update visual rows for this render (single-line case)
-		lastVisualRows = visualRowsFor(line, ghost)
+		lastVisualRows = visualRowsFor(line, ghost+matchCount)
 	}
 
 	// Helper: clear any printed suggestion list below the prompt
@@ -288,12 +333,14 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 			colW = 10
 		}
 		cols := w / colW
-		var rows int
+		var gridRows int
 		if cols <= 1 {
-			rows = len(cands)
+			gridRows = len(cands)
 		} else {
-			rows = (len(cands) + cols - 1) / cols
+			gridRows = (len(cands) + cols - 1) / cols
 		}
+		// The first overlay line is a header with the number of matches
+		rows := gridRows + 1
 		// Ensure there are dedicated overlay lines below the prompt.
 		// If this is the first draw, allocate `rows` new lines so we don't overwrite prior output.
 		if prevRows == 0 {
@@ -324,20 +371,20 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 		for r := 0; r < total; r++ {
 			// Clear line
 			writeStdout("\r\x1b[2K")
-			if r < rows {
-				// Compose row r
+			if r == 0 {
+				writeStdout(paint(activeTheme.ghost, matchCountHeader(len(cands))))
+			} else if r < rows {
+				// Compose grid row r-1
 				for c := 0; c < cols; c++ {
-					idx := r + c*rows
+					idx := r - 1 + c*gridRows
 					if idx >= len(cands) {
 						break
 					}
 					s := cands[idx]
-					if idx != selected {
-						writeStdout(ansiGhost)
-					}
-					writeStdout(s)
-					if idx != selected {
-						writeStdout(ansiReset)
+					if idx == selected {
+						writeStdout(paint(activeTheme.selected, s))
+					} else {
+						writeStdout(paint(activeTheme.ghost, s))
 					}
 					if c < cols-1 {
 						if sp := colW - len(s); sp > 0 {
@@ -355,34 +402,29 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 		return rows
 	}
 
-	// completion logic inlined in TAB handler
-
-	readKey := make([]byte, 1024) // read chunks; handle ESC sequences and bracketed paste within chunk
-
-	// Ensure newlines render correctly in raw TTY: map lone \n to \r\n
-	normalizeTTYNewlines := func(s string) string {
-		if s == "" {
-			return s
-		}
-		var b strings.Builder
-		b.Grow(len(s) + len(s)/8)
-		prev := byte(0)
-		for i := 0; i < len(s); i++ {
-			ch := s[i]
-			if ch == '\n' {
-				if prev != '\r' {
-					b.WriteString("\r\n")
-				} else {
-					b.WriteByte('\n')
-				}
-			} else {
-				b.WriteByte(ch)
-			}
-			prev = ch
+	// Draw the TAB cycle's candidate list unless we're at attribute level
+	// (type.name.attr*), where the list should be hidden
+	showTabCandidates := func() {
+		if len(lastTabCands) == 0 {
+			return
+		}
+		sel := lastTabCands[lastTabIdx]
+		if strings.Count(sel, ".") >= 2 {
+			clearSuggestionList()
+		} else if len(lastTabCands) > 1 {
+			// Draw suggestions on a virtual overlay line without moving the prompt
+			lastTabListRows = printCandidatesOverwrite(lastTabCands, lastTabIdx, lastTabListRows)
 		}
-		return b.String()
 	}
 
+	// completion logic inlined in TAB handler
+
+	// Chunks are read through keys so Ctrl+C can interrupt an evaluation; ESC
+	// sequences and bracketed paste are handled within a chunk
+	keys := newTTYReader()
+	defer keys.close()
+	var readKey, typeahead []byte
+
 	// Enable bracketed paste mode (widely supported) so multiline pastes are bracketed
 	// Start: ESC[200~ , End: ESC[201~
 	writeStdout("\x1b[?2004h")
@@ -392,15 +434,30 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 	refreshNotify := make(chan struct{}, 1)
 	lastScan := time.Now()
 	go func() {
-		for range refreshCh {
-			pendingRefresh = true
+		for {
+			var changedPaths []string
+			select {
+			case paths, ok := <-refreshCh:
+				if !ok {
+					return
+				}
+				changedPaths = paths
+			case <-terraform.RegistryModuleFetched():
+				// A registry module finished downloading; only completion changes
+				if newIdx, err := terraform.BuildSymbolIndex(cwd); err == nil {
+					index = newIdx
+				}
+				continue
+			}
+			refreshing.start()
 			changedTFOnly := false
-			// Sync project files to scratch and re-init (no backend file)
+			// Sync project files to scratch and re-init (no backend file); only the
+			// paths reported by the watcher are checked when available
 			if cwd != "" && scratchDir != "" {
-				changed, changedTF, _ := terraform.SyncToScratch(cwd, scratchDir)
+				changed, changedTF, _ := terraform.SyncPathsToScratch(cwd, scratchDir, changedPaths)
 				if !changed {
 					// Nothing to do
-					pendingRefresh = false
+					refreshing.finish()
 					continue
 				}
 				// Track whether only tfvars/json changed (no .tf)
@@ -408,27 +465,32 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 				// Fast-path: literal-only patch is instant
 				statePath := filepath.Join(scratchDir, "terraform.tfstate")
 				_ = terraform.PatchStateFromConfigLiterals(scratchDir, statePath)
-				// Target only files changed since last scan for non-literals
-				changedFiles := []string{}
-				if err := filepath.Walk(scratchDir, func(p string, info os.FileInfo, err error) error {
-					if err != nil || info.IsDir() {
-						return nil
-					}
-					if strings.ToLower(filepath.Ext(p)) != ".tf" {
+				// Target the files reported by the watcher for non-literals; without
+				// paths (full sync), fall back to files modified since the last scan
+				changedFiles := scratchTFPaths(cwd, scratchDir, changedPaths)
+				if len(changedPaths) == 0 {
+					if err := filepath.Walk(scratchDir, func(p string, info os.FileInfo, err error) error {
+						if err != nil || info.IsDir() {
+							return nil
+						}
+						if strings.ToLower(filepath.Ext(p)) != ".tf" {
+							return nil
+						}
+						if info.ModTime().After(lastScan) {
+							changedFiles = append(changedFiles, p)
+						}
 						return nil
+					}); err != nil {
+						writeStderr(fmt.Sprintf("walk scratch error: %v", err))
 					}
-					if info.ModTime().After(lastScan) {
-						changedFiles = append(changedFiles, p)
-					}
-					return nil
-				}); err != nil {
-					writeStderr(fmt.Sprintf("walk scratch error: %v", err))
 				}
 				if len(changedFiles) > 0 {
 					// For each changed resource block/attribute, run the exact same targeted logic
 					// by calling the exact attribute patch for type+name+attr
-					_ = terraform.PatchTargetedExactByFiles(scratchDir, scratchDir, statePath, varFiles, changedFiles)
+					_ = terraform.PatchTargetedExactByFiles(scratchDir, scratchDir, statePath, meta.currentVarFiles(), changedFiles)
 				}
+				// Mocks win over values patched from configuration
+				_ = terraform.ApplyMocks(statePath, meta.mocks)
 				lastScan = time.Now()
 			}
 			// Restart console and rebuild index in the background
@@ -441,11 +503,19 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 					index = newIdx
 				}
 			}
+			meta.cache.invalidate()
+			refreshing.finish()
 			// No user-facing banner; just note internally that a refresh occurred
 			refreshNotify <- struct{}{}
 		}
 	}()
 
+	// Commands from -exec run before the first prompt
+	meta.index = index
+	if !runInitialCommands(meta, submitEv, prompt, execs) {
+		return
+	}
+
 	// Initial render
 	render()
 
@@ -453,7 +523,45 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 	go func() {
 		_, _, _ = session.Evaluate("0", 10*time.Second)
 	}()
+	// editExternally opens the buffer in the user's editor with the terminal
+	// restored to its normal mode, then re-enters raw mode and loads the result
+	editExternally := func() {
+		clearSuggestionList()
+		writeStdout("\r\n")
+		editor := editorCommand()
+		if editor == "" {
+			writeStderr(errNoEditor.Error() + "\r\n")
+			lastVisualRows = 0
+			render()
+			return
+		}
+		if restore != nil {
+			restore()
+		}
+		edited, err := editBuffer(editor, string(buf))
+		if t, r, aerr := acquireTTY(); aerr == nil {
+			if tty != nil && t != tty {
+				_ = tty.Close()
+			}
+			tty, restore = t, r
+		}
+		if err != nil {
+			writeStderr(normalizeTTYNewlines(err.Error()) + "\r\n")
+		} else {
+			buf = []rune(edited)
+			cursor = len(buf)
+			histIdx = -1
+		}
+		lastTabCands = nil
+		lastTabIdx = -1
+		ghostCache = ""
+		lastVisualRows = 0
+		render()
+	}
+
 	inPaste := false
+	// set after Ctrl+X while waiting for the Ctrl+E that opens the editor
+	ctrlXPending := false
 	for {
 		select {
 		case <-refreshNotify:
@@ -464,12 +572,16 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 		default:
 		}
 
-		// Read up to the buffer size; process sequentially
-		n, err := tty.Read(readKey)
-		if err != nil || n == 0 {
+		// Keys typed during the last evaluation come first; process sequentially
+		if len(typeahead) > 0 {
+			readKey, typeahead = typeahead, nil
+		} else if chunk, err := keys.read(tty); err != nil || len(chunk) == 0 {
 			writeStdout("\r\n")
 			return
+		} else {
+			readKey = chunk
 		}
+		n := len(readKey)
 		i := 0
 		for i < n {
 			b := readKey[i]
@@ -513,8 +625,40 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 				continue
 			}
 
+			// Ctrl+X Ctrl+E edits the buffer in $EDITOR, like bash
+			if ctrlXPending {
+				ctrlXPending = false
+				if b == 5 {
+					editExternally()
+					i++
+					continue
+				}
+			}
+
 			// Handle CSI (ESC [ X) if fully present in this chunk
 			if b == 27 {
+				// Ctrl/Alt+Right or Alt+f: accept the next word of the ghost at EOL,
+				// otherwise move the cursor forward by one word.
+				if seqLen := wordRightSeqLen(readKey[i:n]); seqLen > 0 {
+					i += seqLen
+					if strings.Contains(string(buf), "\n") {
+						continue
+					}
+					if cursor < len(buf) {
+						cursor = nextWordEnd(buf, cursor)
+					} else if ghostCache != "" {
+						part := nextGhostWord(ghostCache)
+						buf = append(buf, []rune(part)...)
+						cursor = len(buf)
+						// Keep an active TAB selection's token bounds in sync with the insert
+						if lastTabIdx >= 0 {
+							lastTabEnd += len(part)
+						}
+					}
+					clearSuggestionList()
+					render()
+					continue
+				}
 				if i+2 < n && readKey[i+1] == '[' {
 					c := readKey[i+2]
 					switch c {
@@ -704,17 +848,33 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 				render()
 				i++
 				continue
+			case 24: // Ctrl+X, the first key of Ctrl+X Ctrl+E
+				ctrlXPending = true
+				i++
+				continue
 			case 4: // Ctrl+D
 				writeStdout("\r\n[exit]\r\n")
 				return
 			case '\r', '\n':
-				// ENTER should always submit; do not accept suggestions or ghosts here.
+				// A trailing backslash continues the input on a new line
+				if next, ok := continueLine(string(buf)); ok {
+					clearSuggestionList()
+					buf = []rune(next)
+					cursor = len(buf)
+					lastTabCands = nil
+					lastTabIdx = -1
+					ghostCache = ""
+					render()
+					i++
+					continue
+				}
+				// ENTER should otherwise always submit; do not accept suggestions or ghosts here.
 				// Submit line
 				line := string(buf)
 				// Clear overlay before printing a new line
 				clearSuggestionList()
 				writeStdout("\r\n")
-				normalized := normalizeInputForEval(line)
+				normalized := submittedExpr(line)
 				if strings.TrimSpace(normalized) != "" {
 					if normalized == "exit" || normalized == "quit" {
 						return
@@ -728,30 +888,32 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 						if historyFile != nil {
 							_, _ = historyFile.WriteString(hist + "\n")
 						}
+						if globalHistoryFile != nil {
+							_, _ = globalHistoryFile.WriteString(hist + "\n")
+						}
 					}
 					// Always reset navigation
 					histIdx = -1
-					stdout, stderr, evalErr := session.Evaluate(normalized, 15*time.Second)
-					if stdout != "" {
-						writeStdout(normalizeTTYNewlines(stdout))
-						if !strings.HasSuffix(stdout, "\n") && !strings.HasSuffix(stdout, "\r\n") {
-							writeStdout("\r\n")
-						}
-					}
-					if stderr != "" {
-						writeStderr(normalizeTTYNewlines(stderr))
-						if !strings.HasSuffix(stderr, "\n") && !strings.HasSuffix(stderr, "\r\n") {
-							writeStderr("\r\n")
-						}
+					if name, arg, ok := parseMetaCommand(normalized); ok {
+						meta.index = index
+						printMetaResult(runMetaCommand(meta, name, arg))
+						buf = buf[:0]
+						cursor = 0
+						lastTabCands = nil
+						lastTabIdx = -1
+						ghostCache = ""
+						lastVisualRows = 0
+						render()
+						i++
+						continue
 					}
-					if evalErr != nil {
-						msg := evalErr.Error()
-						if msg != "" {
-							writeStderr(normalizeTTYNewlines(msg))
-							if !strings.HasSuffix(msg, "\n") && !strings.HasSuffix(msg, "\r\n") {
-								writeStderr("\r\n")
-							}
-						}
+					// Give an in-flight refresh a moment so results reflect the latest edit
+					stale := !isCommentOnly(line) && !refreshing.wait(3*time.Second)
+					typeahead = append(typeahead, evaluateInterruptible(keys, tty, session, func() {
+						evaluateSubmitted(submitEv, line, normalized, meta.output, meta.timeout)
+					})...)
+					if stale {
+						writeStderr(paint(activeTheme.ghost, "(configuration refresh still in progress; result may reflect the previous state)") + "\r\n")
 					}
 				}
 				buf = buf[:0]
@@ -761,9 +923,6 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 				lastTabIdx = -1
 				// lastTabInput removed
 				ghostCache = ""
-				if pendingRefresh {
-					pendingRefresh = false
-				}
 				// After submitting, avoid clearing printed evaluation output in next render
 				lastVisualRows = 0
 				render()
@@ -901,19 +1060,7 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 					}
 				}
 				// Keep buffer unchanged and only render ghost for all levels
-				sel := lastTabCands[lastTabIdx]
-				_ = sel
-				// keep lastTabInput removed; we now track stability via prefix/suffix containment
-				// Draw list unless we're at attribute level (type.name.attr*), where list should be hidden
-				if len(lastTabCands) > 0 {
-					attrLevel := strings.Count(sel, ".") >= 2
-					if attrLevel {
-						clearSuggestionList()
-					} else if len(lastTabCands) > 1 {
-						// Draw suggestions on a virtual overlay line without moving the prompt
-						lastTabListRows = printCandidatesOverwrite(lastTabCands, lastTabIdx, lastTabListRows)
-					}
-				}
+				showTabCandidates()
 				render()
 				i++
 				continue
@@ -926,9 +1073,30 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 				if b >= 32 && b <= 126 {
 					// insert
 					r := rune(b)
+					atTokenEnd := lastTabIdx >= 0 && byteOffsetOfRuneIndex(string(buf), cursor) == lastTabEnd
 					buf = append(buf[:cursor], append([]rune{r}, buf[cursor:]...)...)
 					cursor++
-					// any edit cancels TAB cycle
+					// Typing at the end of the completed token narrows an
+					// active TAB cycle in place
+					if atTokenEnd && (isWordRune(r) || r == '.') {
+						line := string(buf)
+						if cands, start, end, ok := narrowTabCycle(index, line, byteOffsetOfRuneIndex(line, cursor), lastTabStart); ok {
+							lastTabCands = cands
+							lastTabIdx = 0
+							lastTabStart, lastTabEnd = start, end
+							lastTabPrefix = line[:start]
+							lastTabSuffix = line[end:]
+							if len(cands) == 1 {
+								clearSuggestionList()
+							}
+							showTabCandidates()
+							suppressGhostUntilInput = false
+							render()
+							i++
+							continue
+						}
+					}
+					// any other edit cancels TAB cycle
 					lastTabCands = nil
 					lastTabIdx = -1
 					clearSuggestionList()
@@ -942,6 +1110,42 @@ func RunREPL(session *terraform.ConsoleSession, index *terraform.SymbolIndex, re
 	}
 }
 
+// narrowTabCycle recomputes the candidates of an active TAB cycle after a
+// character was typed at the end of its token, which starts at tokStart. ok is
+// false when nothing matches any more or the token itself changed, in which
+// case the cycle ends.
+func narrowTabCycle(idx *terraform.SymbolIndex, line string, cursor, tokStart int) (cands []string, start, end int, ok bool) {
+	cands, start, end = idx.CompletionCandidates(line, cursor)
+	if len(cands) == 0 || start != tokStart || end != cursor {
+		return nil, 0, 0, false
+	}
+	return cands, start, end, true
+}
+
+// historyMatches returns the distinct history entries that extend prefix,
+// most recent first. The first one is offered as the ghost suggestion.
+func historyMatches(history []string, prefix string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for i := len(history) - 1; i >= 0; i-- {
+		h := history[i]
+		if h == prefix || seen[h] || !strings.HasPrefix(h, prefix) {
+			continue
+		}
+		seen[h] = true
+		out = append(out, h)
+	}
+	return out
+}
+
+// matchCountHeader is the first line of the completion overlay.
+func matchCountHeader(n int) string {
+	if n == 1 {
+		return "1 match"
+	}
+	return fmt.Sprintf("%d matches", n)
+}
+
 func byteOffsetOfRuneIndex(s string, runeIndex int) int {
 	// Since we only insert ASCII runes above, this is safe/simple.
 	if runeIndex < 0 {
@@ -953,6 +1157,75 @@ func byteOffsetOfRuneIndex(s string, runeIndex int) int {
 	return runeIndex
 }
 
+// wordRightSeqLen reports the length of a word-forward key sequence at the start
+// of b: Alt+Right (ESC[1;3C), Ctrl+Right (ESC[1;5C), Meta+Right (ESC[1;9C) or
+// readline's Alt+f (ESC f). It returns 0 when b does not start with one.
+func wordRightSeqLen(b []byte) int {
+	if len(b) >= 6 && b[0] == 27 && b[1] == '[' && b[2] == '1' && b[3] == ';' && (b[4] == '3' || b[4] == '5' || b[4] == '9') && b[5] == 'C' {
+		return 6
+	}
+	if len(b) >= 2 && b[0] == 27 && b[1] == 'f' {
+		return 2
+	}
+	return 0
+}
+
+func isWordRune(r rune) bool {
+	return (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_'
+}
+
+// nextGhostWord returns the part of a ghost suggestion up to the next word
+// boundary, mirroring fish/zsh autosuggestions: leading separators plus one run
+// of identifier characters. A directly following "(" is included so function
+// ghosts like "substr(" are accepted in one step.
+func nextGhostWord(ghost string) string {
+	r := []rune(ghost)
+	i := 0
+	for i < len(r) && !isWordRune(r[i]) {
+		i++
+	}
+	for i < len(r) && isWordRune(r[i]) {
+		i++
+	}
+	if i < len(r) && r[i] == '(' {
+		i++
+	}
+	return string(r[:i])
+}
+
+// nextWordEnd returns the cursor position after the next word in buf starting at cursor.
+func nextWordEnd(buf []rune, cursor int) int {
+	i := cursor
+	for i < len(buf) && !isWordRune(buf[i]) {
+		i++
+	}
+	for i < len(buf) && isWordRune(buf[i]) {
+		i++
+	}
+	return i
+}
+
+// continueLine reports whether the last line of buf ends with a backslash,
+// which asks for another line instead of submitting. It returns buf with the
+// backslash replaced by a line break, so the input is rendered and normalized
+// like a pasted multiline expression.
+func continueLine(buf string) (string, bool) {
+	trimmed := strings.TrimRight(buf, " \t")
+	if !strings.HasSuffix(trimmed, "\\") {
+		return buf, false
+	}
+	return strings.TrimRight(strings.TrimSuffix(trimmed, "\\"), " \t") + "\n", true
+}
+
+// submittedExpr turns a submitted buffer into the single-line expression sent
+// for evaluation. Missing commas between the lines of a multiline collection
+// are inserted before flattening, since the line breaks that separated the
+// items are lost afterwards; this also covers input whose paste did not end
+// with a bracketed-paste marker or was edited after pasting.
+func submittedExpr(line string) string {
+	return unwrapBareTemplate(normalizeInputForEval(NormalizeCommasInMultiline(line)))
+}
+
 // normalizeInputForEval replaces CR, LF, and TAB with spaces and trims edges.
 func normalizeInputForEval(s string) string {
 	if s == "" {
@@ -964,3 +1237,473 @@ func normalizeInputForEval(s string) string {
 	s = strings.ReplaceAll(s, "\t", " ")
 	return strings.TrimSpace(s)
 }
+
+// unwrapBareTemplate rewrites input that starts with an unquoted "${", which is
+// not a valid expression on its own, into what was meant: a lone interpolation
+// such as ${var.env} becomes var.env, and a template such as ${var.env}-app is
+// quoted. Anything else, including quoted templates, is returned unchanged.
+func unwrapBareTemplate(s string) string {
+	if !strings.HasPrefix(s, "${") {
+		return s
+	}
+	expr, diags := hclsyntax.ParseTemplate([]byte(s), "<input>", hcl.InitialPos)
+	if diags.HasErrors() {
+		return s
+	}
+	switch e := expr.(type) {
+	case *hclsyntax.TemplateWrapExpr:
+		r := e.Wrapped.Range()
+		return strings.TrimSpace(s[r.Start.Byte:r.End.Byte])
+	case *hclsyntax.TemplateExpr:
+		for _, part := range e.Parts {
+			// Literal quotes or backslashes would need escaping; leave those alone
+			if lit, ok := part.(*hclsyntax.LiteralValueExpr); ok {
+				r := lit.Range()
+				if strings.ContainsAny(s[r.Start.Byte:r.End.Byte], "\"\\") {
+					return s
+				}
+			}
+		}
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// scratchTFPaths maps watcher-reported paths under srcDir to their .tf copies in
+// scratchDir, dropping files that no longer exist there.
+func scratchTFPaths(srcDir, scratchDir string, paths []string) []string {
+	absSrc, _ := filepath.Abs(srcDir)
+	var out []string
+	for _, p := range paths {
+		if strings.ToLower(filepath.Ext(p)) != ".tf" {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(absSrc, p)
+		}
+		rel, err := filepath.Rel(absSrc, p)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		dst := filepath.Join(scratchDir, rel)
+		if _, err := os.Stat(dst); err == nil {
+			out = append(out, dst)
+		}
+	}
+	return out
+}
+
+// lineEvaluator is the part of terraform.ConsoleSession used to evaluate submitted input.
+type lineEvaluator interface {
+	Evaluate(line string, timeout time.Duration) (string, string, error)
+}
+
+// streamEvaluator is implemented by evaluators that can write stdout to w
+// while the evaluation runs, like terraform.ConsoleSession. They still return
+// the full stdout.
+type streamEvaluator interface {
+	EvaluateStream(line string, timeout time.Duration, w io.Writer) (string, string, error)
+}
+
+// evaluateStream evaluates line with ev, streaming its stdout to w when ev
+// supports it and writing it once evaluation finished otherwise.
+func evaluateStream(ev lineEvaluator, line string, timeout time.Duration, w io.Writer) (string, string, error) {
+	if se, ok := ev.(streamEvaluator); ok {
+		return se.EvaluateStream(line, timeout, w)
+	}
+	stdout, stderr, err := ev.Evaluate(line, timeout)
+	if stdout != "" {
+		_, _ = io.WriteString(w, stdout)
+	}
+	return stdout, stderr, err
+}
+
+// runInitialCommands submits cmds in order, echoing each after the prompt the
+// way it would appear had it been typed. It returns false when one of them is
+// exit or quit, which ends the session before the first prompt.
+func runInitialCommands(meta *metaContext, ev lineEvaluator, prompt string, cmds []string) bool {
+	for _, cmd := range cmds {
+		normalized := submittedExpr(cmd)
+		if strings.TrimSpace(normalized) == "" {
+			continue
+		}
+		if normalized == "exit" || normalized == "quit" {
+			return false
+		}
+		writeStdout(prompt + normalizeTTYNewlines(cmd) + "\r\n")
+		if name, arg, ok := parseMetaCommand(normalized); ok {
+			printMetaResult(runMetaCommand(meta, name, arg))
+			continue
+		}
+		evaluateSubmitted(ev, cmd, normalized, meta.output, meta.timeout)
+	}
+	return true
+}
+
+// printMetaResult prints the message and error of a meta-command.
+func printMetaResult(msg string, err error) {
+	if msg != "" {
+		writeStdout(normalizeTTYNewlines(msg) + "\r\n")
+	}
+	if err != nil {
+		writeStderr(normalizeTTYNewlines(err.Error()) + "\r\n")
+	}
+}
+
+// evaluateSubmitted evaluates a submitted line and mirrors Terraform's output.
+// Input consisting only of comments and whitespace is skipped without spawning
+// terraform, which would otherwise fail on an empty expression. mode selects
+// the optional echo of the evaluated expression and compacted results; timeout
+// bounds the evaluation.
+func evaluateSubmitted(ev lineEvaluator, raw, normalized string, mode outputMode, timeout time.Duration) {
+	if isCommentOnly(raw) {
+		return
+	}
+	if mode.echo {
+		writeStdout(paint(activeTheme.ghost, normalized) + "\r\n")
+	}
+	var stdout, stderr string
+	var evalErr error
+	if mode.compact {
+		stdout, stderr, evalErr = ev.Evaluate(normalized, timeout)
+		if strings.Contains(strings.TrimRight(stdout, "\r\n"), "\n") {
+			stdout = compactResult(stdout) + "\n"
+		}
+		writeStdout(normalizeTTYNewlines(stdout))
+	} else {
+		// Results are printed as terraform writes them, so large ones appear
+		// progressively instead of all at once when evaluation ends
+		stdout, stderr, evalErr = evaluateStream(ev, normalized, timeout, &ttyWriter{})
+	}
+	if stdout != "" && !strings.HasSuffix(stdout, "\n") && !strings.HasSuffix(stdout, "\r\n") {
+		writeStdout("\r\n")
+	}
+	if stderr != "" {
+		writeStderr(paint(activeTheme.err, normalizeTTYNewlines(stderr)))
+		if !strings.HasSuffix(stderr, "\n") && !strings.HasSuffix(stderr, "\r\n") {
+			writeStderr("\r\n")
+		}
+	}
+	if evalErr != nil {
+		msg := evalErr.Error()
+		if msg != "" {
+			writeStderr(paint(activeTheme.err, normalizeTTYNewlines(msg)))
+			if !strings.HasSuffix(msg, "\n") && !strings.HasSuffix(msg, "\r\n") {
+				writeStderr("\r\n")
+			}
+		}
+	}
+}
+
+// compactResult collapses a multi-line result, as terraform console prints
+// it, onto one line that still parses as HCL: object attributes are separated
+// by commas, trailing commas are dropped and heredocs become quoted strings.
+// Output it cannot lex is joined by NormalizeMultilineForHistory instead.
+func compactResult(out string) string {
+	src := []byte(strings.TrimRight(strings.ReplaceAll(out, "\r\n", "\n"), "\n"))
+	toks, diags := hclsyntax.LexConfig(src, "<result>", hcl.InitialPos)
+	if diags.HasErrors() {
+		return NormalizeMultilineForHistory(out)
+	}
+	// nextSignificant returns the type of the first token after i that is not
+	// a newline
+	nextSignificant := func(i int) hclsyntax.TokenType {
+		for j := i + 1; j < len(toks); j++ {
+			if toks[j].Type != hclsyntax.TokenNewline {
+				return toks[j].Type
+			}
+		}
+		return hclsyntax.TokenEOF
+	}
+	var b strings.Builder
+	var open []hclsyntax.TokenType
+	var prev hclsyntax.TokenType
+	prevEnd, emitted, newline := 0, false, false
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		switch tok.Type {
+		case hclsyntax.TokenNewline:
+			newline = true
+			continue
+		case hclsyntax.TokenEOF:
+			continue
+		case hclsyntax.TokenComma:
+			if next := nextSignificant(i); next == hclsyntax.TokenCBrack || next == hclsyntax.TokenCBrace || next == hclsyntax.TokenCParen {
+				continue
+			}
+		}
+		closing := tok.Type == hclsyntax.TokenCBrace || tok.Type == hclsyntax.TokenCBrack || tok.Type == hclsyntax.TokenCParen
+		switch {
+		case !emitted:
+		case !newline:
+			// Spacing within a line is kept as printed
+			b.Write(src[prevEnd:tok.Range.Start.Byte])
+		case prev == hclsyntax.TokenOBrace || prev == hclsyntax.TokenOBrack || prev == hclsyntax.TokenOParen || closing:
+		case prev != hclsyntax.TokenComma && len(open) > 0 && open[len(open)-1] == hclsyntax.TokenOBrace:
+			b.WriteString(", ")
+		default:
+			b.WriteString(" ")
+		}
+		switch tok.Type {
+		case hclsyntax.TokenOBrace, hclsyntax.TokenOBrack, hclsyntax.TokenOParen:
+			open = append(open, tok.Type)
+		case hclsyntax.TokenCBrace, hclsyntax.TokenCBrack, hclsyntax.TokenCParen:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+		if tok.Type == hclsyntax.TokenOHeredoc {
+			var lines []string
+			j := i + 1
+			for ; j < len(toks) && toks[j].Type != hclsyntax.TokenCHeredoc; j++ {
+				lines = append(lines, strings.TrimSuffix(string(toks[j].Bytes), "\n"))
+			}
+			if j == len(toks) {
+				return NormalizeMultilineForHistory(out)
+			}
+			if strings.HasPrefix(string(tok.Bytes), "<<-") {
+				lines = trimCommonIndent(lines)
+			}
+			b.WriteString(quoteHCLString(strings.Join(lines, "\n") + "\n"))
+			i = j
+			tok = toks[j]
+		} else {
+			b.Write(tok.Bytes)
+		}
+		prev, prevEnd, emitted, newline = tok.Type, tok.Range.End.Byte, true, false
+	}
+	return b.String()
+}
+
+// trimCommonIndent removes the leading whitespace all non-blank lines share,
+// as a flush heredoc does.
+func trimCommonIndent(lines []string) []string {
+	indent := -1
+	for _, ln := range lines {
+		if strings.TrimSpace(ln) == "" {
+			continue
+		}
+		if n := len(ln) - len(strings.TrimLeft(ln, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	out := make([]string, len(lines))
+	for i, ln := range lines {
+		if strings.TrimSpace(ln) == "" {
+			ln = ""
+		} else if indent > 0 {
+			ln = ln[indent:]
+		}
+		out[i] = ln
+	}
+	return out
+}
+
+// quoteHCLString returns s as a quoted HCL string. Template sequences are left
+// as they are, since terraform console already escapes them in heredocs.
+func quoteHCLString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// isCommentOnly reports whether src contains nothing but HCL comments
+// (#, // or /* */) and whitespace.
+func isCommentOnly(src string) bool {
+	toks, _ := hclsyntax.LexConfig([]byte(src), "<input>", hcl.InitialPos)
+	for _, tok := range toks {
+		switch tok.Type {
+		case hclsyntax.TokenComment, hclsyntax.TokenNewline, hclsyntax.TokenEOF:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeTTYNewlines ensures newlines render correctly in raw TTY: map lone \n to \r\n.
+func normalizeTTYNewlines(s string) string {
+	if s == "" {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + len(s)/8)
+	prev := byte(0)
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch == '\n' {
+			if prev != '\r' {
+				b.WriteString("\r\n")
+			} else {
+				b.WriteByte('\n')
+			}
+		} else {
+			b.WriteByte(ch)
+		}
+		prev = ch
+	}
+	return b.String()
+}
+
+// ttyWriter writes to stdout with normalizeTTYNewlines applied across writes,
+// so a "\r\n" split between two writes is kept intact.
+type ttyWriter struct {
+	prev byte
+}
+
+func (t *ttyWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	var b strings.Builder
+	b.Grow(len(p) + len(p)/8)
+	for _, ch := range p {
+		if ch == '\n' && t.prev != '\r' {
+			b.WriteByte('\r')
+		}
+		b.WriteByte(ch)
+		t.prev = ch
+	}
+	writeStdout(b.String())
+	return len(p), nil
+}
+
+// refreshGate lets evaluations wait for a running background refresh; waiters
+// are woken when it finishes rather than polling for it. Holders exclude each
+// other, so state rebuilds by meta-commands and refreshes do not interleave.
+type refreshGate struct {
+	held sync.Mutex // taken by start, released by finish
+	mu   sync.Mutex
+	done chan struct{} // nil while idle, closed when the running refresh ends
+}
+
+func (g *refreshGate) start() {
+	g.held.Lock()
+	g.mu.Lock()
+	g.done = make(chan struct{})
+	g.mu.Unlock()
+}
+
+func (g *refreshGate) finish() {
+	g.mu.Lock()
+	close(g.done)
+	g.done = nil
+	g.mu.Unlock()
+	g.held.Unlock()
+}
+
+// wait blocks until no refresh is running or timeout elapses, reporting
+// whether the refresh finished.
+func (g *refreshGate) wait(timeout time.Duration) bool {
+	g.mu.Lock()
+	done := g.done
+	g.mu.Unlock()
+	if done == nil {
+		return true
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// ttyReader reads the terminal from a goroutine, one read per request, so keys
+// can be watched while an evaluation runs. A read still pending when the
+// evaluation ends is cancelled, so nothing reads the terminal while an editor
+// launched from the typed keys owns it, or after it was closed.
+type ttyReader struct {
+	req     chan *os.File
+	res     chan ttyChunk
+	pending bool
+}
+
+type ttyChunk struct {
+	b   []byte
+	err error
+}
+
+func newTTYReader() *ttyReader {
+	r := &ttyReader{req: make(chan *os.File), res: make(chan ttyChunk, 1)}
+	go func() {
+		buf := make([]byte, 1024)
+		for f := range r.req {
+			n, err := f.Read(buf)
+			r.res <- ttyChunk{append([]byte(nil), buf[:n]...), err}
+		}
+	}()
+	return r
+}
+
+// start requests a read of f unless one is pending.
+func (r *ttyReader) start(f *os.File) {
+	if !r.pending {
+		r.req <- f
+		r.pending = true
+	}
+}
+
+// read returns the next chunk read from f.
+func (r *ttyReader) read(f *os.File) ([]byte, error) {
+	r.start(f)
+	c := <-r.res
+	r.pending = false
+	return c.b, c.err
+}
+
+// cancel ends the pending read of f, if any, and returns what it read. It
+// fails when f does not support read deadlines.
+func (r *ttyReader) cancel(f *os.File) ([]byte, error) {
+	if !r.pending {
+		return nil, nil
+	}
+	if err := f.SetReadDeadline(time.Now()); err != nil {
+		return nil, err
+	}
+	c := <-r.res
+	r.pending = false
+	return c.b, f.SetReadDeadline(time.Time{})
+}
+
+func (r *ttyReader) close() { close(r.req) }
+
+// evaluateInterruptible runs evaluate while reading keys from f. Ctrl+C
+// interrupts it through session and, as at the prompt, discards what was
+// typed before; the other keys are returned to be handled once it finished.
+// Terminals without read deadlines are not read, since a read could not be
+// cancelled when the evaluation ends.
+func evaluateInterruptible(keys *ttyReader, f *os.File, session interface{ Interrupt() }, evaluate func()) []byte {
+	if f.SetReadDeadline(time.Time{}) != nil {
+		evaluate()
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		evaluate()
+	}()
+	var typed []byte
+	for {
+		keys.start(f)
+		select {
+		case <-done:
+			b, _ := keys.cancel(f)
+			return append(typed, b...)
+		case c := <-keys.res:
+			keys.pending = false
+			if c.err != nil || len(c.b) == 0 {
+				// Leave the end of input to the input loop's next read
+				<-done
+				return typed
+			}
+			if i := bytes.LastIndexByte(c.b, 3); i >= 0 {
+				session.Interrupt()
+				typed = append(typed[:0], c.b[i+1:]...)
+				continue
+			}
+			typed = append(typed, c.b...)
+		}
+	}
+}
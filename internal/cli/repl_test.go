@@ -0,0 +1,449 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+func TestNextGhostWord_PartialAcceptance(t *testing.T) {
+	ghost := `.web.tags["Name"]`
+	var accepted []string
+	for ghost != "" {
+		part := nextGhostWord(ghost)
+		if part == "" {
+			t.Fatalf("no progress on ghost %q", ghost)
+		}
+		accepted = append(accepted, part)
+		ghost = ghost[len(part):]
+	}
+	want := []string{".web", ".tags", `["Name`, `"]`}
+	if len(accepted) != len(want) {
+		t.Fatalf("got %q, want %q", accepted, want)
+	}
+	for i := range want {
+		if accepted[i] != want[i] {
+			t.Fatalf("step %d: got %q, want %q", i, accepted[i], want[i])
+		}
+	}
+	// Function ghosts are accepted through the opening parenthesis
+	if got := nextGhostWord("str(var.x, 0, 1)"); got != "str(" {
+		t.Fatalf("function ghost: got %q", got)
+	}
+	if got := nextGhostWord("("); got != "(" {
+		t.Fatalf("bare paren ghost: got %q", got)
+	}
+}
+
+func TestHistoryMatches_CountsDistinctEntries(t *testing.T) {
+	history := []string{
+		"var.region",
+		"var.name",
+		"upper(var.name)",
+		"var.names[0]",
+		"var.name",
+		"var.",
+	}
+	got := historyMatches(history, "var.")
+	want := []string{"var.name", "var.names[0]", "var.region"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := historyMatches(history, "upper("); len(got) != 1 {
+		t.Fatalf("single match: got %q", got)
+	}
+	if got := historyMatches(history, "var.name"); !reflect.DeepEqual(got, []string{"var.names[0]"}) {
+		t.Fatalf("an entry equal to the line is no match: got %q", got)
+	}
+}
+
+func TestWordRightSeqLen(t *testing.T) {
+	cases := map[string]int{
+		"\x1b[1;5C":  6,
+		"\x1b[1;3Cx": 6,
+		"\x1bf":      2,
+		"\x1b[C":     0,
+		"\x1b[1;2C":  0,
+		"f":          0,
+	}
+	for in, want := range cases {
+		if got := wordRightSeqLen([]byte(in)); got != want {
+			t.Fatalf("%q: got %d, want %d", in, got, want)
+		}
+	}
+}
+
+type recordingEvaluator struct {
+	calls    []string
+	timeouts []time.Duration
+	stdout   string
+	stderr   string
+}
+
+func (r *recordingEvaluator) Evaluate(line string, timeout time.Duration) (string, string, error) {
+	r.calls = append(r.calls, line)
+	r.timeouts = append(r.timeouts, timeout)
+	return r.stdout, r.stderr, nil
+}
+
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = orig
+	_ = w.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestEvaluateSubmitted_SkipsCommentOnlyInput(t *testing.T) {
+	ev := &recordingEvaluator{}
+	for _, in := range []string{"# hi", "// note", "/* block */", "# a\n  // b\n"} {
+		evaluateSubmitted(ev, in, normalizeInputForEval(in), outputMode{}, defaultEvalTimeout)
+	}
+	if len(ev.calls) != 0 {
+		t.Fatalf("expected no evaluation for comment-only input, got %q", ev.calls)
+	}
+	evaluateSubmitted(ev, `"#" # trailing`, normalizeInputForEval(`"#" # trailing`), outputMode{}, defaultEvalTimeout)
+	if len(ev.calls) != 1 {
+		t.Fatalf("expected expression with trailing comment to be evaluated, got %q", ev.calls)
+	}
+}
+
+func TestEvaluateSubmitted_CompactMode(t *testing.T) {
+	ev := &recordingEvaluator{stdout: "{\n  \"name\" = \"web\"\n  \"ports\" = [\n    80,\n    443,\n  ]\n}\n"}
+	got := captureStdout(t, func() { evaluateSubmitted(ev, "local.svc", "local.svc", outputMode{compact: true}, defaultEvalTimeout) })
+	want := "{\"name\" = \"web\", \"ports\" = [80, 443]}\r\n"
+	if got != want {
+		t.Fatalf("compact: got %q, want %q", got, want)
+	}
+	got = captureStdout(t, func() { evaluateSubmitted(ev, "local.svc", "local.svc", outputMode{}, defaultEvalTimeout) })
+	if got != normalizeTTYNewlines(ev.stdout) {
+		t.Fatalf("default output changed: got %q", got)
+	}
+}
+
+func TestCompactResult(t *testing.T) {
+	cases := map[string]string{
+		"[\n  {\n    \"a\" = 1\n    \"b\" = tolist([\n      \"x\",\n    ])\n  },\n  {},\n]\n": `[{"a" = 1, "b" = tolist(["x"])}, {}]`,
+		"{\n  \"script\" = <<-EOT\n  echo \"hi\"\n    done\n  EOT\n  \"n\" = null\n}\n":       `{"script" = "echo \"hi\"\n  done\n", "n" = null}`,
+		"tomap({\n  \"k\" = (sensitive value)\n})\n":                                          `tomap({"k" = (sensitive value)})`,
+	}
+	for in, want := range cases {
+		got := compactResult(in)
+		if got != want {
+			t.Errorf("compactResult(%q) = %q, want %q", in, got, want)
+		}
+		if !strings.Contains(want, "sensitive") {
+			if _, diags := hclsyntax.ParseExpression([]byte(got), "<result>", hcl.InitialPos); diags.HasErrors() {
+				t.Errorf("%q does not parse: %s", got, diags.Error())
+			}
+		}
+	}
+}
+
+func TestScratchTFPaths(t *testing.T) {
+	src, scratch := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(scratch, "mod"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(scratch, "mod", "main.tf"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{
+		filepath.Join(src, "mod", "main.tf"),
+		filepath.Join(src, "gone.tf"),
+		filepath.Join(src, "terraform.tfvars"),
+	}
+	got := scratchTFPaths(src, scratch, paths)
+	want := filepath.Join(scratch, "mod", "main.tf")
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("got %v, want [%s]", got, want)
+	}
+}
+
+func TestUnwrapBareTemplate(t *testing.T) {
+	cases := map[string]string{
+		`"${var.env}-app"`:        `"${var.env}-app"`,
+		`${var.env}`:              `var.env`,
+		`${ upper(var.env) }`:     `upper(var.env)`,
+		`${var.env}-app`:          `"${var.env}-app"`,
+		`${var.a}${var.b}`:        `"${var.a}${var.b}"`,
+		`${var.env}-"quoted"`:     `${var.env}-"quoted"`,
+		`var.env`:                 `var.env`,
+		`{ a = "${var.env}" }`:    `{ a = "${var.env}" }`,
+		`${var.env`:               `${var.env`,
+		`${lookup(var.m, "k")}`:   `lookup(var.m, "k")`,
+		`${var.env}-${var.team}`:  `"${var.env}-${var.team}"`,
+		`"${var.env}"`:            `"${var.env}"`,
+		`${jsonencode({a = 1})}x`: `"${jsonencode({a = 1})}x"`,
+	}
+	for in, want := range cases {
+		if got := unwrapBareTemplate(in); got != want {
+			t.Fatalf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestEvaluateSubmitted_EchoesNormalizedInput(t *testing.T) {
+	ev := &recordingEvaluator{stdout: "{\n  \"a\" = 1\n}\n"}
+	raw := NormalizeCommasInMultiline("{\n  a = 1\n  b = [\n    \"x\"\n  ]\n}")
+	normalized := normalizeInputForEval(raw)
+	got := captureStdout(t, func() { evaluateSubmitted(ev, raw, normalized, outputMode{echo: true}, defaultEvalTimeout) })
+	echoed, _, _ := strings.Cut(got, "\r\n")
+	if echoed != ansiDim+normalized+ansiReset {
+		t.Fatalf("echoed %q, want %q", echoed, normalized)
+	}
+	if len(ev.calls) != 1 || ev.calls[0] != normalized {
+		t.Fatalf("evaluated %q, want %q", ev.calls, normalized)
+	}
+	if got := captureStdout(t, func() { evaluateSubmitted(ev, raw, normalized, outputMode{}, defaultEvalTimeout) }); strings.Contains(got, normalized) {
+		t.Fatalf("echo should be off by default, got %q", got)
+	}
+}
+
+func TestRunInitialCommands_PrintsResultsBeforePrompt(t *testing.T) {
+	ev := &recordingEvaluator{stdout: "\"web\"\n"}
+	meta := &metaContext{timeout: defaultEvalTimeout}
+	var ok bool
+	got := captureStdout(t, func() {
+		ok = runInitialCommands(meta, ev, ">> ", []string{":timeout 7s", "  ", "local.name"})
+	})
+	if !ok {
+		t.Fatal("initial commands ended the session")
+	}
+	want := ">> :timeout 7s\r\n" +
+		"Evaluation timeout is 7s.\r\n" +
+		">> local.name\r\n" +
+		"\"web\"\r\n"
+	if got != want {
+		t.Fatalf("output = %q, want %q", got, want)
+	}
+	// Meta-commands apply to the commands after them
+	if len(ev.calls) != 1 || ev.calls[0] != "local.name" || ev.timeouts[0] != 7*time.Second {
+		t.Fatalf("evaluated %q with %v", ev.calls, ev.timeouts)
+	}
+
+	ev.calls = nil
+	captureStdout(t, func() { ok = runInitialCommands(meta, ev, ">> ", []string{"exit", "local.name"}) })
+	if ok || len(ev.calls) != 0 {
+		t.Fatalf("exit should end the session before evaluating, ok=%v calls=%q", ok, ev.calls)
+	}
+}
+
+func TestSubmittedExpr_PastedMultilineListWithoutCommas(t *testing.T) {
+	pasted := "[\n  \"a\"\n  upper(\"b\")\n  { c = 1\n    d = 2 }\n]"
+	normalized := submittedExpr(pasted)
+	if strings.Contains(normalized, "\n") {
+		t.Fatalf("expected a single line, got %q", normalized)
+	}
+	expr, diags := hclsyntax.ParseExpression([]byte(normalized), "<input>", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("%q does not parse: %s", normalized, diags.Error())
+	}
+	v, diags := expr.Value(&hcl.EvalContext{Functions: map[string]function.Function{"upper": stdlib.UpperFunc}})
+	if diags.HasErrors() {
+		t.Fatalf("%q does not evaluate: %s", normalized, diags.Error())
+	}
+	if n := v.LengthInt(); n != 3 {
+		t.Fatalf("%q evaluated to %d elements, want 3", normalized, n)
+	}
+
+	ev := &recordingEvaluator{stdout: "[\n  \"a\",\n]\n"}
+	captureStdout(t, func() { evaluateSubmitted(ev, pasted, normalized, outputMode{}, defaultEvalTimeout) })
+	if len(ev.calls) != 1 || ev.calls[0] != normalized {
+		t.Fatalf("evaluated %q, want %q", ev.calls, normalized)
+	}
+}
+
+func TestContinueLine_BackslashJoinsLinesIntoOneExpression(t *testing.T) {
+	if _, ok := continueLine(`upper("a")`); ok {
+		t.Fatal("a line without a trailing backslash should submit")
+	}
+	buf, ok := continueLine(`[upper("a") \`)
+	if !ok || buf != "[upper(\"a\")\n" {
+		t.Fatalf("continueLine = %q, %v", buf, ok)
+	}
+	buf += `  upper("b")]`
+	if _, ok := continueLine(buf); ok {
+		t.Fatal("the second line has no trailing backslash and should submit")
+	}
+
+	normalized := submittedExpr(buf)
+	expr, diags := hclsyntax.ParseExpression([]byte(normalized), "<input>", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("%q does not parse: %s", normalized, diags.Error())
+	}
+	v, diags := expr.Value(&hcl.EvalContext{Functions: map[string]function.Function{"upper": stdlib.UpperFunc}})
+	if diags.HasErrors() {
+		t.Fatalf("%q does not evaluate: %s", normalized, diags.Error())
+	}
+	if n := v.LengthInt(); n != 2 {
+		t.Fatalf("%q evaluated to %d elements, want 2", normalized, n)
+	}
+	ev := &recordingEvaluator{stdout: "[\n  \"A\",\n  \"B\",\n]\n"}
+	captureStdout(t, func() { evaluateSubmitted(ev, buf, normalized, outputMode{}, defaultEvalTimeout) })
+	if len(ev.calls) != 1 || ev.calls[0] != normalized {
+		t.Fatalf("evaluated %q, want one call with %q", ev.calls, normalized)
+	}
+}
+
+func TestNarrowTabCycle_TypingFiltersCandidates(t *testing.T) {
+	idx := &terraform.SymbolIndex{
+		Resource:   map[string][]string{"aws_instance": {"web", "worker", "db"}},
+		DataSource: map[string][]string{},
+	}
+	// TAB on "aws_instance." starts a cycle over all instances
+	line := "aws_instance."
+	cands, start, _ := idx.CompletionCandidates(line, len(line))
+	if len(cands) != 3 {
+		t.Fatalf("initial candidates: %v", cands)
+	}
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{"aws_instance.w", []string{"aws_instance.web", "aws_instance.worker"}},
+		{"aws_instance.wo", []string{"aws_instance.worker"}},
+	} {
+		got, s, e, ok := narrowTabCycle(idx, tc.line, len(tc.line), start)
+		if !ok || !reflect.DeepEqual(got, tc.want) || s != start || e != len(tc.line) {
+			t.Fatalf("%q: got %v [%d:%d] ok=%v, want %v", tc.line, got, s, e, ok, tc.want)
+		}
+	}
+	if _, _, _, ok := narrowTabCycle(idx, "aws_instance.x", len("aws_instance.x"), start); ok {
+		t.Fatal("typing past every candidate should end the cycle")
+	}
+	if got := matchCountHeader(2); got != "2 matches" {
+		t.Fatalf("header = %q", got)
+	}
+}
+
+func TestTTYWriter_NormalizesNewlinesAcrossWrites(t *testing.T) {
+	got := captureStdout(t, func() {
+		w := &ttyWriter{}
+		for _, chunk := range []string{"a\n", "b\r", "\nc", "\n"} {
+			_, _ = w.Write([]byte(chunk))
+		}
+	})
+	if got != "a\r\nb\r\nc\r\n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestRefreshGate_WakesWaiters(t *testing.T) {
+	var g refreshGate
+	if !g.wait(0) {
+		t.Fatal("wait without a refresh should return at once")
+	}
+	g.start()
+	if g.wait(10 * time.Millisecond) {
+		t.Fatal("wait should time out while the refresh runs")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		g.finish()
+	}()
+	start := time.Now()
+	if !g.wait(5 * time.Second) {
+		t.Fatal("wait should report the finished refresh")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("waiter woke after %v", d)
+	}
+}
+
+func TestRefreshGate_HoldersExcludeEachOther(t *testing.T) {
+	var g refreshGate
+	g.start()
+	second := make(chan struct{})
+	go func() {
+		g.start()
+		close(second)
+		g.finish()
+	}()
+	select {
+	case <-second:
+		t.Fatal("a second holder started while the first held the gate")
+	case <-time.After(20 * time.Millisecond):
+	}
+	g.finish()
+	select {
+	case <-second:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second holder did not start after finish")
+	}
+}
+
+// interruptFunc adapts a func to the Interrupt method of a session.
+type interruptFunc func()
+
+func (f interruptFunc) Interrupt() { f() }
+
+func TestEvaluateInterruptible_CtrlCInterruptsAndKeepsLaterKeys(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	keys := newTTYReader()
+	defer keys.close()
+
+	interrupted := make(chan struct{})
+	session := interruptFunc(func() { close(interrupted) })
+	typed := evaluateInterruptible(keys, r, session, func() {
+		if _, err := w.WriteString("ab\x03cd"); err != nil {
+			t.Error(err)
+		}
+		select {
+		case <-interrupted:
+		case <-time.After(5 * time.Second):
+			t.Error("Ctrl+C did not interrupt the evaluation")
+		}
+	})
+	if string(typed) != "cd" {
+		t.Fatalf("typed = %q, want the keys after Ctrl+C", typed)
+	}
+
+	// Once the evaluation ended nothing reads the terminal, so an editor
+	// launched from the typed keys gets every key typed after that
+	typed = evaluateInterruptible(keys, r, session, func() { time.Sleep(10 * time.Millisecond) })
+	if keys.pending || len(typed) != 0 {
+		t.Fatalf("pending = %v, typed = %q, want no read left", keys.pending, typed)
+	}
+	if _, err := w.WriteString("x"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	n, err := r.Read(buf)
+	if err != nil || string(buf[:n]) != "x" {
+		t.Fatalf("editor read = %q, %v", buf[:n], err)
+	}
+	if _, err := w.WriteString("y"); err != nil {
+		t.Fatal(err)
+	}
+	chunk, err := keys.read(r)
+	if err != nil || string(chunk) != "y" {
+		t.Fatalf("next read = %q, %v", chunk, err)
+	}
+}
@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// replayOptions holds the flags of the replay command.
+type replayOptions struct {
+	since       *int
+	diffAgainst *string
+	asJSON      *bool
+	varFiles    multiStringFlag
+}
+
+// newReplayFlagSet defines the flags and usage of the replay command.
+func newReplayFlagSet() (*flag.FlagSet, *replayOptions) {
+	opts := &replayOptions{}
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		if _, err := fmt.Fprint(fs.Output(), `Usage: terraflow [global options] replay [options]
+
+  Evaluates the expressions of the console history against the current
+  configuration and state, and prints them as a transcript of
+  "expression => value" lines. Meta-commands are skipped and each
+  expression is replayed once, at its latest position.
+
+Options:
+
+  -diff-against=path    Compare the results with a transcript saved from an
+                        earlier replay, text or -json, and list the
+                        expressions whose result changed, or that it does
+                        not mention, on stderr. Exits with a non-zero
+                        status when any result changed.
+
+  -json                 Print the transcript as a JSON array of objects with
+                        expression, value and error.
+
+  -since=n              Replay only the last n expressions of the history
+                        (default 0, all of them).
+
+  -var-file=path        Set variables in the Terraform configuration from
+                        a file. If "terraform.tfvars" or any ".auto.tfvars"
+                        files are present, they will be automatically loaded.
+`); err != nil {
+			fmt.Fprintln(os.Stderr, "error printing usage:", err)
+		}
+	}
+	opts.since = fs.Int("since", 0, "Replay only the last n expressions (0 for all)")
+	opts.diffAgainst = fs.String("diff-against", "", "Transcript to compare the results with")
+	opts.asJSON = fs.Bool("json", false, "Print the transcript as JSON")
+	fs.Var(&opts.varFiles, "var-file", "Path to a .tfvars file (repeatable).")
+	return fs, opts
+}
+
+// RunReplayCommand implements `terraflow replay`. With -diff-against it returns
+// an error when any result differs from the saved transcript.
+func RunReplayCommand(args []string) error {
+	fs, opts := newReplayFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *opts.since < 0 {
+		return fmt.Errorf("replay: -since must not be negative, got %d", *opts.since)
+	}
+	var saved []savedResult
+	if *opts.diffAgainst != "" {
+		var err error
+		if saved, err = readTranscript(*opts.diffAgainst); err != nil {
+			return err
+		}
+	}
+	cwd, _ := os.Getwd()
+	if err := checkProjectDir(cwd); err != nil {
+		return err
+	}
+	exprs := replayExpressions(readHistoryFile(filepath.Join(cwd, ".terraflow", historyFileName)), *opts.since)
+	if len(exprs) == 0 {
+		return fmt.Errorf("replay: no expressions in the history of %s", cwd)
+	}
+	workDir, statePath := consoleWorkspace(cwd)
+	// Replay against the configuration as it is now, not as a console last
+	// synced it
+	if workDir != cwd {
+		if _, _, err := terraform.SyncToScratch(cwd, workDir); err != nil {
+			return fmt.Errorf("replay: sync to scratch: %w", err)
+		}
+	}
+	results := evalExpressions(workDir, statePath, normalizeVarFiles(workDir, []string(opts.varFiles)), exprs, defaultEvalTimeout)
+	terraform.ResetAllPersistentEvaluators()
+	if err := writeEvalResults(os.Stdout, results, *opts.asJSON); err != nil {
+		return err
+	}
+	if *opts.diffAgainst == "" {
+		return nil
+	}
+	changed, err := writeTranscriptDiff(os.Stderr, saved, results)
+	if err != nil {
+		return err
+	}
+	if changed > 0 {
+		return fmt.Errorf("%d of %d results differ from %s", changed, len(results), *opts.diffAgainst)
+	}
+	return nil
+}
+
+// replayExpressions returns the expressions of history, oldest first, as the
+// console would submit them. Meta-commands, exit and comment-only entries are
+// left out, repeated expressions are kept at their latest position, and with
+// since > 0 only the last since of them are returned.
+func replayExpressions(history []string, since int) []string {
+	var exprs []string
+	for _, h := range history {
+		expr := submittedExpr(h)
+		if _, _, ok := parseMetaCommand(expr); ok || expr == "exit" || expr == "quit" || isCommentOnly(expr) {
+			continue
+		}
+		exprs = append(exprs, expr)
+	}
+	exprs = mergeHistory(nil, exprs)
+	if since > 0 && len(exprs) > since {
+		exprs = exprs[len(exprs)-since:]
+	}
+	return exprs
+}
+
+// savedResult is one entry of a saved transcript: the expression it is for and
+// the result the way the text format prints it.
+type savedResult struct {
+	expression string
+	entry      string
+}
+
+// readTranscript loads a transcript written by replay or eval. JSON transcripts
+// are converted to text entries so both compare alike.
+func readTranscript(path string) ([]savedResult, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var results []evalResult
+	if json.Unmarshal(b, &results) == nil {
+		var out []savedResult
+		for _, r := range results {
+			entry, err := transcriptEntry(r)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, savedResult{expression: r.Expression, entry: entry})
+		}
+		return out, nil
+	}
+	// An entry goes on until its expression is complete, so the lines of a
+	// multi-line expression stay together, and then takes the indented
+	// continuation lines of a multi-line error
+	var out []savedResult
+	for _, ln := range strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n") {
+		if n := len(out); n > 0 && (out[n-1].expression == "" || strings.HasPrefix(ln, "  ")) {
+			out[n-1].entry += "\n" + ln
+			if out[n-1].expression == "" {
+				out[n-1].expression = entryExpression(out[n-1].entry)
+			}
+			continue
+		}
+		if strings.TrimSpace(ln) != "" {
+			out = append(out, savedResult{expression: entryExpression(ln), entry: ln})
+		}
+	}
+	for i := range out {
+		out[i].entry = strings.TrimRight(out[i].entry, "\n")
+	}
+	return out, nil
+}
+
+// entryExpression returns the expression of a text transcript entry: the text
+// before the first " => " that parses as a whole expression, which skips the
+// arrows of for expressions. It returns "" when there is none yet.
+func entryExpression(entry string) string {
+	end := 0
+	for {
+		i := strings.Index(entry[end:], " => ")
+		if i < 0 {
+			return ""
+		}
+		end += i
+		if _, diags := hclsyntax.ParseExpression([]byte(entry[:end]), "<transcript>", hcl.InitialPos); !diags.HasErrors() {
+			return entry[:end]
+		}
+		end += len(" => ")
+	}
+}
+
+// transcriptEntry renders r the way writeEvalResults prints it, without the
+// trailing newline.
+func transcriptEntry(r evalResult) (string, error) {
+	var sb strings.Builder
+	if err := writeEvalResults(&sb, []evalResult{r}, false); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
+
+// writeTranscriptDiff lists the results whose entry differs from the one saved
+// for the same expression, with both entries, and returns how many differ.
+// Expressions the saved transcript does not mention are listed as new without
+// being counted.
+func writeTranscriptDiff(w io.Writer, saved []savedResult, results []evalResult) (int, error) {
+	changed := 0
+	for _, r := range results {
+		entry, err := transcriptEntry(r)
+		if err != nil {
+			return changed, err
+		}
+		was, found := "", false
+		for _, s := range saved {
+			if s.expression == r.Expression {
+				was, found = s.entry, true
+				break
+			}
+		}
+		switch {
+		case !found:
+			_, err = fmt.Fprintf(w, "new: %s\n  + %s\n", r.Expression, indentContinuation(entry))
+		case was != entry:
+			changed++
+			_, err = fmt.Fprintf(w, "changed: %s\n  - %s\n  + %s\n", r.Expression, indentContinuation(was), indentContinuation(entry))
+		}
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReplayExpressions_SkipsMetaCommandsAndRepeats(t *testing.T) {
+	history := []string{"var.name", ":timeout 5s", "1 + 2", "# note", "var.name", "exit", "upper(var.name)"}
+	if got := strings.Join(replayExpressions(history, 0), "|"); got != "1 + 2|var.name|upper(var.name)" {
+		t.Fatalf("expressions = %q", got)
+	}
+	if got := strings.Join(replayExpressions(history, 2), "|"); got != "var.name|upper(var.name)" {
+		t.Fatalf("last 2 expressions = %q", got)
+	}
+}
+
+func TestRunReplayCommand_TranscriptAndDiff(t *testing.T) {
+	// Without terraform on PATH only the in-process evaluator answers
+	t.Setenv("PATH", t.TempDir())
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".terraflow"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// Only the project copy is written; replay syncs it to the scratch directory
+	writeConfig := func(name string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte("variable \"name\" {\n  default = \""+name+"\"\n}\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("web")
+	if err := os.WriteFile(filepath.Join(dir, ".terraflow", historyFileName), []byte("1 + 2\n:echo on\nupper(var.name)\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	var runErr error
+	transcript := captureStdout(t, func() { runErr = RunReplayCommand(nil) })
+	if runErr != nil {
+		t.Fatal(runErr)
+	}
+	if want := "1 + 2 => 3\nupper(var.name) => \"WEB\"\n"; transcript != want {
+		t.Fatalf("transcript = %q, want %q", transcript, want)
+	}
+	saved := filepath.Join(dir, "transcript.txt")
+	if err := os.WriteFile(saved, []byte(transcript), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	captureStdout(t, func() { runErr = RunReplayCommand([]string{"-diff-against", saved}) })
+	if runErr != nil {
+		t.Fatalf("unchanged configuration: %v", runErr)
+	}
+
+	writeConfig("db")
+	captureStdout(t, func() { runErr = RunReplayCommand([]string{"-diff-against", saved}) })
+	if runErr == nil || runErr.Error() != "1 of 2 results differ from "+saved {
+		t.Fatalf("err = %v", runErr)
+	}
+	entries, err := readTranscript(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var js strings.Builder
+	if err := writeEvalResults(&js, evalExpressions(dir, "", nil, []string{"1 + 2"}, defaultEvalTimeout), true); err != nil {
+		t.Fatal(err)
+	}
+	savedJSON := filepath.Join(dir, "transcript.json")
+	if err := os.WriteFile(savedJSON, []byte(js.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readTranscript(savedJSON); err != nil || len(got) != 1 || got[0] != (savedResult{"1 + 2", "1 + 2 => 3"}) {
+		t.Fatalf("JSON transcript entries = %q, %v", got, err)
+	}
+	var diff strings.Builder
+	results := evalExpressions(dir, "", nil, []string{"upper(var.name)", "2 * 2"}, defaultEvalTimeout)
+	if n, err := writeTranscriptDiff(&diff, entries, results); err != nil || n != 1 {
+		t.Fatalf("changed = %d, %v", n, err)
+	}
+	want := "changed: upper(var.name)\n  - upper(var.name) => \"WEB\"\n  + upper(var.name) => \"DB\"\n" +
+		"new: 2 * 2\n  + 2 * 2 => 4\n"
+	if diff.String() != want {
+		t.Fatalf("diff:\n%s\nwant:\n%s", diff.String(), want)
+	}
+}
+
+func TestReadTranscript_MultiLineAndForExpressions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transcript.txt")
+	text := "{for k, v in var.m : k => v} => {\"a\":1}\n" +
+		"merge(\n  var.a,\n  var.b,\n) => {}\n" +
+		"var.x => error: first line\n  second line\n" +
+		"1 + 2 => 3\n"
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readTranscript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []savedResult{
+		{"{for k, v in var.m : k => v}", "{for k, v in var.m : k => v} => {\"a\":1}"},
+		{"merge(\n  var.a,\n  var.b,\n)", "merge(\n  var.a,\n  var.b,\n) => {}"},
+		{"var.x", "var.x => error: first line\n  second line"},
+		{"1 + 2", "1 + 2 => 3"},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("entries = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// resultCache remembers the last successful result of each distinct expression
+// submitted in the REPL. Entries are stamped with a fingerprint of the state
+// and a generation bumped on every configuration refresh, so a re-submitted
+// expression is answered from the cache only while neither has changed.
+type resultCache struct {
+	ev        lineEvaluator
+	statePath string
+	enabled   bool // toggled by :cache
+
+	mu         sync.Mutex
+	generation uint64
+	entries    map[string]cachedResult
+}
+
+type cachedResult struct {
+	stdout     string
+	state      string // terraform.StateFingerprint when evaluated
+	generation uint64
+}
+
+func newResultCache(ev lineEvaluator, statePath string) *resultCache {
+	return &resultCache{ev: ev, statePath: statePath, enabled: true, entries: map[string]cachedResult{}}
+}
+
+// Evaluate returns the cached result for line when it is still current and
+// otherwise evaluates it. Only results without errors or stderr output are kept.
+func (c *resultCache) Evaluate(line string, timeout time.Duration) (string, string, error) {
+	return c.evaluate(line, func() (string, string, error) { return c.ev.Evaluate(line, timeout) }, nil)
+}
+
+// EvaluateStream implements streamEvaluator; cached results are written to w
+// at once.
+func (c *resultCache) EvaluateStream(line string, timeout time.Duration, w io.Writer) (string, string, error) {
+	return c.evaluate(line, func() (string, string, error) { return evaluateStream(c.ev, line, timeout, w) }, w)
+}
+
+// evaluate answers line from the cache when current and runs eval otherwise.
+func (c *resultCache) evaluate(line string, eval func() (string, string, error), w io.Writer) (string, string, error) {
+	if !c.enabled || !cacheable(line) {
+		return eval()
+	}
+	state := terraform.StateFingerprint(c.statePath)
+	c.mu.Lock()
+	gen := c.generation
+	if r, ok := c.entries[line]; ok && r.state == state && r.generation == gen {
+		c.mu.Unlock()
+		if w != nil {
+			_, _ = io.WriteString(w, r.stdout)
+		}
+		return r.stdout, "", nil
+	}
+	c.mu.Unlock()
+	stdout, stderr, err := eval()
+	if err == nil && stderr == "" {
+		c.mu.Lock()
+		c.entries[line] = cachedResult{stdout: stdout, state: state, generation: gen}
+		c.mu.Unlock()
+	}
+	return stdout, stderr, err
+}
+
+// invalidate drops all cached results; called when configuration or state
+// is refreshed, and by :engine, :profile and :reset-state.
+func (c *resultCache) invalidate() {
+	c.mu.Lock()
+	c.generation++
+	c.entries = map[string]cachedResult{}
+	c.mu.Unlock()
+}
+
+// fileFunctions read files the watcher does not track, so a cached result
+// could outlive an edit to them.
+var fileFunctions = map[string]bool{
+	"file":             true,
+	"filebase64":       true,
+	"filebase64sha256": true,
+	"filebase64sha512": true,
+	"fileexists":       true,
+	"filemd5":          true,
+	"fileset":          true,
+	"filesha1":         true,
+	"filesha256":       true,
+	"filesha512":       true,
+	"templatefile":     true,
+}
+
+// cacheable reports whether expr parses and calls neither an impure function
+// nor one reading files.
+func cacheable(expr string) bool {
+	parsed, diags := hclsyntax.ParseExpression([]byte(expr), "<input>", hcl.InitialPos)
+	if diags.HasErrors() || terraform.CallsImpureFunction(parsed) {
+		return false
+	}
+	readsFiles := false
+	_ = hclsyntax.VisitAll(parsed, func(n hclsyntax.Node) hcl.Diagnostics {
+		if call, ok := n.(*hclsyntax.FunctionCallExpr); ok && fileFunctions[strings.TrimPrefix(call.Name, "core::")] {
+			readsFiles = true
+		}
+		return nil
+	})
+	return !readsFiles
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResultCache_HitsUntilInvalidated(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "terraform.tfstate")
+	if err := os.WriteFile(statePath, []byte(`{"version":4,"serial":1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ev := &recordingEvaluator{stdout: "\"x\"\n"}
+	c := newResultCache(ev, statePath)
+	evaluate := func(line string) {
+		t.Helper()
+		if stdout, _, err := c.Evaluate(line, time.Second); err != nil || stdout != "\"x\"\n" {
+			t.Fatalf("%s: got %q (err=%v)", line, stdout, err)
+		}
+	}
+
+	evaluate("var.x")
+	evaluate("var.x")
+	if len(ev.calls) != 1 {
+		t.Fatalf("unchanged re-submit should hit the cache, evaluated %d times", len(ev.calls))
+	}
+	c.invalidate()
+	evaluate("var.x")
+	if len(ev.calls) != 2 {
+		t.Fatalf("refresh should invalidate the cache, evaluated %d times", len(ev.calls))
+	}
+	if err := os.WriteFile(statePath, []byte(`{"version":4,"serial":2}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	evaluate("var.x")
+	if len(ev.calls) != 3 {
+		t.Fatalf("a new state serial should miss the cache, evaluated %d times", len(ev.calls))
+	}
+	// A reproducible state keeps its serial across rewrites
+	if err := os.WriteFile(statePath, []byte(`{"version":4,"serial":2,"outputs":{"a":{"value":1}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	evaluate("var.x")
+	if len(ev.calls) != 4 {
+		t.Fatalf("a rewrite keeping the serial should miss the cache, evaluated %d times", len(ev.calls))
+	}
+	evaluate("timestamp()")
+	evaluate("timestamp()")
+	if len(ev.calls) != 6 {
+		t.Fatalf("impure expressions must not be cached, evaluated %d times", len(ev.calls))
+	}
+	evaluate(`jsondecode(file("policy.json"))`)
+	evaluate(`jsondecode(file("policy.json"))`)
+	if len(ev.calls) != 8 {
+		t.Fatalf("expressions reading files must not be cached, evaluated %d times", len(ev.calls))
+	}
+
+	mc := &metaContext{cache: c}
+	if msg, err := runMetaCommand(mc, "cache", "off"); err != nil || msg != "Result cache is off." {
+		t.Fatalf("cache off: msg=%q err=%v", msg, err)
+	}
+	evaluate("var.x")
+	if len(ev.calls) != 9 {
+		t.Fatalf("disabled cache should evaluate, evaluated %d times", len(ev.calls))
+	}
+}
+
+func TestResultCache_SkipsErrors(t *testing.T) {
+	ev := &recordingEvaluator{stderr: "Error: Reference to undeclared input variable\n"}
+	c := newResultCache(ev, filepath.Join(t.TempDir(), "terraform.tfstate"))
+	for i := 0; i < 2; i++ {
+		if _, stderr, _ := c.Evaluate("var.missing", time.Second); stderr == "" {
+			t.Fatal("expected the evaluator's stderr")
+		}
+	}
+	if len(ev.calls) != 2 {
+		t.Fatalf("failed evaluations must not be cached, evaluated %d times", len(ev.calls))
+	}
+}
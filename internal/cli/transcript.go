@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// debugLogFileName is the log written under the scratch directory with -debug.
+const debugLogFileName = "terraflow.log"
+
+// openDebugLog opens the debug log in scratchDir for appending, returning a
+// logger stamping each line with date and time and the file to close.
+func openDebugLog(scratchDir string) (*log.Logger, *os.File, error) {
+	if err := os.MkdirAll(scratchDir, 0o700); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(scratchDir, debugLogFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return log.New(f, "", log.LstdFlags|log.Lmicroseconds), f, nil
+}
+
+// transcriptEvaluator mirrors every evaluated expression and its result or
+// error to a log, giving a session transcript to attach to bug reports. It
+// records the output as terraform console printed it, so sensitive values
+// appear as "(sensitive value)" just as on screen.
+type transcriptEvaluator struct {
+	ev  lineEvaluator
+	log *log.Logger
+}
+
+// Evaluate evaluates line and logs it together with what it produced.
+func (t *transcriptEvaluator) Evaluate(line string, timeout time.Duration) (string, string, error) {
+	return t.record(line, func() (string, string, error) { return t.ev.Evaluate(line, timeout) })
+}
+
+// EvaluateStream implements streamEvaluator.
+func (t *transcriptEvaluator) EvaluateStream(line string, timeout time.Duration, w io.Writer) (string, string, error) {
+	return t.record(line, func() (string, string, error) { return evaluateStream(t.ev, line, timeout, w) })
+}
+
+// record runs eval and logs line together with what it produced.
+func (t *transcriptEvaluator) record(line string, eval func() (string, string, error)) (string, string, error) {
+	stdout, stderr, err := eval()
+	t.log.Printf("[eval] %s", indentContinuation(line))
+	if out := strings.TrimRight(stdout, "\r\n"); out != "" {
+		t.log.Printf("[result] %s", indentContinuation(out))
+	}
+	if msg := strings.TrimRight(stderr, "\r\n"); msg != "" {
+		t.log.Printf("[stderr] %s", indentContinuation(msg))
+	}
+	if err != nil {
+		t.log.Printf("[error] %s", indentContinuation(err.Error()))
+	}
+	return stdout, stderr, err
+}
+
+// indentContinuation indents every line after the first so multi-line values
+// stay visibly attached to their log entry.
+func indentContinuation(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\n    ")
+}
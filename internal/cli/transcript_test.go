@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTranscriptEvaluator_LogsEvaluations(t *testing.T) {
+	dir := t.TempDir()
+	l, f, err := openDebugLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := &recordingEvaluator{stdout: "{\n  \"a\" = 1\n}\n"}
+	te := &transcriptEvaluator{ev: ev, log: l}
+	if stdout, _, _ := te.Evaluate("var.m", time.Second); stdout != ev.stdout {
+		t.Fatalf("result not passed through: %q", stdout)
+	}
+	ev.stdout, ev.stderr = "(sensitive value)\n", ""
+	te.Evaluate("var.password", time.Second)
+	ev.stdout, ev.stderr = "", "Error: Reference to undeclared input variable\n"
+	te.Evaluate("var.missing", time.Second)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, debugLogFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := `\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}\.\d{6} `
+	want := regexp.MustCompile(`^` + ts + `\[eval\] var\.m\n` +
+		ts + `\[result\] \{\n      "a" = 1\n    \}\n` +
+		ts + `\[eval\] var\.password\n` +
+		ts + `\[result\] \(sensitive value\)\n` +
+		ts + `\[eval\] var\.missing\n` +
+		ts + `\[stderr\] Error: Reference to undeclared input variable\n$`)
+	if !want.Match(b) {
+		t.Fatalf("unexpected transcript:\n%s", b)
+	}
+}
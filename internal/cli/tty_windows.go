@@ -2,11 +2,66 @@
 
 package cli
 
-import "os"
+import (
+	"fmt"
+	"os"
 
-// acquireTTY on Windows returns standard input with a no-op restore.
+	"golang.org/x/sys/windows"
+)
+
+// consoleModeFuncs reads and writes a console handle's mode; replaced in tests.
+type consoleModeFuncs struct {
+	get func(h windows.Handle, mode *uint32) error
+	set func(h windows.Handle, mode uint32) error
+}
+
+var consoleModes = consoleModeFuncs{get: windows.GetConsoleMode, set: windows.SetConsoleMode}
+
+// rawInputMode turns off line buffering, echo and Ctrl+C processing and asks
+// the console to deliver keys as VT sequences, so arrows and bracketed paste
+// arrive as the same ANSI input the Unix terminal produces.
+func rawInputMode(mode uint32) uint32 {
+	mode &^= windows.ENABLE_LINE_INPUT | windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT
+	return mode | windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+}
+
+// vtOutputMode makes the console interpret the ANSI escapes the REPL writes.
+func vtOutputMode(mode uint32) uint32 {
+	return mode | windows.ENABLE_PROCESSED_OUTPUT | windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING
+}
+
+// setConsoleModes switches in to raw VT input and, when out is a console too,
+// out to VT processing, returning a func that restores the saved modes. Only
+// in has to be a console: a redirected out is left alone, so keys are still
+// read raw while the output goes to a file or pipe.
+func (c consoleModeFuncs) setConsoleModes(in, out windows.Handle) (func(), error) {
+	var inMode, outMode uint32
+	if err := c.get(in, &inMode); err != nil {
+		return nil, fmt.Errorf("get console input mode: %w", err)
+	}
+	if err := c.set(in, rawInputMode(inMode)); err != nil {
+		return nil, fmt.Errorf("set console input mode: %w", err)
+	}
+	vtOut := c.get(out, &outMode) == nil && c.set(out, vtOutputMode(outMode)) == nil
+	return func() {
+		if vtOut {
+			_ = c.set(out, outMode)
+		}
+		_ = c.set(in, inMode)
+	}, nil
+}
+
+// acquireTTY on Windows enables raw virtual terminal input on standard input
+// and, when standard output is a console, VT processing on it, returning
+// standard input and a func restoring the original console modes. When
+// standard input is not a console (redirected, or a console without VT input)
+// it returns standard input with a no-op restore and the error.
 func acquireTTY() (*os.File, func(), error) {
-	return os.Stdin, func() {}, nil
+	restore, err := consoleModes.setConsoleModes(windows.Handle(os.Stdin.Fd()), windows.Handle(os.Stdout.Fd()))
+	if err != nil {
+		return os.Stdin, func() {}, err
+	}
+	return os.Stdin, restore, nil
 }
 
 // detectTermWidth on Windows falls back to COLUMNS env or 80.
@@ -0,0 +1,81 @@
+//go:build windows
+
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/windows"
+)
+
+// fakeConsole records console modes per handle and can fail a set on one handle.
+type fakeConsole struct {
+	modes   map[windows.Handle]uint32
+	failSet windows.Handle
+}
+
+func (f *fakeConsole) funcs() consoleModeFuncs {
+	return consoleModeFuncs{
+		get: func(h windows.Handle, mode *uint32) error {
+			*mode = f.modes[h]
+			return nil
+		},
+		set: func(h windows.Handle, mode uint32) error {
+			if h == f.failSet {
+				return errors.New("access denied")
+			}
+			f.modes[h] = mode
+			return nil
+		},
+	}
+}
+
+func TestSetConsoleModes_SaveAndRestore(t *testing.T) {
+	const in, out = windows.Handle(1), windows.Handle(2)
+	origIn := uint32(windows.ENABLE_LINE_INPUT | windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_QUICK_EDIT_MODE)
+	origOut := uint32(windows.ENABLE_PROCESSED_OUTPUT)
+	fc := &fakeConsole{modes: map[windows.Handle]uint32{in: origIn, out: origOut}}
+	restore, err := fc.funcs().setConsoleModes(in, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fc.modes[in]; got != windows.ENABLE_QUICK_EDIT_MODE|windows.ENABLE_VIRTUAL_TERMINAL_INPUT {
+		t.Fatalf("input mode = %#x", got)
+	}
+	if got := fc.modes[out]; got&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING == 0 {
+		t.Fatalf("output mode = %#x, want VT processing", got)
+	}
+	restore()
+	if fc.modes[in] != origIn || fc.modes[out] != origOut {
+		t.Fatalf("restore: got in=%#x out=%#x", fc.modes[in], fc.modes[out])
+	}
+}
+
+func TestSetConsoleModes_RedirectedOutput(t *testing.T) {
+	const in, out = windows.Handle(1), windows.Handle(2)
+	origIn := uint32(windows.ENABLE_LINE_INPUT | windows.ENABLE_ECHO_INPUT)
+	fc := &fakeConsole{modes: map[windows.Handle]uint32{in: origIn, out: 0}, failSet: out}
+	restore, err := fc.funcs().setConsoleModes(in, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fc.modes[in]; got != windows.ENABLE_VIRTUAL_TERMINAL_INPUT {
+		t.Fatalf("input mode = %#x, want raw VT input", got)
+	}
+	restore()
+	if fc.modes[in] != origIn {
+		t.Fatalf("input mode not restored: %#x", fc.modes[in])
+	}
+}
+
+func TestSetConsoleModes_FailsWhenInputIsNotConsole(t *testing.T) {
+	const in, out = windows.Handle(1), windows.Handle(2)
+	fc := &fakeConsole{modes: map[windows.Handle]uint32{in: 0, out: 0}, failSet: in}
+	if _, err := fc.funcs().setConsoleModes(in, out); err == nil {
+		t.Fatal("expected error")
+	}
+	if fc.modes[out] != 0 {
+		t.Fatalf("output mode changed: %#x", fc.modes[out])
+	}
+}
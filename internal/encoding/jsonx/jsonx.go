@@ -0,0 +1,15 @@
+// Package jsonx is the JSON codec used for state files and console responses.
+// It wraps encoding/json by default; building with -tags terrafastjson swaps
+// in sonic for faster marshaling of large states.
+package jsonx
+
+import "encoding/json"
+
+// RawMessage is a raw encoded JSON value.
+type RawMessage = json.RawMessage
+
+// MarshalIndent is not on the hot path (manifests, exports), so it always uses
+// encoding/json for byte-for-byte stable, human-readable output.
+func MarshalIndent(v any, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(v, prefix, indent)
+}
@@ -0,0 +1,67 @@
+package jsonx
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// representativeState mirrors what the patchers write: nested maps and lists,
+// numbers, booleans, nulls and strings that need escaping.
+const representativeState = `{
+  "version": 4,
+  "terraform_version": "1.9.0",
+  "serial": 12,
+  "lineage": "5b1e3c2a-0000-4000-8000-000000000000",
+  "outputs": {"url": {"value": "https://example.com/?a=1&b=<2>", "type": "string"}},
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "web",
+      "provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+      "instances": [
+        {
+          "schema_version": 1,
+          "attributes": {
+            "id": "i-0123",
+            "count": 3,
+            "ratio": 0.25,
+            "enabled": true,
+            "missing": null,
+            "tags": {"Name": "web é", "z": "last", "a": "first"},
+            "ports": [80, 443]
+          }
+        }
+      ]
+    }
+  ]
+}`
+
+// Run with and without -tags terrafastjson: both codecs must agree with
+// encoding/json so state files are identical regardless of build.
+func TestCodecMatchesEncodingJSON(t *testing.T) {
+	var want, got map[string]any
+	if err := json.Unmarshal([]byte(representativeState), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := Unmarshal([]byte(representativeState), &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unmarshal mismatch:\n got %#v\nwant %#v", got, want)
+	}
+
+	wantBytes, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotBytes, err := Marshal(got)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if !bytes.Equal(gotBytes, wantBytes) {
+		t.Fatalf("Marshal mismatch:\n got %s\nwant %s", gotBytes, wantBytes)
+	}
+}
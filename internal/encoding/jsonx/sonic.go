@@ -0,0 +1,15 @@
+//go:build terrafastjson
+
+package jsonx
+
+import "github.com/bytedance/sonic"
+
+// api matches encoding/json behavior (map key sorting, HTML escaping, no
+// trailing newline) so state files stay byte-identical across builds.
+var api = sonic.ConfigStd
+
+// Marshal returns the JSON encoding of v.
+func Marshal(v any) ([]byte, error) { return api.Marshal(v) }
+
+// Unmarshal parses JSON-encoded data into v.
+func Unmarshal(data []byte, v any) error { return api.Unmarshal(data, v) }
@@ -0,0 +1,11 @@
+//go:build !terrafastjson
+
+package jsonx
+
+import "encoding/json"
+
+// Marshal returns the JSON encoding of v.
+func Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+// Unmarshal parses JSON-encoded data into v.
+func Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
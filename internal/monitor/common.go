@@ -0,0 +1,30 @@
+package monitor
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// watchExtensions lists Terraform-related file extensions that trigger refreshes.
+var watchExtensions = []string{".tf", ".tfvars"}
+
+// pendingPaths returns the accumulated paths in a stable order.
+func pendingPaths(pending map[string]struct{}) []string {
+	out := make([]string, 0, len(pending))
+	for p := range pending {
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// matchesExt reports whether path has one of the watched extensions.
+func matchesExt(path string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range watchExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
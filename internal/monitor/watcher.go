@@ -1,3 +1,5 @@
+//go:build !fsnotify
+
 package monitor
 
 import (
@@ -6,56 +8,65 @@ import (
 	"time"
 )
 
-// watchExtensions lists Terraform-related file extensions that trigger refreshes.
-var watchExtensions = []string{".tf", ".tfvars"}
+// Debounce is how long bursts of edits are collected into one refresh.
+const Debounce = 20 * time.Millisecond
 
 // WatchTerraformFilesNotifying periodically polls Terraform files under dir and
-// sends a signal on refreshCh when any relevant file changes.
-func WatchTerraformFilesNotifying(dir string, refreshCh chan<- struct{}) {
+// sends the paths that changed (created, modified or deleted) on refreshCh.
+// Paths are relative to dir when dir is relative.
+func WatchTerraformFilesNotifying(dir string, refreshCh chan<- []string) {
 	last := map[string]time.Time{}
-	// Debounce bursts of edits within this interval (aggressive)
-	const debounce = 20 * time.Millisecond
-	var pending bool
+	// Prime with the current tree so existing files are not reported as new
+	pollTerraformFiles(dir, last)
+	pending := map[string]struct{}{}
 	var lastFire time.Time
 	go func() {
 		ticker := time.NewTicker(20 * time.Millisecond)
 		defer ticker.Stop()
 		for range ticker.C {
-			if pollTerraformFiles(dir, last) {
-				pending = true
+			for _, p := range pollTerraformFiles(dir, last) {
+				pending[p] = struct{}{}
 			}
-			if pending && time.Since(lastFire) >= debounce {
+			if len(pending) > 0 && time.Since(lastFire) >= Debounce {
 				select {
-				case refreshCh <- struct{}{}:
+				case refreshCh <- pendingPaths(pending):
 					lastFire = time.Now()
-					pending = false
+					pending = map[string]struct{}{}
 				default:
-					// channel full, skip
+					// channel full; keep accumulating and retry on the next tick
 				}
 			}
 		}
 	}()
 }
 
-func pollTerraformFiles(dir string, last map[string]time.Time) bool {
-	changed := false
+// pollTerraformFiles updates last with the current modification times and
+// returns the paths that changed since the previous poll.
+func pollTerraformFiles(dir string, last map[string]time.Time) []string {
+	var changed []string
+	primed := len(last) > 0
+	seen := make(map[string]struct{}, len(last))
 	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil || info.IsDir() {
 			return nil
 		}
-		for _, ext := range watchExtensions {
-			if filepath.Ext(path) == ext {
-				mod := info.ModTime()
-				if last[path].IsZero() {
-					last[path] = mod
-				} else if mod.After(last[path]) {
-					last[path] = mod
-					changed = true
-				}
-				break
-			}
+		if !matchesExt(path) {
+			return nil
+		}
+		seen[path] = struct{}{}
+		mod := info.ModTime()
+		prev, known := last[path]
+		last[path] = mod
+		if (known && mod.After(prev)) || (!known && primed) {
+			changed = append(changed, path)
 		}
 		return nil
 	})
+	for path := range last {
+		if _, ok := seen[path]; !ok {
+			delete(last, path)
+			changed = append(changed, path)
+		}
+	}
 	return changed
 }
@@ -11,12 +11,16 @@ import (
 	"github.com/fsnotify/fsnotify"
 )
 
+// Debounce is how long bursts of edits are collected into one refresh.
+const Debounce = 75 * time.Millisecond
+
 // WatchTerraformFilesNotifying (fsnotify build) uses OS events for instant refreshes.
-func WatchTerraformFilesNotifying(dir string, refreshCh chan<- struct{}) {
+// The paths named by the events are sent on refreshCh.
+func WatchTerraformFilesNotifying(dir string, refreshCh chan<- []string) {
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
-		// Should not happen under fsnotify build, but guard anyway
-		go func() { refreshCh <- struct{}{} }()
+		// Should not happen under fsnotify build, but guard anyway; nil requests a full sync
+		go func() { refreshCh <- nil }()
 		return
 	}
 	go func() {
@@ -30,9 +34,25 @@ func WatchTerraformFilesNotifying(dir string, refreshCh chan<- struct{}) {
 			}
 			return nil
 		})
-		const debounce = 75 * time.Millisecond
-		var pending bool
+		pending := map[string]struct{}{}
 		var lastFire time.Time
+		// send delivers the pending paths unless a refresh is still queued
+		send := func() bool {
+			select {
+			case refreshCh <- pendingPaths(pending):
+				lastFire = time.Now()
+				pending = map[string]struct{}{}
+				return true
+			default:
+				return false
+			}
+		}
+		// flush delivers paths that arrived within Debounce of the last refresh
+		// once it has passed, and retries while refreshCh is full, so they do
+		// not wait for an unrelated later edit
+		flush := time.NewTimer(Debounce)
+		flush.Stop()
+		defer flush.Stop()
 		for {
 			select {
 			case ev, ok := <-w.Events:
@@ -40,15 +60,19 @@ func WatchTerraformFilesNotifying(dir string, refreshCh chan<- struct{}) {
 					return
 				}
 				if matchesExt(ev.Name) {
-					pending = true
+					pending[ev.Name] = struct{}{}
+				}
+				if len(pending) == 0 {
+					continue
 				}
-				if pending && time.Since(lastFire) >= debounce {
-					select {
-					case refreshCh <- struct{}{}:
-						lastFire = time.Now()
-						pending = false
-					default:
-					}
+				if wait := Debounce - time.Since(lastFire); wait > 0 {
+					flush.Reset(wait)
+				} else if !send() {
+					flush.Reset(Debounce)
+				}
+			case <-flush.C:
+				if len(pending) > 0 && !send() {
+					flush.Reset(Debounce)
 				}
 			case err, ok := <-w.Errors:
 				if !ok {
@@ -59,13 +83,3 @@ func WatchTerraformFilesNotifying(dir string, refreshCh chan<- struct{}) {
 		}
 	}()
 }
-
-func matchesExt(path string) bool {
-	ext := filepath.Ext(path)
-	for _, e := range watchExtensions {
-		if ext == e {
-			return true
-		}
-	}
-	return false
-}
@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchTerraformFilesNotifying_DeliversChangedPath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte("locals {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	refreshCh := make(chan []string, 1)
+	WatchTerraformFilesNotifying(dir, refreshCh)
+	// Let the watcher register the tree before editing
+	time.Sleep(100 * time.Millisecond)
+
+	target := filepath.Join(dir, "vars.tf")
+	if err := os.WriteFile(target, []byte("variable \"x\" {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case paths := <-refreshCh:
+			for _, p := range paths {
+				if p == target {
+					return
+				}
+			}
+		case <-deadline:
+			t.Fatalf("changed path %s was not delivered", target)
+		}
+	}
+}
+
+func TestWatchTerraformFilesNotifying_FlushesBurstWithoutLaterEdit(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "versions.tf"), []byte("terraform {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	refreshCh := make(chan []string, 1)
+	WatchTerraformFilesNotifying(dir, refreshCh)
+	time.Sleep(100 * time.Millisecond)
+
+	// Two files saved within Debounce of each other, like a save-all, and
+	// nothing edited afterwards
+	first, second := filepath.Join(dir, "a.tf"), filepath.Join(dir, "b.tf")
+	for _, p := range []string{first, second} {
+		if err := os.WriteFile(p, []byte("locals {}\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]bool{first: true, second: true}
+	deadline := time.After(5 * time.Second)
+	for len(want) > 0 {
+		select {
+		case paths := <-refreshCh:
+			for _, p := range paths {
+				delete(want, p)
+			}
+		case <-deadline:
+			t.Fatalf("paths not delivered: %v", want)
+		}
+	}
+}
+
+func TestWatchTerraformFilesNotifying_RetriesWhileRefreshQueued(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "versions.tf"), []byte("terraform {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	refreshCh := make(chan []string, 1)
+	WatchTerraformFilesNotifying(dir, refreshCh)
+	time.Sleep(100 * time.Millisecond)
+
+	// A refresh is still queued when the edit arrives
+	refreshCh <- nil
+	target := filepath.Join(dir, "main.tf")
+	if err := os.WriteFile(target, []byte("locals {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * Debounce)
+	<-refreshCh
+	select {
+	case paths := <-refreshCh:
+		if len(paths) != 1 || paths[0] != target {
+			t.Fatalf("paths = %v, want %s", paths, target)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s was not delivered once the queued refresh was taken", target)
+	}
+}
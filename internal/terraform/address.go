@@ -0,0 +1,173 @@
+package terraform
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	cty "github.com/zclconf/go-cty/cty"
+)
+
+// ModuleStep is one module call of an address, with the instance key of a
+// module called with count or for_each.
+type ModuleStep struct {
+	Name string
+	Key  any // int, string, or nil when the call has no key
+}
+
+// Address is a parsed Terraform address such as
+// module.a["x"].module.b.aws_instance.web[0] or data.aws_ami.ubuntu. An
+// address of a module alone ("module.db") has an empty Type.
+type Address struct {
+	Module []ModuleStep
+	Mode   string // "managed" or "data", as in state; empty for a module address
+	Type   string
+	Name   string
+	Key    any // instance key: int for count, string for for_each, nil when absent
+}
+
+// ParseAddress parses a resource, data source or module address the way
+// Terraform's -target does.
+func ParseAddress(s string) (Address, error) {
+	var a Address
+	src := strings.TrimSpace(s)
+	if src == "" {
+		return a, fmt.Errorf("empty address")
+	}
+	trav, diags := hclsyntax.ParseTraversalAbs([]byte(src), "<address>", hcl.InitialPos)
+	if diags.HasErrors() {
+		return a, fmt.Errorf("invalid address %q: %s", s, diags[0].Summary)
+	}
+	names, keys, err := addressSteps(trav)
+	if err != nil {
+		return a, fmt.Errorf("invalid address %q: %w", s, err)
+	}
+	i := 0
+	for i < len(names) && names[i] == "module" {
+		if keys[i] != nil {
+			return a, fmt.Errorf("invalid address %q: index after \"module\"", s)
+		}
+		if i+1 >= len(names) {
+			return a, fmt.Errorf("invalid address %q: module name missing", s)
+		}
+		a.Module = append(a.Module, ModuleStep{Name: names[i+1], Key: keys[i+1]})
+		i += 2
+	}
+	rest, restKeys := names[i:], keys[i:]
+	if len(rest) == 0 {
+		return a, nil
+	}
+	a.Mode = "managed"
+	if rest[0] == "data" {
+		if restKeys[0] != nil {
+			return a, fmt.Errorf("invalid address %q: index after \"data\"", s)
+		}
+		a.Mode = "data"
+		rest, restKeys = rest[1:], restKeys[1:]
+	}
+	if len(rest) != 2 {
+		return a, fmt.Errorf("invalid address %q: expected [module.<name>.]...[data.]<type>.<name>[key]", s)
+	}
+	if restKeys[0] != nil {
+		return a, fmt.Errorf("invalid address %q: index after resource type %q", s, rest[0])
+	}
+	a.Type, a.Name, a.Key = rest[0], rest[1], restKeys[1]
+	return a, nil
+}
+
+// addressSteps flattens a traversal into its names, each with the index key
+// that follows it (nil when none does).
+func addressSteps(trav hcl.Traversal) (names []string, keys []any, err error) {
+	for _, step := range trav {
+		switch t := step.(type) {
+		case hcl.TraverseRoot:
+			names, keys = append(names, t.Name), append(keys, nil)
+		case hcl.TraverseAttr:
+			names, keys = append(names, t.Name), append(keys, nil)
+		case hcl.TraverseIndex:
+			if len(keys) == 0 || keys[len(keys)-1] != nil {
+				return nil, nil, fmt.Errorf("unexpected index")
+			}
+			k, err := addressKey(t.Key)
+			if err != nil {
+				return nil, nil, err
+			}
+			keys[len(keys)-1] = k
+		default:
+			return nil, nil, fmt.Errorf("unsupported %T", step)
+		}
+	}
+	return names, keys, nil
+}
+
+// addressKey converts an index key to an int for count or a string for
+// for_each.
+func addressKey(v cty.Value) (any, error) {
+	switch {
+	case v.IsNull() || !v.IsKnown():
+		return nil, fmt.Errorf("invalid instance key")
+	case v.Type() == cty.String:
+		return v.AsString(), nil
+	case v.Type() == cty.Number:
+		bf := v.AsBigFloat()
+		if !bf.IsInt() || bf.Sign() < 0 {
+			return nil, fmt.Errorf("instance key %s is not a whole number", bf.Text('f', -1))
+		}
+		n, acc := bf.Int64()
+		if acc != big.Exact || n > int64(^uint(0)>>1) {
+			return nil, fmt.Errorf("instance key %s is too large", bf.Text('f', -1))
+		}
+		return int(n), nil
+	default:
+		return nil, fmt.Errorf("instance key must be a number or a string")
+	}
+}
+
+// IsModule reports whether a addresses a module rather than a resource.
+func (a Address) IsModule() bool { return a.Type == "" }
+
+// ModulePath returns the module call names of a without their keys, as used
+// by the scanners and state keys.
+func (a Address) ModulePath() []string {
+	var out []string
+	for _, m := range a.Module {
+		out = append(out, m.Name)
+	}
+	return out
+}
+
+// String formats a the way Terraform prints addresses; it round-trips through
+// ParseAddress.
+func (a Address) String() string {
+	var b strings.Builder
+	for _, m := range a.Module {
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString("module." + m.Name + formatAddressKey(m.Key))
+	}
+	if a.IsModule() {
+		return b.String()
+	}
+	if b.Len() > 0 {
+		b.WriteByte('.')
+	}
+	if a.Mode == "data" {
+		b.WriteString("data.")
+	}
+	b.WriteString(a.Type + "." + a.Name + formatAddressKey(a.Key))
+	return b.String()
+}
+
+func formatAddressKey(k any) string {
+	switch k := k.(type) {
+	case int:
+		return "[" + strconv.Itoa(k) + "]"
+	case string:
+		return "[" + hclString(k) + "]"
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	cases := map[string]Address{
+		"aws_instance.web":          {Mode: "managed", Type: "aws_instance", Name: "web"},
+		"aws_instance.web[0]":       {Mode: "managed", Type: "aws_instance", Name: "web", Key: 0},
+		`aws_instance.web["a"]`:     {Mode: "managed", Type: "aws_instance", Name: "web", Key: "a"},
+		"data.aws_ami.ubuntu":       {Mode: "data", Type: "aws_ami", Name: "ubuntu"},
+		"module.db":                 {Module: []ModuleStep{{Name: "db"}}},
+		`module.a["x"].module.b[2]`: {Module: []ModuleStep{{Name: "a", Key: "x"}, {Name: "b", Key: 2}}},
+		"module.a.module.b.aws_instance.web[0]": {
+			Module: []ModuleStep{{Name: "a"}, {Name: "b"}},
+			Mode:   "managed", Type: "aws_instance", Name: "web", Key: 0,
+		},
+		`module.net["eu"].module.subnet[1].module.nat.data.aws_eip.this["a/b"]`: {
+			Module: []ModuleStep{{Name: "net", Key: "eu"}, {Name: "subnet", Key: 1}, {Name: "nat"}},
+			Mode:   "data", Type: "aws_eip", Name: "this", Key: "a/b",
+		},
+	}
+	for in, want := range cases {
+		got, err := ParseAddress(in)
+		if err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", in, got, want)
+		}
+		if s := got.String(); s != in {
+			t.Fatalf("%s: String() = %q", in, s)
+		}
+	}
+}
+
+func TestParseAddress_Invalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"module",
+		"aws_instance",
+		"data.aws_ami",
+		"a.b.c",
+		"module[0].db",
+		"aws_instance[0].web",
+		"data[0].aws_ami.x",
+		"aws_instance.web[0][1]",
+		"aws_instance.web[-1]",
+		"aws_instance.web[1.5]",
+		"aws_instance.web[*]",
+		"aws_instance.web.id",
+		"module.db.aws_instance",
+		"module..x",
+		"1abc.web",
+	} {
+		if a, err := ParseAddress(in); err == nil {
+			t.Errorf("%q: expected an error, got %#v", in, a)
+		}
+	}
+}
+
+func TestAddress_StringRoundTripsEscapes(t *testing.T) {
+	a := Address{Mode: "managed", Type: "null_resource", Name: "x", Key: "quote\" and ${interp}"}
+	got, err := ParseAddress(a.String())
+	if err != nil {
+		t.Fatalf("%s: %v", a, err)
+	}
+	if !reflect.DeepEqual(got, a) {
+		t.Fatalf("got %#v, want %#v", got, a)
+	}
+	if p := (Address{Module: []ModuleStep{{Name: "a", Key: 1}, {Name: "b"}}}).ModulePath(); !reflect.DeepEqual(p, []string{"a", "b"}) {
+		t.Fatalf("ModulePath = %#v", p)
+	}
+}
@@ -0,0 +1,94 @@
+package terraform
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// comparedRefRe matches a reference followed by a comparison operator at the
+// end of the text before the cursor, as in `aws_instance.web[0].monitoring == `.
+var comparedRefRe = regexp.MustCompile(`([A-Za-z0-9_.\-*\[\]"]+)\s*(?:==|!=)\s*$`)
+
+// indexSegmentRe matches index and splat segments such as [0], ["a"] and [*].
+var indexSegmentRe = regexp.MustCompile(`\[[^\]]*\]`)
+
+// allowedValuesRe finds the values a schema description lists as allowed, as
+// in "Valid values are `default`, `dedicated` and `host`.".
+var allowedValuesRe = regexp.MustCompile("(?i)(?:valid|allowed|possible|supported) values (?:are|include|is)?:?\\s*((?:`[^`]+`[\\s,]*(?:and |or )?)+)")
+
+// backquotedRe matches one backquoted value of such a list.
+var backquotedRe = regexp.MustCompile("`([^`]+)`")
+
+// valueCandidates proposes values for the attribute compared in before, the
+// line up to the token being completed: true and false for a bool attribute,
+// and the values the description of a string or number attribute lists as
+// allowed. Provider schemas carry no enums, so that is all it knows. It
+// returns nil outside a value position.
+func (s *SymbolIndex) valueCandidates(before, prefix string) []Candidate {
+	attr, ok := s.comparedAttribute(before)
+	if !ok {
+		return nil
+	}
+	var values []string
+	switch attr.Type {
+	case "bool":
+		values = []string{"true", "false"}
+	case "string":
+		for _, v := range allowedValues(attr.Description) {
+			values = append(values, strconv.Quote(v))
+		}
+	case "number":
+		for _, v := range allowedValues(attr.Description) {
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				values = append(values, v)
+			}
+		}
+	}
+	var out []Candidate
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			out = append(out, Candidate{Text: v, Kind: KindValue, Detail: attr.Name})
+		}
+	}
+	return out
+}
+
+// comparedAttribute returns the schema of the resource or data source
+// attribute on the left of a trailing == or != in before.
+func (s *SymbolIndex) comparedAttribute(before string) (SchemaAttribute, bool) {
+	m := comparedRefRe.FindStringSubmatch(before)
+	if m == nil {
+		return SchemaAttribute{}, false
+	}
+	ref := strings.TrimPrefix(indexSegmentRe.ReplaceAllString(m[1], ""), ConfigNamespace+".")
+	parts := strings.Split(ref, ".")
+	var attrs []SchemaAttribute
+	var name string
+	switch {
+	case parts[0] == "data" && len(parts) == 4:
+		attrs, name = s.DataSchemas[parts[1]], parts[3]
+	case parts[0] != "data" && len(parts) == 3:
+		attrs, name = s.ResourceSchemas[parts[0]], parts[2]
+	}
+	for _, a := range attrs {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return SchemaAttribute{}, false
+}
+
+// allowedValues extracts the backquoted values of the first "Valid values
+// are ..." list in description.
+func allowedValues(description string) []string {
+	m := allowedValuesRe.FindStringSubmatch(description)
+	if m == nil {
+		return nil
+	}
+	var out []string
+	for _, v := range backquotedRe.FindAllStringSubmatch(m[1], -1) {
+		out = append(out, v[1])
+	}
+	return out
+}
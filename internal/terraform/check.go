@@ -0,0 +1,130 @@
+package terraform
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Reasons an attribute can fail to resolve, as reported by CheckConfig.
+const (
+	ReasonMissingProvider     = "missing provider"
+	ReasonUnknownFunction     = "unknown function"
+	ReasonUnresolvedReference = "unresolved reference"
+	ReasonEvalFailed          = "evaluation failed"
+)
+
+// checkTimeout bounds the console evaluation of a single attribute.
+const checkTimeout = 3 * time.Second
+
+// UnresolvedAttr is a resource attribute that neither in-process evaluation nor
+// terraform console could compute.
+type UnresolvedAttr struct {
+	Resource string // resource address, e.g. module.net.aws_subnet.a
+	Attr     string
+	Expr     string
+	Reason   string // one of the Reason* constants
+	Detail   string // the function, reference or error behind Reason
+	// Range locates the expression; its Filename is relative to the root
+	// directory passed to CheckConfig.
+	Range hcl.Range
+}
+
+// CheckConfig evaluates every non-literal resource attribute the way state
+// hydration does, collecting the ones that fail instead of patching them into
+// the state. It returns the number of attributes checked and the failures,
+// ordered by resource and attribute.
+func CheckConfig(rootDir, workDir, statePath string, varFiles []string) (int, []UnresolvedAttr, error) {
+	collected, err := collectFocusedExpressions(rootDir)
+	if err != nil {
+		return 0, nil, err
+	}
+	abs, _ := filepath.Abs(rootDir)
+	resources := stateResourceValues(statePath)
+	checked := 0
+	var out []UnresolvedAttr
+	for _, ri := range collected {
+		addr := batchAddr(ri.mode, ri.rType, ri.rName)
+		if mod := modulePathToString(ri.modulePath); mod != "" {
+			addr = mod + "." + addr
+		}
+		for attr, expr := range ri.exprs {
+			checked++
+			evalExpr := expr
+			if ri.forEach != "" {
+				// Evaluate for every instance so each.key/each.value are bound
+				evalExpr = forEachInstancesExpr(ri.forEach, map[string]string{attr: expr})
+			}
+			v, diags := evalInProcessDiags(workDir, varFiles, resources, evalExpr)
+			if !diags.HasErrors() && v.IsWhollyKnown() {
+				continue
+			}
+			if _, err := EvalJSON(workDir, statePath, varFiles, evalExpr, checkTimeout); err == nil {
+				continue
+			}
+			reason, detail := unresolvedReason(expr, diags)
+			rng := ri.ranges[attr]
+			if rel, err := filepath.Rel(abs, rng.Filename); err == nil {
+				rng.Filename = rel
+			}
+			out = append(out, UnresolvedAttr{Resource: addr, Attr: attr, Expr: expr, Reason: reason, Detail: detail, Range: rng})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Resource != out[j].Resource {
+			return out[i].Resource < out[j].Resource
+		}
+		return out[i].Attr < out[j].Attr
+	})
+	return checked, out, nil
+}
+
+// unresolvedReason classifies why expr failed, from the functions it calls and
+// the diagnostics of its in-process evaluation.
+func unresolvedReason(expr string, diags hcl.Diagnostics) (string, string) {
+	parsed, pdiags := hclsyntax.ParseExpression([]byte(expr), "<check>", hcl.InitialPos)
+	if pdiags.HasErrors() {
+		return ReasonEvalFailed, pdiags[0].Summary
+	}
+	funcs := terraformFunctions()
+	reason, detail := "", ""
+	_ = hclsyntax.VisitAll(parsed, func(n hclsyntax.Node) hcl.Diagnostics {
+		call, ok := n.(*hclsyntax.FunctionCallExpr)
+		if !ok || reason != "" {
+			return nil
+		}
+		if strings.Contains(call.Name, "::") {
+			reason, detail = ReasonMissingProvider, call.Name
+		} else if _, known := funcs[call.Name]; !known {
+			reason, detail = ReasonUnknownFunction, call.Name
+		}
+		return nil
+	})
+	if reason != "" {
+		return reason, detail
+	}
+	for _, d := range diags {
+		if d.Severity != hcl.DiagError || d.Subject == nil {
+			continue
+		}
+		for _, tr := range parsed.Variables() {
+			r := tr.SourceRange()
+			if d.Subject.Start.Byte >= r.Start.Byte && d.Subject.Start.Byte < r.End.Byte {
+				return ReasonUnresolvedReference, expr[r.Start.Byte:r.End.Byte]
+			}
+		}
+	}
+	if len(diags) > 0 {
+		return ReasonEvalFailed, diags[0].Summary
+	}
+	// No error, but the value depends on something only known after apply
+	if refs := parsed.Variables(); len(refs) > 0 {
+		r := refs[0].SourceRange()
+		return ReasonUnresolvedReference, expr[r.Start.Byte:r.End.Byte]
+	}
+	return ReasonEvalFailed, "value is not known"
+}
@@ -0,0 +1,51 @@
+package terraform
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestCheckConfig_ReportsUnresolvedAttribute(t *testing.T) {
+	// Without terraform on PATH only the in-process evaluator can resolve
+	t.Setenv("PATH", t.TempDir())
+	defer ResetAllPersistentEvaluators()
+	dir := filepath.Join(repoRoot(t), "test", "fixtures", "check_unresolved")
+
+	checked, unresolved, err := CheckConfig(dir, dir, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 2 {
+		t.Fatalf("checked %d attributes, want 2", checked)
+	}
+	want := UnresolvedAttr{Resource: "null_resource.broken", Attr: "triggers", Expr: "{\n    owner = local.owner\n  }", Reason: ReasonUnresolvedReference, Detail: "local.owner"}
+	if len(unresolved) != 1 {
+		t.Fatalf("unresolved = %#v, want %#v", unresolved, want)
+	}
+	got := unresolved[0]
+	if r := got.Range; r.Filename != "main.tf" || r.Start.Line != 17 || r.End.Line != 19 {
+		t.Fatalf("range = %s, want main.tf lines 17-19", r)
+	}
+	got.Range = hcl.Range{}
+	if got != want {
+		t.Fatalf("unresolved = %#v, want %#v", got, want)
+	}
+}
+
+func TestUnresolvedReason(t *testing.T) {
+	cases := []struct {
+		expr, reason, detail string
+	}{
+		{`provider::aws::arn_parse(var.arn)`, ReasonMissingProvider, "provider::aws::arn_parse"},
+		{`upper(timestamp())`, ReasonUnknownFunction, "timestamp"},
+		{`"${data.aws_ami.ubuntu.id}-x"`, ReasonUnresolvedReference, "data.aws_ami.ubuntu.id"},
+	}
+	for _, c := range cases {
+		_, diags := evalInProcessDiags(t.TempDir(), nil, nil, c.expr)
+		if reason, detail := unresolvedReason(c.expr, diags); reason != c.reason || detail != c.detail {
+			t.Fatalf("%s: got (%s, %s), want (%s, %s)", c.expr, reason, detail, c.reason, c.detail)
+		}
+	}
+}
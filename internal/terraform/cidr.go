@@ -0,0 +1,179 @@
+package terraform
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+
+	cty "github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// The cidr* functions follow Terraform's implementations: addresses are
+// treated as integers so IPv4 and IPv6 share the arithmetic, and every invalid
+// input is an error so try() and can() can fall back.
+
+var cidrHostFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "hostnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		network, err := parseCIDRArg(args[0])
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		hostNum, err := wholeNumberArg(args[1], 1)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		prefixLen, bits := network.Mask.Size()
+		size := new(big.Int).Lsh(big.NewInt(1), uint(bits-prefixLen))
+		if hostNum.Sign() < 0 {
+			hostNum.Add(hostNum, size)
+		}
+		if hostNum.Sign() < 0 || hostNum.Cmp(size) >= 0 {
+			return cty.UnknownVal(cty.String), fmt.Errorf("prefix of %d bits cannot accommodate a host numbered %s", prefixLen, args[1].AsBigFloat().Text('f', -1))
+		}
+		ip := intToIP(hostNum.Add(hostNum, ipToInt(network.IP)), len(network.IP))
+		return cty.StringVal(ip.String()), nil
+	},
+})
+
+var cidrNetmaskFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{Name: "prefix", Type: cty.String}},
+	Type:   function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		network, err := parseCIDRArg(args[0])
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		if len(network.IP) != net.IPv4len {
+			return cty.UnknownVal(cty.String), fmt.Errorf("IPv6 addresses cannot have a netmask: %s", args[0].AsString())
+		}
+		return cty.StringVal(net.IP(network.Mask).String()), nil
+	},
+})
+
+var cidrSubnetFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "newbits", Type: cty.Number},
+		{Name: "netnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		network, err := parseCIDRArg(args[0])
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		newBits, err := wholeNumberArg(args[1], 1)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		netNum, err := wholeNumberArg(args[2], 2)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		prefixLen, bits := network.Mask.Size()
+		if newBits.Sign() < 0 || !newBits.IsInt64() || prefixLen+int(newBits.Int64()) > bits {
+			return cty.UnknownVal(cty.String), fmt.Errorf("insufficient address space to extend prefix of %d by %s", prefixLen, newBits)
+		}
+		newLen := prefixLen + int(newBits.Int64())
+		if netNum.Sign() < 0 || netNum.BitLen() > newLen-prefixLen {
+			return cty.UnknownVal(cty.String), fmt.Errorf("prefix extension of %s does not accommodate a subnet numbered %s", newBits, netNum)
+		}
+		base := ipToInt(network.IP)
+		base.Or(base, netNum.Lsh(netNum, uint(bits-newLen)))
+		return cty.StringVal(cidrString(base, newLen, len(network.IP))), nil
+	},
+})
+
+var cidrSubnetsFunc = function.New(&function.Spec{
+	Params:   []function.Parameter{{Name: "prefix", Type: cty.String}},
+	VarParam: &function.Parameter{Name: "newbits", Type: cty.Number},
+	Type:     function.StaticReturnType(cty.List(cty.String)),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		network, err := parseCIDRArg(args[0])
+		if err != nil {
+			return cty.UnknownVal(cty.List(cty.String)), err
+		}
+		if len(args) == 1 {
+			return cty.ListValEmpty(cty.String), nil
+		}
+		prefixLen, bits := network.Mask.Size()
+		start := ipToInt(network.IP)
+		end := new(big.Int).Add(start, new(big.Int).Lsh(big.NewInt(1), uint(bits-prefixLen)))
+		next := new(big.Int).Set(start)
+		last := network.String()
+		out := make([]cty.Value, 0, len(args)-1)
+		for i, arg := range args[1:] {
+			n, err := wholeNumberArg(arg, i+1)
+			if err != nil {
+				return cty.UnknownVal(cty.List(cty.String)), err
+			}
+			if n.Sign() < 1 {
+				return cty.UnknownVal(cty.List(cty.String)), function.NewArgErrorf(i+1, "must extend prefix by at least one bit")
+			}
+			if !n.IsInt64() || prefixLen+int(n.Int64()) > bits {
+				return cty.UnknownVal(cty.List(cty.String)), function.NewArgErrorf(i+1, "would extend prefix to %s bits, which is too long for an IPv%d address", new(big.Int).Add(n, big.NewInt(int64(prefixLen))), ipVersion(network.IP))
+			}
+			newLen := prefixLen + int(n.Int64())
+			// Align to the next block of this size, as consecutive allocation does
+			block := new(big.Int).Lsh(big.NewInt(1), uint(bits-newLen))
+			if rem := new(big.Int).Mod(next, block); rem.Sign() != 0 {
+				next.Add(next, new(big.Int).Sub(block, rem))
+			}
+			if new(big.Int).Add(next, block).Cmp(end) > 0 {
+				return cty.UnknownVal(cty.List(cty.String)), function.NewArgErrorf(i+1, "not enough remaining address space for a subnet with a prefix of %d bits after %s", newLen, last)
+			}
+			last = cidrString(next, newLen, len(network.IP))
+			out = append(out, cty.StringVal(last))
+			next.Add(next, block)
+		}
+		return cty.ListVal(out), nil
+	},
+})
+
+// parseCIDRArg parses a CIDR prefix argument, normalizing IPv4 networks to
+// their 4-byte form.
+func parseCIDRArg(v cty.Value) (*net.IPNet, error) {
+	_, network, err := net.ParseCIDR(v.AsString())
+	if err != nil {
+		return nil, function.NewArgErrorf(0, "invalid CIDR expression: %s", err)
+	}
+	if ip4 := network.IP.To4(); ip4 != nil {
+		network.IP = ip4
+	}
+	return network, nil
+}
+
+// wholeNumberArg converts argument idx to an integer, rejecting fractions.
+func wholeNumberArg(v cty.Value, idx int) (*big.Int, error) {
+	bf := v.AsBigFloat()
+	if !bf.IsInt() {
+		return nil, function.NewArgErrorf(idx, "value must be a whole number, got %s", bf.Text('f', -1))
+	}
+	n, _ := bf.Int(nil)
+	return n, nil
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	return new(big.Int).SetBytes(ip)
+}
+
+func intToIP(n *big.Int, size int) net.IP {
+	return n.FillBytes(make([]byte, size))
+}
+
+func cidrString(base *big.Int, prefixLen, size int) string {
+	return (&net.IPNet{IP: intToIP(base, size), Mask: net.CIDRMask(prefixLen, size*8)}).String()
+}
+
+func ipVersion(ip net.IP) int {
+	if len(ip) == net.IPv4len {
+		return 4
+	}
+	return 6
+}
@@ -0,0 +1,90 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// computedAttrs holds the computed attributes of each resource and data source
+// type whose provider schema has been loaded, keyed by mode and type
+// ("managed.random_pet").
+var (
+	computedAttrsMu sync.RWMutex
+	computedAttrs   = map[string][]string{}
+)
+
+// rememberComputedAttributes records the computed attributes of the schemas in
+// idx, so synthesized state can name them even when configuration sets none.
+func rememberComputedAttributes(idx *SymbolIndex) {
+	computedAttrsMu.Lock()
+	defer computedAttrsMu.Unlock()
+	for mode, schemas := range map[string]map[string][]SchemaAttribute{"managed": idx.ResourceSchemas, "data": idx.DataSchemas} {
+		for typ, attrs := range schemas {
+			var names []string
+			for _, a := range attrs {
+				if a.Computed && !strings.HasPrefix(a.Type, "block") {
+					names = append(names, a.Name)
+				}
+			}
+			computedAttrs[mode+"."+typ] = names
+		}
+	}
+}
+
+// seedComputedAttributes gives every instance of resources an attributes
+// object and, for types with a known schema, a null placeholder for each
+// computed attribute it lacks. A reference such as random_pet.p.id then
+// evaluates to null instead of failing on a missing key when configuration
+// sets no attribute at all. Reports whether anything changed.
+func seedComputedAttributes(resources []any) bool {
+	computedAttrsMu.RLock()
+	defer computedAttrsMu.RUnlock()
+	changed := false
+	for _, r := range resources {
+		res, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		mode, _ := res["mode"].(string)
+		rType, _ := res["type"].(string)
+		names := computedAttrs[mode+"."+rType]
+		insts, _ := res["instances"].([]any)
+		for _, it := range insts {
+			im, ok := it.(map[string]any)
+			if !ok {
+				continue
+			}
+			attrs, _ := im["attributes"].(map[string]any)
+			if attrs == nil {
+				attrs = map[string]any{}
+				im["attributes"] = attrs
+				changed = true
+			}
+			for _, name := range names {
+				if _, exists := attrs[name]; !exists {
+					attrs[name] = nil
+					changed = true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// SeedComputedAttributes applies seedComputedAttributes to the state at
+// statePath, for schemas loaded after the state was last patched.
+func SeedComputedAttributes(statePath string) error {
+	unlock := lockState(statePath)
+	defer unlock()
+	st, _, _, err := readStateCached(statePath)
+	if err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+	resources, _ := st["resources"].([]any)
+	if !seedComputedAttributes(resources) {
+		return nil
+	}
+	bumpSerial(st)
+	return writeStateAtomicRaw(statePath, st)
+}
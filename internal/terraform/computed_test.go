@@ -0,0 +1,76 @@
+package terraform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPatchStateFromConfigEvaluatedFast_EmptyResourceBody(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	defer ResetAllPersistentEvaluators()
+	t.Cleanup(func() {
+		computedAttrsMu.Lock()
+		computedAttrs = map[string][]string{}
+		computedAttrsMu.Unlock()
+	})
+	dir := filepath.Join(repoRoot(t), "test", "fixtures", "empty_resource")
+	statePath := filepath.Join(t.TempDir(), "terraform.tfstate")
+	readInstance := func() map[string]any {
+		t.Helper()
+		b, err := os.ReadFile(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var st struct {
+			Resources []struct {
+				Type      string           `json:"type"`
+				Provider  string           `json:"provider"`
+				Instances []map[string]any `json:"instances"`
+			} `json:"resources"`
+		}
+		if err := json.Unmarshal(b, &st); err != nil {
+			t.Fatal(err)
+		}
+		if len(st.Resources) != 1 || len(st.Resources[0].Instances) != 1 {
+			t.Fatalf("want one random_pet instance, got %s", b)
+		}
+		if st.Resources[0].Provider != `provider["registry.terraform.io/hashicorp/random"]` {
+			t.Fatalf("provider = %q", st.Resources[0].Provider)
+		}
+		return st.Resources[0].Instances[0]
+	}
+
+	if err := PatchStateFromConfigEvaluatedFast(dir, dir, statePath, nil); err != nil {
+		t.Fatal(err)
+	}
+	inst := readInstance()
+	if attrs, ok := inst["attributes"].(map[string]any); !ok || len(attrs) != 0 || inst["schema_version"] != float64(0) {
+		t.Fatalf("instance without a schema = %v, want empty attributes", inst)
+	}
+
+	// Once the provider schema is known its computed attributes get placeholders
+	idx := &SymbolIndex{ResourceAttrs: map[string][]string{}, DataAttrs: map[string][]string{}}
+	if err := applyProviderSchemas([]byte(`{"provider_schemas": {"registry.terraform.io/hashicorp/random": {"resource_schemas": {
+  "random_pet": {"block": {"attributes": {
+    "id": {"type": "string", "computed": true},
+    "length": {"type": "number", "optional": true},
+    "separator": {"type": "string", "optional": true, "computed": true}
+  }}}
+}}}}`), idx); err != nil {
+		t.Fatal(err)
+	}
+	if err := SeedComputedAttributes(statePath); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"id": nil, "separator": nil}
+	if got := readInstance()["attributes"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("attributes = %#v, want %#v", got, want)
+	}
+	if v, ok := TryEvalInProcessWithState(dir, statePath, nil, "random_pet.p.id == null", time.Second); !ok || v != true {
+		t.Fatalf("random_pet.p.id == null = %v (ok=%v), want true", v, ok)
+	}
+}
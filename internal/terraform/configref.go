@@ -0,0 +1,181 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// ConfigNamespace is the root of the console's references to the configured
+// attributes of root module resources: config.<type>.<name> and
+// config.data.<type>.<name>. Unlike <type>.<name>, they need no state.
+const ConfigNamespace = "config"
+
+// configNode is a step of the config namespace: a resource, whose object holds
+// its configured attributes, or a level of types or names below it.
+type configNode struct {
+	children map[string]*configNode
+	object   string
+}
+
+func (n *configNode) child(name string) *configNode {
+	c, ok := n.children[name]
+	if !ok {
+		c = &configNode{children: map[string]*configNode{}}
+		n.children[name] = c
+	}
+	return c
+}
+
+// render returns an HCL expression for the node's value.
+func (n *configNode) render() string {
+	if n.object != "" {
+		return n.object
+	}
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + " = " + n.children[name].render()
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// ExpandConfigReferences replaces references into the config namespace in expr
+// by object constructors of what the root module in rootDir configures, so they
+// evaluate in-process and in terraform console alike. Literal attributes are
+// copied; other expressions are wrapped in try(..., null) so one that cannot
+// be evaluated does not fail the rest, and those using count, each or self are
+// left out. The result stays on one line, as terraform console needs. expr is
+// returned unchanged when it holds no such reference or does not parse,
+// leaving the error to the evaluator.
+func ExpandConfigReferences(rootDir, expr string) (string, error) {
+	if !strings.Contains(expr, ConfigNamespace) {
+		return expr, nil
+	}
+	syn, diags := hclsyntax.ParseExpression([]byte(expr), "<console-input>", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return expr, nil
+	}
+	var refs []hcl.Traversal
+	for _, t := range syn.Variables() {
+		if t.RootName() == ConfigNamespace {
+			refs = append(refs, t)
+		}
+	}
+	if len(refs) == 0 {
+		return expr, nil
+	}
+	// Replace from the end so the offsets of earlier references stay valid
+	sort.Slice(refs, func(i, j int) bool { return refs[i].SourceRange().Start.Byte > refs[j].SourceRange().Start.Byte })
+	root := rootConfigTree(rootDir)
+	for _, t := range refs {
+		node, path := root, []string{ConfigNamespace}
+		end := t[0].SourceRange().End.Byte
+		for _, step := range t[1:] {
+			a, ok := step.(hcl.TraverseAttr)
+			if !ok || node.object != "" {
+				break
+			}
+			next, ok := node.children[a.Name]
+			if !ok {
+				return "", fmt.Errorf("%s.%s is not declared in the root module", strings.Join(path, "."), a.Name)
+			}
+			node, path, end = next, append(path, a.Name), a.SrcRange.End.Byte
+		}
+		start := t.SourceRange().Start.Byte
+		expr = expr[:start] + "(" + node.render() + ")" + expr[end:]
+	}
+	return expr, nil
+}
+
+// rootConfigTree collects the resources and data sources of the module in dir
+// into the config namespace.
+func rootConfigTree(dir string) *configNode {
+	root := &configNode{children: map[string]*configNode{}}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return root
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.ToLower(filepath.Ext(e.Name())) != ".tf" {
+			continue
+		}
+		src, f, ok := getSyntaxFileCached(filepath.Join(dir, e.Name()))
+		if !ok || f == nil {
+			continue
+		}
+		body, ok := f.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, blk := range body.Blocks {
+			mode, ok := blockMode(blk)
+			if !ok {
+				continue
+			}
+			types := root
+			if mode == "data" {
+				types = root.child("data")
+			}
+			types.child(blk.Labels[0]).child(blk.Labels[1]).object = configObject(src, blk.Body)
+		}
+	}
+	return root
+}
+
+// configObject renders the attributes and nested blocks of body as an object
+// constructor, nested blocks as lists of objects by type.
+func configObject(src []byte, body *hclsyntax.Body) string {
+	fields := map[string]string{}
+	for k, a := range body.Attributes {
+		if isMetaArg(k) || usesInstanceRefs(a.Expr) {
+			continue
+		}
+		if v, ok := constValue(a.Expr); ok {
+			fields[k] = hclLiteral(v)
+		} else if s := exprSource(src, a.Expr); s != "" {
+			fields[k] = "try((" + singleLineExpr(s) + "), null)"
+		}
+	}
+	blocks := map[string][]string{}
+	for _, blk := range body.Blocks {
+		if blk.Type == "dynamic" || isMetaArg(blk.Type) {
+			continue
+		}
+		blocks[blk.Type] = append(blocks[blk.Type], configObject(src, blk.Body))
+	}
+	for k, objs := range blocks {
+		fields[k] = "[" + strings.Join(objs, ", ") + "]"
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + " = " + fields[k]
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// usesInstanceRefs reports whether expr refers to count, each or self, which
+// have no value outside a resource instance.
+func usesInstanceRefs(expr hclsyntax.Expression) bool {
+	for _, t := range expr.Variables() {
+		switch t.RootName() {
+		case "count", "each", "self":
+			return true
+		}
+	}
+	return false
+}
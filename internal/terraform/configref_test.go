@@ -0,0 +1,77 @@
+package terraform
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandConfigReferences_ResolvesConfiguredValues(t *testing.T) {
+	// Without terraform on PATH only the in-process evaluator answers
+	t.Setenv("PATH", t.TempDir())
+	dir := filepath.Join(repoRoot(t), "test", "fixtures", "config_namespace")
+
+	for _, tc := range []struct {
+		expr string
+		want any
+	}{
+		{"config.aws_instance.web.tags", map[string]any{"Name": "web", "team": "platform"}},
+		{"config.aws_instance.web.root_block_device[0].volume_size", float64(20)},
+		// Attributes using count.index are left out
+		{`keys(config.aws_instance.workers)`, []any{"ami"}},
+		{"config.data.aws_ami.ubuntu.owners", []any{"099720109477"}},
+		{`keys(config.aws_instance)`, []any{"web", "workers"}},
+	} {
+		expanded, err := ExpandConfigReferences(dir, tc.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		if got := evalInProcess(t, dir, expanded); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s = %#v, want %#v", tc.expr, got, tc.want)
+		}
+	}
+	// aws_subnet.main is not in state, so its try() is left to terraform console
+	expanded, err := ExpandConfigReferences(dir, "config.aws_instance.web.subnet_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := TryEvalInProcess(dir, nil, expanded, time.Second); ok {
+		t.Fatalf("config.aws_instance.web.subnet_id: expected fallback, got %#v", v)
+	}
+
+	if _, err := ExpandConfigReferences(dir, "config.aws_instance.db.tags"); err == nil || !strings.Contains(err.Error(), "config.aws_instance.db is not declared") {
+		t.Fatalf("undeclared resource: err = %v", err)
+	}
+	// Expressions without the namespace, or binding it locally, are untouched
+	for _, expr := range []string{`upper("config")`, `[for config in ["a"] : config]`} {
+		if got, err := ExpandConfigReferences(dir, expr); err != nil || got != expr {
+			t.Fatalf("%s expanded to %q (err %v)", expr, got, err)
+		}
+	}
+}
+
+func TestCompletionCandidates_ConfigNamespace(t *testing.T) {
+	idx := &SymbolIndex{
+		Variables:     []string{"region"},
+		Resource:      map[string][]string{"aws_instance": {"web", "inner"}},
+		ResourceAttrs: map[string][]string{"aws_instance": {"ami", "tags"}},
+		DataSource:    map[string][]string{"aws_ami": {"ubuntu"}},
+		Origins: map[string][]string{
+			"aws_instance.web":   {""},
+			"aws_instance.inner": {"module.app"},
+		},
+	}
+	for line, want := range map[string][]string{
+		"conf":                      {"config."},
+		"config.":                   {"config.aws_instance", "config.data."},
+		"config.aws_instance.":      {"config.aws_instance.web"},
+		"config.aws_instance.web.t": {"config.aws_instance.web.tags"},
+		"config.data.aws_ami.":      {"config.data.aws_ami.ubuntu"},
+	} {
+		if got, _, _ := idx.CompletionCandidates(line, len(line)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %#v, want %#v", line, got, want)
+		}
+	}
+}
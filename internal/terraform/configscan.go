@@ -1,8 +1,6 @@
 package terraform
 
 import (
-	"encoding/json"
-	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
@@ -11,33 +9,82 @@ import (
 
 	"sync"
 
+	"github.com/flowave-io/terraflow/internal/encoding/jsonx"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
-	"github.com/hashicorp/terraform-config-inspect/tfconfig"
 	cty "github.com/zclconf/go-cty/cty"
 )
 
-// ResourceConfig represents a managed resource discovered in configuration.
+// ResourceConfig represents a managed resource or data source discovered in configuration.
 type ResourceConfig struct {
 	ModulePath []string // module call names in order from root
+	// ModuleKeys holds the instance key of each call in ModulePath for modules
+	// below a call with count or for_each (nil for calls without); nil otherwise.
+	ModuleKeys []any
+	Mode       string // "managed" or "data"; empty means managed
 	Type       string
 	Name       string
 	Attrs      map[string]any // only literal attributes captured
+	Provider   string         // provider meta-argument such as "aws.west"; empty when implicit
+	// Instances holds the attributes of each instance of a for_each resource by
+	// instance key, with each.key/each.value bound; nil for other resources.
+	Instances map[string]map[string]any
+	// Provenance records where each attribute value came from; nil unless
+	// EnableStateProvenance was called.
+	Provenance map[string]AttrProvenance
+}
+
+// moduleAddress returns the module instance of the resource as written in
+// state, such as module.envs["prod"].
+func (rc ResourceConfig) moduleAddress() string {
+	return moduleInstanceAddress(rc.ModulePath, rc.ModuleKeys)
+}
+
+// mode returns the state mode of the resource, defaulting to managed.
+func (rc ResourceConfig) mode() string {
+	if rc.Mode == "" {
+		return "managed"
+	}
+	return rc.Mode
+}
+
+// blockMode returns the state mode for a resource or data block, or false for
+// any other block.
+func blockMode(blk *hclsyntax.Block) (string, bool) {
+	if blk == nil || len(blk.Labels) < 2 {
+		return "", false
+	}
+	switch blk.Type {
+	case "resource":
+		return "managed", true
+	case "data":
+		return "data", true
+	}
+	return "", false
 }
 
 // scanResInfo is used by global-batch evaluation to collect literals and expressions per resource.
 type scanResInfo struct {
 	modulePath []string
+	moduleDir  string // absolute directory of the module, for path.module
+	mode       string
 	rType      string
 	rName      string
 	lit        map[string]any
+	litSrc     map[string]string // source of each entry in lit
 	exprs      map[string]string
+	ranges     map[string]hcl.Range // source range of each entry in exprs
+	provider   string
+	forEach    string // source of the for_each expression; empty without one
+	moduleKeys []any  // instance keys of the module calls, see ResourceConfig.ModuleKeys
+	vars       string // input variables of the module instance, see moduleInstance
 }
 
 // BuildResourceConfigs walks the root module and any nested local modules,
 // returning managed resources with literal attributes.
 func BuildResourceConfigs(rootDir string) ([]ResourceConfig, error) {
 	abs, _ := filepath.Abs(rootDir)
+	focus := currentFocus()
 	var out []ResourceConfig
 
 	// Prefer module index (covers registry modules) if available
@@ -50,57 +97,32 @@ func BuildResourceConfigs(rootDir string) ([]ResourceConfig, error) {
 		for _, k := range keys {
 			dir := modMap[k]
 			mp := splitModuleKey(k)
+			if !focus.coversModule(mp) {
+				continue
+			}
 			resCfgs, perr := parseModuleResources(dir, mp)
 			if perr != nil {
 				return out, perr
 			}
-			out = append(out, resCfgs...)
+			out = append(out, focus.filter(resCfgs)...)
 		}
 		return out, nil
 	}
 
 	// Fallback: local-only recursion using tfconfig
-	visited := map[string]struct{}{}
-	var walkModule func(moduleDir string, modulePath []string) error
-	walkModule = func(moduleDir string, modulePath []string) error {
-		absMod, _ := filepath.Abs(moduleDir)
-		if _, ok := visited[absMod]; ok {
+	walkErr := walkLocalModules(abs, func(absMod string, modulePath []string) error {
+		if !focus.coversModule(modulePath) {
 			return nil
 		}
-		visited[absMod] = struct{}{}
 		resCfgs, err := parseModuleResources(absMod, modulePath)
 		if err != nil {
 			return err
 		}
-		out = append(out, resCfgs...)
-		mod, diags := tfconfig.LoadModule(absMod)
-		if diags != nil && diags.HasErrors() {
-			return fmt.Errorf("%s: %s", absMod, diags.Error())
-		}
-		if mod == nil {
-			return nil
-		}
-		for name, call := range mod.ModuleCalls {
-			if call == nil || strings.TrimSpace(call.Source) == "" {
-				continue
-			}
-			src := call.Source
-			if strings.HasPrefix(src, "./") || strings.HasPrefix(src, "../") || filepath.IsAbs(src) {
-				next := src
-				if !filepath.IsAbs(next) {
-					next = filepath.Join(absMod, src)
-				}
-				if fi, err := os.Stat(next); err == nil && fi.IsDir() {
-					if err := walkModule(next, append(append([]string{}, modulePath...), name)); err != nil {
-						return err
-					}
-				}
-			}
-		}
+		out = append(out, focus.filter(resCfgs)...)
 		return nil
-	}
-	if err := walkModule(abs, nil); err != nil {
-		return out, err
+	})
+	if walkErr != nil {
+		return out, walkErr
 	}
 	return out, nil
 }
@@ -108,9 +130,11 @@ func BuildResourceConfigs(rootDir string) ([]ResourceConfig, error) {
 // BuildResourceConfigsEvaluated is like BuildResourceConfigs but attempts to
 // evaluate non-literal expressions via terraform console to obtain values.
 // workDir/statePath/varFiles should match the console's evaluation context
-// (typically the .terraflow scratch directory and its state file).
+// (typically the .terraflow scratch directory and its state file). Resources
+// of modules called with count or for_each are repeated for every instance.
 func BuildResourceConfigsEvaluated(rootDir, workDir, statePath string, varFiles []string) ([]ResourceConfig, error) {
 	abs, _ := filepath.Abs(rootDir)
+	focus := currentFocus()
 	var out []ResourceConfig
 	// simple per-refresh cache: expression source -> evaluated value
 	evalCache := map[string]any{}
@@ -121,126 +145,55 @@ func BuildResourceConfigsEvaluated(rootDir, workDir, statePath string, varFiles
 			keys = append(keys, k)
 		}
 		sort.Strings(keys)
-		for _, k := range keys {
-			dir := modMap[k]
-			mp := splitModuleKey(k)
-			resCfgs, perr := parseModuleResourcesWithEval(dir, mp, workDir, statePath, varFiles, evalCache)
-			if perr != nil {
-				return out, perr
-			}
-			out = append(out, resCfgs...)
-		}
-		return out, nil
+		// Modules are scanned in parallel; results are joined in key order
+		results := make([][]ResourceConfig, len(keys))
+		errs := make([]error, len(keys))
+		forEachParallel(len(keys), func(i int) {
+			mp := splitModuleKey(keys[i])
+			if !focus.coversModule(mp) {
+				return
+			}
+			resCfgs, perr := parseModuleResourcesWithEval(abs, modMap[keys[i]], mp, workDir, statePath, varFiles, evalCache)
+			results[i], errs[i] = focus.filter(resCfgs), perr
+		})
+		for i := range keys {
+			if errs[i] != nil {
+				return out, errs[i]
+			}
+			out = append(out, results[i]...)
+		}
+		return expandResourceInstances(out, evaluatedModuleInstances(abs, workDir, statePath, varFiles)), nil
 	}
 
-	visited := map[string]struct{}{}
-	var walkModule func(moduleDir string, modulePath []string) error
-	walkModule = func(moduleDir string, modulePath []string) error {
-		absMod, _ := filepath.Abs(moduleDir)
-		if _, ok := visited[absMod]; ok {
+	walkErr := walkLocalModules(abs, func(absMod string, modulePath []string) error {
+		if !focus.coversModule(modulePath) {
 			return nil
 		}
-		visited[absMod] = struct{}{}
-		resCfgs, err := parseModuleResourcesWithEval(absMod, modulePath, workDir, statePath, varFiles, evalCache)
+		resCfgs, err := parseModuleResourcesWithEval(abs, absMod, modulePath, workDir, statePath, varFiles, evalCache)
 		if err != nil {
 			return err
 		}
-		out = append(out, resCfgs...)
-		mod, diags := tfconfig.LoadModule(absMod)
-		if diags != nil && diags.HasErrors() {
-			return fmt.Errorf("%s: %s", absMod, diags.Error())
-		}
-		if mod == nil {
-			return nil
-		}
-		for name, call := range mod.ModuleCalls {
-			if call == nil || strings.TrimSpace(call.Source) == "" {
-				continue
-			}
-			src := call.Source
-			if strings.HasPrefix(src, "./") || strings.HasPrefix(src, "../") || filepath.IsAbs(src) {
-				next := src
-				if !filepath.IsAbs(next) {
-					next = filepath.Join(absMod, src)
-				}
-				if fi, err := os.Stat(next); err == nil && fi.IsDir() {
-					if err := walkModule(next, append(append([]string{}, modulePath...), name)); err != nil {
-						return err
-					}
-				}
-			}
-		}
+		out = append(out, focus.filter(resCfgs)...)
 		return nil
+	})
+	if walkErr != nil {
+		return out, walkErr
 	}
-	if err := walkModule(abs, nil); err != nil {
-		return out, err
-	}
-	return out, nil
+	return expandResourceInstances(out, evaluatedModuleInstances(abs, workDir, statePath, varFiles)), nil
 }
 
 // BuildResourceConfigsEvaluatedGlobal scans all modules and evaluates all non-literal
 // resource attributes in a single batched terraform console invocation for speed.
-// Literal attributes are merged with evaluated results.
+// Literal attributes are merged with evaluated results. Resources of modules
+// called with count or for_each are evaluated once per instance, with var bound
+// to the instance's input variables.
 func BuildResourceConfigsEvaluatedGlobal(rootDir, workDir, statePath string, varFiles []string) ([]ResourceConfig, error) {
-	abs, _ := filepath.Abs(rootDir)
-	var collected []scanResInfo
-
-	// Walk modules similar to BuildResourceConfigs
-	if modMap, err := resolveModuleDirs(abs); err == nil && len(modMap) > 0 {
-		keys := make([]string, 0, len(modMap))
-		for k := range modMap {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		for _, k := range keys {
-			dir := modMap[k]
-			mp := splitModuleKey(k)
-			if err := collectModuleExpressions(dir, mp, &collected); err != nil {
-				return nil, err
-			}
-		}
-	} else {
-		visited := map[string]struct{}{}
-		var walkModule func(moduleDir string, modulePath []string) error
-		walkModule = func(moduleDir string, modulePath []string) error {
-			absMod, _ := filepath.Abs(moduleDir)
-			if _, ok := visited[absMod]; ok {
-				return nil
-			}
-			visited[absMod] = struct{}{}
-			if err := collectModuleExpressions(absMod, modulePath, &collected); err != nil {
-				return err
-			}
-			mod, diags := tfconfig.LoadModule(absMod)
-			if diags != nil && diags.HasErrors() {
-				return fmt.Errorf("%s: %s", absMod, diags.Error())
-			}
-			if mod == nil {
-				return nil
-			}
-			for name, call := range mod.ModuleCalls {
-				if call == nil || strings.TrimSpace(call.Source) == "" {
-					continue
-				}
-				src := call.Source
-				if strings.HasPrefix(src, "./") || strings.HasPrefix(src, "../") || filepath.IsAbs(src) {
-					next := src
-					if !filepath.IsAbs(next) {
-						next = filepath.Join(absMod, src)
-					}
-					if fi, err := os.Stat(next); err == nil && fi.IsDir() {
-						if err := walkModule(next, append(append([]string{}, modulePath...), name)); err != nil {
-							return err
-						}
-					}
-				}
-			}
-			return nil
-		}
-		if err := walkModule(abs, nil); err != nil {
-			return nil, err
-		}
+	collected, err := collectFocusedExpressions(rootDir)
+	if err != nil {
+		return nil, err
 	}
+	collected = expandScanInstances(collected, evaluatedModuleInstances(rootDir, workDir, statePath, varFiles))
+	abs, _ := filepath.Abs(rootDir)
 
 	// Build single batched evaluation as a list of { k = "mod|type.name", v = { ...attrs... } }
 	// Using a list avoids invalid HCL object keys (quoted/with dots) in constructors.
@@ -249,37 +202,46 @@ func BuildResourceConfigsEvaluatedGlobal(rootDir, workDir, statePath string, var
 	b.WriteByte('[')
 	firstRes := true
 	for _, ri := range collected {
-		if len(ri.exprs) == 0 {
+		if len(ri.exprs) == 0 && ri.forEach == "" {
 			continue
 		}
 		if !firstRes {
 			b.WriteByte(',')
 		}
 		firstRes = false
-		b.WriteString("{ k = \"")
-		b.WriteString(modulePathToString(ri.modulePath))
-		b.WriteString("|")
-		b.WriteString(ri.rType)
-		b.WriteByte('.')
-		b.WriteString(ri.rName)
-		b.WriteString("\", v = {")
+		b.WriteString("{ k = ")
+		b.WriteString(hclString(moduleInstanceAddress(ri.modulePath, ri.moduleKeys) + "|" + batchAddr(ri.mode, ri.rType, ri.rName)))
+		moduleRel := modulePathRel(abs, ri.moduleDir)
+		if ri.forEach != "" {
+			// for_each resources report their instances under i instead of v
+			b.WriteString(", i = ")
+			b.WriteString(bindModuleVars(ri.vars, bindModulePath(abs, moduleRel, forEachInstancesExpr(ri.forEach, ri.exprs))))
+			b.WriteString(" }")
+			continue
+		}
+		var attrs strings.Builder
+		attrs.WriteByte('{')
 		firstAttr := true
 		for k, expr := range ri.exprs {
 			if !firstAttr {
-				b.WriteByte(',')
+				attrs.WriteByte(',')
 			}
 			firstAttr = false
-			b.WriteString(k)
-			b.WriteString(" = (")
-			b.WriteString(expr)
-			b.WriteString(")")
-		}
-		b.WriteString("} }")
+			attrs.WriteString(k)
+			attrs.WriteString(" = (")
+			attrs.WriteString(expr)
+			attrs.WriteString(")")
+		}
+		attrs.WriteByte('}')
+		b.WriteString(", v = ")
+		b.WriteString(bindModuleVars(ri.vars, bindModulePath(abs, moduleRel, attrs.String())))
+		b.WriteString(" }")
 	}
 	b.WriteByte(']')
 
 	evaluated := map[string]any{}
-	if v, ok := EvalJSON(workDir, statePath, varFiles, b.String(), 3*time.Second); ok {
+	v, source, ok := evalJSONSource(workDir, statePath, varFiles, b.String(), 3*time.Second)
+	if ok {
 		if arr, ok := v.([]any); ok {
 			for _, it := range arr {
 				if m, ok := it.(map[string]any); ok {
@@ -289,6 +251,8 @@ func BuildResourceConfigsEvaluatedGlobal(rootDir, workDir, statePath string, var
 					}
 					if val, ok := m["v"].(map[string]any); ok {
 						evaluated[k] = val
+					} else if insts, ok := m["i"].(map[string]any); ok {
+						evaluated[k] = insts
 					}
 				}
 			}
@@ -302,17 +266,131 @@ func BuildResourceConfigsEvaluatedGlobal(rootDir, workDir, statePath string, var
 		for k, v := range ri.lit {
 			attrs[k] = v
 		}
-		key := modulePathToString(ri.modulePath) + "|" + ri.rType + "." + ri.rName
-		if rm, ok := evaluated[key].(map[string]any); ok {
+		key := moduleInstanceAddress(ri.modulePath, ri.moduleKeys) + "|" + batchAddr(ri.mode, ri.rType, ri.rName)
+		rc := ResourceConfig{ModulePath: append([]string{}, ri.modulePath...), ModuleKeys: ri.moduleKeys, Mode: ri.mode, Type: ri.rType, Name: ri.rName, Attrs: attrs, Provider: ri.provider}
+		if ri.forEach != "" {
+			insts, _ := evaluated[key].(map[string]any)
+			rc.Instances = forEachInstances(ri.lit, insts)
+			rc.Provenance = attrProvenance(ri.litSrc, ri.exprs, instanceAttrSources(insts, source))
+		} else {
+			rm, _ := evaluated[key].(map[string]any)
 			for k, v := range rm {
 				attrs[k] = v
 			}
+			rc.Provenance = attrProvenance(ri.litSrc, ri.exprs, attrSources(rm, source))
 		}
-		out = append(out, ResourceConfig{ModulePath: append([]string{}, ri.modulePath...), Type: ri.rType, Name: ri.rName, Attrs: attrs})
+		out = append(out, rc)
 	}
 	return out, nil
 }
 
+// forEachInstancesExpr builds an expression evaluating to an object of the
+// instance keys of a for_each resource, each mapped to an object of its
+// non-literal attributes. each is bound by a single-element for expression, so
+// the attribute expressions are used verbatim both in-process and in terraform
+// console, where each is otherwise unavailable.
+func forEachInstancesExpr(forEach string, exprs map[string]string) string {
+	var b strings.Builder
+	b.WriteString("{ for key, value in (")
+	b.WriteString(forEach)
+	b.WriteString(") : key => [for each in [{ key = key, value = value }] : {")
+	first := true
+	for k, expr := range exprs {
+		if !first {
+			b.WriteByte(',')
+		}
+		first = false
+		b.WriteString(k)
+		b.WriteString(" = (")
+		b.WriteString(expr)
+		b.WriteString(")")
+	}
+	b.WriteString("}][0] }")
+	return b.String()
+}
+
+// forEachInstances merges the literal attributes of a for_each resource into
+// the evaluated attributes of each of its instances. It returns nil when the
+// instances could not be evaluated.
+func forEachInstances(lit map[string]any, evaluated map[string]any) map[string]map[string]any {
+	if evaluated == nil {
+		return nil
+	}
+	out := make(map[string]map[string]any, len(evaluated))
+	for key, v := range evaluated {
+		attrs := map[string]any{}
+		for k, lv := range lit {
+			attrs[k] = lv
+		}
+		if m, ok := v.(map[string]any); ok {
+			for k, ev := range m {
+				attrs[k] = ev
+			}
+		}
+		out[key] = attrs
+	}
+	return out
+}
+
+// collectFocusedExpressions gathers the literal and non-literal attributes of
+// every resource under rootDir that the current focus covers.
+func collectFocusedExpressions(rootDir string) ([]scanResInfo, error) {
+	abs, _ := filepath.Abs(rootDir)
+	focus := currentFocus()
+	var collected []scanResInfo
+
+	// Walk modules similar to BuildResourceConfigs
+	if modMap, err := resolveModuleDirs(abs); err == nil && len(modMap) > 0 {
+		keys := make([]string, 0, len(modMap))
+		for k := range modMap {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			dir := modMap[k]
+			mp := splitModuleKey(k)
+			if !focus.coversModule(mp) {
+				continue
+			}
+			if err := collectModuleExpressions(dir, mp, &collected); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		walkErr := walkLocalModules(abs, func(absMod string, modulePath []string) error {
+			if !focus.coversModule(modulePath) {
+				return nil
+			}
+			if err := collectModuleExpressions(absMod, modulePath, &collected); err != nil {
+				return err
+			}
+			return nil
+		})
+		if walkErr != nil {
+			return nil, walkErr
+		}
+	}
+
+	if len(focus) > 0 {
+		kept := collected[:0]
+		for _, ri := range collected {
+			if focus.Matches(ri.modulePath, ri.rType, ri.rName) {
+				kept = append(kept, ri)
+			}
+		}
+		collected = kept
+	}
+	return collected, nil
+}
+
+// batchAddr is the address of a resource within batched evaluation results.
+func batchAddr(mode, rType, rName string) string {
+	if mode == "data" {
+		return "data." + rType + "." + rName
+	}
+	return rType + "." + rName
+}
+
 // collectModuleExpressions parses a module directory to collect resources with
 // their literal attributes and string forms of non-literal expressions.
 func collectModuleExpressions(moduleDir string, modulePath []string, out *[]scanResInfo) error {
@@ -336,18 +414,22 @@ func collectModuleExpressions(moduleDir string, modulePath []string, out *[]scan
 		}
 		if body, ok := f.Body.(*hclsyntax.Body); ok {
 			for _, blk := range body.Blocks {
-				if blk == nil || blk.Type != "resource" || len(blk.Labels) < 2 {
+				mode, ok := blockMode(blk)
+				if !ok {
 					continue
 				}
 				rType, rName := blk.Labels[0], blk.Labels[1]
 				lit := map[string]any{}
+				litSrc := map[string]string{}
 				exprs := map[string]string{}
+				ranges := map[string]hcl.Range{}
 				for k, a := range blk.Body.Attributes {
 					if isMetaArg(k) {
 						continue
 					}
 					if v, ok := constValue(a.Expr); ok {
 						lit[k] = v
+						litSrc[k] = exprSource(src, a.Expr)
 						continue
 					}
 					r := a.Expr.Range()
@@ -356,9 +438,10 @@ func collectModuleExpressions(moduleDir string, modulePath []string, out *[]scan
 					}
 					if int(r.Start.Byte) >= 0 && int(r.End.Byte) <= len(src) && r.End.Byte >= r.Start.Byte {
 						exprs[k] = string(src[r.Start.Byte:r.End.Byte])
+						ranges[k] = a.Expr.Range()
 					}
 				}
-				*out = append(*out, scanResInfo{modulePath: append([]string{}, modulePath...), rType: rType, rName: rName, lit: lit, exprs: exprs})
+				*out = append(*out, scanResInfo{modulePath: append([]string{}, modulePath...), moduleDir: moduleDir, mode: mode, rType: rType, rName: rName, lit: lit, litSrc: litSrc, exprs: exprs, ranges: ranges, provider: providerRefFromBody(blk.Body), forEach: forEachSource(src, blk.Body)})
 			}
 		}
 		return nil
@@ -369,6 +452,26 @@ func collectModuleExpressions(moduleDir string, modulePath []string, out *[]scan
 	return nil
 }
 
+// exprSource returns the source text of expr within src, or "" when its range
+// falls outside src.
+func exprSource(src []byte, expr hcl.Expression) string {
+	r := expr.Range()
+	if int(r.Start.Byte) < 0 || int(r.End.Byte) > len(src) || r.End.Byte < r.Start.Byte {
+		return ""
+	}
+	return string(src[r.Start.Byte:r.End.Byte])
+}
+
+// forEachSource returns the source of the for_each meta-argument of a resource
+// body, or "" when it has none.
+func forEachSource(src []byte, body *hclsyntax.Body) string {
+	a, ok := body.Attributes["for_each"]
+	if !ok || a == nil {
+		return ""
+	}
+	return exprSource(src, a.Expr)
+}
+
 // -------- Cached HCL parsing to speed up refreshes --------
 var (
 	parseCacheMu sync.Mutex
@@ -397,7 +500,7 @@ func getSyntaxFileCached(path string) ([]byte, *hcl.File, bool) {
 	}
 	parseCacheMu.Unlock()
 	// Read and parse
-	src, rerr := os.ReadFile(path)
+	src, rerr := readConfigFile(path)
 	if rerr != nil {
 		return nil, nil, false
 	}
@@ -415,8 +518,9 @@ func getSyntaxFileCached(path string) ([]byte, *hcl.File, bool) {
 	return src, f, true
 }
 
-func parseModuleResourcesWithEval(moduleDir string, modulePath []string, workDir, statePath string, varFiles []string, evalCache map[string]any) ([]ResourceConfig, error) {
+func parseModuleResourcesWithEval(rootDir, moduleDir string, modulePath []string, workDir, statePath string, varFiles []string, evalCache map[string]any) ([]ResourceConfig, error) {
 	var out []ResourceConfig
+	moduleRel := modulePathRel(rootDir, moduleDir)
 	err := filepath.Walk(moduleDir, func(p string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
@@ -431,7 +535,7 @@ func parseModuleResourcesWithEval(moduleDir string, modulePath []string, workDir
 		if strings.ToLower(filepath.Ext(p)) != ".tf" {
 			return nil
 		}
-		src, rerr := os.ReadFile(p)
+		src, rerr := readConfigFile(p)
 		if rerr != nil {
 			return nil
 		}
@@ -442,17 +546,23 @@ func parseModuleResourcesWithEval(moduleDir string, modulePath []string, workDir
 		if body, ok := f.Body.(*hclsyntax.Body); ok {
 			// Gather per-resource literal attrs and expression attrs
 			type resInfo struct {
+				mode         string
 				rType, rName string
 				lit          map[string]any
+				litSrc       map[string]string
 				exprs        map[string]string
+				provider     string
+				forEach      string
 			}
 			resources := []resInfo{}
 			for _, blk := range body.Blocks {
-				if blk == nil || blk.Type != "resource" || len(blk.Labels) < 2 {
+				mode, ok := blockMode(blk)
+				if !ok {
 					continue
 				}
 				rType, rName := blk.Labels[0], blk.Labels[1]
 				lit := map[string]any{}
+				litSrc := map[string]string{}
 				exprs := map[string]string{}
 				// Collect attributes for batching
 				for k, a := range blk.Body.Attributes {
@@ -461,6 +571,7 @@ func parseModuleResourcesWithEval(moduleDir string, modulePath []string, workDir
 					}
 					if v, ok := constValue(a.Expr); ok {
 						lit[k] = v
+						litSrc[k] = exprSource(src, a.Expr)
 						continue
 					}
 					r := a.Expr.Range()
@@ -471,15 +582,18 @@ func parseModuleResourcesWithEval(moduleDir string, modulePath []string, workDir
 						exprs[k] = string(src[r.Start.Byte:r.End.Byte])
 					}
 				}
-				resources = append(resources, resInfo{rType: rType, rName: rName, lit: lit, exprs: exprs})
+				resources = append(resources, resInfo{mode: mode, rType: rType, rName: rName, lit: lit, litSrc: litSrc, exprs: exprs, provider: providerRefFromBody(blk.Body), forEach: forEachSource(src, blk.Body)})
 			}
 			// Build one batch eval for all non-literal expressions in this file
 			batched := false
 			var result map[string]any
+			var batchSource string
 			// Count total exprs
 			totalExprs := 0
 			for _, ri := range resources {
-				totalExprs += len(ri.exprs)
+				if ri.forEach == "" {
+					totalExprs += len(ri.exprs)
+				}
 			}
 			if totalExprs > 0 {
 				var b strings.Builder
@@ -487,18 +601,16 @@ func parseModuleResourcesWithEval(moduleDir string, modulePath []string, workDir
 				b.WriteByte('{')
 				firstRes := true
 				for _, ri := range resources {
-					if len(ri.exprs) == 0 {
+					if len(ri.exprs) == 0 || ri.forEach != "" {
 						continue
 					}
 					if !firstRes {
 						b.WriteByte(',')
 					}
 					firstRes = false
-					// key is "type.name"
+					// key is "type.name", or "data.type.name" for data sources
 					b.WriteByte('"')
-					b.WriteString(ri.rType)
-					b.WriteByte('.')
-					b.WriteString(ri.rName)
+					b.WriteString(batchAddr(ri.mode, ri.rType, ri.rName))
 					b.WriteByte('"')
 					b.WriteString(" = {")
 					firstAttr := true
@@ -515,10 +627,11 @@ func parseModuleResourcesWithEval(moduleDir string, modulePath []string, workDir
 					b.WriteByte('}')
 				}
 				b.WriteByte('}')
-				if v, ok := EvalJSON(workDir, statePath, varFiles, b.String(), 10*time.Second); ok {
+				if v, source, ok := evalJSONSource(workDir, statePath, varFiles, bindModulePath(rootDir, moduleRel, b.String()), 10*time.Second); ok {
 					if mm, ok := v.(map[string]any); ok {
 						result = mm
 						batched = true
+						batchSource = source
 					}
 				}
 			}
@@ -528,25 +641,40 @@ func parseModuleResourcesWithEval(moduleDir string, modulePath []string, workDir
 				for k, v := range ri.lit {
 					attrs[k] = v
 				}
+				if ri.forEach != "" {
+					// Instances are evaluated on their own since each needs binding
+					rc := ResourceConfig{ModulePath: append([]string{}, modulePath...), Mode: ri.mode, Type: ri.rType, Name: ri.rName, Attrs: attrs, Provider: ri.provider}
+					if v, source, ok := evalJSONSource(workDir, statePath, varFiles, bindModulePath(rootDir, moduleRel, forEachInstancesExpr(ri.forEach, ri.exprs)), 10*time.Second); ok {
+						insts, _ := v.(map[string]any)
+						rc.Instances = forEachInstances(ri.lit, insts)
+						rc.Provenance = attrProvenance(ri.litSrc, ri.exprs, instanceAttrSources(insts, source))
+					} else {
+						rc.Provenance = attrProvenance(ri.litSrc, nil, nil)
+					}
+					out = append(out, rc)
+					continue
+				}
 				var rm map[string]any
 				if batched {
-					if m, ok := result[ri.rType+"."+ri.rName].(map[string]any); ok {
+					if m, ok := result[batchAddr(ri.mode, ri.rType, ri.rName)].(map[string]any); ok {
 						rm = m
 					}
 				}
 				for k, v := range rm {
 					attrs[k] = v
 				}
+				sources := attrSources(rm, batchSource)
 				// Fallback per-attribute eval when missing from batch
 				for k, expr := range ri.exprs {
 					if _, ok := attrs[k]; ok {
 						continue
 					}
-					if v, ok := EvalJSON(workDir, statePath, varFiles, expr, 5*time.Second); ok {
+					if v, source, ok := evalJSONSource(workDir, statePath, varFiles, bindModulePath(rootDir, moduleRel, expr), 5*time.Second); ok {
 						attrs[k] = v
+						sources[k] = source
 					}
 				}
-				out = append(out, ResourceConfig{ModulePath: append([]string{}, modulePath...), Type: ri.rType, Name: ri.rName, Attrs: attrs})
+				out = append(out, ResourceConfig{ModulePath: append([]string{}, modulePath...), Mode: ri.mode, Type: ri.rType, Name: ri.rName, Attrs: attrs, Provider: ri.provider, Provenance: attrProvenance(ri.litSrc, ri.exprs, sources)})
 			}
 		}
 		return nil
@@ -560,7 +688,7 @@ func parseModuleResourcesWithEval(moduleDir string, modulePath []string, workDir
 // resolveModuleDirs returns mapping from module key ("" for root, "child.grand" for nested) to absolute directory.
 func resolveModuleDirs(rootDir string) (map[string]string, error) {
 	m := map[string]string{"": rootDir}
-	idxPath := filepath.Join(rootDir, ".terraform", "modules", "modules.json")
+	idxPath := filepath.Join(DataDir(rootDir), "modules", "modules.json")
 	b, err := os.ReadFile(idxPath)
 	if err != nil {
 		return m, err
@@ -571,18 +699,15 @@ func resolveModuleDirs(rootDir string) (map[string]string, error) {
 			Dir string `json:"Dir"`
 		} `json:"Modules"`
 	}
-	if jerr := json.Unmarshal(b, &idx); jerr != nil {
+	if jerr := jsonx.Unmarshal(b, &idx); jerr != nil {
 		return m, jerr
 	}
 	for _, mod := range idx.Modules {
-		if strings.TrimSpace(mod.Key) == "" || strings.TrimSpace(mod.Dir) == "" {
-			continue
-		}
-		if !strings.HasPrefix(mod.Key, "root") {
+		if strings.TrimSpace(mod.Key) == "" || mod.Key == "root" || strings.TrimSpace(mod.Dir) == "" {
 			continue
 		}
-		key := strings.TrimPrefix(mod.Key, "root")
-		key = strings.TrimPrefix(key, ".")
+		// Terraform writes "net.subnet"; older manifests prefix keys with "root."
+		key := strings.TrimPrefix(mod.Key, "root.")
 		dir := mod.Dir
 		if !filepath.IsAbs(dir) {
 			dir = filepath.Join(rootDir, dir)
@@ -626,7 +751,7 @@ func parseModuleResources(moduleDir string, modulePath []string) ([]ResourceConf
 		if strings.ToLower(filepath.Ext(p)) != ".tf" {
 			return nil
 		}
-		src, rerr := os.ReadFile(p)
+		src, rerr := readConfigFile(p)
 		if rerr != nil {
 			return nil
 		}
@@ -637,12 +762,13 @@ func parseModuleResources(moduleDir string, modulePath []string) ([]ResourceConf
 		// Walk resource blocks from syntax tree for reliable nested access
 		if body, ok := f.Body.(*hclsyntax.Body); ok {
 			for _, blk := range body.Blocks {
-				if blk == nil || blk.Type != "resource" || len(blk.Labels) < 2 {
+				mode, ok := blockMode(blk)
+				if !ok {
 					continue
 				}
 				rType, rName := blk.Labels[0], blk.Labels[1]
 				lit := extractLiteralsFromBody(blk.Body)
-				out = append(out, ResourceConfig{ModulePath: append([]string{}, modulePath...), Type: rType, Name: rName, Attrs: lit})
+				out = append(out, ResourceConfig{ModulePath: append([]string{}, modulePath...), Mode: mode, Type: rType, Name: rName, Attrs: lit, Provider: providerRefFromBody(blk.Body)})
 			}
 		}
 		return nil
@@ -653,6 +779,31 @@ func parseModuleResources(moduleDir string, modulePath []string) ([]ResourceConf
 	return out, nil
 }
 
+// providerRefFromBody returns the provider meta-argument of a resource block as
+// written ("aws" or "aws.west"), or "" when the block relies on the default.
+func providerRefFromBody(body *hclsyntax.Body) string {
+	if body == nil {
+		return ""
+	}
+	a, ok := body.Attributes["provider"]
+	if !ok {
+		return ""
+	}
+	trav, diags := hcl.AbsTraversalForExpr(a.Expr)
+	if diags.HasErrors() || len(trav) == 0 || len(trav) > 2 {
+		return ""
+	}
+	ref := trav.RootName()
+	if len(trav) == 2 {
+		attr, ok := trav[1].(hcl.TraverseAttr)
+		if !ok {
+			return ""
+		}
+		ref += "." + attr.Name
+	}
+	return ref
+}
+
 func isMetaArg(k string) bool {
 	switch k {
 	case "provider", "depends_on", "lifecycle", "count", "for_each", "provisioner", "connection":
@@ -720,10 +871,20 @@ func constValue(expr hcl.Expression) (any, bool) {
 	return convertCtyToGo(v)
 }
 
+// convertCtyToGo converts v into plain Go values. Parts marked sensitive are
+// wrapped in Sensitive so they are redacted when printed.
 func convertCtyToGo(v cty.Value) (any, bool) {
 	if !v.IsWhollyKnown() {
 		return nil, false
 	}
+	if v.IsMarked() {
+		unmarked, marks := v.Unmark()
+		goV, ok := convertCtyToGo(unmarked)
+		if _, sensitive := marks[sensitiveMark]; ok && sensitive {
+			return Sensitive{Value: goV}, true
+		}
+		return goV, ok
+	}
 	switch {
 	case v.IsNull():
 		return nil, true
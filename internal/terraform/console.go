@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
@@ -15,12 +17,23 @@ type ConsoleSession struct {
 	statePath string
 	workDir   string
 
-	// precomputed execution details to avoid per-eval overhead
+	// precomputed execution details to avoid per-eval overhead; args is
+	// guarded by argsMu since SetVarFiles rebuilds it
 	binPath string
+	argsMu  sync.Mutex
 	args    []string
 	env     []string
+
+	// interruptCtx is the parent of every evaluation started since the last
+	// Interrupt, which cancels it
+	interruptMu  sync.Mutex
+	interruptCtx context.Context
+	interrupt    context.CancelFunc
 }
 
+// errInterrupted is returned by evaluations ended by Interrupt.
+var errInterrupted = errors.New("terraform console evaluation interrupted")
+
 var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
 
 // StartConsoleSession creates a new ephemeral-eval session that records working directory and state path.
@@ -33,11 +46,19 @@ func StartConsoleSession(workDir, statePath string, varFiles []string) *ConsoleS
 	} else {
 		s.binPath = "terraform"
 	}
-	// Precompute args
-	s.args = []string{"console", "-no-color"}
+	s.args = s.buildArgs(varFiles)
+	// Precompute env
+	s.env = consoleEnv(workDir)
+	return s
+}
+
+// buildArgs returns the `terraform console` arguments for the session's state
+// and the given var-files, which are forwarded as repeated -var-file flags.
+func (s *ConsoleSession) buildArgs(varFiles []string) []string {
+	args := consoleBaseArgs()
 	if sp := s.statePath; sp != "" {
 		if fi, err := os.Stat(sp); err == nil && !fi.IsDir() {
-			s.args = append(s.args, "-state", sp)
+			args = append(args, "-state", sp)
 		}
 	}
 	// Append any provided -var-file flags in the given order
@@ -45,15 +66,97 @@ func StartConsoleSession(workDir, statePath string, varFiles []string) *ConsoleS
 		if strings.TrimSpace(vf) == "" {
 			continue
 		}
-		s.args = append(s.args, "-var-file", vf)
+		args = append(args, "-var-file", vf)
+	}
+	return args
+}
+
+// SetVarFiles makes later evaluations use varFiles instead of the var-files
+// the session was started with. Evaluations in flight are not affected.
+func (s *ConsoleSession) SetVarFiles(varFiles []string) {
+	args := s.buildArgs(varFiles)
+	s.argsMu.Lock()
+	s.args = args
+	s.argsMu.Unlock()
+}
+
+// consoleBaseArgs returns the leading `terraform console` arguments, including any
+// defaults injected through TF_CLI_ARGS and TF_CLI_ARGS_console. As in Terraform,
+// they go right after the subcommand so the -state/-var-file flags appended by
+// callers still take precedence.
+func consoleBaseArgs() []string {
+	args := []string{"console"}
+	args = append(args, splitCLIArgs(os.Getenv("TF_CLI_ARGS_console"))...)
+	args = append(args, splitCLIArgs(os.Getenv("TF_CLI_ARGS"))...)
+	return append(args, "-no-color")
+}
+
+// consoleEnv returns the environment for console subprocesses in workDir.
+// TF_CLI_ARGS* are removed because consoleBaseArgs already applied them;
+// Terraform would otherwise inject them a second time.
+func consoleEnv(workDir string) []string {
+	base := terraformEnv()
+	if isScratchDataDir(workDir) {
+		base = scratchEnv(base)
+	}
+	env := make([]string, 0, len(base)+3)
+	for _, kv := range base {
+		if strings.HasPrefix(kv, "TF_CLI_ARGS=") || strings.HasPrefix(kv, "TF_CLI_ARGS_console=") {
+			continue
+		}
+		env = append(env, kv)
 	}
-	// Precompute env
-	env := append([]string{}, os.Environ()...)
 	env = append(env, "TF_IN_AUTOMATION=1")
+	// Skip the version check that can print an upgrade notice before the
+	// first answer, unless the user configured it
+	if _, ok := os.LookupEnv("CHECKPOINT_DISABLE"); !ok {
+		env = append(env, "CHECKPOINT_DISABLE=1")
+	}
 	// Avoid accidental pagers or prompts
 	env = append(env, "PAGER=")
-	s.env = env
-	return s
+	return env
+}
+
+// splitCLIArgs splits a TF_CLI_ARGS value into words, honoring single and double
+// quotes and backslash escapes the way a POSIX shell would.
+func splitCLIArgs(s string) []string {
+	var out []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				out = append(out, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		out = append(out, cur.String())
+	}
+	return out
 }
 
 // Restart is a no-op for ephemeral evaluations.
@@ -62,22 +165,58 @@ func (s *ConsoleSession) Restart() {}
 // Stop is a no-op for ephemeral evaluations.
 func (s *ConsoleSession) Stop() {}
 
-// Interrupt is a no-op for ephemeral evaluations.
-func (s *ConsoleSession) Interrupt() {}
+// Interrupt kills the terraform console processes of the evaluations in
+// flight, which then return an error. Later evaluations are not affected.
+func (s *ConsoleSession) Interrupt() {
+	s.interruptMu.Lock()
+	defer s.interruptMu.Unlock()
+	if s.interrupt != nil {
+		s.interrupt()
+		s.interruptCtx, s.interrupt = nil, nil
+	}
+}
+
+// interruptContext returns the context the next evaluation derives from.
+func (s *ConsoleSession) interruptContext() context.Context {
+	s.interruptMu.Lock()
+	defer s.interruptMu.Unlock()
+	if s.interruptCtx == nil {
+		s.interruptCtx, s.interrupt = context.WithCancel(context.Background())
+	}
+	return s.interruptCtx
+}
 
 // Evaluate runs a short-lived `terraform console`, writes the provided line to stdin,
 // and returns the raw stdout and stderr from Terraform. No trimming is applied.
 // On timeout, an error is returned; on other non-zero exits, stdout/stderr are
 // returned and error is nil so the caller can mirror Terraform output faithfully.
 func (s *ConsoleSession) Evaluate(line string, timeout time.Duration) (string, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	return s.EvaluateStream(line, timeout, nil)
+}
+
+// EvaluateStream is Evaluate also writing stdout to w as Terraform prints it,
+// so large results appear progressively. The full stdout is still returned. A
+// nil w streams nothing. Interrupt ends the evaluation early with an error.
+func (s *ConsoleSession) EvaluateStream(line string, timeout time.Duration, w io.Writer) (string, string, error) {
+	ctx, cancel := context.WithTimeout(s.interruptContext(), timeout)
 	defer cancel()
+	release, err := acquireTerraformProc(ctx)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return "", "", errInterrupted
+		}
+		return "", "", fmt.Errorf("terraform console evaluation timed out waiting for one of %d process slots (%s)", cap(terraformProcs), maxTerraformProcsEnv)
+	}
+	defer release()
 
 	bin := s.binPath
 	if bin == "" {
 		bin = "terraform"
 	}
-	cmd := exec.CommandContext(ctx, bin, s.args...)
+	s.argsMu.Lock()
+	args := s.args
+	s.argsMu.Unlock()
+	cmd := exec.CommandContext(ctx, bin, args...)
 	if s.workDir != "" {
 		cmd.Dir = s.workDir
 	}
@@ -97,21 +236,42 @@ func (s *ConsoleSession) Evaluate(line string, timeout time.Duration) (string, s
 
 	cmd.Stdin = strings.NewReader(line + "\n")
 	cmd.Stdout = out
+	if w != nil {
+		cmd.Stdout = io.MultiWriter(out, w)
+	}
 	cmd.Stderr = errBuf
-	err := cmd.Run()
-	if ctx.Err() == context.DeadlineExceeded {
+	done := TraceCommand(cmd)
+	err = cmd.Run()
+	done(err)
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
 		return "", "", errors.New("terraform console evaluation timed out")
+	case context.Canceled:
+		// What was already streamed is returned so the caller can end its line
+		return out.String(), "", errInterrupted
 	}
 	if err != nil {
 		// If Terraform produced output on either stream, return it and suppress the error
 		if out.Len() > 0 || errBuf.Len() > 0 {
 			sOut := out.String()
 			sErr := errBuf.String()
-			return sOut, sErr, nil
+			return sOut, s.explainError(line, sErr), nil
 		}
 		return "", "", err
 	}
 	sOut := out.String()
 	sErr := errBuf.String()
-	return sOut, sErr, nil
+	return sOut, s.explainError(line, sErr), nil
+}
+
+// explainError appends a hint to Terraform's error output when it is most likely
+// caused by a binary that is too old for the features used in line.
+func (s *ConsoleSession) explainError(line, stderr string) string {
+	if stderr == "" || !usesProviderFunctions(line) {
+		return stderr
+	}
+	if err := providerFuncsUnsupported(installedVersion(s.binPath)); err != nil {
+		return strings.TrimRight(stderr, "\n") + "\n\n" + err.Error() + "\n"
+	}
+	return stderr
 }
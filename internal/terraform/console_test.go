@@ -0,0 +1,274 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartConsoleSession_AppliesTFCLIArgs(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := os.WriteFile(statePath, []byte(`{"version":4}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TF_CLI_ARGS", "")
+	t.Setenv("TF_CLI_ARGS_console", `-var 'greeting=hello world' -compact-warnings`)
+
+	s := StartConsoleSession(dir, statePath, []string{"prod.tfvars"})
+	want := []string{"console", "-var", "greeting=hello world", "-compact-warnings", "-no-color", "-state", statePath, "-var-file", "prod.tfvars"}
+	if !reflect.DeepEqual(s.args, want) {
+		t.Fatalf("args = %q, want %q", s.args, want)
+	}
+	for _, kv := range s.env {
+		if strings.HasPrefix(kv, "TF_CLI_ARGS") {
+			t.Fatalf("expected %s to be stripped from the child env", kv)
+		}
+	}
+}
+
+func TestConsoleSessionSetVarFiles_ReplacesVarFileArgs(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := os.WriteFile(statePath, []byte(`{"version":4}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TF_CLI_ARGS", "")
+	t.Setenv("TF_CLI_ARGS_console", "")
+
+	s := StartConsoleSession(dir, statePath, []string{"dev.tfvars"})
+	s.SetVarFiles([]string{"staging.tfvars", "common.tfvars"})
+	want := []string{"console", "-no-color", "-state", statePath, "-var-file", "staging.tfvars", "-var-file", "common.tfvars"}
+	if !reflect.DeepEqual(s.args, want) {
+		t.Fatalf("args = %q, want %q", s.args, want)
+	}
+}
+
+func TestConsoleEnv_DisablesVersionCheck(t *testing.T) {
+	t.Setenv("CHECKPOINT_DISABLE", "")
+	os.Unsetenv("CHECKPOINT_DISABLE")
+	if env := consoleEnv(""); !slices.Contains(env, "CHECKPOINT_DISABLE=1") {
+		t.Fatalf("CHECKPOINT_DISABLE not set in %q", env)
+	}
+	t.Setenv("CHECKPOINT_DISABLE", "")
+	if env := consoleEnv(""); slices.Contains(env, "CHECKPOINT_DISABLE=1") {
+		t.Fatal("a configured CHECKPOINT_DISABLE must be kept")
+	}
+}
+
+func TestSplitCLIArgs(t *testing.T) {
+	cases := map[string][]string{
+		"":                      nil,
+		"  -a  -b ":             {"-a", "-b"},
+		`-var "x=a b" -y`:       {"-var", "x=a b", "-y"},
+		`-var='k=v' a\ b`:       {"-var=k=v", "a b"},
+		`-plugin-dir="/p q" ""`: {"-plugin-dir=/p q", ""},
+	}
+	for in, want := range cases {
+		if got := splitCLIArgs(in); !reflect.DeepEqual(got, want) {
+			t.Fatalf("splitCLIArgs(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestConsoleSessionEvaluate_LimitsConcurrentProcesses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "procs.log")
+	bin := filepath.Join(dir, "terraform")
+	script := "#!/bin/sh\necho start >> " + logPath + "\nsleep 0.1\necho end >> " + logPath + "\necho 1\n"
+	if err := os.WriteFile(bin, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	prev := terraformProcs
+	terraformProcs = make(chan struct{}, 1)
+	defer func() { terraformProcs = prev }()
+
+	s := &ConsoleSession{workDir: dir, binPath: bin, args: []string{"console"}}
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out, _, err := s.Evaluate("1", 10*time.Second); err != nil || strings.TrimSpace(out) != "1" {
+				t.Errorf("Evaluate = %q, %v", out, err)
+			}
+		}()
+	}
+	wg.Wait()
+	b, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), strings.Repeat("start\nend\n", 3); got != want {
+		t.Fatalf("processes overlapped:\n%s", got)
+	}
+}
+
+// chunkWriter hands every write to a channel.
+type chunkWriter chan string
+
+func (c chunkWriter) Write(p []byte) (int, error) {
+	c <- string(p)
+	return len(p), nil
+}
+
+func TestConsoleSessionEvaluateStream_DeliversOutputIncrementally(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "continue")
+	bin := filepath.Join(dir, "terraform")
+	// The stub prints the second half only once the test saw the first
+	script := "#!/bin/sh\nread -r line\necho first\nwhile [ ! -f " + marker + " ]; do sleep 0.01; done\necho second\n"
+	if err := os.WriteFile(bin, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	s := &ConsoleSession{workDir: dir, binPath: bin, args: []string{"console"}}
+	chunks := make(chunkWriter, 10)
+	type result struct {
+		stdout string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stdout, _, err := s.EvaluateStream("local.big", 10*time.Second, chunks)
+		done <- result{stdout, err}
+	}()
+	select {
+	case c := <-chunks:
+		if c != "first\n" {
+			t.Fatalf("first chunk = %q", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no output before the evaluation finished")
+	}
+	if err := os.WriteFile(marker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r := <-done
+	if r.err != nil || r.stdout != "first\nsecond\n" {
+		t.Fatalf("EvaluateStream = %q, %v", r.stdout, r.err)
+	}
+	if c := <-chunks; c != "second\n" {
+		t.Fatalf("second chunk = %q", c)
+	}
+}
+
+func TestConsoleSessionInterrupt_EndsStreamingEvaluation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "terraform")
+	// The stub prints part of a result and then never finishes it
+	script := "#!/bin/sh\nread -r line\necho partial\nexec sleep 60\n"
+	if err := os.WriteFile(bin, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	s := &ConsoleSession{workDir: dir, binPath: bin, args: []string{"console"}}
+	chunks := make(chunkWriter, 10)
+	type result struct {
+		stdout string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stdout, _, err := s.EvaluateStream("local.big", time.Minute, chunks)
+		done <- result{stdout, err}
+	}()
+	<-chunks
+	s.Interrupt()
+	select {
+	case r := <-done:
+		if r.err == nil || r.err.Error() != "terraform console evaluation interrupted" || r.stdout != "partial\n" {
+			t.Fatalf("EvaluateStream = %q, %v", r.stdout, r.err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Interrupt did not end the evaluation")
+	}
+	// The next evaluation runs normally
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\nread -r line\necho 1\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if out, _, err := s.Evaluate("1", 10*time.Second); err != nil || out != "1\n" {
+		t.Fatalf("Evaluate after Interrupt = %q, %v", out, err)
+	}
+}
+
+func TestConsoleSessionEvaluate_TimesOutWaitingForSlot(t *testing.T) {
+	prev := terraformProcs
+	terraformProcs = make(chan struct{}, 1)
+	defer func() { terraformProcs = prev }()
+	terraformProcs <- struct{}{}
+
+	s := &ConsoleSession{binPath: "terraform", args: []string{"console"}}
+	if _, _, err := s.Evaluate("1", 20*time.Millisecond); err == nil || !strings.Contains(err.Error(), maxTerraformProcsEnv) {
+		t.Fatalf("expected a slot timeout, got %v", err)
+	}
+}
+
+func TestMaxTerraformProcs(t *testing.T) {
+	t.Setenv(maxTerraformProcsEnv, "3")
+	if got := maxTerraformProcs(); got != 3 {
+		t.Fatalf("got %d, want 3", got)
+	}
+	t.Setenv(maxTerraformProcsEnv, "0")
+	var got int
+	// The warning waits for first use, after -quiet has set up the logger
+	if out := captureLog(t, func() { got = maxTerraformProcs() }); out != "" {
+		t.Fatalf("reading the limit logged %q", out)
+	}
+	if got != max(runtime.NumCPU(), 2) {
+		t.Fatalf("invalid value: got %d, want the CPU count", got)
+	}
+}
+
+func TestForEachParallel_RespectsParallelism(t *testing.T) {
+	SetParallelism(2)
+	t.Cleanup(func() { SetParallelism(0) })
+	var mu sync.Mutex
+	active, peak, calls := 0, 0, 0
+	forEachParallel(10, func(int) {
+		mu.Lock()
+		active++
+		calls++
+		peak = max(peak, active)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+	})
+	if calls != 10 {
+		t.Fatalf("got %d calls, want 10", calls)
+	}
+	if peak != 2 {
+		t.Fatalf("got %d concurrent workers, want 2", peak)
+	}
+}
+
+func TestCurrentParallelism(t *testing.T) {
+	t.Setenv(parallelismEnv, "")
+	if got, want := currentParallelism(), min(defaultParallelism, runtime.NumCPU()); got != want {
+		t.Fatalf("default: got %d, want %d", got, want)
+	}
+	t.Setenv(parallelismEnv, "5")
+	if got := currentParallelism(); got != 5 {
+		t.Fatalf("env: got %d, want 5", got)
+	}
+	SetParallelism(7)
+	t.Cleanup(func() { SetParallelism(0) })
+	if got := currentParallelism(); got != 7 {
+		t.Fatalf("flag: got %d, want 7", got)
+	}
+}
@@ -0,0 +1,91 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dataDirEnvVar moves the working data terraform init writes, modules and
+// providers, out of .terraform.
+const dataDirEnvVar = "TF_DATA_DIR"
+
+// dataDirSetting returns TF_DATA_DIR as set, or ".terraform".
+func dataDirSetting() string {
+	if d := strings.TrimSpace(os.Getenv(dataDirEnvVar)); d != "" {
+		return filepath.Clean(d)
+	}
+	return ".terraform"
+}
+
+// dataDirOutside reports whether TF_DATA_DIR points outside the configuration
+// directory, where a scratch directory cannot keep a copy at the same path.
+func dataDirOutside() bool {
+	d := dataDirSetting()
+	return filepath.IsAbs(d) || d == ".." || strings.HasPrefix(d, ".."+string(filepath.Separator))
+}
+
+// DataDir returns the directory terraform keeps the working data of the
+// configuration in dir in: TF_DATA_DIR, relative to dir unless absolute, or
+// dir/.terraform.
+func DataDir(dir string) string {
+	d := dataDirSetting()
+	if filepath.IsAbs(d) {
+		return d
+	}
+	return filepath.Join(dir, d)
+}
+
+// scratchDataDir returns where the data directory of the project is mirrored
+// in scratchDir: at the same relative location, so the module directories
+// recorded in modules.json resolve there too. A TF_DATA_DIR outside the
+// configuration would point back at the project's own, so it is mirrored into
+// .terraform instead and scratchEnv points terraform there.
+func scratchDataDir(scratchDir string) string {
+	if dataDirOutside() {
+		return filepath.Join(scratchDir, ".terraform")
+	}
+	return DataDir(scratchDir)
+}
+
+// scratchEnv adjusts env for terraform commands run in a scratch directory,
+// so they use the data directory scratchDataDir mirrored.
+func scratchEnv(env []string) []string {
+	if dataDirOutside() {
+		return append(env, dataDirEnvVar+"=.terraform")
+	}
+	return env
+}
+
+// isScratchDataDir reports whether dir holds a data directory mirrored by
+// scratchDataDir in place of one outside the configuration.
+func isScratchDataDir(dir string) bool {
+	if dir == "" || !dataDirOutside() {
+		return false
+	}
+	fi, err := os.Stat(filepath.Join(dir, ".terraform"))
+	return err == nil && fi.IsDir()
+}
+
+// isDataDir reports whether rel, the path of a directory relative to the
+// configuration root, holds terraform's working data rather than
+// configuration: a .terraform directory, or TF_DATA_DIR when it points inside
+// the configuration.
+func isDataDir(rel string) bool {
+	rel = filepath.Clean(rel)
+	if filepath.Base(rel) == ".terraform" {
+		return true
+	}
+	return !dataDirOutside() && rel == dataDirSetting()
+}
+
+// inDataDir reports whether rel, relative to the configuration root, is a
+// data directory or lies within one.
+func inDataDir(rel string) bool {
+	for p := filepath.Clean(rel); p != "." && p != string(filepath.Separator); p = filepath.Dir(p) {
+		if isDataDir(p) {
+			return true
+		}
+	}
+	return false
+}
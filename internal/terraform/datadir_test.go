@@ -0,0 +1,111 @@
+package terraform
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestResolveModuleDirs_FromCustomDataDir(t *testing.T) {
+	root := writeModuleTree(t, map[string]string{
+		"main.tf": `module "net" {
+  source = "hashicorp/net/aws"
+}
+`,
+		".tfdata/modules/modules.json":    `{"Modules":[{"Key":"","Source":"","Dir":"."},{"Key":"net","Source":"hashicorp/net/aws","Dir":".tfdata/modules/net"}]}`,
+		".tfdata/modules/net/main.tf":     `resource "null_resource" "n" {}`,
+		".terraform/modules/modules.json": `{"Modules":[]}`,
+	})
+	t.Setenv("TF_DATA_DIR", ".tfdata")
+
+	dirs, err := resolveModuleDirs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, ".tfdata", "modules", "net"); dirs["net"] != want {
+		t.Fatalf("module dirs = %v, want net in %s", dirs, want)
+	}
+
+	// An absolute data directory is used wherever the configuration is read from
+	abs := filepath.Join(root, ".tfdata")
+	t.Setenv("TF_DATA_DIR", abs)
+	if got := DataDir(t.TempDir()); got != abs {
+		t.Fatalf("DataDir = %s, want %s", got, abs)
+	}
+	if isDataDir(".tfdata") {
+		t.Fatal("an absolute data directory has no name within the configuration")
+	}
+}
+
+func TestPrepareScratch_MirrorsCustomDataDir(t *testing.T) {
+	src := writeModuleTree(t, map[string]string{
+		"main.tf":                      `locals { a = 1 }`,
+		".tfdata/modules/modules.json": `{"Modules":[]}`,
+		".tfdata/modules/net/main.tf":  `resource "null_resource" "n" {}`,
+	})
+	scratch := filepath.Join(src, ".terraflow")
+	var env []string
+	orig := runTerraformCommand
+	runTerraformCommand = func(cmd *exec.Cmd) error {
+		env = cmd.Env
+		return os.WriteFile(filepath.Join(cmd.Dir, ".terraform.lock.hcl"), nil, 0o600)
+	}
+	defer func() { runTerraformCommand = orig }()
+
+	t.Setenv("TF_DATA_DIR", ".tfdata")
+	if _, err := PrepareScratch(src, scratch, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(scratch, ".tfdata", "modules", "modules.json")); err != nil {
+		t.Fatalf("relative data dir should be mirrored at the same path: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(scratch, ".tfdata", "main.tf")); err == nil {
+		t.Fatal("modules in the data dir must not be synced as configuration")
+	}
+
+	// An absolute one is mirrored into .terraform, which terraform is pointed at
+	t.Setenv("TF_DATA_DIR", filepath.Join(src, ".tfdata"))
+	env = nil
+	if err := os.Remove(filepath.Join(scratch, ".terraform.lock.hcl")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PrepareScratch(src, scratch, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(scratch, ".terraform", "modules", "net", "main.tf")); err != nil {
+		t.Fatalf("absolute data dir should be mirrored into .terraform: %v", err)
+	}
+	if !slices.Contains(env, "TF_DATA_DIR=.terraform") {
+		t.Fatalf("scratch commands should use the mirrored data dir, env %q", env)
+	}
+	if !slices.Contains(consoleEnv(scratch), "TF_DATA_DIR=.terraform") {
+		t.Fatal("consoles in the scratch dir should use the mirrored data dir")
+	}
+	if _, err := os.Stat(filepath.Join(src, ".tfdata", "modules", "net", "main.tf")); err != nil {
+		t.Fatalf("the project's data dir must be left alone: %v", err)
+	}
+}
+
+func TestSyncToScratch_SkipsNestedDataDirOnly(t *testing.T) {
+	src := writeModuleTree(t, map[string]string{
+		"main.tf":                      `module "x" { source = "./build/x" }`,
+		"build/x/main.tf":              `locals { a = 1 }`,
+		"build/tf/modules/net/main.tf": `resource "null_resource" "n" {}`,
+		"x/build/tf/main.tf":           `locals { b = 1 }`,
+	})
+	t.Setenv("TF_DATA_DIR", "build/tf")
+	scratch := filepath.Join(src, ".terraflow")
+	if _, _, err := SyncToScratch(src, scratch); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"build/x/main.tf", "x/build/tf/main.tf"} {
+		if _, err := os.Stat(filepath.Join(scratch, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("%s should be synced as configuration: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(scratch, "build", "tf", "modules", "net", "main.tf")); err == nil {
+		t.Error("the data directory must not be synced as configuration")
+	}
+}
@@ -0,0 +1,57 @@
+package terraform
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+var (
+	loggerMu sync.RWMutex
+	// logger receives the package's informational and warning output.
+	logger = log.Default()
+	// debugEnabled turns on [debug] log lines; set TERRAFLOW_DEBUG to any
+	// non-empty value.
+	debugEnabled = os.Getenv("TERRAFLOW_DEBUG") != ""
+	// debugLogger receives [debug] lines instead of logger when set.
+	debugLogger *log.Logger
+)
+
+// SetLogger routes informational and warning logs to l, for example a
+// discarding logger when the console runs quietly.
+func SetLogger(l *log.Logger) {
+	loggerMu.Lock()
+	logger = l
+	loggerMu.Unlock()
+}
+
+// currentLogger returns the logger set by SetLogger; background work such as
+// registry downloads logs concurrently with it being replaced.
+func currentLogger() *log.Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// SetDebugLog enables debug logging and writes it to l, such as the log file
+// opened for -debug, rather than to the console.
+func SetDebugLog(l *log.Logger) {
+	loggerMu.Lock()
+	debugEnabled = true
+	debugLogger = l
+	loggerMu.Unlock()
+}
+
+// debugf logs a diagnostic message when debug logging is enabled.
+func debugf(format string, args ...any) {
+	loggerMu.RLock()
+	enabled, l := debugEnabled, logger
+	if debugLogger != nil {
+		l = debugLogger
+	}
+	loggerMu.RUnlock()
+	if !enabled {
+		return
+	}
+	l.Printf("[debug] "+format, args...)
+}
@@ -0,0 +1,107 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// DuplicateAddress is a resource or data source declared more than once in
+// the same module, which Terraform rejects.
+type DuplicateAddress struct {
+	Address string // e.g. module.net.aws_subnet.a
+	// Ranges locate the declaring blocks, ordered by file and line; their
+	// Filenames are relative to the root directory.
+	Ranges []hcl.Range
+}
+
+// String formats d as "null_resource.ex is declared 2 times: a.tf:1, b.tf:4".
+func (d DuplicateAddress) String() string {
+	at := make([]string, len(d.Ranges))
+	for i, r := range d.Ranges {
+		at[i] = fmt.Sprintf("%s:%d", r.Filename, r.Start.Line)
+	}
+	return fmt.Sprintf("%s is declared %d times: %s", d.Address, len(d.Ranges), strings.Join(at, ", "))
+}
+
+// FindDuplicateAddresses reports the resources and data sources declared more
+// than once within the module at rootDir or a local module it calls, ordered by
+// address.
+func FindDuplicateAddresses(rootDir string) ([]DuplicateAddress, error) {
+	abs, _ := filepath.Abs(rootDir)
+	var out []DuplicateAddress
+	err := walkLocalModules(rootDir, func(absMod string, modulePath []string) error {
+		out = append(out, moduleDuplicates(abs, absMod, modulePath)...)
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Address < out[j].Address })
+	return out, err
+}
+
+// moduleDuplicates scans the .tf files of the module in dir for addresses
+// declared more than once.
+func moduleDuplicates(rootDir, dir string, modulePath []string) []DuplicateAddress {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	steps := make([]ModuleStep, len(modulePath))
+	for i, name := range modulePath {
+		steps[i] = ModuleStep{Name: name}
+	}
+	ranges := map[string][]hcl.Range{}
+	for _, e := range entries {
+		if e.IsDir() || strings.ToLower(filepath.Ext(e.Name())) != ".tf" {
+			continue
+		}
+		_, f, ok := getSyntaxFileCached(filepath.Join(dir, e.Name()))
+		if !ok || f == nil {
+			continue
+		}
+		body, ok := f.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, blk := range body.Blocks {
+			mode, ok := blockMode(blk)
+			if !ok {
+				continue
+			}
+			addr := Address{Module: steps, Mode: mode, Type: blk.Labels[0], Name: blk.Labels[1]}.String()
+			rng := blk.DefRange()
+			if rel, err := filepath.Rel(rootDir, rng.Filename); err == nil {
+				rng.Filename = rel
+			}
+			ranges[addr] = append(ranges[addr], rng)
+		}
+	}
+	var out []DuplicateAddress
+	for addr, rs := range ranges {
+		if len(rs) > 1 {
+			out = append(out, DuplicateAddress{Address: addr, Ranges: rs})
+		}
+	}
+	return out
+}
+
+// duplicatesWarned remembers the duplicates already reported, so a refresh
+// warns only about new ones.
+var duplicatesWarned sync.Map
+
+// warnDuplicateAddresses logs every duplicate address under rootDir once.
+// State hydration would otherwise merge the declarations into one resource.
+func warnDuplicateAddresses(rootDir string) {
+	dups, _ := FindDuplicateAddresses(rootDir)
+	for _, d := range dups {
+		msg := d.String()
+		if _, seen := duplicatesWarned.LoadOrStore(msg, true); !seen {
+			currentLogger().Printf("[warn] %s\n", msg)
+		}
+	}
+}
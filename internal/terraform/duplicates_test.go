@@ -0,0 +1,59 @@
+package terraform
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicateAddresses_ReportsEachDeclaration(t *testing.T) {
+	dir := filepath.Join(repoRoot(t), "test", "fixtures", "duplicate_address")
+
+	dups, err := FindDuplicateAddresses(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range dups {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"data.null_data_source.lookup is declared 2 times: extra.tf:11, main.tf:7",
+		"null_resource.ex is declared 2 times: extra.tf:5, main.tf:1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("duplicates:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	out := captureLog(t, func() {
+		warnDuplicateAddresses(dir)
+		warnDuplicateAddresses(dir)
+	})
+	if n := strings.Count(out, "[warn] null_resource.ex is declared 2 times"); n != 1 {
+		t.Fatalf("warned %d times, want once:\n%s", n, out)
+	}
+}
+
+func TestFindDuplicateAddresses_ScopesToModule(t *testing.T) {
+	root := writeModuleTree(t, map[string]string{
+		"main.tf": `module "net" {
+  source = "./net"
+}
+
+resource "null_resource" "a" {}
+`,
+		"net/a.tf": `resource "null_resource" "a" {}
+`,
+		"net/b.tf": `resource "null_resource" "a" {}
+`,
+	})
+
+	dups, err := FindDuplicateAddresses(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "module.net.null_resource.a is declared 2 times: net/a.tf:1, net/b.tf:1"
+	if len(dups) != 1 || dups[0].String() != want {
+		t.Fatalf("duplicates = %v, want [%s]", dups, want)
+	}
+}
@@ -0,0 +1,115 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// skippedEncodings remembers the files already reported as undecodable so a
+// refresh does not warn about them again.
+var skippedEncodings sync.Map
+
+// decodeConfigSource returns src as UTF-8 without a byte order mark. Files
+// saved as UTF-16 by Windows editors are transcoded, with or without a BOM.
+// ok is false, and the file is logged once as skipped, when src is not valid
+// UTF-8 after decoding.
+func decodeConfigSource(path string, src []byte) ([]byte, bool) {
+	switch {
+	case bytes.HasPrefix(src, bomUTF8):
+		src = src[len(bomUTF8):]
+	case bytes.HasPrefix(src, bomUTF16LE):
+		src = decodeUTF16(src[len(bomUTF16LE):], binary.LittleEndian)
+	case bytes.HasPrefix(src, bomUTF16BE):
+		src = decodeUTF16(src[len(bomUTF16BE):], binary.BigEndian)
+	case len(src) >= 2 && src[0] != 0 && src[1] == 0:
+		// ASCII text as UTF-16LE without a BOM: every other byte is NUL
+		src = decodeUTF16(src, binary.LittleEndian)
+	case len(src) >= 2 && src[0] == 0 && src[1] != 0:
+		src = decodeUTF16(src, binary.BigEndian)
+	}
+	if !utf8.Valid(src) {
+		if _, seen := skippedEncodings.LoadOrStore(path, true); !seen {
+			currentLogger().Printf("[warn] skipping %s: not UTF-8 or UTF-16 encoded\n", path)
+		}
+		return nil, false
+	}
+	return src, true
+}
+
+// decodeUTF16 transcodes UTF-16 in the given byte order to UTF-8. A trailing
+// odd byte is dropped.
+func decodeUTF16(b []byte, order binary.ByteOrder) []byte {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, order.Uint16(b[i:]))
+	}
+	out := make([]byte, 0, len(units))
+	for _, r := range utf16.Decode(units) {
+		out = utf8.AppendRune(out, r)
+	}
+	return out
+}
+
+// readConfigFile reads a configuration file and decodes it with
+// decodeConfigSource.
+func readConfigFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	src, ok := decodeConfigSource(path, b)
+	if !ok {
+		return nil, fmt.Errorf("%s: not UTF-8 or UTF-16 encoded", path)
+	}
+	return src, nil
+}
+
+// configFS is the filesystem tfconfig loads modules through, decoding files
+// like the package's own parsers do. Undecodable files read as empty so the
+// rest of the module still loads.
+type configFS struct{ tfconfig.FS }
+
+func (c configFS) ReadFile(name string) ([]byte, error) {
+	b, err := c.FS.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if src, ok := decodeConfigSource(name, b); ok {
+		return src, nil
+	}
+	return []byte{}, nil
+}
+
+// loadModule is tfconfig.LoadModule reading files through configFS.
+func loadModule(dir string) (*tfconfig.Module, tfconfig.Diagnostics) {
+	return tfconfig.LoadModuleFromFilesystem(configFS{tfconfig.NewOsFs()}, dir)
+}
+
+// parseHCLConfigFile is hclparse.Parser.ParseHCLFile decoding path like
+// readConfigFile. A file that cannot be decoded has already been logged and
+// returns a nil file without diagnostics.
+func parseHCLConfigFile(p *hclparse.Parser, path string) (*hcl.File, hcl.Diagnostics) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return p.ParseHCLFile(path)
+	}
+	if src, ok := decodeConfigSource(path, src); ok {
+		return p.ParseHCL(src, path)
+	}
+	return nil, nil
+}
@@ -0,0 +1,66 @@
+package terraform
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildSymbolIndex_BOMAndUTF16Files(t *testing.T) {
+	dir := filepath.Join(repoRoot(t), "test", "fixtures", "encoding_bom")
+	idx, err := BuildSymbolIndex(dir)
+	if err != nil {
+		t.Fatalf("BuildSymbolIndex error: %v", err)
+	}
+	if got := idx.Resource["null_resource"]; len(got) != 2 || got[0] != "bom" || got[1] != "utf16" {
+		t.Fatalf("resources = %#v, want bom and utf16", got)
+	}
+	if len(idx.Variables) != 1 || idx.Variables[0] != "region" {
+		t.Fatalf("variables = %#v", idx.Variables)
+	}
+	if len(idx.Locals) != 1 || idx.Locals[0] != "greeting" {
+		t.Fatalf("locals = %#v", idx.Locals)
+	}
+	cfgs, err := BuildResourceConfigs(dir)
+	if err != nil {
+		t.Fatalf("BuildResourceConfigs error: %v", err)
+	}
+	if len(cfgs) != 2 {
+		t.Fatalf("got %d resource configs, want 2: %#v", len(cfgs), cfgs)
+	}
+}
+
+func TestDecodeConfigSource(t *testing.T) {
+	var buf bytes.Buffer
+	prev := currentLogger()
+	SetLogger(log.New(&buf, "", 0))
+	defer SetLogger(prev)
+
+	utf16be := []byte{0xFE, 0xFF, 0, 'x', 0, ' ', 0, '=', 0, ' ', 0, '1'}
+	for name, src := range map[string][]byte{
+		"utf8":        []byte("x = 1"),
+		"utf8 bom":    append([]byte{0xEF, 0xBB, 0xBF}, "x = 1"...),
+		"utf16be bom": utf16be,
+		"utf16le":     {'x', 0, ' ', 0, '=', 0, ' ', 0, '1', 0},
+	} {
+		got, ok := decodeConfigSource(name, src)
+		if !ok || string(got) != "x = 1" {
+			t.Errorf("%s: got %q, %v", name, got, ok)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected log output: %s", buf.String())
+	}
+
+	latin1 := []byte("name = \"caf\xe9\"")
+	for range 2 {
+		if _, ok := decodeConfigSource("latin1.tf", latin1); ok {
+			t.Fatal("expected Latin-1 source to be rejected")
+		}
+	}
+	if n := strings.Count(buf.String(), "skipping latin1.tf"); n != 1 {
+		t.Fatalf("expected one skip warning, got %q", buf.String())
+	}
+}
@@ -0,0 +1,64 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Engine names the evaluators EvalJSON may use.
+type Engine string
+
+const (
+	// EngineAuto tries the in-process evaluator, then the persistent terraform
+	// console, then a one-shot terraform console.
+	EngineAuto Engine = "auto"
+	// EngineInProcess only evaluates in-process.
+	EngineInProcess Engine = "inprocess"
+	// EnginePersistent only asks the long-running terraform console.
+	EnginePersistent Engine = "persistent"
+	// EngineSubprocess only starts a one-shot terraform console.
+	EngineSubprocess Engine = "subprocess"
+)
+
+// Engines lists the accepted engine names.
+var Engines = []Engine{EngineAuto, EngineInProcess, EnginePersistent, EngineSubprocess}
+
+var (
+	engineMu sync.RWMutex
+	engine   = EngineAuto
+)
+
+// ParseEngine returns the engine called name; an empty name is EngineAuto.
+func ParseEngine(name string) (Engine, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return EngineAuto, nil
+	}
+	for _, e := range Engines {
+		if string(e) == name {
+			return e, nil
+		}
+	}
+	names := make([]string, len(Engines))
+	for i, e := range Engines {
+		names[i] = string(e)
+	}
+	return "", fmt.Errorf("unknown engine %q; use one of %s", name, strings.Join(names, ", "))
+}
+
+// SetEngine restricts evaluation to e for the rest of the process, so results
+// of the evaluators can be compared. It is meant for debugging: state synthesis
+// is restricted as well.
+func SetEngine(e Engine) {
+	engineMu.Lock()
+	engine = e
+	engineMu.Unlock()
+}
+
+// CurrentEngine returns the engine set by SetEngine.
+func CurrentEngine() Engine {
+	engineMu.RLock()
+	defer engineMu.RUnlock()
+	return engine
+}
@@ -0,0 +1,47 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestEvalJSON_ForcedEngine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	bin := t.TempDir()
+	// Any one-shot console answers the same, so its answers are recognizable
+	script := "#!/bin/sh\nread -r line\necho '\"from terraform\"'\n"
+	if err := os.WriteFile(filepath.Join(bin, "terraform"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	t.Cleanup(func() { SetEngine(EngineAuto) })
+	dir := writeEvalFixture(t, `locals { a = 1 }`)
+
+	if v, err := EvalJSON(dir, "", nil, `upper("in process")`, 5*time.Second); err != nil || v != "IN PROCESS" {
+		t.Fatalf("auto: %#v, %v", v, err)
+	}
+	SetEngine(EngineSubprocess)
+	if v, err := EvalJSON(dir, "", nil, `upper("in process")`, 5*time.Second); err != nil || v != "from terraform" {
+		t.Fatalf("subprocess: %#v, %v", v, err)
+	}
+	SetEngine(EngineInProcess)
+	if v, err := EvalJSON(dir, "", nil, `timestamp()`, 5*time.Second); err == nil {
+		t.Fatalf("inprocess: timestamp() evaluated to %#v", v)
+	}
+}
+
+func TestParseEngine(t *testing.T) {
+	for in, want := range map[string]Engine{"": EngineAuto, "auto": EngineAuto, "InProcess": EngineInProcess, "subprocess": EngineSubprocess} {
+		if got, err := ParseEngine(in); err != nil || got != want {
+			t.Errorf("ParseEngine(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseEngine("console"); err == nil {
+		t.Error("expected an error for an unknown engine")
+	}
+}
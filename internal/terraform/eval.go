@@ -10,47 +10,86 @@ import (
 
 // EvalJSON evaluates the given HCL expression in the context of the project's
 // Terraform console and attempts to parse the result as JSON by wrapping it in
-// jsonencode(). Returns (value, true) on success; otherwise (nil, false).
+// jsonencode(). Returns the value on success; otherwise an *EvalError holding
+// Terraform's diagnostic when it reported one.
 // workDir should be the scratch dir used by the console so files and modules match.
-func EvalJSON(workDir, statePath string, varFiles []string, expr string, timeout time.Duration) (any, bool) {
+func EvalJSON(workDir, statePath string, varFiles []string, expr string, timeout time.Duration) (any, *EvalError) {
+	v, _, err := evalJSONDiagnosed(workDir, statePath, varFiles, expr, timeout)
+	return v, err
+}
+
+// evalJSONSource is EvalJSON also reporting which evaluator produced the value:
+// provenanceInProcess, provenancePersistent or provenanceSubprocess.
+func evalJSONSource(workDir, statePath string, varFiles []string, expr string, timeout time.Duration) (any, string, bool) {
+	v, source, err := evalJSONDiagnosed(workDir, statePath, varFiles, expr, timeout)
+	return v, source, err == nil
+}
+
+// evalJSONDiagnosed is evalJSONSource returning why the evaluation failed.
+func evalJSONDiagnosed(workDir, statePath string, varFiles []string, expr string, timeout time.Duration) (any, string, *EvalError) {
 	// Protect against empty expressions
 	e := strings.TrimSpace(expr)
 	if e == "" {
-		return nil, false
+		return nil, "", &EvalError{Summary: "empty expression"}
 	}
-	// Zero-cost fast path: in-process HCL evaluation for simple var/local expressions
-	if v, ok := TryEvalInProcess(workDir, varFiles, e, timeout); ok {
-		return v, true
+	// timeout bounds the evaluation as a whole, whichever evaluators it tries
+	deadline := time.Now().Add(timeout)
+	engine := CurrentEngine()
+	// Zero-cost fast path: in-process HCL evaluation for var/local and resource
+	// references. Impure calls such as timestamp() go to terraform, which answers
+	// them with the plan time.
+	if (engine == EngineAuto && !impureSource(e)) || engine == EngineInProcess {
+		if v, ok := TryEvalInProcessWithState(workDir, statePath, varFiles, e, timeout); ok {
+			return v, provenanceInProcess, nil
+		}
+		if engine == EngineInProcess {
+			return nil, "", &EvalError{Summary: "the expression cannot be evaluated in-process"}
+		}
 	}
 	// Try persistent evaluator first for speed
-	if pe := getOrStartPersistentEvaluator(workDir, statePath, varFiles); pe != nil {
-		if v, ok := pe.EvaluateJSON(e, timeout); ok {
-			return v, true
+	if engine == EngineAuto || engine == EnginePersistent {
+		pe := getOrStartPersistentEvaluator(workDir, statePath, varFiles)
+		if pe != nil {
+			if v, ok := pe.EvaluateJSON(e, time.Until(deadline)); ok {
+				return v, provenancePersistent, nil
+			}
+		}
+		if engine == EnginePersistent {
+			diag := &EvalError{Summary: ErrPersistentNoValue.Error(), cause: ErrPersistentNoValue}
+			if pe != nil && pe.LastError() != nil {
+				diag.Detail = pe.LastError().Error()
+			}
+			return nil, "", diag
 		}
 	}
 	// Wrap in jsonencode to force machine-readable output
-	line := "jsonencode(" + e + ")"
+	line := "jsonencode(" + singleLineExpr(e) + ")"
 	// Use a read-only snapshot of the state to avoid lock contention with our writer
 	snap := statePath
 	if fi, err := os.Stat(statePath); err == nil && !fi.IsDir() {
-		tmp := filepath.Join(filepath.Dir(statePath), ".tfstate-eval-"+time.Now().Format("20060102T150405.000000000"))
-		if err := copyFile(statePath, tmp, 0o600); err == nil {
-			snap = tmp
-			defer func() { _ = os.Remove(tmp) }()
+		if dir, err := evalSnapshotDir(statePath); err == nil {
+			tmp := filepath.Join(dir, evalSnapshotPrefix+time.Now().Format("20060102T150405.000000000"))
+			if err := copyFile(statePath, tmp, 0o600); err == nil {
+				snap = tmp
+				defer func() { _ = os.Remove(tmp) }()
+			}
 		}
 	}
 	s := StartConsoleSession(workDir, snap, varFiles)
-	stdout, _, err := s.Evaluate(line, timeout)
+	stdout, stderr, err := s.Evaluate(line, time.Until(deadline))
 	if err != nil {
-		return nil, false
+		return nil, "", &EvalError{Summary: err.Error()}
 	}
 	out := strings.TrimSpace(stdout)
 	if out == "" {
-		return nil, false
+		if diag := ParseEvalError(stderr); diag != nil {
+			return nil, "", diag
+		}
+		return nil, "", &EvalError{Summary: "the expression has no value that can be printed"}
 	}
 	var v any
 	if jerr := json.Unmarshal([]byte(out), &v); jerr != nil {
-		return nil, false
+		return nil, "", &EvalError{Summary: "terraform console printed a value that is not JSON", Detail: out}
 	}
-	return v, true
+	return v, provenanceSubprocess, nil
 }
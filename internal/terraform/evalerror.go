@@ -0,0 +1,95 @@
+package terraform
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EvalError is a failed evaluation. When Terraform reported the failure, it
+// holds the first diagnostic: its summary, detail and the source position it
+// points at, if any.
+type EvalError struct {
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	// cause is the sentinel the failure matches, such as ErrPersistentNoValue
+	cause error
+}
+
+// ErrPersistentNoValue is matched, with errors.Is, by the EvalError returned
+// when the persistent terraform console gave no answer, as opposed to
+// Terraform reporting a diagnostic.
+var ErrPersistentNoValue = errors.New("the persistent terraform console returned no value")
+
+func (e *EvalError) Error() string {
+	if e.Detail == "" {
+		return e.Summary
+	}
+	return e.Summary + ": " + e.Detail
+}
+
+func (e *EvalError) Unwrap() error { return e.cause }
+
+// diagnosticSubject matches the line naming the source of a diagnostic, as in
+// `on main.tf line 3, in locals:`.
+var diagnosticSubject = regexp.MustCompile(`^on (.+) line (\d+)(?:, in .*)?:$`)
+
+// ParseEvalError turns the stderr of terraform console into an EvalError. The
+// first "Error:" diagnostic is used, with or without the box drawing newer
+// Terraform versions frame it in; output without one becomes the summary as
+// is. It returns nil for empty output.
+func ParseEvalError(stderr string) *EvalError {
+	var lines []string
+	for _, l := range strings.Split(strings.ReplaceAll(stderr, "\r\n", "\n"), "\n") {
+		l = strings.TrimRight(l, " \t")
+		if l == "╷" || l == "╵" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(l, "│"); ok {
+			l = strings.TrimPrefix(rest, " ")
+		}
+		lines = append(lines, l)
+	}
+	start := -1
+	for i, l := range lines {
+		if strings.HasPrefix(l, "Error: ") {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		msg := strings.TrimSpace(stderr)
+		if msg == "" {
+			return nil
+		}
+		return &EvalError{Summary: msg}
+	}
+	e := &EvalError{Summary: strings.TrimSpace(strings.TrimPrefix(lines[start], "Error: "))}
+	i := start + 1
+	for i < len(lines) && lines[i] == "" {
+		i++
+	}
+	// The subject line is followed by an indented source snippet up to the
+	// next blank line.
+	if i < len(lines) {
+		if m := diagnosticSubject.FindStringSubmatch(strings.TrimSpace(lines[i])); m != nil && strings.HasPrefix(lines[i], " ") {
+			e.Filename = m[1]
+			e.Line, _ = strconv.Atoi(m[2])
+			for i < len(lines) && lines[i] != "" {
+				i++
+			}
+		}
+	}
+	var detail []string
+	for ; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "Error: ") || strings.HasPrefix(lines[i], "Warning: ") {
+			break
+		}
+		detail = append(detail, lines[i])
+	}
+	e.Detail = strings.TrimSpace(strings.Join(detail, "\n"))
+	return e
+}
@@ -0,0 +1,53 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEvalError(t *testing.T) {
+	boxed := `╷
+│ Error: Reference to undeclared input variable
+│ 
+│   on <console-input> line 1:
+│   (source code not available)
+│ 
+│ An input variable with the name "missing" has not been declared. This
+│ variable can be declared with a variable "missing" {} block.
+╵
+`
+	plain := `
+Error: Invalid function argument
+
+  on main.tf line 4, in locals:
+   4:   n = tonumber("x")
+
+Invalid value for "v" parameter: cannot convert "x" to number.
+
+`
+	for _, tc := range []struct {
+		name, stderr string
+		want         *EvalError
+	}{
+		{"boxed", boxed, &EvalError{
+			Summary:  "Reference to undeclared input variable",
+			Detail:   "An input variable with the name \"missing\" has not been declared. This\nvariable can be declared with a variable \"missing\" {} block.",
+			Filename: "<console-input>",
+			Line:     1,
+		}},
+		{"plain", plain, &EvalError{
+			Summary:  "Invalid function argument",
+			Detail:   `Invalid value for "v" parameter: cannot convert "x" to number.`,
+			Filename: "main.tf",
+			Line:     4,
+		}},
+		{"no diagnostic", "terraform: command not found\n", &EvalError{Summary: "terraform: command not found"}},
+		{"empty", "\n", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ParseEvalError(tc.stderr); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package terraform
 
 import (
 	"bufio"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
@@ -12,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/flowave-io/terraflow/internal/encoding/jsonx"
 	"github.com/google/uuid"
 )
 
@@ -27,15 +31,22 @@ type persistentEvaluator struct {
 	args    []string
 	env     []string
 
-	cmd    *exec.Cmd
-	stdin  io.WriteCloser
-	stdout io.ReadCloser
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    io.ReadCloser
+	traceDone func(error) // ends the trace of cmd when it is killed
 
-	mu      sync.Mutex
-	started bool
-	closed  bool
-	respMu  sync.Mutex
-	waiters map[string]chan string
+	mu       sync.Mutex
+	started  bool
+	closed   bool
+	lastErr  error     // why the most recent evaluation failed, reported by LastError
+	lastUsed time.Time // when the evaluator was last handed out or answered
+	respMu   sync.Mutex
+	waiters  map[string]chan string
+
+	// fingerprint of the real state the snapshot was last copied from
+	snapMu  sync.Mutex
+	snapSum string
 }
 
 var (
@@ -53,14 +64,122 @@ func getOrStartPersistentEvaluator(workDir, statePath string, varFiles []string)
 	key := peKey(workDir, statePath, varFiles)
 	peMu.Lock()
 	defer peMu.Unlock()
+	startIdleReaper()
 	if pe, ok := peInstances[key]; ok && pe != nil && !pe.closed {
+		pe.touch()
 		return pe
 	}
 	pe := &persistentEvaluator{workDir: workDir, realState: statePath, varFiles: append([]string{}, varFiles...), waiters: map[string]chan string{}}
+	pe.touch()
 	peInstances[key] = pe
 	return pe
 }
 
+// touch records that the evaluator is in use, postponing its idle timeout.
+func (p *persistentEvaluator) touch() {
+	p.mu.Lock()
+	p.lastUsed = time.Now()
+	p.mu.Unlock()
+}
+
+// DefaultEvaluatorIdleTimeout is how long a persistent evaluator may go unused
+// before its terraform console process is closed.
+const DefaultEvaluatorIdleTimeout = 5 * time.Minute
+
+// idleReapInterval is how often evaluators are checked for idleness.
+const idleReapInterval = 30 * time.Second
+
+var (
+	idleTimeoutMu sync.Mutex
+	idleTimeout   = DefaultEvaluatorIdleTimeout
+	idleReaper    sync.Once
+)
+
+// SetEvaluatorIdleTimeout closes persistent evaluators that have not been used
+// for d, with their terraform console process and state snapshot; the next
+// evaluation starts a new one. Zero or less keeps them for the whole session.
+func SetEvaluatorIdleTimeout(d time.Duration) {
+	idleTimeoutMu.Lock()
+	idleTimeout = max(d, 0)
+	idleTimeoutMu.Unlock()
+}
+
+// EvaluatorIdleTimeout returns the idle timeout set by SetEvaluatorIdleTimeout,
+// zero when evaluators are kept for the whole session.
+func EvaluatorIdleTimeout() time.Duration {
+	idleTimeoutMu.Lock()
+	defer idleTimeoutMu.Unlock()
+	return idleTimeout
+}
+
+// startIdleReaper starts the goroutine closing idle evaluators, once per
+// process.
+func startIdleReaper() {
+	idleReaper.Do(func() {
+		go func() {
+			for range time.Tick(idleReapInterval) {
+				if ttl := EvaluatorIdleTimeout(); ttl > 0 {
+					reapIdleEvaluators(time.Now().Add(-ttl))
+				}
+			}
+		}()
+	})
+}
+
+// reapIdleEvaluators closes the evaluators last used before cutoff and not
+// waiting for an answer, and removes their snapshots unless another evaluator
+// shares them.
+func reapIdleEvaluators(cutoff time.Time) {
+	peMu.Lock()
+	var idle []*persistentEvaluator
+	for key, pe := range peInstances {
+		if pe == nil || !pe.idleSince(cutoff) {
+			continue
+		}
+		delete(peInstances, key)
+		idle = append(idle, pe)
+	}
+	inUse := map[string]bool{}
+	for _, pe := range peInstances {
+		if pe != nil {
+			inUse[pe.snapshotPath()] = true
+		}
+	}
+	peMu.Unlock()
+	for _, pe := range idle {
+		debugf("closing terraform console idle since %s (in %s)", pe.lastUsedAt().Format(time.RFC3339), pe.workDir)
+		_ = pe.Close()
+		if snap := pe.snapshotPath(); snap != "" && !inUse[snap] {
+			_ = os.Remove(snap)
+		}
+	}
+}
+
+// idleSince reports whether the evaluator was last used before cutoff and
+// has no evaluation in flight.
+func (p *persistentEvaluator) idleSince(cutoff time.Time) bool {
+	if !p.lastUsedAt().Before(cutoff) {
+		return false
+	}
+	p.respMu.Lock()
+	defer p.respMu.Unlock()
+	return len(p.waiters) == 0
+}
+
+func (p *persistentEvaluator) lastUsedAt() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastUsed
+}
+
+// snapshotPath returns the state snapshot the evaluator reads, or "" when it
+// runs without state.
+func (p *persistentEvaluator) snapshotPath() string {
+	p.snapMu.Lock()
+	defer p.snapMu.Unlock()
+	return p.statePath
+}
+
 func (p *persistentEvaluator) ensureStarted() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -76,14 +195,19 @@ func (p *persistentEvaluator) ensureStarted() error {
 		}
 	}
 	// Build args
-	args := []string{"console", "-no-color"}
+	args := consoleBaseArgs()
 	// Prepare a fresh snapshot of the real state to avoid locking the live file
 	if rs := strings.TrimSpace(p.realState); rs != "" {
 		if fi, err := os.Stat(rs); err == nil && !fi.IsDir() {
-			snap := filepath.Join(filepath.Dir(rs), ".tfstate-eval-snapshot.json")
-			if copyFile(rs, snap, 0o600) == nil {
-				p.statePath = snap
-				args = append(args, "-state", snap)
+			if dir, err := evalSnapshotDir(rs); err == nil {
+				snap := filepath.Join(dir, evalSnapshotPrefix+"snapshot.json")
+				p.snapMu.Lock()
+				if copyFile(rs, snap, 0o600) == nil {
+					p.statePath = snap
+					p.snapSum = StateFingerprint(snap)
+					args = append(args, "-state", snap)
+				}
+				p.snapMu.Unlock()
 			}
 		}
 	}
@@ -94,10 +218,7 @@ func (p *persistentEvaluator) ensureStarted() error {
 		args = append(args, "-var-file", vf)
 	}
 	p.args = args
-	env := append([]string{}, os.Environ()...)
-	env = append(env, "TF_IN_AUTOMATION=1")
-	env = append(env, "PAGER=")
-	p.env = env
+	p.env = consoleEnv(p.workDir)
 
 	cmd := exec.Command(p.binPath, p.args...)
 	if p.workDir != "" {
@@ -114,10 +235,13 @@ func (p *persistentEvaluator) ensureStarted() error {
 	}
 	// Discard stderr; evaluator focuses on JSON returns
 	cmd.Stderr = io.Discard
+	done := TraceCommand(cmd)
 	if err := cmd.Start(); err != nil {
+		done(err)
 		return err
 	}
 	p.cmd = cmd
+	p.traceDone = done
 	p.stdin = stdin
 	p.stdout = stdout
 	p.started = true
@@ -132,12 +256,16 @@ func (p *persistentEvaluator) readLoop() {
 	buf := make([]byte, 64*1024)
 	scanner.Buffer(buf, 10*1024*1024)
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || line == ">" { // skip empty/prompt
+		line, ok := evaluatorResponse(scanner.Text())
+		if !ok {
+			// Banners, prompts and warning diagnostics answer no request
+			if noise := strings.TrimSpace(scanner.Text()); noise != "" && noise != ">" {
+				debugf("terraform console: %s", noise)
+			}
 			continue
 		}
 		var m map[string]any
-		if json.Unmarshal([]byte(line), &m) == nil {
+		if jsonx.Unmarshal([]byte(line), &m) == nil {
 			if id, _ := m["__id"].(string); id != "" {
 				p.respMu.Lock()
 				ch := p.waiters[id]
@@ -146,10 +274,8 @@ func (p *persistentEvaluator) readLoop() {
 				if ch != nil {
 					ch <- line
 				}
-				continue
 			}
 		}
-		// Ignore any other non-JSON lines (banners/prompts/warnings)
 	}
 	// On exit, close and notify waiters with empty string
 	p.respMu.Lock()
@@ -173,11 +299,13 @@ func (p *persistentEvaluator) EvaluateJSON(expr string, timeout time.Duration) (
 		return nil, false
 	}
 	if err := p.ensureStarted(); err != nil {
+		p.setLastError(fmt.Errorf("start terraform console: %w", err))
 		return nil, false
 	}
+	// Never answer from a snapshot older than the state on disk
+	p.ensureSnapshotCurrent()
 	id := uuid.NewString()
-	// Wrap expression to include unique id and force JSON output
-	line := "jsonencode({__id=\"" + id + "\", __val=(" + expr + ")})"
+	line := wrapEvaluatorLine(id, expr)
 
 	// Register waiter
 	ch := make(chan string, 1)
@@ -190,6 +318,7 @@ func (p *persistentEvaluator) EvaluateJSON(expr string, timeout time.Duration) (
 	_, werr := io.WriteString(p.stdin, line+"\n")
 	p.mu.Unlock()
 	if werr != nil {
+		p.setLastError(fmt.Errorf("write to terraform console: %w", werr))
 		return nil, false
 	}
 
@@ -202,21 +331,61 @@ func (p *persistentEvaluator) EvaluateJSON(expr string, timeout time.Duration) (
 		p.respMu.Lock()
 		delete(p.waiters, id)
 		p.respMu.Unlock()
+		p.setLastError(fmt.Errorf("terraform console did not answer within %s", timeout))
 		return nil, false
 	}
 	if strings.TrimSpace(resp) == "" {
+		p.setLastError(errors.New("terraform console exited"))
 		return nil, false
 	}
 	var m map[string]any
-	if json.Unmarshal([]byte(resp), &m) != nil {
+	if jsonx.Unmarshal([]byte(resp), &m) != nil {
 		return nil, false
 	}
 	if v, ok := m["__val"]; ok {
+		p.setLastError(nil)
+		p.touch()
 		return v, true
 	}
 	return nil, false
 }
 
+// LastError reports why the most recent evaluation failed to get an answer from
+// the console process, or nil if it succeeded. Expressions that merely fail to
+// evaluate are not errors of the evaluator.
+func (p *persistentEvaluator) LastError() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastErr
+}
+
+func (p *persistentEvaluator) setLastError(err error) {
+	p.mu.Lock()
+	p.lastErr = err
+	p.mu.Unlock()
+}
+
+// evaluatorResponse returns the JSON answer held by a line of console output.
+// Some Terraform and OpenTofu versions print a prompt or the tail of a warning
+// on the same line, so the answer is located by its leading __id key rather
+// than expected at the start of the line. ok is false for anything else, such
+// as banners and the lines of a warning box.
+func evaluatorResponse(line string) (string, bool) {
+	i := strings.Index(line, `{"__id":`)
+	if i < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(line[i:]), true
+}
+
+// wrapEvaluatorLine wraps expr in a jsonencode call tagged with id so the
+// response can be matched to its request. The expression is flattened to one
+// line first, since the console reads a line per request and a trailing
+// comment would otherwise swallow the closing brackets of the wrapper.
+func wrapEvaluatorLine(id, expr string) string {
+	return "jsonencode({__id=\"" + id + "\", __val=(" + singleLineExpr(expr) + ")})"
+}
+
 func (p *persistentEvaluator) Close() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -230,6 +399,9 @@ func (p *persistentEvaluator) Close() error {
 	if p.cmd != nil && p.cmd.Process != nil {
 		_ = p.cmd.Process.Kill()
 		_, _ = p.cmd.Process.Wait()
+		if p.traceDone != nil {
+			p.traceDone(nil)
+		}
 	}
 	return nil
 }
@@ -271,9 +443,54 @@ func UpdatePersistentEvaluatorSnapshots(realStatePath string, stateBytes []byte)
 		}
 	}
 	peMu.Unlock()
+	sum := stateFingerprintOf(stateBytes)
 	for _, pe := range instances {
+		pe.snapMu.Lock()
 		tmp := pe.statePath + ".tmp-" + time.Now().Format("20060102T150405.000000000")
-		_ = os.WriteFile(tmp, stateBytes, 0o600)
-		_ = os.Rename(tmp, pe.statePath)
+		if os.WriteFile(tmp, stateBytes, 0o600) == nil && os.Rename(tmp, pe.statePath) == nil {
+			pe.snapSum = sum
+		}
+		pe.snapMu.Unlock()
+	}
+}
+
+// ensureSnapshotCurrent re-copies the real state into the evaluator snapshot when
+// the state on disk differs from the one it was copied from, closing the window
+// between a state write and the snapshot update. Content is compared rather
+// than the serial, which a reproducible state keeps across rewrites.
+func (p *persistentEvaluator) ensureSnapshotCurrent() {
+	p.snapMu.Lock()
+	defer p.snapMu.Unlock()
+	if strings.TrimSpace(p.statePath) == "" || strings.TrimSpace(p.realState) == "" {
+		return
+	}
+	b, err := os.ReadFile(p.realState)
+	if err != nil {
+		return
+	}
+	sum := stateFingerprintOf(b)
+	if sum == p.snapSum {
+		return
+	}
+	tmp := p.statePath + ".tmp-" + time.Now().Format("20060102T150405.000000000")
+	if os.WriteFile(tmp, b, 0o600) == nil && os.Rename(tmp, p.statePath) == nil {
+		p.snapSum = sum
 	}
 }
+
+// StateFingerprint identifies the content of the state file at path, or is
+// empty when it cannot be read. Unlike the serial, which a reproducible state
+// keeps, it changes with every rewrite that changes the state.
+func StateFingerprint(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return stateFingerprintOf(b)
+}
+
+// stateFingerprintOf is StateFingerprint of raw state JSON.
+func stateFingerprintOf(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,363 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+func TestPersistentEvaluator_SnapshotCatchesUpWithState(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "terraform.tfstate")
+	if err := os.WriteFile(real, []byte(`{"version":4,"serial":1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pe := &persistentEvaluator{realState: real, statePath: filepath.Join(dir, ".tfstate-eval-snapshot.json")}
+	pe.ensureSnapshotCurrent()
+	if got := pe.snapSum; got != StateFingerprint(real) {
+		t.Fatalf("initial snapshot fingerprint = %q, want %q", got, StateFingerprint(real))
+	}
+
+	// A state write the evaluator was not notified about must still be picked
+	// up, also when it keeps the serial as a reproducible state does
+	for _, st := range []map[string]any{
+		{"version": 4, "serial": 2},
+		{"version": 4, "serial": 2, "outputs": map[string]any{"a": map[string]any{"value": 1}}},
+	} {
+		if err := writeStateAtomicRaw(real, st); err != nil {
+			t.Fatal(err)
+		}
+		pe.ensureSnapshotCurrent()
+		want, err := os.ReadFile(real)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := os.ReadFile(pe.statePath); err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("snapshot = %s (err=%v), want %s", got, err, want)
+		}
+		if got := pe.snapSum; got != StateFingerprint(real) {
+			t.Fatalf("snapshot fingerprint = %q, want %q", got, StateFingerprint(real))
+		}
+	}
+}
+
+// fakeTerraform installs a stub terraform on PATH that reports version and
+// answers provider::aws::arn_parse calls the way a 1.8+ console would; older
+// versions reject them on stderr.
+func fakeTerraform(t *testing.T, version string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	dir := t.TempDir()
+	script := `#!/bin/sh
+if [ "$1" = "version" ]; then echo "Terraform v` + version + `"; exit 0; fi
+while IFS= read -r line; do
+  case "$line" in
+  *provider::aws::arn_parse*)
+    case "` + version + `" in
+    1.[0-7].*) echo 'Error: Invalid function name' >&2; exit 1 ;;
+    esac
+    id=$(printf '%s' "$line" | sed -n 's/.*__id="\([^"]*\)".*/\1/p')
+    if [ -n "$id" ]; then
+      printf '{"__id":"%s","__val":{"service":"iam"}}\n' "$id"
+    else
+      echo '{"service":"iam"}'
+    fi
+    ;;
+  esac
+done
+`
+	if err := os.WriteFile(filepath.Join(dir, "terraform"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestEvalJSON_ProviderFunctionUsesEvaluator(t *testing.T) {
+	fakeTerraform(t, "1.8.0")
+	defer ResetAllPersistentEvaluators()
+	dir := writeEvalFixture(t, `locals { a = 1 }`)
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := EnsureStateInitialized(statePath); err != nil {
+		t.Fatal(err)
+	}
+	expr := `provider::aws::arn_parse("arn:aws:iam::123456789012:role/x")`
+	if _, ok := TryEvalInProcessWithState(dir, statePath, nil, expr, time.Second); ok {
+		t.Fatal("provider functions must not resolve in-process")
+	}
+	got, evalErr := EvalJSON(dir, statePath, nil, expr, 5*time.Second)
+	if evalErr != nil || !reflect.DeepEqual(got, map[string]any{"service": "iam"}) {
+		t.Fatalf("got %#v (err=%v)", got, evalErr)
+	}
+}
+
+func TestConsoleSession_ProviderFunctionOnOldBinary(t *testing.T) {
+	fakeTerraform(t, "1.5.7")
+	dir := t.TempDir()
+	s := StartConsoleSession(dir, "", nil)
+	_, stderr, err := s.Evaluate(`provider::aws::arn_parse("x")`, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr, "provider functions require Terraform 1.8+/OpenTofu 1.7+ (found Terraform 1.5.7)") {
+		t.Fatalf("missing version hint in %q", stderr)
+	}
+}
+
+func TestProviderFuncsUnsupported(t *testing.T) {
+	cases := map[string]bool{
+		"Terraform v1.7.5\non linux_amd64": true,
+		"Terraform v1.8.0":                 false,
+		"OpenTofu v1.6.2":                  true,
+		"OpenTofu v1.7.0":                  false,
+		"unknown":                          false,
+	}
+	for out, unsupported := range cases {
+		if got := providerFuncsUnsupported(parseVersionOutput([]byte(out))) != nil; got != unsupported {
+			t.Fatalf("%q: unsupported=%v, want %v", out, got, unsupported)
+		}
+	}
+}
+
+func TestWrapEvaluatorLine_CommentsAndNestedObjects(t *testing.T) {
+	cases := map[string]string{
+		"{a = 1}":                            `{"a":1}`,
+		"{\n  a = 1 # one\n  b = {c = 2}\n}": `{"a":1,"b":{"c":2}}`,
+		"{\n  a = 1,\n  // two\n  b = [\n    2, # in list\n    3,\n  ]\n}": `{"a":1,"b":[2,3]}`,
+		"{for k, v in {x = 1} :\n  k => v + 1\n}":                          `{"x":2}`,
+		"[\n  1, /* inline */ 2\n]":                                        `[1,2]`,
+		"\"a # not a comment\" # but this is":                              `"a # not a comment"`,
+		"merge({a = 1}, {\n  b = \"${1 + 1}\"\n})":                         `{"a":1,"b":2}`,
+	}
+	ctx := &hcl.EvalContext{Functions: map[string]function.Function{
+		"jsonencode": stdlib.JSONEncodeFunc,
+		"merge":      stdlib.MergeFunc,
+	}}
+	for expr, want := range cases {
+		line := wrapEvaluatorLine("id-1", expr)
+		if strings.Contains(line, "\n") {
+			t.Fatalf("%q: wrapped line spans lines: %q", expr, line)
+		}
+		parsed, diags := hclsyntax.ParseExpression([]byte(line), "<line>", hcl.InitialPos)
+		if diags.HasErrors() {
+			t.Fatalf("%q: wrapped line %q does not parse: %s", expr, line, diags.Error())
+		}
+		v, diags := parsed.Value(ctx)
+		if diags.HasErrors() {
+			t.Fatalf("%q: %s", expr, diags.Error())
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(v.AsString()), &m); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := json.Marshal(m["__val"])
+		if m["__id"] != "id-1" || string(got) != want {
+			t.Fatalf("%q: got id=%v val=%s, want %s", expr, m["__id"], got, want)
+		}
+	}
+}
+
+func TestPersistentEvaluator_LastErrorExplainsFailure(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	defer ResetAllPersistentEvaluators()
+	pe := getOrStartPersistentEvaluator(t.TempDir(), "", nil)
+	if _, ok := pe.EvaluateJSON(`"x"`, time.Second); ok {
+		t.Fatal("expected evaluation without terraform to fail")
+	}
+	if err := pe.LastError(); err == nil || !strings.Contains(err.Error(), "start terraform console") {
+		t.Fatalf("LastError = %v", err)
+	}
+}
+
+func TestPersistentEvaluator_IgnoresWarningsAroundResponses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	// A deprecation warning box precedes every answer, which itself follows
+	// a prompt on the same line
+	dir := t.TempDir()
+	script := `#!/bin/sh
+echo 'Terraform console banner'
+while IFS= read -r line; do
+  id=$(printf '%s' "$line" | sed -n 's/.*__id="\([^"]*\)".*/\1/p')
+  echo '╷'
+  echo '│ Warning: Deprecated attribute'
+  echo '│ {"__id":"not-json'
+  echo '╵'
+  printf '> {"__id":"%s","__val":"ok"}\n' "$id"
+done
+`
+	if err := os.WriteFile(filepath.Join(dir, "terraform"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer ResetAllPersistentEvaluators()
+
+	pe := getOrStartPersistentEvaluator(t.TempDir(), "", nil)
+	for range 2 {
+		if v, ok := pe.EvaluateJSON(`"ok"`, 5*time.Second); !ok || v != "ok" {
+			t.Fatalf("got %#v (ok=%v), last error %v", v, ok, pe.LastError())
+		}
+	}
+}
+
+func TestEvaluatorResponse(t *testing.T) {
+	cases := map[string]string{
+		`{"__id":"a","__val":1}`:          `{"__id":"a","__val":1}`,
+		`> {"__id":"a","__val":1}`:        `{"__id":"a","__val":1}`,
+		"  {\"__id\":\"a\"}  ":            `{"__id":"a"}`,
+		"│ Warning: Deprecated":           "",
+		`{"other":1}`:                     "",
+		"Terraform v1.9.0 on linux_amd64": "",
+	}
+	for in, want := range cases {
+		got, ok := evaluatorResponse(in)
+		if ok != (want != "") || got != want {
+			t.Errorf("%q: got %q (ok=%v), want %q", in, got, ok, want)
+		}
+	}
+}
+
+func TestPatchAttrValue_TimestampNotMemoized(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	// A stub console answering timestamp() with a new time on every call
+	bin := t.TempDir()
+	script := `#!/bin/sh
+if [ "$1" = "version" ]; then echo "Terraform v1.8.0"; exit 0; fi
+n=0
+while IFS= read -r line; do
+  n=$((n+1))
+  id=$(printf '%s' "$line" | sed -n 's/.*__id="\([^"]*\)".*/\1/p')
+  printf '{"__id":"%s","__val":"2024-01-01T00:00:0%dZ"}\n' "$id" "$n"
+done
+`
+	if err := os.WriteFile(filepath.Join(bin, "terraform"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer ResetAllPersistentEvaluators()
+
+	dir := writeEvalFixture(t, `locals { a = 1 }`)
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := EnsureStateInitialized(statePath); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &hcl.EvalContext{Functions: terraformFunctions()}
+	var seen []any
+	for i := 0; i < 2; i++ {
+		if err := patchAttrValueExactWithCtx(ctx, "", dir, statePath, nil, "null_resource", "t", "triggers", false, nil, "timestamp()"); err != nil {
+			t.Fatal(err)
+		}
+		st, _, _, err := readStateCached(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := st["resources"].([]any)[0].(map[string]any)
+		attrs := res["instances"].([]any)[0].(map[string]any)["attributes"].(map[string]any)
+		seen = append(seen, attrs["triggers"])
+	}
+	if seen[0] == nil || seen[0] == seen[1] {
+		t.Fatalf("timestamp() was not re-evaluated: %v", seen)
+	}
+	evalMemoMu.Lock()
+	defer evalMemoMu.Unlock()
+	for k := range evalMemo {
+		if strings.HasSuffix(k, "|timestamp()") {
+			t.Fatalf("timestamp() memoized under %q", k)
+		}
+	}
+}
+
+func TestReapIdleEvaluators_ClosesIdleEvaluatorAndRemovesSnapshot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	bin := t.TempDir()
+	script := `#!/bin/sh
+while IFS= read -r line; do
+  id=$(printf '%s' "$line" | sed -n 's/.*__id="\([^"]*\)".*/\1/p')
+  printf '{"__id":"%s","__val":"ok"}\n' "$id"
+done
+`
+	if err := os.WriteFile(filepath.Join(bin, "terraform"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer ResetAllPersistentEvaluators()
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := os.WriteFile(statePath, []byte(`{"version":4,"serial":1,"resources":[]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pe := getOrStartPersistentEvaluator(dir, statePath, nil)
+	if v, ok := pe.EvaluateJSON(`"ok"`, 5*time.Second); !ok || v != "ok" {
+		t.Fatalf("got %#v (ok=%v), last error %v", v, ok, pe.LastError())
+	}
+	snap := pe.snapshotPath()
+	if _, err := os.Stat(snap); err != nil {
+		t.Fatalf("snapshot missing: %v", err)
+	}
+
+	isClosed := func() bool {
+		pe.mu.Lock()
+		defer pe.mu.Unlock()
+		return pe.closed
+	}
+	// Still within the timeout
+	reapIdleEvaluators(time.Now().Add(-time.Minute))
+	if isClosed() {
+		t.Fatal("evaluator used within the timeout was closed")
+	}
+
+	reapIdleEvaluators(time.Now().Add(time.Second))
+	if !isClosed() {
+		t.Fatal("idle evaluator was not closed")
+	}
+	if _, err := os.Stat(snap); !os.IsNotExist(err) {
+		t.Fatalf("snapshot not removed: %v", err)
+	}
+	if next := getOrStartPersistentEvaluator(dir, statePath, nil); next == pe {
+		t.Fatal("a reaped evaluator was handed out again")
+	}
+}
+
+func TestEvalJSON_TimeoutBoundsAllEvaluators(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binary is a shell script")
+	}
+	// A terraform whose consoles never answer
+	bin := t.TempDir()
+	script := "#!/bin/sh\nwhile IFS= read -r line; do :; done\nsleep 5\n"
+	if err := os.WriteFile(filepath.Join(bin, "terraform"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer ResetAllPersistentEvaluators()
+	dir := writeEvalFixture(t, `locals { a = 1 }`)
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := EnsureStateInitialized(statePath); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, evalErr := EvalJSON(dir, statePath, nil, `timestamp()`, time.Second); evalErr == nil {
+		t.Fatal("expected a timeout")
+	}
+	if d := time.Since(start); d > 1500*time.Millisecond {
+		t.Fatalf("evaluation took %v with a 1s timeout", d)
+	}
+}
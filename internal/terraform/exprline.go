@@ -0,0 +1,81 @@
+package terraform
+
+import (
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// singleLineExpr rewrites a possibly multi-line expression as one logical line
+// with the same meaning: comments are dropped, newlines separating object
+// attributes become commas and all other newlines become spaces. Input that
+// does not lex cleanly, or that holds a heredoc, is returned unchanged.
+func singleLineExpr(expr string) string {
+	if !strings.ContainsAny(expr, "\n\r#/") {
+		return expr
+	}
+	toks, diags := hclsyntax.LexExpression([]byte(expr), "<expr>", hcl.InitialPos)
+	if diags.HasErrors() {
+		return expr
+	}
+	// Each open bracket records whether newlines inside it separate object
+	// attributes; they do for object constructors but not for-expressions.
+	var objects []bool
+	inObject := func() bool { return len(objects) > 0 && objects[len(objects)-1] }
+	var b strings.Builder
+	prev := hclsyntax.TokenNil
+	prevEnd := 0
+	pendingSep, pendingSpace := false, false
+	for i, tok := range toks {
+		switch tok.Type {
+		case hclsyntax.TokenOHeredoc:
+			return expr
+		case hclsyntax.TokenEOF:
+			continue
+		case hclsyntax.TokenNewline, hclsyntax.TokenComment:
+			if inObject() && (tok.Type == hclsyntax.TokenNewline || strings.HasSuffix(string(tok.Bytes), "\n")) {
+				pendingSep = true
+			}
+			pendingSpace = true
+			prevEnd = tok.Range.End.Byte
+			continue
+		}
+		if pendingSep && tok.Type != hclsyntax.TokenCBrace && prev != hclsyntax.TokenOBrace && prev != hclsyntax.TokenComma {
+			b.WriteString(",")
+		}
+		if b.Len() > 0 && (pendingSpace || tok.Range.Start.Byte > prevEnd) {
+			b.WriteString(" ")
+		}
+		pendingSep, pendingSpace = false, false
+		b.Write(tok.Bytes)
+
+		switch tok.Type {
+		case hclsyntax.TokenOBrace:
+			objects = append(objects, !nextIsFor(toks[i+1:]))
+		case hclsyntax.TokenOParen, hclsyntax.TokenOBrack, hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			objects = append(objects, false)
+		case hclsyntax.TokenCBrace, hclsyntax.TokenCParen, hclsyntax.TokenCBrack, hclsyntax.TokenTemplateSeqEnd:
+			if len(objects) > 0 {
+				objects = objects[:len(objects)-1]
+			}
+		}
+		prev = tok.Type
+		prevEnd = tok.Range.End.Byte
+	}
+	return b.String()
+}
+
+// nextIsFor reports whether the first significant token is the "for" keyword.
+func nextIsFor(toks hclsyntax.Tokens) bool {
+	for _, tok := range toks {
+		switch tok.Type {
+		case hclsyntax.TokenNewline, hclsyntax.TokenComment:
+			continue
+		case hclsyntax.TokenIdent:
+			return string(tok.Bytes) == "for"
+		}
+		return false
+	}
+	return false
+}
@@ -3,13 +3,15 @@ package terraform
 import (
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/flowave-io/terraflow/internal/encoding/jsonx"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
-	"github.com/hashicorp/terraform-config-inspect/tfconfig"
 	cty "github.com/zclconf/go-cty/cty"
 )
 
@@ -17,42 +19,180 @@ import (
 // best-effort subset of Terraform semantics: variables (var.*), locals (local.*),
 // and standard cty functions from stdlib. Falls back to external console when false.
 func TryEvalInProcess(workDir string, varFiles []string, expr string, timeout time.Duration) (any, bool) {
+	return tryEvalInProcess(workDir, varFiles, nil, expr)
+}
+
+// TryEvalInProcessWithState is like TryEvalInProcess but also resolves references
+// to root-module managed resources (aws_instance.web.id, aws_instance.web[*].id)
+// and data sources (data.aws_ami.ubuntu.id) from the synthesized state at statePath.
+func TryEvalInProcessWithState(workDir, statePath string, varFiles []string, expr string, timeout time.Duration) (any, bool) {
+	return tryEvalInProcess(workDir, varFiles, stateResourceValues(statePath), expr)
+}
+
+func tryEvalInProcess(workDir string, varFiles []string, resources map[string]cty.Value, expr string) (any, bool) {
 	if strings.TrimSpace(expr) == "" {
 		return nil, false
 	}
-	// Build evaluation context from module variables (defaults + tfvars) and locals
+	v, diags := evalInProcessDiags(workDir, varFiles, resources, expr)
+	if diags.HasErrors() || !v.IsWhollyKnown() {
+		return nil, false
+	}
+	goV, ok := convertCtyToGo(v)
+	if !ok {
+		return nil, false
+	}
+	return goV, true
+}
+
+// evalInProcessDiags evaluates expr against module variables (defaults + tfvars),
+// locals and the given resources, returning the diagnostics so callers can
+// tell why an expression did not resolve.
+func evalInProcessDiags(workDir string, varFiles []string, resources map[string]cty.Value, expr string) (cty.Value, hcl.Diagnostics) {
 	vars, locals := loadVarsAndLocals(workDir, varFiles)
 	ctx := &hcl.EvalContext{
 		Variables: map[string]cty.Value{
 			"var":   ctyObjectFromMap(vars),
 			"local": ctyObjectFromMap(locals),
+			"path":  pathObject(workDir),
 		},
-		Functions: terraformFunctions(),
+		Functions: workDirFunctions(workDir),
+	}
+	for rType, v := range resources {
+		if _, reserved := ctx.Variables[rType]; !reserved {
+			ctx.Variables[rType] = v
+		}
 	}
 	// Parse expression as a snippet; file name is synthetic
 	tfExpr, diags := hclsyntax.ParseExpression([]byte(expr), filepath.Join(workDir, "__expr__.tf"), hcl.Pos{Line: 1, Column: 1})
 	if diags.HasErrors() || tfExpr == nil {
-		return nil, false
+		return cty.DynamicVal, diags
 	}
-	v, diags := tfExpr.Value(ctx)
-	if diags.HasErrors() || !v.IsWhollyKnown() {
-		return nil, false
+	return tfExpr.Value(ctx)
+}
+
+var (
+	stateValsMu   sync.Mutex
+	stateValsMemo = map[string]stateValsEntry{}
+)
+
+type stateValsEntry struct {
+	sum  string
+	vals map[string]cty.Value
+}
+
+// stateResourceValues converts the root-module managed resources in the state
+// file into HCL variables keyed by resource type, shaped like Terraform's: a
+// single object per name, a tuple for count, or an object for for_each. Data
+// sources are nested the same way under "data". An instance whose attributes
+// cannot be converted is an unknown value, so the instances after it keep
+// their index and references to it fall back to terraform console. The result
+// is memoized per state file content.
+func stateResourceValues(statePath string) map[string]cty.Value {
+	b, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil
 	}
-	goV, ok := convertCtyToGo(v)
-	if !ok {
-		return nil, false
+	sum := stateFingerprintOf(b)
+	stateValsMu.Lock()
+	if e, ok := stateValsMemo[statePath]; ok && e.sum == sum {
+		stateValsMu.Unlock()
+		return e.vals
 	}
-	return goV, true
+	stateValsMu.Unlock()
+	var st struct {
+		Resources []struct {
+			Module    string `json:"module"`
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				IndexKey   any            `json:"index_key"`
+				Attributes map[string]any `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if jsonx.Unmarshal(b, &st) != nil {
+		return nil
+	}
+	byType := map[string]map[string]cty.Value{}
+	dataByType := map[string]map[string]cty.Value{}
+	for _, r := range st.Resources {
+		if r.Module != "" || (r.Mode != "managed" && r.Mode != "data") || r.Type == "" || r.Name == "" || len(r.Instances) == 0 {
+			continue
+		}
+		var v cty.Value
+		switch r.Instances[0].IndexKey.(type) {
+		case float64:
+			insts := make([]cty.Value, 0, len(r.Instances))
+			sort.SliceStable(r.Instances, func(i, j int) bool {
+				a, _ := r.Instances[i].IndexKey.(float64)
+				b, _ := r.Instances[j].IndexKey.(float64)
+				return a < b
+			})
+			for _, in := range r.Instances {
+				cv, ok := convertInterfaceToCty(in.Attributes)
+				if !ok {
+					cv = cty.DynamicVal
+				}
+				insts = append(insts, cv)
+			}
+			v = cty.TupleVal(insts)
+		case string:
+			insts := map[string]cty.Value{}
+			for _, in := range r.Instances {
+				k, _ := in.IndexKey.(string)
+				cv, ok := convertInterfaceToCty(in.Attributes)
+				if !ok {
+					cv = cty.DynamicVal
+				}
+				insts[k] = cv
+			}
+			v = cty.ObjectVal(insts)
+		default:
+			cv, ok := convertInterfaceToCty(r.Instances[0].Attributes)
+			if !ok {
+				cv = cty.DynamicVal
+			}
+			v = cv
+		}
+		types := byType
+		if r.Mode == "data" {
+			types = dataByType
+		}
+		if types[r.Type] == nil {
+			types[r.Type] = map[string]cty.Value{}
+		}
+		types[r.Type][r.Name] = v
+	}
+	vals := make(map[string]cty.Value, len(byType))
+	for t, names := range byType {
+		vals[t] = cty.ObjectVal(names)
+	}
+	if len(dataByType) > 0 {
+		data := make(map[string]cty.Value, len(dataByType))
+		for t, names := range dataByType {
+			data[t] = cty.ObjectVal(names)
+		}
+		vals["data"] = cty.ObjectVal(data)
+	}
+	stateValsMu.Lock()
+	stateValsMemo[statePath] = stateValsEntry{sum: sum, vals: vals}
+	stateValsMu.Unlock()
+	return vals
 }
 
 func loadVarsAndLocals(workDir string, varFiles []string) (map[string]cty.Value, map[string]cty.Value) {
 	abs, _ := filepath.Abs(workDir)
 	vars := map[string]cty.Value{}
 	locals := map[string]cty.Value{}
+	var sensitiveVars []string
 	// Variable defaults via tfconfig
-	if mod, diags := tfconfig.LoadModule(abs); diags == nil || !diags.HasErrors() {
+	if mod, diags := loadModule(abs); diags == nil || !diags.HasErrors() {
 		if mod != nil {
 			for name, v := range mod.Variables {
+				if v.Sensitive {
+					sensitiveVars = append(sensitiveVars, name)
+				}
 				if v.Default != nil {
 					if cv, ok := convertInterfaceToCty(v.Default); ok {
 						vars[name] = cv
@@ -66,21 +206,27 @@ func loadVarsAndLocals(workDir string, varFiles []string) (map[string]cty.Value,
 		if strings.TrimSpace(vf) == "" {
 			continue
 		}
-		p := hclparse.NewParser()
-		f, diags := p.ParseHCLFile(vf)
+		f, diags := parseVarFile(hclparse.NewParser(), vf)
 		if diags != nil && diags.HasErrors() || f == nil {
 			continue
 		}
 		body := f.Body
 		attrs, _ := body.JustAttributes()
 		for k, a := range attrs {
-			if v, d := a.Expr.Value(&hcl.EvalContext{}); d == nil || !d.HasErrors() {
+			// A nil context keeps JSON strings literal, as Terraform reads var-files
+			if v, d := a.Expr.Value(nil); d == nil || !d.HasErrors() {
 				if v.IsWhollyKnown() {
 					vars[k] = v
 				}
 			}
 		}
 	}
+	// Variables declared sensitive stay marked wherever they are used
+	for _, name := range sensitiveVars {
+		if v, ok := vars[name]; ok {
+			vars[name] = v.Mark(sensitiveMark)
+		}
+	}
 	// Compute locals by iterating until fixed point
 	p := hclparse.NewParser()
 	// Collect local attribute expressions across files
@@ -93,7 +239,7 @@ func loadVarsAndLocals(workDir string, varFiles []string) (map[string]cty.Value,
 		if strings.ToLower(filepath.Ext(path)) != ".tf" {
 			return nil
 		}
-		f, diags := p.ParseHCLFile(path)
+		f, diags := parseHCLConfigFile(p, path)
 		if diags != nil && diags.HasErrors() || f == nil {
 			return nil
 		}
@@ -110,7 +256,7 @@ func loadVarsAndLocals(workDir string, varFiles []string) (map[string]cty.Value,
 	// Iteratively evaluate locals
 	for i := 0; i < 4; i++ { // limit to prevent cycles
 		progressed := false
-		ctx := &hcl.EvalContext{Variables: map[string]cty.Value{"var": ctyObjectFromMap(vars), "local": ctyObjectFromMap(locals)}, Functions: terraformFunctions()}
+		ctx := &hcl.EvalContext{Variables: map[string]cty.Value{"var": ctyObjectFromMap(vars), "local": ctyObjectFromMap(locals), "path": pathObject(workDir)}, Functions: workDirFunctions(workDir)}
 		for name, la := range locExprs {
 			if _, exists := locals[name]; exists {
 				continue
@@ -129,6 +275,18 @@ func loadVarsAndLocals(workDir string, varFiles []string) (map[string]cty.Value,
 	return vars, locals
 }
 
+// parseVarFile parses a var-file with the JSON parser when its name ends in
+// .json (terraform.tfvars.json) and as native syntax otherwise.
+func parseVarFile(p *hclparse.Parser, path string) (*hcl.File, hcl.Diagnostics) {
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		if src, err := readConfigFile(path); err == nil {
+			return p.ParseJSON(src, path)
+		}
+		return p.ParseJSONFile(path)
+	}
+	return parseHCLConfigFile(p, path)
+}
+
 func ctyObjectFromMap(m map[string]cty.Value) cty.Value {
 	if len(m) == 0 {
 		return cty.EmptyObjectVal
@@ -0,0 +1,159 @@
+package terraform
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// focusAddr is one parsed -focus address: a module path, optionally narrowed to
+// a single resource within that module.
+type focusAddr struct {
+	modulePath []string
+	rType      string
+	rName      string
+}
+
+// FocusFilter restricts state synthesis to resources matching any of its
+// addresses. An empty filter matches everything.
+type FocusFilter []focusAddr
+
+var (
+	focusMu sync.RWMutex
+	focus   FocusFilter
+)
+
+// ParseFocus parses -focus addresses. Each address is either a module path
+// ("module.db", "module.a.module.b") selecting every resource beneath it, or a
+// resource address optionally prefixed by a module path ("aws_instance.web",
+// "module.db.aws_db_instance.main"). Instance keys such as "[0]" are ignored.
+func ParseFocus(addrs []string) (FocusFilter, error) {
+	var out FocusFilter
+	for _, raw := range addrs {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		a, err := ParseAddress(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid focus address: %w", err)
+		}
+		if a.Mode == "data" {
+			return nil, fmt.Errorf("invalid focus address %q: data sources cannot be focused", raw)
+		}
+		out = append(out, focusAddr{modulePath: a.ModulePath(), rType: a.Type, rName: a.Name})
+	}
+	return out, nil
+}
+
+// SetFocus restricts state synthesis for the rest of the process to resources
+// matching f. Passing nil removes the restriction.
+func SetFocus(f FocusFilter) {
+	focusMu.Lock()
+	focus = f
+	focusMu.Unlock()
+}
+
+func currentFocus() FocusFilter {
+	focusMu.RLock()
+	defer focusMu.RUnlock()
+	return focus
+}
+
+// Matches reports whether the resource at modulePath with the given type and
+// name is selected by the filter.
+func (f FocusFilter) Matches(modulePath []string, rType, rName string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, fa := range f {
+		if !hasPathPrefix(modulePath, fa.modulePath) {
+			continue
+		}
+		if fa.rType == "" {
+			return true
+		}
+		if len(modulePath) == len(fa.modulePath) && fa.rType == rType && fa.rName == rName {
+			return true
+		}
+	}
+	return false
+}
+
+// coversModule reports whether any resource declared directly in the module at
+// modulePath can match the filter, allowing scanners to skip whole modules.
+func (f FocusFilter) coversModule(modulePath []string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, fa := range f {
+		if hasPathPrefix(modulePath, fa.modulePath) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPathPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// moduleStringToPath is the inverse of modulePathToString. Instance keys, as
+// in module.envs["prod"], are dropped.
+func moduleStringToPath(s string) []string {
+	if s == "" {
+		return nil
+	}
+	a, err := ParseAddress(s)
+	if err != nil || !a.IsModule() {
+		return nil
+	}
+	return a.ModulePath()
+}
+
+// filter returns the subset of cfgs selected by the filter.
+func (f FocusFilter) filter(cfgs []ResourceConfig) []ResourceConfig {
+	if len(f) == 0 {
+		return cfgs
+	}
+	out := cfgs[:0:0]
+	for _, rc := range cfgs {
+		if f.Matches(rc.ModulePath, rc.Type, rc.Name) {
+			out = append(out, rc)
+		}
+	}
+	return out
+}
+
+// focusMatchesKey applies the filter to a resourceKey-formatted address.
+func focusMatchesKey(f FocusFilter, key string) bool {
+	parts := strings.Split(key, "|")
+	switch len(parts) {
+	case 2:
+		return f.Matches(nil, parts[0], parts[1])
+	case 3:
+		return f.Matches(moduleStringToPath(parts[0]), parts[1], parts[2])
+	}
+	return false
+}
+
+// matchesResource is used by the file-targeted patchers, which do not know the
+// module a block belongs to: module-only addresses are assumed to cover it.
+func (f FocusFilter) matchesResource(rType, rName string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, fa := range f {
+		if fa.rType == "" || (fa.rType == rType && fa.rName == rName) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package terraform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestParseFocus(t *testing.T) {
+	valid := []string{"aws_instance.web", "module.db", "module.a.module.b.aws_s3_bucket.logs", "aws_instance.web[0]"}
+	if _, err := ParseFocus(valid); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, bad := range []string{"aws_instance", "module", "a.b.c", "data.aws_ami.x"} {
+		if _, err := ParseFocus([]string{bad}); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestPatchState_FocusRestrictsToTargetedResource(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "db"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"main.tf": `
+resource "aws_instance" "web" {
+  ami = "ami-1"
+}
+resource "aws_instance" "worker" {
+  ami = "ami-2"
+}
+module "db" {
+  source = "./db"
+}
+`,
+		"db/main.tf": `
+resource "aws_db_instance" "main" {
+  engine = "postgres"
+}
+`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addresses := func(statePath string) []string {
+		t.Helper()
+		b, err := os.ReadFile(statePath)
+		if err != nil {
+			t.Fatalf("read state: %v", err)
+		}
+		var st map[string]any
+		if err := json.Unmarshal(b, &st); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		var out []string
+		res, _ := st["resources"].([]any)
+		for _, r := range res {
+			m := r.(map[string]any)
+			mod, _ := m["module"].(string)
+			out = append(out, resourceKey(mod, m["type"].(string), m["name"].(string)))
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	cases := map[string][]string{
+		"aws_instance.web": {"aws_instance|web"},
+		"module.db":        {"module.db|aws_db_instance|main"},
+	}
+	for addr, want := range cases {
+		f, err := ParseFocus([]string{addr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		SetFocus(f)
+		statePath := filepath.Join(t.TempDir(), "terraform.tfstate")
+		err = PatchStateFromConfig(root, statePath, nil)
+		SetFocus(nil)
+		if err != nil {
+			t.Fatalf("%s: patch: %v", addr, err)
+		}
+		got := addresses(statePath)
+		if len(got) != len(want) || got[0] != want[0] {
+			t.Fatalf("%s: got %v, want %v", addr, got, want)
+		}
+	}
+}
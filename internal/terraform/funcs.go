@@ -1,11 +1,29 @@
 package terraform
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"net/url"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/customdecode"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	ctyyaml "github.com/zclconf/go-cty-yaml"
 	cty "github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
 )
 
 // terraformFunctions provides a minimal set of Terraform-like functions to resolve
@@ -80,11 +98,14 @@ func terraformFunctions() map[string]function.Function {
 			},
 		}),
 		"coalesce": function.New(&function.Spec{
-			VarParam: &function.Parameter{Name: "vals", Type: cty.DynamicPseudoType},
+			VarParam: &function.Parameter{Name: "vals", Type: cty.DynamicPseudoType, AllowNull: true, AllowDynamicType: true},
 			Type:     function.StaticReturnType(cty.DynamicPseudoType),
 			Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
 				for _, a := range args {
-					if !a.IsNull() && a.IsKnown() {
+					if !a.IsKnown() {
+						return cty.DynamicVal, nil
+					}
+					if !a.IsNull() {
 						// prefer non-empty strings
 						if a.Type() == cty.String && a.AsString() == "" {
 							continue
@@ -95,12 +116,348 @@ func terraformFunctions() map[string]function.Function {
 				return cty.NullVal(cty.DynamicPseudoType), nil
 			},
 		}),
+		// As in Terraform, a substring enclosed in slashes is a regular expression
+		// whose matches are replaced, with $1 and ${name} expanding to its groups.
 		"replace": function.New(&function.Spec{
 			Params: []function.Parameter{{Name: "s", Type: cty.String}, {Name: "substr", Type: cty.String}, {Name: "repl", Type: cty.String}},
 			Type:   function.StaticReturnType(cty.String),
 			Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
-				return cty.StringVal(strings.ReplaceAll(args[0].AsString(), args[1].AsString(), args[2].AsString())), nil
+				str, substr, repl := args[0].AsString(), args[1].AsString(), args[2].AsString()
+				if len(substr) > 1 && strings.HasPrefix(substr, "/") && strings.HasSuffix(substr, "/") {
+					re, err := regexp.Compile(substr[1 : len(substr)-1])
+					if err != nil {
+						return cty.UnknownVal(cty.String), function.NewArgErrorf(1, "invalid regular expression: %s", err)
+					}
+					return cty.StringVal(re.ReplaceAllString(str, repl)), nil
+				}
+				return cty.StringVal(strings.ReplaceAll(str, substr, repl)), nil
 			},
 		}),
+		// Regular expressions use Go's RE2 syntax, like Terraform's.
+		"regex":    stdlib.RegexFunc,
+		"regexall": stdlib.RegexAllFunc,
+		// String helpers shared with Terraform through cty's stdlib; substr
+		// counts characters and accepts a negative offset from the end.
+		"trim":       stdlib.TrimFunc,
+		"trimprefix": stdlib.TrimPrefixFunc,
+		"trimsuffix": stdlib.TrimSuffixFunc,
+		"trimspace":  stdlib.TrimSpaceFunc,
+		"title":      stdlib.TitleFunc,
+		"substr":     stdlib.SubstrFunc,
+		"strrev":     stdlib.ReverseFunc,
+		"startswith": stringPredicateFunc(strings.HasPrefix),
+		"endswith":   stringPredicateFunc(strings.HasSuffix),
+		// List access; index expressions (var.list[0]) are handled natively by HCL.
+		"element": stdlib.ElementFunc,
+		"slice":   stdlib.SliceFunc,
+		// Map and collection helpers.
+		"length":   lengthFunc,
+		"lookup":   lookupFunc,
+		"keys":     stdlib.KeysFunc,
+		"values":   stdlib.ValuesFunc,
+		"contains": stdlib.ContainsFunc,
+		"one":      oneFunc,
+		"merge":    stdlib.MergeFunc,
+		"zipmap":   stdlib.ZipmapFunc,
+		// Set operations. cty iterates sets in a fixed order (strings sorted,
+		// numbers ascending), so their results convert to stable lists.
+		"setunion":        stdlib.SetUnionFunc,
+		"setintersection": stdlib.SetIntersectionFunc,
+		"setsubtract":     stdlib.SetSubtractFunc,
+		"setproduct":      stdlib.SetProductFunc,
+		// Type conversions; invalid input is an error so try() can fall back.
+		"tonumber": stdlib.MakeToFunc(cty.Number),
+		"tobool":   stdlib.MakeToFunc(cty.Bool),
+		"tolist":   stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
+		"tomap":    stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+		"toset":    stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+		"try":      tryFunc,
+		"can":      canFunc,
+		// Encoding and hashing. uuid() is deliberately absent: its result differs on
+		// every call, so it is left to terraform console.
+		"base64encode": base64EncodeFunc,
+		"base64decode": base64DecodeFunc,
+		"base64gzip":   base64GzipFunc,
+		"md5":          makeHashFunc(md5.New),
+		"sha1":         makeHashFunc(sha1.New),
+		"sha256":       makeHashFunc(sha256.New),
+		"sha512":       makeHashFunc(sha512.New),
+		"urlencode":    urlEncodeFunc,
+		// IP network arithmetic.
+		"cidrhost":    cidrHostFunc,
+		"cidrnetmask": cidrNetmaskFunc,
+		"cidrsubnet":  cidrSubnetFunc,
+		"cidrsubnets": cidrSubnetsFunc,
+		// Sensitivity marks; results derived from a sensitive value are redacted.
+		"sensitive":    sensitiveFunc,
+		"nonsensitive": nonsensitiveFunc,
+		// Structured data encodings; YAML uses the same implementation as Terraform.
+		"jsondecode": stdlib.JSONDecodeFunc,
+		"yamldecode": ctyyaml.YAMLDecodeFunc,
+		"yamlencode": ctyyaml.YAMLEncodeFunc,
+		// Date and time arithmetic on RFC 3339 timestamps. timestamp() and
+		// plantimestamp() are deliberately absent: Terraform answers them with the
+		// plan time, so they are left to terraform console.
+		"formatdate": stdlib.FormatDateFunc,
+		"timeadd":    stdlib.TimeAddFunc,
+	}
+}
+
+// impureFunctions return a different result on every call, so expressions
+// using them are never evaluated in-process nor served from a cache.
+var impureFunctions = map[string]bool{
+	"bcrypt":        true,
+	"plantimestamp": true,
+	"timestamp":     true,
+	"uuid":          true,
+}
+
+// CallsImpureFunction reports whether expr calls a function whose result
+// differs on every call, such as timestamp().
+func CallsImpureFunction(expr hclsyntax.Expression) bool {
+	impure := false
+	_ = hclsyntax.VisitAll(expr, func(n hclsyntax.Node) hcl.Diagnostics {
+		if call, ok := n.(*hclsyntax.FunctionCallExpr); ok && impureFunctions[strings.TrimPrefix(call.Name, "core::")] {
+			impure = true
+		}
+		return nil
+	})
+	return impure
+}
+
+// impureSource reports whether the expression source calls an impure function.
+// Source that does not parse is reported as pure; it cannot be evaluated anyway.
+func impureSource(src string) bool {
+	expr, diags := hclsyntax.ParseExpression([]byte(src), "<expr>", hcl.InitialPos)
+	return !diags.HasErrors() && CallsImpureFunction(expr)
+}
+
+// oneFunc follows Terraform's one: the only element of a list, set or tuple,
+// null when it is empty, and an error with more than one element.
+var oneFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{Name: "list", Type: cty.DynamicPseudoType}},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		ty := args[0].Type()
+		switch {
+		case ty == cty.DynamicPseudoType:
+			return cty.DynamicPseudoType, nil
+		case ty.IsListType() || ty.IsSetType():
+			return ty.ElementType(), nil
+		case ty.IsTupleType():
+			switch elems := ty.TupleElementTypes(); len(elems) {
+			case 0:
+				return cty.DynamicPseudoType, nil
+			case 1:
+				return elems[0], nil
+			}
+		}
+		return cty.NilType, function.NewArgErrorf(0, "must be a list, set, or tuple value with either zero or one elements")
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		val := args[0]
+		switch {
+		case val.IsNull():
+			return cty.NilVal, function.NewArgErrorf(0, "argument must not be null")
+		case !val.IsKnown():
+			return cty.UnknownVal(retType), nil
+		}
+		switch val.LengthInt() {
+		case 0:
+			return cty.NullVal(retType), nil
+		case 1:
+			it := val.ElementIterator()
+			it.Next()
+			_, v := it.Element()
+			return v, nil
+		}
+		return cty.NilVal, function.NewArgErrorf(0, "must be a list, set, or tuple value with either zero or one elements")
+	},
+})
+
+// lookupFunc follows Terraform's lookup: the default argument is optional, and
+// without it a missing key is an error rather than a null result. A null
+// default, as in lookup(var.tags, "team", null), yields null for a missing key.
+var lookupFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "inputMap", Type: cty.DynamicPseudoType},
+		{Name: "key", Type: cty.String},
+	},
+	VarParam: &function.Parameter{Name: "default", Type: cty.DynamicPseudoType, AllowNull: true, AllowDynamicType: true},
+	Type:     function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		switch {
+		case len(args) > 3:
+			return cty.NilVal, fmt.Errorf("lookup() takes two or three arguments, got %d", len(args))
+		case len(args) == 3 && !args[2].IsNull():
+			return stdlib.LookupFunc.Call(args)
+		}
+		m, key := args[0], args[1].AsString()
+		ty := m.Type()
+		switch {
+		case ty.IsObjectType():
+			if ty.HasAttribute(key) {
+				return m.GetAttr(key), nil
+			}
+		case ty.IsMapType():
+			if !m.IsNull() && m.HasIndex(cty.StringVal(key)) == cty.True {
+				return m.Index(cty.StringVal(key)), nil
+			}
+		default:
+			return cty.NilVal, function.NewArgErrorf(0, "lookup() requires a map as the first argument")
+		}
+		if len(args) == 3 {
+			return args[2], nil
+		}
+		return cty.NilVal, fmt.Errorf("lookup failed to find key %q", key)
+	},
+})
+
+// canFunc is tryfunc.CanFunc except that an argument referring to a variable,
+// local or resource the in-process context could not resolve yields an unknown
+// bool instead of false. Such a reference usually exists in the configuration
+// (a variable without a default, a local depending on a resource), so the
+// expression falls back to terraform console rather than reporting a false
+// that Terraform would not.
+var canFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{Name: "expression", Type: customdecode.ExpressionClosureType}},
+	Type:   function.StaticReturnType(cty.Bool),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		closure := customdecode.ExpressionClosureFromVal(args[0])
+		for _, tr := range closure.Expression.Variables() {
+			if !referenceResolvable(closure.EvalContext, tr) {
+				return cty.UnknownVal(cty.Bool), nil
+			}
+		}
+		return tryfunc.CanFunc.Call(args)
+	},
+})
+
+// tryFunc is tryfunc.TryFunc except that reaching an argument referring to a
+// variable, local or resource the in-process context could not resolve yields
+// an unknown value instead of moving on to the next argument, for the same
+// reason as canFunc.
+var tryFunc = function.New(&function.Spec{
+	VarParam: &function.Parameter{Name: "expressions", Type: customdecode.ExpressionClosureType},
+	Type:     function.StaticReturnType(cty.DynamicPseudoType),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		for _, arg := range args {
+			closure := customdecode.ExpressionClosureFromVal(arg)
+			for _, tr := range closure.Expression.Variables() {
+				if !referenceResolvable(closure.EvalContext, tr) {
+					return cty.DynamicVal, nil
+				}
+			}
+			if v, err := tryfunc.TryFunc.Call([]cty.Value{arg}); err == nil {
+				return v, nil
+			}
+		}
+		return tryfunc.TryFunc.Call(args)
+	},
+})
+
+// referenceResolvable reports whether the root of tr is defined in ctx and, for
+// a root defined at the top level (var, local, a resource type), whether it has
+// the attribute named by the next step. Iterator symbols of for expressions are
+// only checked for existence.
+func referenceResolvable(ctx *hcl.EvalContext, tr hcl.Traversal) bool {
+	root := tr.RootName()
+	for c := ctx; c != nil; c = c.Parent() {
+		v, ok := c.Variables[root]
+		if !ok {
+			continue
+		}
+		if c.Parent() != nil || len(tr) < 2 {
+			return true
+		}
+		attr, isAttr := tr[1].(hcl.TraverseAttr)
+		if !isAttr || !v.Type().IsObjectType() {
+			return true
+		}
+		return v.Type().HasAttribute(attr.Name)
+	}
+	return false
+}
+
+// lengthFunc follows Terraform in counting characters for strings, attributes
+// for objects and elements for collections.
+var lengthFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{Name: "value", Type: cty.DynamicPseudoType, AllowDynamicType: true, AllowUnknown: true}},
+	Type:   function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		switch ty := args[0].Type(); {
+		case ty == cty.String:
+			return stdlib.Strlen(args[0])
+		case ty.IsObjectType():
+			return cty.NumberIntVal(int64(len(ty.AttributeTypes()))), nil
+		}
+		return stdlib.Length(args[0])
+	},
+})
+
+// stringPredicateFunc builds a function of two strings returning a bool, such
+// as startswith.
+func stringPredicateFunc(pred func(s, sub string) bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "str", Type: cty.String}, {Name: "substr", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			return cty.BoolVal(pred(args[0].AsString(), args[1].AsString())), nil
+		},
+	})
+}
+
+// stringFunc builds a function of one string argument returning a string.
+func stringFunc(impl func(string) (string, error)) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "str", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			out, err := impl(args[0].AsString())
+			if err != nil {
+				return cty.UnknownVal(cty.String), err
+			}
+			return cty.StringVal(out), nil
+		},
+	})
+}
+
+var base64EncodeFunc = stringFunc(func(s string) (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(s)), nil
+})
+
+// base64DecodeFunc follows Terraform in rejecting input that does not decode to UTF-8.
+var base64DecodeFunc = stringFunc(func(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64 data %q", s)
+	}
+	if !utf8.Valid(b) {
+		return "", fmt.Errorf("the result of decoding the provided string is not valid UTF-8")
+	}
+	return string(b), nil
+})
+
+var base64GzipFunc = stringFunc(func(s string) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		return "", fmt.Errorf("failed to write gzip raw data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to close gzip writer: %w", err)
 	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+})
+
+var urlEncodeFunc = stringFunc(func(s string) (string, error) {
+	return url.QueryEscape(s), nil
+})
+
+// makeHashFunc returns a function producing the hex digest of its argument.
+func makeHashFunc(newHash func() hash.Hash) function.Function {
+	return stringFunc(func(s string) (string, error) {
+		h := newHash()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	})
 }
@@ -0,0 +1,570 @@
+package terraform
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeEvalFixture writes a minimal module declaring the given HCL into a temp dir.
+func writeEvalFixture(t *testing.T, src string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func evalInProcess(t *testing.T, dir, expr string) any {
+	t.Helper()
+	v, ok := TryEvalInProcess(dir, nil, expr, time.Second)
+	if !ok {
+		t.Fatalf("expected %q to evaluate in-process", expr)
+	}
+	return v
+}
+
+func TestTryEvalInProcess_ListAccess(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "list" {
+  default = ["a", "b", "c"]
+}
+`)
+	cases := map[string]any{
+		`var.list[1]`:            "b",
+		`element(var.list, 0)`:   "a",
+		`element(var.list, 4)`:   "b",
+		`slice(var.list, 0, 2)`:  []any{"a", "b"},
+		`element(["x", "y"], 1)`: "y",
+	}
+	for expr, want := range cases {
+		got := evalInProcess(t, dir, expr)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+}
+
+func TestTryEvalInProcess_MapFunctions(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "m" {
+  default = { a = "1", b = "2" }
+}
+variable "over" {
+  default = { b = "3", c = "4" }
+}
+`)
+	cases := map[string]any{
+		`lookup(var.m, "a")`:                  "1",
+		`lookup(var.m, "z", "dflt")`:          "dflt",
+		`lookup({ x = "y" }, "x", "n")`:       "y",
+		`keys(var.m)`:                         []any{"a", "b"},
+		`values(var.m)`:                       []any{"1", "2"},
+		`contains(["a", "b"], "b")`:           true,
+		`contains(keys(var.m), "z")`:          false,
+		`merge(var.m, var.over)`:              map[string]any{"a": "1", "b": "3", "c": "4"},
+		`merge(var.m, var.over, { d = "5" })`: map[string]any{"a": "1", "b": "3", "c": "4", "d": "5"},
+		`zipmap(["k1", "k2"], ["v1", "v2"])`:  map[string]any{"k1": "v1", "k2": "v2"},
+		`setproduct(["a"], ["x", "y"])`:       []any{[]any{"a", "x"}, []any{"a", "y"}},
+	}
+	for expr, want := range cases {
+		got := evalInProcess(t, dir, expr)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+	// Without a default, a missing key is an error and must not resolve in-process
+	if v, ok := TryEvalInProcess(dir, nil, `lookup(var.m, "z")`, time.Second); ok {
+		t.Fatalf("expected missing key without default to fail, got %#v", v)
+	}
+}
+
+func TestTryEvalInProcess_StructuredDecoding(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "blob" {
+  default = "{\"name\": \"web\", \"ports\": [80, 443], \"tls\": true}"
+}
+locals {
+  doc = <<-EOT
+    name: db
+    replicas: 2
+    tags:
+      - a
+      - b
+  EOT
+}
+`)
+	cases := map[string]any{
+		`jsondecode(var.blob)`:                  map[string]any{"name": "web", "ports": []any{float64(80), float64(443)}, "tls": true},
+		`jsondecode(var.blob).ports[1]`:         float64(443),
+		`yamldecode(local.doc)`:                 map[string]any{"name": "db", "replicas": float64(2), "tags": []any{"a", "b"}},
+		`yamlencode({ a = "b" })`:               "\"a\": \"b\"\n",
+		`yamldecode(yamlencode({ k = ["x"] }))`: map[string]any{"k": []any{"x"}},
+	}
+	for expr, want := range cases {
+		got := evalInProcess(t, dir, expr)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+}
+
+func TestTryEvalInProcessWithState_OneAndNullSafeAccess(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "obj" {
+  default = { tags = { team = "net" }, owner = null }
+}
+`)
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := os.WriteFile(statePath, []byte(`{"version":4,"serial":1,"resources":[
+  {"mode":"managed","type":"aws_instance","name":"web","instances":[{"index_key":0,"attributes":{"id":"i-0"}}]}
+]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]any{
+		`one([])`:                              nil,
+		`one(["x"])`:                           "x",
+		`one(toset([]))`:                       nil,
+		`one(aws_instance.web[*].id)`:          "i-0",
+		`try(one(["x", "y"]), "many")`:         "many",
+		`try(aws_instance.web[0].id, null)`:    "i-0",
+		`try(aws_instance.web[1].id, null)`:    nil,
+		`try(var.obj.owner.name, "nobody")`:    "nobody",
+		`try(var.obj.tags.env, "dev")`:         "dev",
+		`lookup(var.obj.tags, "team", null)`:   "net",
+		`lookup(var.obj.tags, "env", null)`:    nil,
+		`lookup(var.obj.tags, "env", "prod")`:  "prod",
+		`coalesce(var.obj.owner, "nobody")`:    "nobody",
+		`var.obj.owner == null ? "none" : "x"`: "none",
+	}
+	for expr, want := range cases {
+		got, ok := TryEvalInProcessWithState(dir, statePath, nil, expr, time.Second)
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v (ok=%v), want %#v", expr, got, ok, want)
+		}
+	}
+	// Errors try() would catch must not resolve to a value on their own
+	for _, expr := range []string{`one(["x", "y"])`, `var.obj.owner.name`, `aws_instance.web[1].id`} {
+		if v, ok := TryEvalInProcessWithState(dir, statePath, nil, expr, time.Second); ok {
+			t.Fatalf("%s: expected an error, got %#v", expr, v)
+		}
+	}
+}
+
+func TestTryEvalInProcessWithState_Splat(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "list" {
+  default = [{ name = "a" }, { name = "b" }]
+}
+`)
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := os.WriteFile(statePath, []byte(`{"version":4,"serial":1,"resources":[
+  {"mode":"managed","type":"aws_instance","name":"web","instances":[
+    {"index_key":1,"attributes":{"id":"i-1"}},
+    {"index_key":0,"attributes":{"id":"i-0"}}]},
+  {"mode":"managed","type":"aws_instance","name":"db","instances":[{"attributes":{"id":"i-db"}}]},
+  {"module":"module.x","mode":"managed","type":"aws_instance","name":"web","instances":[{"attributes":{"id":"i-mod"}}]}
+]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]any{
+		`var.list[*].name`:       []any{"a", "b"},
+		`aws_instance.web[*].id`: []any{"i-0", "i-1"},
+		`aws_instance.db[*].id`:  []any{"i-db"},
+		`aws_instance.web[1].id`: "i-1",
+		`aws_instance.db.id`:     "i-db",
+	}
+	for expr, want := range cases {
+		got, ok := TryEvalInProcessWithState(dir, statePath, nil, expr, time.Second)
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v (ok=%v), want %#v", expr, got, ok, want)
+		}
+	}
+	// A rewrite keeping the size and modification time is still picked up
+	fi, err := os.Stat(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(statePath)
+	if err := os.WriteFile(statePath, bytes.Replace(b, []byte(`"i-db"`), []byte(`"i-dx"`), 1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(statePath, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := TryEvalInProcessWithState(dir, statePath, nil, `aws_instance.db.id`, time.Second); !ok || got != "i-dx" {
+		t.Fatalf("after rewrite: got %#v (ok=%v), want \"i-dx\"", got, ok)
+	}
+}
+
+func TestEvalJSON_BareResourceReference(t *testing.T) {
+	// Without terraform on PATH only the in-process evaluator can resolve
+	t.Setenv("PATH", t.TempDir())
+	dir := writeEvalFixture(t, `
+resource "aws_instance" "web" {
+  count = 2
+}
+resource "aws_instance" "db" {}
+`)
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	// Synthesized instances hold only the attributes that could be computed
+	if err := os.WriteFile(statePath, []byte(`{"version":4,"serial":1,"resources":[
+  {"mode":"managed","type":"aws_instance","name":"db","instances":[{"attributes":{"id":"i-db","tags":{"Name":"db"},"ami":null}}]},
+  {"mode":"managed","type":"aws_instance","name":"web","instances":[
+    {"index_key":0,"attributes":{"id":"i-0"}},
+    {"index_key":1,"attributes":{"id":"i-1"}}]},
+  {"mode":"data","type":"aws_ami","name":"ubuntu","instances":[{"attributes":{"id":"ami-1"}}]}
+]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]any{
+		`aws_instance.db`:     map[string]any{"id": "i-db", "tags": map[string]any{"Name": "db"}, "ami": nil},
+		`aws_instance.web`:    []any{map[string]any{"id": "i-0"}, map[string]any{"id": "i-1"}},
+		`data.aws_ami.ubuntu`: map[string]any{"id": "ami-1"},
+	}
+	for expr, want := range cases {
+		got, err := EvalJSON(dir, statePath, nil, expr, time.Second)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v (err=%v), want %#v", expr, got, err, want)
+		}
+	}
+	if _, err := EvalJSON(dir, statePath, nil, `aws_instance.missing`, time.Second); err == nil {
+		t.Fatal("expected a resource missing from state not to evaluate")
+	}
+}
+
+func TestTryEvalInProcess_TypeConversions(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "port" {
+  default = "8080"
+}
+variable "names" {
+  default = ["b", "a", "b"]
+}
+`)
+	cases := map[string]any{
+		`tonumber(var.port)`:               float64(8080),
+		`tonumber(3)`:                      float64(3),
+		`tobool("true")`:                   true,
+		`tobool(false)`:                    false,
+		`tolist(["a", "b"])`:               []any{"a", "b"},
+		`tomap({ a = "1", b = 2 })`:        map[string]any{"a": "1", "b": "2"},
+		`toset(var.names)`:                 []any{"a", "b"},
+		`try(tonumber("not a number"), 0)`: float64(0),
+		`try(tonumber(var.port), 0)`:       float64(8080),
+		`can(tobool("maybe"))`:             false,
+	}
+	for expr, want := range cases {
+		got := evalInProcess(t, dir, expr)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+	// Invalid conversions are errors and must not resolve in-process
+	for _, expr := range []string{`tonumber("abc")`, `tobool("yes")`, `tomap(["a"])`} {
+		if v, ok := TryEvalInProcess(dir, nil, expr, time.Second); ok {
+			t.Fatalf("%s: expected failure, got %#v", expr, v)
+		}
+	}
+}
+
+func TestTryEvalInProcess_SetFunctions(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "admins" {
+  default = ["carol", "alice"]
+}
+`)
+	cases := map[string]any{
+		`setunion(["a"], ["b"])`:                       []any{"a", "b"},
+		`setunion(["b", "a"], var.admins)`:             []any{"a", "alice", "b", "carol"},
+		`setsubtract(["a", "b"], ["b"])`:               []any{"a"},
+		`setintersection(["a", "b", "c"], ["c", "a"])`: []any{"a", "c"},
+		`setunion([3, 1], [2])`:                        []any{float64(1), float64(2), float64(3)},
+		`length(setproduct(["x", "y"], [1, 2]))`:       float64(4),
+	}
+	for expr, want := range cases {
+		got := evalInProcess(t, dir, expr)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+}
+
+func TestTryEvalInProcess_RegexFunctions(t *testing.T) {
+	dir := writeEvalFixture(t, `locals { a = 1 }`)
+	cases := map[string]any{
+		`replace("ab12", "/[0-9]+/", "#")`:               "ab#",
+		`replace("a.b.c", ".", "-")`:                     "a-b-c",
+		`replace("key=val", "/(\\w+)=(\\w+)/", "$2=$1")`: "val=key",
+		`replace("/", "/", "|")`:                         "|",
+		`regexall("[a-z]+", "a1b2")`:                     []any{"a", "b"},
+		`regex("([a-z]+)([0-9]+)", "ab12")`:              []any{"ab", "12"},
+		`regex("(?P<word>[a-z]+)", "ab12")`:              map[string]any{"word": "ab"},
+	}
+	for expr, want := range cases {
+		got := evalInProcess(t, dir, expr)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+	// No match is an error, leaving the expression to terraform console
+	if v, ok := TryEvalInProcess(dir, nil, `regex("[0-9]+", "abc")`, time.Second); ok {
+		t.Fatalf("regex without a match evaluated to %#v", v)
+	}
+}
+
+func TestTryEvalInProcess_Can(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "defined" {
+  default = "x"
+}
+variable "required" {}
+`)
+	cases := map[string]any{
+		`can(tonumber("x"))`:                       false,
+		`can(tonumber("1"))`:                       true,
+		`can(var.defined)`:                         true,
+		`can(var.defined.attr)`:                    false,
+		`[for s in ["1", "a"] : can(tonumber(s))]`: []any{true, false},
+		`try(var.defined, var.required)`:           "x",
+	}
+	for expr, want := range cases {
+		got := evalInProcess(t, dir, expr)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+	// References the in-process context cannot resolve fall back to the console
+	for _, expr := range []string{`can(var.required)`, `can(local.missing)`, `can(aws_instance.web.id)`, `try(var.required, "x")`, `try(tonumber("x"), local.missing, 0)`} {
+		if v, ok := TryEvalInProcess(dir, nil, expr, time.Second); ok {
+			t.Fatalf("%s: expected fallback, got %#v", expr, v)
+		}
+	}
+}
+
+func TestTryEvalInProcess_EncodingAndHashing(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "user_data" {
+  default = "#!/bin/sh\necho hi\n"
+}
+`)
+	cases := map[string]any{
+		`base64encode("x")`:                         "eA==",
+		`base64decode("eA==")`:                      "x",
+		`base64decode(base64encode(var.user_data))`: "#!/bin/sh\necho hi\n",
+		`md5("x")`:               "9dd4e461268c8034f5c8564e155c67a6",
+		`sha1("x")`:              "11f6ad8ec52a2984abaafd7c3b516503785c2072",
+		`sha256("x")`:            "2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881",
+		`sha512("x")`:            "a4abd4448c49562d828115d13a1fccea927f52b4d5459297f8b43e42da89238bc13626e43dcb38ddb082488927ec904fb42057443983e88585179d50551afe62",
+		`urlencode("a b&c=d/e")`: "a+b%26c%3Dd%2Fe",
+	}
+	for expr, want := range cases {
+		got := evalInProcess(t, dir, expr)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+	// base64gzip output round-trips through gzip
+	got, _ := evalInProcess(t, dir, `base64gzip("hello")`).(string)
+	raw, err := base64.StdEncoding.DecodeString(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != "hello" {
+		t.Fatalf("base64gzip round trip: %q", b)
+	}
+	// uuid() must be answered by terraform, never in-process
+	for _, expr := range []string{`uuid()`, `base64decode("not base64!")`} {
+		if v, ok := TryEvalInProcess(dir, nil, expr, time.Second); ok {
+			t.Fatalf("%s: expected no in-process result, got %#v", expr, v)
+		}
+	}
+}
+
+func TestTryEvalInProcess_DateTime(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "created" {
+  default = "2024-03-05T07:08:09Z"
+}
+`)
+	cases := map[string]any{
+		`timeadd(var.created, "36h")`:                            "2024-03-06T19:08:09Z",
+		`timeadd("2024-01-01T00:00:00Z", "-10m")`:                "2023-12-31T23:50:00Z",
+		`formatdate("YYYY-MM-DD hh:mm", var.created)`:            "2024-03-05 07:08",
+		`formatdate("DD MMM YYYY", timeadd(var.created, "24h"))`: "06 Mar 2024",
+	}
+	for expr, want := range cases {
+		if got := evalInProcess(t, dir, expr); got != want {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+	// timestamp() is the plan time, which only terraform knows
+	for _, expr := range []string{`timestamp()`, `plantimestamp()`, `formatdate("YYYY", timestamp())`} {
+		if v, ok := TryEvalInProcess(dir, nil, expr, time.Second); ok {
+			t.Fatalf("%s: expected no in-process result, got %#v", expr, v)
+		}
+	}
+}
+
+func TestTryEvalInProcess_CIDRFunctions(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "vpc_cidr" {
+  default = "10.0.0.0/16"
+}
+`)
+	cases := map[string]any{
+		`cidrsubnet("10.0.0.0/16", 8, 2)`:                 "10.0.2.0/24",
+		`cidrsubnet(var.vpc_cidr, 4, 15)`:                 "10.0.240.0/20",
+		`cidrsubnet("fd00:fd12:3456:7890::/56", 16, 162)`: "fd00:fd12:3456:7800:a200::/72",
+		`cidrhost("10.0.0.0/24", 5)`:                      "10.0.0.5",
+		`cidrhost("10.0.0.0/24", -1)`:                     "10.0.0.255",
+		`cidrhost("10.12.112.0/20", 268)`:                 "10.12.113.12",
+		`cidrhost("fd00:fd12:3456:7890::/56", 34)`:        "fd00:fd12:3456:7800::22",
+		`cidrnetmask("172.16.0.0/12")`:                    "255.240.0.0",
+		`cidrsubnets("10.1.0.0/16", 4, 4, 8, 4)`:          []any{"10.1.0.0/20", "10.1.16.0/20", "10.1.32.0/24", "10.1.48.0/20"},
+		`try(cidrsubnet("not-a-cidr", 8, 1), "fallback")`: "fallback",
+		`can(cidrhost("10.0.0.0/24", 256))`:               false,
+	}
+	for expr, want := range cases {
+		got := evalInProcess(t, dir, expr)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+	for _, expr := range []string{
+		`cidrsubnet("10.0.0.0/16", 8, 256)`,
+		`cidrsubnet("10.0.0.0/30", 4, 0)`,
+		`cidrhost("10.0.0.0/33", 1)`,
+		`cidrnetmask("fd00::/56")`,
+		`cidrsubnets("10.0.0.0/24", 1, 1, 1)`,
+	} {
+		if v, ok := TryEvalInProcess(dir, nil, expr, time.Second); ok {
+			t.Fatalf("%s: expected an error, got %#v", expr, v)
+		}
+	}
+}
+
+func TestTryEvalInProcess_SensitiveRedacted(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "token" {
+  default   = "t0ken"
+  sensitive = true
+}
+locals {
+  creds = { user = "admin", password = sensitive("hunter2") }
+}
+`)
+	cases := map[string]string{
+		`sensitive("secret")`:                "(sensitive value)",
+		`upper(sensitive("secret"))`:         "(sensitive value)",
+		`"prefix-${sensitive("secret")}"`:    "(sensitive value)",
+		`local.creds`:                        "map[password:(sensitive value) user:admin]",
+		`nonsensitive(sensitive("visible"))`: "visible",
+		`lower(var.token)`:                   "(sensitive value)",
+	}
+	for expr, want := range cases {
+		if got := fmt.Sprint(evalInProcess(t, dir, expr)); got != want {
+			t.Fatalf("%s: got %q, want %q", expr, got, want)
+		}
+	}
+	// State keeps the real value, as Terraform's does
+	if got := sanitizeValue(evalInProcess(t, dir, `sensitive("secret")`)); got != "secret" {
+		t.Fatalf("sanitized sensitive value: got %#v", got)
+	}
+}
+
+func TestTryEvalInProcess_FilteredComprehensions(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "l" {
+  default = [1, 2, 3, 4]
+}
+variable "m" {
+  default = { a = "x", b = "", c = " web-1 " }
+}
+variable "names" {
+  default = ["web-1", "db", "web-22"]
+}
+`)
+	cases := map[string]any{
+		`[for x in var.l : x if x > 2]`:                                            []any{3.0, 4.0},
+		`{for k, v in var.m : k => v if v != ""}`:                                  map[string]any{"a": "x", "c": " web-1 "},
+		`[for n in var.names : upper(n) if startswith(n, "web") && length(n) > 5]`: []any{"WEB-22"},
+		`{for k, v in var.m : k => trimspace(v) if length(trimspace(v)) > 1}`:      map[string]any{"c": "web-1"},
+		`[for i, n in var.names : "${i}:${n}" if contains(["db", "web-22"], n)]`:   []any{"1:db", "2:web-22"},
+		`length({for k, v in var.m : k => v if endswith(v, "1 ") || v == "x"})`:    2.0,
+	}
+	for expr, want := range cases {
+		// Succeeding here means the expression never reaches terraform console
+		got := evalInProcess(t, dir, expr)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+}
+
+func TestTryEvalInProcess_StringFunctions(t *testing.T) {
+	dir := writeEvalFixture(t, `
+locals {
+  name = "  my-app.example.com "
+}
+`)
+	cases := map[string]any{
+		`substr("hello", 1, 3)`:                             "ell",
+		`substr("hello", -3, -1)`:                           "llo",
+		`substr("hello world", -5, 3)`:                      "wor",
+		`trimprefix("abc", "a")`:                            "bc",
+		`trimsuffix("abc", "c")`:                            "ab",
+		`trim("?!hello?!", "!?")`:                           "hello",
+		`title("hello world")`:                              "Hello World",
+		`strrev("héllo")`:                                   "olléh",
+		`startswith("abc", "ab")`:                           true,
+		`endswith("abc", "ab")`:                             false,
+		`trimsuffix(trimspace(local.name), ".example.com")`: "my-app",
+	}
+	for expr, want := range cases {
+		if got := evalInProcess(t, dir, expr); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v, want %#v", expr, got, want)
+		}
+	}
+}
+
+func TestTryEvalInProcess_JSONVarFile(t *testing.T) {
+	dir := writeEvalFixture(t, `
+variable "region" {
+  default = "us-east-1"
+}
+variable "tags" {
+  default = {}
+}
+locals {
+  name = "app-${var.region}"
+}
+`)
+	vf := filepath.Join(dir, "prod.tfvars.json")
+	if err := os.WriteFile(vf, []byte(`{"region": "eu-west-1", "tags": {"team": "${literal}"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]any{
+		`var.region`:    "eu-west-1",
+		`local.name`:    "app-eu-west-1",
+		`var.tags.team`: "${literal}",
+	}
+	for expr, want := range cases {
+		got, ok := TryEvalInProcess(dir, []string{vf}, expr, time.Second)
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v (ok=%v), want %#v", expr, got, ok, want)
+		}
+	}
+}
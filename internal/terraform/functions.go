@@ -10,13 +10,36 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// functionsCacheTTL is how long a cached function list is trusted before it is
+// fetched again.
+const functionsCacheTTL = 30 * 24 * time.Hour
+
+// functionsCache is the on-disk format of functions.json. Older releases wrote
+// a bare array of names, which is still read but always considered stale.
+type functionsCache struct {
+	Version   string    `json:"terraform_version,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Functions []string  `json:"functions"`
+}
+
+var (
+	// fetchFunctionNames is replaced in tests to avoid network access.
+	fetchFunctionNames = fetchTerraformFunctionNames
+	// functionsRefreshes tracks background refreshes so tests can wait for them.
+	functionsRefreshes sync.WaitGroup
+)
+
 // EnsureFunctionsCached guarantees a cached JSON of Terraform functions exists under
 // the given scratchDir (e.g., .terraflow). If missing, it fetches the list from
-// HashiCorp docs and writes it as a JSON array of strings (0600).
-func EnsureFunctionsCached(scratchDir string) error {
+// HashiCorp docs and writes it (0600) before returning. An existing cache that is
+// older than functionsCacheTTL, was written for another Terraform version, or
+// refresh is set is refetched in the background; the new list is picked up on
+// the next start so startup is not delayed.
+func EnsureFunctionsCached(scratchDir string, refresh bool) error {
 	if strings.TrimSpace(scratchDir) == "" {
 		return errors.New("scratchDir is empty")
 	}
@@ -24,18 +47,59 @@ func EnsureFunctionsCached(scratchDir string) error {
 		return err
 	}
 	cachePath := filepath.Join(scratchDir, "functions.json")
+	version := ""
+	if v := installedVersion("terraform").version; v != nil {
+		version = v.String()
+	}
 	if fi, err := os.Stat(cachePath); err == nil && !fi.IsDir() {
+		if refresh || functionsCacheStale(cachePath, version, time.Now()) {
+			functionsRefreshes.Add(1)
+			go func() {
+				defer functionsRefreshes.Done()
+				if err := writeFunctionsCache(cachePath, version); err != nil {
+					currentLogger().Printf("[warn] unable to refresh Terraform functions: %v\n", err)
+				}
+			}()
+		}
 		return nil
 	}
-	names, err := fetchTerraformFunctionNames()
+	return writeFunctionsCache(cachePath, version)
+}
+
+// functionsCacheStale reports whether the cache at cachePath should be
+// refetched. A version of "" means the installed version is unknown and is not
+// compared.
+func functionsCacheStale(cachePath, version string, now time.Time) bool {
+	b, err := os.ReadFile(cachePath)
+	if err != nil {
+		return true
+	}
+	var c functionsCache
+	if json.Unmarshal(b, &c) != nil {
+		return true
+	}
+	if now.Sub(c.FetchedAt) > functionsCacheTTL {
+		return true
+	}
+	return version != "" && c.Version != version
+}
+
+// writeFunctionsCache fetches the function names and replaces the cache file
+// atomically, so a concurrent reader never sees a partial list.
+func writeFunctionsCache(cachePath, version string) error {
+	names, err := fetchFunctionNames()
 	if err != nil {
 		return err
 	}
-	b, err := json.Marshal(names)
+	b, err := json.Marshal(functionsCache{Version: version, FetchedAt: time.Now().UTC(), Functions: names})
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(cachePath, b, 0o600)
+	tmp := cachePath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cachePath)
 }
 
 // LoadTerraformFunctions reads the cached functions list from `.terraflow/functions.json`.
@@ -47,7 +111,10 @@ func LoadTerraformFunctions(scratchDir string) []string {
 		return nil
 	}
 	var names []string
-	if err := json.Unmarshal(b, &names); err != nil {
+	var c functionsCache
+	if err := json.Unmarshal(b, &c); err == nil {
+		names = c.Functions
+	} else if err := json.Unmarshal(b, &names); err != nil {
 		return nil
 	}
 	// normalize, unique, sorted
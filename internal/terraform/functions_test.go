@@ -0,0 +1,88 @@
+package terraform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnsureFunctionsCached_RefreshesStaleCache(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	fetches := 0
+	orig := fetchFunctionNames
+	fetchFunctionNames = func() ([]string, error) {
+		fetches++
+		return []string{"newfunc", "upper"}, nil
+	}
+	defer func() { fetchFunctionNames = orig }()
+
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "functions.json")
+	writeCache := func(c functionsCache) {
+		t.Helper()
+		b, err := json.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cachePath, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeCache(functionsCache{FetchedAt: time.Now().Add(-time.Hour), Functions: []string{"upper"}})
+	if err := EnsureFunctionsCached(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	functionsRefreshes.Wait()
+	if fetches != 0 {
+		t.Fatalf("fresh cache was refetched %d times", fetches)
+	}
+
+	writeCache(functionsCache{FetchedAt: time.Now().Add(-functionsCacheTTL - time.Hour), Functions: []string{"upper"}})
+	if err := EnsureFunctionsCached(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	functionsRefreshes.Wait()
+	if fetches != 1 {
+		t.Fatalf("stale cache: %d fetches, want 1", fetches)
+	}
+	if got := LoadTerraformFunctions(dir); !reflect.DeepEqual(got, []string{"newfunc", "upper"}) {
+		t.Fatalf("functions after refresh = %v", got)
+	}
+
+	// Caches written by older releases carry no timestamp
+	if err := os.WriteFile(cachePath, []byte(`["upper"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := LoadTerraformFunctions(dir); !reflect.DeepEqual(got, []string{"upper"}) {
+		t.Fatalf("legacy cache = %v", got)
+	}
+	if err := EnsureFunctionsCached(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	functionsRefreshes.Wait()
+	if fetches != 2 {
+		t.Fatalf("legacy cache: %d fetches, want 2", fetches)
+	}
+}
+
+func TestFunctionsCacheStale_VersionChange(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "functions.json")
+	now := time.Now()
+	b, _ := json.Marshal(functionsCache{Version: "1.8.5", FetchedAt: now, Functions: []string{"upper"}})
+	if err := os.WriteFile(cachePath, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if functionsCacheStale(cachePath, "1.8.5", now) {
+		t.Fatal("same version reported stale")
+	}
+	if functionsCacheStale(cachePath, "", now) {
+		t.Fatal("unknown installed version reported stale")
+	}
+	if !functionsCacheStale(cachePath, "1.9.0", now) {
+		t.Fatal("upgraded Terraform not reported stale")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 
@@ -14,7 +15,6 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
-	"github.com/hashicorp/terraform-config-inspect/tfconfig"
 )
 
 // SymbolIndex holds discovered Terraform symbols for autocompletion.
@@ -25,43 +25,94 @@ type SymbolIndex struct {
 	Resource   map[string][]string // type -> names
 	DataSource map[string][]string // type -> names
 	Outputs    []string
+	// Outputs of each called module keyed by its address ("module.db",
+	// "module.net.module.subnet"), for completing module.<name>.<output>
+	ModuleOutputs map[string][]string
 	// Collected attribute keys seen in configuration for each resource/data type
 	ResourceAttrs map[string][]string // resource type -> attribute keys (from config)
 	DataAttrs     map[string][]string // data type -> attribute keys (from config)
+	// Attributes and nested blocks of each type as declared by provider schemas
+	ResourceSchemas map[string][]SchemaAttribute
+	DataSchemas     map[string][]SchemaAttribute
 	// Terraform built-in functions (from cached docs). Used only for ghost suggestions.
 	Functions []string
+	// Providers whose schemas contributed attributes (short names such as "aws")
+	SchemaProviders []string
+	// Provider-defined functions (provider::aws::arn_parse); also listed in Functions
+	ProviderFunctions []string
+	// Module addresses ("" for root) defining each symbol, keyed by its reference
+	// ("var.region", "aws_instance.web", "data.aws_ami.ubuntu", "module.db")
+	Origins map[string][]string
+	// Declared type and description of each variable, and description of each
+	// output, shown as completion detail. The root module wins on variable name
+	// clashes; outputs of module calls are keyed by their address
+	// ("module.net.vpc_id") and root outputs by name.
+	VariableInfo       map[string]VariableInfo
+	OutputDescriptions map[string]string
+}
+
+// VariableInfo is what a variable block declares about its value.
+type VariableInfo struct {
+	Type        string // type constraint as written, e.g. "list(string)"
+	Description string
+}
+
+// detail formats v for completion: "(string): AWS region".
+func (v VariableInfo) detail() string {
+	switch {
+	case v.Type != "" && v.Description != "":
+		return "(" + v.Type + "): " + v.Description
+	case v.Type != "":
+		return "(" + v.Type + ")"
+	}
+	return v.Description
 }
 
 // BuildSymbolIndex loads configuration from dir using tfconfig and hcl. It
 // follows local child modules and optionally fetches remote (non-registry)
-// module sources into a cache under .terraflow/modules.
+// module sources into a cache under .terraflow/modules. Until terraform init
+// has installed modules, registry modules are downloaded into
+// .terraflow/registry-modules so their symbols complete; those copies are never
+// used for evaluation.
 func BuildSymbolIndex(dir string) (*SymbolIndex, error) {
 	idx := &SymbolIndex{
-		Resource:      map[string][]string{},
-		DataSource:    map[string][]string{},
-		ResourceAttrs: map[string][]string{},
-		DataAttrs:     map[string][]string{},
+		ModuleOutputs:      map[string][]string{},
+		Resource:           map[string][]string{},
+		DataSource:         map[string][]string{},
+		ResourceAttrs:      map[string][]string{},
+		DataAttrs:          map[string][]string{},
+		Origins:            map[string][]string{},
+		VariableInfo:       map[string]VariableInfo{},
+		OutputDescriptions: map[string]string{},
 	}
 	absRoot, _ := filepath.Abs(dir)
 	cacheDir := filepath.Join(absRoot, ".terraflow", "modules")
-	visited := map[string]struct{}{}
+	guard := newModuleWalkGuard()
+	modDir := filepath.Join(DataDir(absRoot), "modules")
+	var reg *registryFetcher
+	if _, err := os.Stat(filepath.Join(modDir, "modules.json")); err != nil && RegistryFetch() {
+		reg = &registryFetcher{cacheDir: filepath.Join(absRoot, ".terraflow", "registry-modules"), remaining: maxRegistryFetches}
+	}
 
 	var allErr error
-	if err := indexModuleRecursive(context.Background(), absRoot, absRoot, cacheDir, idx, visited); err != nil {
+	if err := indexModuleRecursive(context.Background(), absRoot, absRoot, cacheDir, idx, guard, reg, nil); err != nil {
 		allErr = multierror.Append(allErr, err)
 	}
 
-	// Optionally hydrate from .terraform/modules if present (covers registry modules)
-	modDir := filepath.Join(absRoot, ".terraform", "modules")
+	// Optionally hydrate from the installed modules if present (covers registry modules)
 	if fi, err := os.Stat(modDir); err == nil && fi.IsDir() {
+		// modules.json tells which module call each installed directory belongs to
+		keyByDir := map[string]string{}
+		if dirs, err := resolveModuleDirs(absRoot); err == nil {
+			for k, d := range dirs {
+				keyByDir[canonicalModuleDir(d)] = k
+			}
+		}
 		_ = filepath.Walk(modDir, func(p string, info os.FileInfo, err error) error {
 			if err != nil || !info.IsDir() {
 				return nil
 			}
-			if _, seen := visited[p]; seen {
-				return nil
-			}
-			_ = indexModuleRecursive(context.Background(), p, p, cacheDir, idx, visited)
+			_ = indexModuleRecursive(context.Background(), p, p, cacheDir, idx, guard, nil, splitModuleKey(keyByDir[canonicalModuleDir(p)]))
 			return nil
 		})
 	}
@@ -74,6 +125,11 @@ func BuildSymbolIndex(dir string) (*SymbolIndex, error) {
 	idx.Locals = uniqueSorted(idx.Locals)
 	idx.Modules = uniqueSorted(idx.Modules)
 	idx.Outputs = uniqueSorted(idx.Outputs)
+	for k, v := range idx.ModuleOutputs {
+		idx.ModuleOutputs[k] = uniqueSorted(v)
+	}
+	idx.SchemaProviders = uniqueSorted(idx.SchemaProviders)
+	idx.ProviderFunctions = uniqueSorted(idx.ProviderFunctions)
 	for k, v := range idx.Resource {
 		idx.Resource[k] = uniqueSorted(v)
 	}
@@ -96,19 +152,43 @@ func BuildSymbolIndex(dir string) (*SymbolIndex, error) {
 		// Fallback to dir for backward-compat or tests that place functions.json there
 		idx.Functions = LoadTerraformFunctions(dir)
 	}
+	idx.Functions = append(idx.Functions, idx.ProviderFunctions...)
 
 	// Return partial index and a combined error if present
 	return idx, allErr
 }
 
-func indexModuleRecursive(ctx context.Context, rootDir, moduleDir, cacheDir string, idx *SymbolIndex, visited map[string]struct{}) error {
-	abs, _ := filepath.Abs(moduleDir)
-	if _, ok := visited[abs]; ok {
+// maxRegistryFetches bounds the registry modules downloaded per index build.
+const maxRegistryFetches = 8
+
+// registryFetcher downloads registry modules for completion while none are
+// installed, up to a fixed number per index build.
+type registryFetcher struct {
+	cacheDir  string
+	remaining int
+}
+
+// fetch returns the directory of the registry module source, or "" while it
+// is being downloaded, after a failed download or once the budget is spent.
+func (r *registryFetcher) fetch(source, version string) string {
+	if r == nil || r.remaining <= 0 {
+		return ""
+	}
+	r.remaining--
+	return registryModule(source, version, r.cacheDir)
+}
+
+// indexModuleRecursive adds the symbols of the module at moduleDir, reached
+// through the module calls in modulePath, and of the modules it calls. Registry
+// module calls are followed through reg when it is non-nil.
+func indexModuleRecursive(ctx context.Context, rootDir, moduleDir, cacheDir string, idx *SymbolIndex, guard *moduleWalkGuard, reg *registryFetcher, modulePath []string) error {
+	abs := canonicalModuleDir(moduleDir)
+	if !guard.enter(abs, len(modulePath), modulePath) {
 		return nil
 	}
-	visited[abs] = struct{}{}
+	defer guard.leave(abs)
 
-	mod, diags := tfconfig.LoadModule(abs)
+	mod, diags := loadModule(abs)
 	var resultErr error
 	if diags != nil && diags.HasErrors() {
 		resultErr = multierror.Append(resultErr, fmt.Errorf("%s: %s", abs, diags.Error()))
@@ -117,13 +197,33 @@ func indexModuleRecursive(ctx context.Context, rootDir, moduleDir, cacheDir stri
 		return resultErr
 	}
 
+	origin := modulePathToString(modulePath)
+	addOrigin := func(ref string) {
+		if idx.Origins != nil {
+			idx.Origins[ref] = append(idx.Origins[ref], origin)
+		}
+	}
 	// Variables
-	for name := range mod.Variables {
+	for name, v := range mod.Variables {
 		idx.Variables = append(idx.Variables, name)
+		addOrigin("var." + name)
+		if _, seen := idx.VariableInfo[name]; !seen && v != nil && idx.VariableInfo != nil {
+			idx.VariableInfo[name] = VariableInfo{Type: v.Type, Description: v.Description}
+		}
 	}
 	// Outputs
-	for name := range mod.Outputs {
+	for name, o := range mod.Outputs {
 		idx.Outputs = append(idx.Outputs, name)
+		if origin != "" && idx.ModuleOutputs != nil {
+			idx.ModuleOutputs[origin] = append(idx.ModuleOutputs[origin], name)
+		}
+		key := name
+		if origin != "" {
+			key = origin + "." + name
+		}
+		if _, seen := idx.OutputDescriptions[key]; !seen && o != nil && idx.OutputDescriptions != nil {
+			idx.OutputDescriptions[key] = o.Description
+		}
 	}
 	// Resources
 	for _, r := range mod.ManagedResources {
@@ -131,6 +231,7 @@ func indexModuleRecursive(ctx context.Context, rootDir, moduleDir, cacheDir stri
 			continue
 		}
 		idx.Resource[r.Type] = append(idx.Resource[r.Type], r.Name)
+		addOrigin(r.Type + "." + r.Name)
 	}
 	// Data sources
 	for _, d := range mod.DataResources {
@@ -138,6 +239,7 @@ func indexModuleRecursive(ctx context.Context, rootDir, moduleDir, cacheDir stri
 			continue
 		}
 		idx.DataSource[d.Type] = append(idx.DataSource[d.Type], d.Name)
+		addOrigin("data." + d.Type + "." + d.Name)
 	}
 	// Lightweight attribute keys collection from HCL AST (best-effort):
 	// We scan *.tf files for blocks of form resource "type" "name" { attr = ... }
@@ -150,7 +252,7 @@ func indexModuleRecursive(ctx context.Context, rootDir, moduleDir, cacheDir stri
 		if strings.ToLower(filepath.Ext(p)) != ".tf" {
 			return nil
 		}
-		f, diags := hclparse.NewParser().ParseHCLFile(p)
+		f, diags := parseHCLConfigFile(hclparse.NewParser(), p)
 		if diags != nil && diags.HasErrors() || f == nil {
 			return nil
 		}
@@ -186,12 +288,17 @@ func indexModuleRecursive(ctx context.Context, rootDir, moduleDir, cacheDir stri
 		resultErr = multierror.Append(resultErr, lerr)
 	}
 	idx.Locals = append(idx.Locals, locals...)
+	for _, l := range locals {
+		addOrigin("local." + l)
+	}
 
 	// Modules
 	for name, call := range mod.ModuleCalls {
 		if name != "" {
 			idx.Modules = append(idx.Modules, name)
+			addOrigin("module." + name)
 		}
+		childPath := append(append([]string{}, modulePath...), name)
 		if call == nil || strings.TrimSpace(call.Source) == "" {
 			continue
 		}
@@ -202,16 +309,20 @@ func indexModuleRecursive(ctx context.Context, rootDir, moduleDir, cacheDir stri
 			if !filepath.IsAbs(child) {
 				child = filepath.Join(abs, child)
 			}
-			_ = indexModuleRecursive(ctx, rootDir, child, cacheDir, idx, visited)
+			_ = indexModuleRecursive(ctx, rootDir, child, cacheDir, idx, guard, reg, childPath)
 			continue
 		}
-		// Registry addresses are handled via .terraform/modules hydration
+		// Registry addresses are handled via .terraform/modules hydration once
+		// installed, and fetched for completion before that
 		if isRegistryAddress(src) {
+			if local := reg.fetch(src, call.Version); local != "" {
+				_ = indexModuleRecursive(ctx, rootDir, local, cacheDir, idx, guard, reg, childPath)
+			}
 			continue
 		}
 		// Remote via go-getter
 		if local, err := ResolveOrFetchModuleSource(ctx, src, cacheDir); err == nil && local != "" {
-			_ = indexModuleRecursive(ctx, rootDir, local, cacheDir, idx, visited)
+			_ = indexModuleRecursive(ctx, rootDir, local, cacheDir, idx, guard, reg, childPath)
 		} else if err != nil {
 			resultErr = multierror.Append(resultErr, fmt.Errorf("module %q: %v", name, err))
 		}
@@ -228,7 +339,8 @@ func parseLocals(dir string) ([]string, error) {
 			// skip heavy/internal dirs
 			if info != nil && info.IsDir() {
 				base := filepath.Base(p)
-				if base == ".terraform" || base == ".terraflow" || strings.HasPrefix(base, ".git") || base == "vendor" || base == "node_modules" {
+				rel, _ := filepath.Rel(dir, p)
+				if isDataDir(rel) || base == ".terraflow" || strings.HasPrefix(base, ".git") || base == "vendor" || base == "node_modules" {
 					return filepath.SkipDir
 				}
 			}
@@ -240,7 +352,7 @@ func parseLocals(dir string) ([]string, error) {
 		if strings.ToLower(filepath.Ext(p)) != ".tf" {
 			return nil
 		}
-		f, diags := parser.ParseHCLFile(p)
+		f, diags := parseHCLConfigFile(parser, p)
 		if diags != nil && diags.HasErrors() {
 			allErr = multierror.Append(allErr, fmt.Errorf("%s: %s", p, diags.Error()))
 			return nil
@@ -291,27 +403,26 @@ func uniqueSorted(in []string) []string {
 func augmentAttributesFromProviderSchemas(dir string, idx *SymbolIndex) error {
 	bin := "terraform"
 	cmd := exec.Command(bin, "providers", "schema", "-json")
+	cmd.Env = terraformEnv()
 	if dir != "" {
 		cmd.Dir = dir
 	}
+	done := TraceCommand(cmd)
 	out, err := cmd.Output()
+	done(err)
 	if err != nil || len(out) == 0 {
 		return err
 	}
-	// Minimal struct to parse resources and datasources
+	return applyProviderSchemas(out, idx)
+}
+
+// applyProviderSchemas merges the attribute names found in `terraform providers
+// schema -json` output into idx. The document is decoded one provider and one
+// schema at a time, since its shape varies across Terraform and OpenTofu
+// versions: a malformed entry is skipped instead of discarding every provider.
+func applyProviderSchemas(out []byte, idx *SymbolIndex) error {
 	var doc struct {
-		ProviderSchemas map[string]struct {
-			ResourceSchemas map[string]struct {
-				Block struct {
-					Attributes map[string]any `json:"attributes"`
-				} `json:"block"`
-			} `json:"resource_schemas"`
-			DataSourceSchemas map[string]struct {
-				Block struct {
-					Attributes map[string]any `json:"attributes"`
-				} `json:"block"`
-			} `json:"data_source_schemas"`
-		} `json:"provider_schemas"`
+		ProviderSchemas map[string]json.RawMessage `json:"provider_schemas"`
 	}
 	if err := json.Unmarshal(out, &doc); err != nil {
 		return err
@@ -319,38 +430,174 @@ func augmentAttributesFromProviderSchemas(dir string, idx *SymbolIndex) error {
 	// The keys for resources are provider-qualified like "azurerm_resource_group" in TF 1.6+ (depends).
 	// We'll merge by suffix matching against types we already know.
 	// Fill maps of type->attrs from provider schemas.
-	for _, prov := range doc.ProviderSchemas {
-		for rType, rSchema := range prov.ResourceSchemas {
-			// prefer exact key; otherwise allow suffix after last '.'
-			t := rType
-			if i := strings.LastIndex(t, "."); i >= 0 {
-				t = t[i+1:]
-			}
-			if len(rSchema.Block.Attributes) > 0 {
-				for k := range rSchema.Block.Attributes {
-					idx.ResourceAttrs[t] = append(idx.ResourceAttrs[t], k)
-				}
-			}
+	for provName, raw := range doc.ProviderSchemas {
+		var prov struct {
+			ResourceSchemas   map[string]json.RawMessage `json:"resource_schemas"`
+			DataSourceSchemas map[string]json.RawMessage `json:"data_source_schemas"`
+			Functions         map[string]json.RawMessage `json:"functions"`
 		}
-		for dType, dSchema := range prov.DataSourceSchemas {
-			t := dType
-			if i := strings.LastIndex(t, "."); i >= 0 {
-				t = t[i+1:]
-			}
-			if len(dSchema.Block.Attributes) > 0 {
-				for k := range dSchema.Block.Attributes {
-					idx.DataAttrs[t] = append(idx.DataAttrs[t], k)
-				}
-			}
+		if err := json.Unmarshal(raw, &prov); err != nil {
+			debugf("skipping provider schema %s: %v", provName, err)
+			continue
+		}
+		if idx.ResourceSchemas == nil {
+			idx.ResourceSchemas = map[string][]SchemaAttribute{}
+		}
+		if idx.DataSchemas == nil {
+			idx.DataSchemas = map[string][]SchemaAttribute{}
+		}
+		mergeSchemaAttributes(provName, prov.ResourceSchemas, idx.ResourceAttrs, idx.ResourceSchemas)
+		mergeSchemaAttributes(provName, prov.DataSourceSchemas, idx.DataAttrs, idx.DataSchemas)
+		short := provName[strings.LastIndex(provName, "/")+1:]
+		idx.SchemaProviders = append(idx.SchemaProviders, short)
+		// Terraform 1.8+/OpenTofu 1.7+ report provider-defined functions
+		for fn := range prov.Functions {
+			idx.ProviderFunctions = append(idx.ProviderFunctions, "provider::"+short+"::"+fn)
 		}
 	}
+	rememberComputedAttributes(idx)
 	return nil
 }
 
+// mergeSchemaAttributes appends the top-level attribute names of each schema to
+// attrs and their full descriptions to rich, keyed by the unqualified type
+// name. Malformed schemas are skipped.
+func mergeSchemaAttributes(provName string, schemas map[string]json.RawMessage, attrs map[string][]string, rich map[string][]SchemaAttribute) {
+	for typ, raw := range schemas {
+		var schema struct {
+			Block schemaBlock `json:"block"`
+		}
+		if err := json.Unmarshal(raw, &schema); err != nil {
+			debugf("skipping schema %s in provider %s: %v", typ, provName, err)
+			continue
+		}
+		// prefer exact key; otherwise allow suffix after last '.'
+		t := typ
+		if i := strings.LastIndex(t, "."); i >= 0 {
+			t = t[i+1:]
+		}
+		for k := range schema.Block.Attributes {
+			attrs[t] = append(attrs[t], k)
+		}
+		rich[t] = schema.Block.attributes()
+	}
+}
+
+// Summary describes what the index discovered in two short lines, e.g.
+// "indexed 12 resources, 2 data sources, 3 modules; schema: loaded (aws, random)".
+func (idx *SymbolIndex) Summary() string {
+	countNames := func(m map[string][]string) int {
+		n := 0
+		for _, names := range m {
+			n += len(names)
+		}
+		return n
+	}
+	schema := "not loaded"
+	if len(idx.SchemaProviders) > 0 {
+		schema = "loaded (" + strings.Join(idx.SchemaProviders, ", ") + ")"
+	}
+	return fmt.Sprintf("indexed %s, %s, %s; schema: %s\n%s, %s, %s",
+		plural(countNames(idx.Resource), "resource"),
+		plural(countNames(idx.DataSource), "data source"),
+		plural(len(idx.Modules), "module"),
+		schema,
+		plural(len(idx.Variables), "variable"),
+		plural(len(idx.Locals), "local"),
+		plural(len(idx.Outputs), "output"),
+	)
+}
+
+// plural formats n with noun, adding an "s" unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// CandidateKind classifies a completion candidate.
+type CandidateKind int
+
+const (
+	KindKeyword CandidateKind = iota // category starters such as "var."
+	KindVariable
+	KindLocal
+	KindModule
+	KindResourceType
+	KindResource
+	KindDataSourceType
+	KindDataSource
+	KindAttribute
+	KindFunction
+	KindOutput
+	KindValue // a literal value for a compared attribute, such as true
+)
+
+func (k CandidateKind) String() string {
+	switch k {
+	case KindKeyword:
+		return "keyword"
+	case KindVariable:
+		return "variable"
+	case KindLocal:
+		return "local"
+	case KindModule:
+		return "module"
+	case KindResourceType:
+		return "resource_type"
+	case KindResource:
+		return "resource"
+	case KindDataSourceType:
+		return "data_source_type"
+	case KindDataSource:
+		return "data_source"
+	case KindAttribute:
+		return "attribute"
+	case KindFunction:
+		return "function"
+	case KindOutput:
+		return "output"
+	case KindValue:
+		return "value"
+	}
+	return "unknown"
+}
+
+// Candidate is a completion suggestion with metadata for editor integrations.
+// Detail carries context such as the resource type an attribute belongs to.
+type Candidate struct {
+	Text   string
+	Kind   CandidateKind
+	Detail string
+}
+
 // CompletionCandidates generates suggestions for a given tokenized context.
 // cursorIndex is byte index in line. Returns suggestions and the range [start,end)
-// (byte offsets) of the token to replace.
+// (byte offsets) of the token to replace. Function names are not included; the
+// REPL offers those separately as ghost suggestions.
 func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candidates []string, start int, end int) {
+	detailed, start, end := s.CompletionCandidatesDetailed(line, cursorIndex)
+	for _, c := range detailed {
+		if c.Kind == KindFunction {
+			continue
+		}
+		candidates = append(candidates, c.Text)
+	}
+	return candidates, start, end
+}
+
+// maxCompletionTokenLen bounds the token completion looks at around the
+// cursor. No symbol is this long, so a longer run of token characters, such as
+// a base64 string, gets no candidates without being scanned in full.
+const maxCompletionTokenLen = 256
+
+// CompletionCandidatesDetailed is like CompletionCandidates but reports the kind
+// of each candidate and also proposes matching function names for bare tokens.
+func (s *SymbolIndex) CompletionCandidatesDetailed(line string, cursorIndex int) (candidates []Candidate, start int, end int) {
+	add := func(text string, kind CandidateKind, detail string) {
+		candidates = append(candidates, Candidate{Text: text, Kind: kind, Detail: detail})
+	}
 	if cursorIndex < 0 || cursorIndex > len(line) {
 		cursorIndex = len(line)
 	}
@@ -361,15 +608,23 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 		}
 		return r == ':' || r == '/' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
 	}
-	// Walk backward to token start
+	// Walk backward to token start, giving up on tokens longer than any symbol
 	start = cursorIndex
 	for start > 0 {
+		if cursorIndex-start > maxCompletionTokenLen {
+			return nil, cursorIndex, cursorIndex
+		}
 		r, size := rune(line[start-1]), 1
 		if (start-1) >= 0 && (start-1) < len(line) {
 			r = rune(line[start-1])
 			size = 1
 		}
 		if !isTokChar(r) {
+			// Splat segments ([*]) are part of the reference path
+			if start >= 3 && line[start-3:start] == "[*]" {
+				start -= 3
+				continue
+			}
 			break
 		}
 		start -= size
@@ -382,9 +637,23 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 			break
 		}
 		end++
+		if end-start > maxCompletionTokenLen {
+			return nil, cursorIndex, cursorIndex
+		}
+	}
+	// Inside a string template only ${ ... } and %{ ... } hold expressions
+	exprStart, inLiteral := templateContext(line, cursorIndex)
+	if inLiteral {
+		return nil, cursorIndex, cursorIndex
+	}
+	if start < exprStart {
+		start = exprStart
 	}
 	token := strings.TrimSpace(line[start:end])
 	lower := strings.ToLower(token)
+	if values := s.valueCandidates(line[:start], token); len(values) > 0 {
+		return values, start, end
+	}
 
 	// Friendly handling: allow bare keywords without trailing dot to behave like prefix with dot
 	switch lower {
@@ -396,6 +665,8 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 		token, lower = "module.", "module."
 	case "data":
 		token, lower = "data.", "data."
+	case ConfigNamespace:
+		token, lower = ConfigNamespace+".", ConfigNamespace+"."
 	}
 
 	// Patterns: var., local., module., data., <type>., data.<type>., type.name.
@@ -404,22 +675,57 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 		prefix := token[len("var."):]
 		for _, v := range s.Variables {
 			if strings.HasPrefix(v, prefix) {
-				candidates = append(candidates, "var."+v)
+				add("var."+v, KindVariable, s.VariableInfo[v].detail())
 			}
 		}
 	case strings.HasPrefix(lower, "local."):
 		prefix := token[len("local."):]
 		for _, v := range s.Locals {
 			if strings.HasPrefix(v, prefix) {
-				candidates = append(candidates, "local."+v)
+				add("local."+v, KindLocal, "")
 			}
 		}
 	case strings.HasPrefix(lower, "module."):
-		prefix := token[len("module."):]
-		for _, v := range s.Modules {
-			if strings.HasPrefix(v, prefix) {
-				candidates = append(candidates, "module."+v)
+		rest := token[len("module."):]
+		if i := strings.Index(rest, "."); i == -1 {
+			for _, v := range s.Modules {
+				if strings.HasPrefix(v, rest) {
+					add("module."+v, KindModule, "")
+				}
+			}
+		} else {
+			// module.<name>.<output-prefix>, for calls of the root module
+			name, outPrefix := rest[:i], rest[i+1:]
+			addr := "module." + name
+			for _, o := range s.ModuleOutputs[addr] {
+				if strings.HasPrefix(o, outPrefix) {
+					add("module."+name+"."+o, KindOutput, s.OutputDescriptions[addr+"."+o])
+				}
+			}
+		}
+	case strings.HasPrefix(lower, ConfigNamespace+"."):
+		// config.<type>.<name>.<attr> completes like the reference without it,
+		// limited to resources of the root module
+		rest := token[len(ConfigNamespace+"."):]
+		if strings.HasPrefix(rest, ConfigNamespace) {
+			break
+		}
+		sub, _, _ := s.CompletionCandidatesDetailed(rest, len(rest))
+		for _, c := range sub {
+			switch c.Kind {
+			case KindResource, KindDataSource:
+				if origins := s.Origins[c.Text]; len(origins) > 0 && !slices.Contains(origins, "") {
+					continue
+				}
+			case KindResourceType, KindDataSourceType, KindAttribute:
+			case KindKeyword:
+				if c.Text != "data." {
+					continue
+				}
+			default:
+				continue
 			}
+			add(ConfigNamespace+"."+c.Text, c.Kind, c.Detail)
 		}
 	case strings.HasPrefix(lower, "data."):
 		rest := token[len("data."):]
@@ -428,7 +734,7 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 			// Complete data types
 			for dType := range s.DataSource {
 				if strings.HasPrefix(dType, rest) {
-					candidates = append(candidates, "data."+dType)
+					add("data."+dType, KindDataSourceType, "")
 				}
 			}
 		} else {
@@ -437,7 +743,7 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 			if names, ok := s.DataSource[dType]; ok {
 				for _, n := range names {
 					if strings.HasPrefix(n, namePrefix) {
-						candidates = append(candidates, "data."+dType+"."+n)
+						add("data."+dType+"."+n, KindDataSource, dType)
 					}
 				}
 			}
@@ -448,7 +754,7 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 			// Completing a top-level symbol: resource type OR category keywords (var/local/module/data/output)
 			for rType := range s.Resource {
 				if strings.HasPrefix(rType, token) {
-					candidates = append(candidates, rType)
+					add(rType, KindResourceType, "")
 				}
 			}
 			// Also propose category starters that actually exist in the index and match the current prefix (case-insensitive)
@@ -466,9 +772,19 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 			if len(s.DataSource) > 0 {
 				starters = append(starters, "data.")
 			}
+			if len(s.Resource) > 0 || len(s.DataSource) > 0 {
+				starters = append(starters, ConfigNamespace+".")
+			}
 			for _, kw := range starters {
 				if strings.HasPrefix(kw, kwPrefix) {
-					candidates = append(candidates, kw)
+					add(kw, KindKeyword, "")
+				}
+			}
+			if token != "" {
+				for _, fn := range s.Functions {
+					if strings.HasPrefix(fn, token) {
+						add(fn, KindFunction, "")
+					}
 				}
 			}
 		} else {
@@ -481,7 +797,7 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 				if names, ok := s.Resource[rType]; ok {
 					for _, n := range names {
 						if strings.HasPrefix(n, namePrefix) {
-							candidates = append(candidates, rType+"."+n)
+							add(rType+"."+n, KindResource, rType)
 						}
 					}
 				}
@@ -492,7 +808,7 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 				if attrs, ok := s.ResourceAttrs[rType]; ok {
 					for _, a := range attrs {
 						if strings.HasPrefix(a, attrPrefix) {
-							candidates = append(candidates, rType+"."+parts[1]+"."+a)
+							add(rType+"."+parts[1]+"."+a, KindAttribute, rType)
 						}
 					}
 				}
@@ -500,6 +816,85 @@ func (s *SymbolIndex) CompletionCandidates(line string, cursorIndex int) (candid
 		}
 	}
 
-	sort.Strings(candidates)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ri, rj := s.originRank(candidates[i].Text), s.originRank(candidates[j].Text)
+		if ri != rj {
+			return ri < rj
+		}
+		return candidates[i].Text < candidates[j].Text
+	})
 	return candidates, start, end
 }
+
+// templateContext reports where the expression around cursor starts: after
+// the innermost unclosed "${" or "%{" of a quoted template, or 0 outside any
+// string. inLiteral is true when cursor is in the literal text of a quoted
+// string, where nothing can be completed. Escaped quotes and the $${ and %%{
+// escapes are literal text.
+func templateContext(line string, cursor int) (exprStart int, inLiteral bool) {
+	type frame struct {
+		quote bool
+		start int // first byte of an interpolation's expression
+		depth int // braces opened inside the interpolation
+	}
+	var stack []frame
+	for i := 0; i < cursor && i < len(line); i++ {
+		c := line[i]
+		if n := len(stack); n > 0 && stack[n-1].quote {
+			switch {
+			case c == '\\':
+				i++
+			case c == '"':
+				stack = stack[:n-1]
+			case (c == '$' || c == '%') && i+2 < len(line) && line[i+1] == c && line[i+2] == '{':
+				i += 2
+			case (c == '$' || c == '%') && i+1 < len(line) && line[i+1] == '{':
+				stack = append(stack, frame{start: i + 2})
+				i++
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			stack = append(stack, frame{quote: true})
+		case '{':
+			if n := len(stack); n > 0 {
+				stack[n-1].depth++
+			}
+		case '}':
+			if n := len(stack); n > 0 {
+				if stack[n-1].depth == 0 {
+					stack = stack[:n-1]
+				} else {
+					stack[n-1].depth--
+				}
+			}
+		}
+	}
+	if len(stack) == 0 {
+		return 0, false
+	}
+	top := stack[len(stack)-1]
+	if top.quote {
+		return 0, true
+	}
+	return min(top.start, cursor), false
+}
+
+// originRank orders a completion candidate by where its symbol is defined:
+// symbols of the root module, where the console evaluates, come first, then
+// those of shallower modules. Candidates without recorded origins (keywords,
+// functions, attributes) rank with the root module's symbols.
+func (s *SymbolIndex) originRank(ref string) int {
+	origins := s.Origins[ref]
+	if len(origins) == 0 {
+		return 0
+	}
+	best := -1
+	for _, o := range origins {
+		if depth := strings.Count(o, "module."); best < 0 || depth < best {
+			best = depth
+		}
+	}
+	return best
+}
@@ -2,7 +2,9 @@ package terraform
 
 import (
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -29,6 +31,29 @@ func TestBuildSymbolIndex_FixturesBasic(t *testing.T) {
 	}
 }
 
+func TestBuildSymbolIndex_CompletionDetail(t *testing.T) {
+	dir := filepath.Join(repoRoot(t), "test", "fixtures", "completion_detail")
+	idx, err := BuildSymbolIndex(dir)
+	if err != nil {
+		t.Fatalf("BuildSymbolIndex error: %v", err)
+	}
+	if got, want := idx.VariableInfo["region"], (VariableInfo{Type: "string", Description: "Region to deploy into"}); got != want {
+		t.Fatalf("variable info = %#v, want %#v", got, want)
+	}
+	if got := idx.OutputDescriptions["region_upper"]; got != "region in upper case" {
+		t.Fatalf("output description = %q", got)
+	}
+	cands, _, _ := idx.CompletionCandidatesDetailed("var.reg", len("var.reg"))
+	if len(cands) != 1 || cands[0].Detail != "(string): Region to deploy into" {
+		t.Fatalf("variable completion detail: %#v", cands)
+	}
+	line := "module.net.vp"
+	cands, _, _ = idx.CompletionCandidatesDetailed(line, len(line))
+	if len(cands) != 1 || cands[0].Text != "module.net.vpc_id" || cands[0].Detail != "ID of the VPC" {
+		t.Fatalf("module output completion detail: %#v", cands)
+	}
+}
+
 func TestCompletionCandidates_Variables(t *testing.T) {
 	idx := &SymbolIndex{Variables: []string{"some_var", "other"}}
 	line := "var.so"
@@ -91,3 +116,251 @@ func TestCompletionCandidates_CategoryStarters_NonEmptyIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestCompletionCandidatesDetailed_Kinds(t *testing.T) {
+	idx := &SymbolIndex{
+		Variables:     []string{"region"},
+		Resource:      map[string][]string{"aws_instance": {"web"}},
+		ResourceAttrs: map[string][]string{"aws_instance": {"ami"}},
+		DataSource:    map[string][]string{},
+		Functions:     []string{"abs", "upper"},
+	}
+	cases := []struct {
+		line   string
+		text   string
+		kind   CandidateKind
+		detail string
+	}{
+		{"var.re", "var.region", KindVariable, ""},
+		{"aws_i", "aws_instance", KindResourceType, ""},
+		{"aws_instance.w", "aws_instance.web", KindResource, "aws_instance"},
+		{"aws_instance.web.a", "aws_instance.web.ami", KindAttribute, "aws_instance"},
+		{"upp", "upper", KindFunction, ""},
+	}
+	for _, tc := range cases {
+		cands, _, _ := idx.CompletionCandidatesDetailed(tc.line, len(tc.line))
+		found := false
+		for _, c := range cands {
+			if c.Text == tc.text {
+				found = true
+				if c.Kind != tc.kind || c.Detail != tc.detail {
+					t.Fatalf("%q: got kind=%s detail=%q, want kind=%s detail=%q", tc.line, c.Kind, c.Detail, tc.kind, tc.detail)
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("%q: candidate %q not found in %#v", tc.line, tc.text, cands)
+		}
+	}
+	// The plain string API keeps omitting functions
+	if cands, _, _ := idx.CompletionCandidates("upp", 3); len(cands) != 0 {
+		t.Fatalf("expected no function names from CompletionCandidates, got %#v", cands)
+	}
+}
+
+func TestCompletionCandidates_SplatAttributes(t *testing.T) {
+	idx := &SymbolIndex{
+		Resource:      map[string][]string{"aws_instance": {"web"}},
+		ResourceAttrs: map[string][]string{"aws_instance": {"ami", "id"}},
+	}
+	line := "length(aws_instance.web[*]."
+	cands, start, end := idx.CompletionCandidates(line, len(line))
+	if start != len("length(") || end != len(line) {
+		t.Fatalf("unexpected range: %d..%d", start, end)
+	}
+	want := []string{"aws_instance.web[*].ami", "aws_instance.web[*].id"}
+	if len(cands) != len(want) || cands[0] != want[0] || cands[1] != want[1] {
+		t.Fatalf("got %#v, want %#v", cands, want)
+	}
+}
+
+func TestCompletionCandidates_StringInterpolation(t *testing.T) {
+	idx := &SymbolIndex{Variables: []string{"region"}, Locals: []string{"name"}}
+	cases := []struct {
+		line  string
+		want  string
+		start int
+	}{
+		{`"x-${var.`, "var.region", len(`"x-${`)},
+		{`"x-${local.`, "local.name", len(`"x-${`)},
+		{`"x-${ var.re`, "var.region", len(`"x-${ `)},
+		{`"${lookup(var.m, "k")}-${local.`, "local.name", len(`"${lookup(var.m, "k")}-${`)},
+		{`"%{ if var.`, "var.region", len(`"%{ if `)},
+	}
+	for _, tc := range cases {
+		cands, start, end := idx.CompletionCandidates(tc.line, len(tc.line))
+		if len(cands) != 1 || cands[0] != tc.want || start != tc.start || end != len(tc.line) {
+			t.Errorf("%s: got %#v at %d..%d, want %q at %d", tc.line, cands, start, end, tc.want, tc.start)
+		}
+	}
+	// Literal text of a string is not an expression
+	for _, line := range []string{`"var.`, `"x-${var.region}-local.`, `"$${var.`} {
+		if cands, _, _ := idx.CompletionCandidates(line, len(line)); len(cands) != 0 {
+			t.Errorf("%s: expected no candidates, got %#v", line, cands)
+		}
+	}
+}
+
+func TestApplyProviderSchemas_SkipsMalformedProviders(t *testing.T) {
+	doc := `{
+  "format_version": "1.0",
+  "provider_schemas": {
+    "registry.terraform.io/hashicorp/aws": {
+      "resource_schemas": {
+        "aws_instance": {"block": {"attributes": {"ami": {"type": "string"}, "instance_type": {"type": "string"}}}}
+      },
+      "data_source_schemas": {
+        "aws_ami": {"block": {"attributes": {"owners": {"type": ["list", "string"]}}}}
+      }
+    },
+    "registry.terraform.io/example/broken": "unexpected",
+    "registry.terraform.io/hashicorp/random": {
+      "resource_schemas": {
+        "random_id": {"block": ["not", "an", "object"]},
+        "random_pet": {"block": {"attributes": {"length": {"type": "number"}}}}
+      }
+    }
+  }
+}`
+	idx := &SymbolIndex{ResourceAttrs: map[string][]string{}, DataAttrs: map[string][]string{}}
+	if err := applyProviderSchemas([]byte(doc), idx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string][]string{
+		"aws_instance": {"ami", "instance_type"},
+		"random_pet":   {"length"},
+	}
+	for typ, attrs := range want {
+		if got := uniqueSorted(idx.ResourceAttrs[typ]); !reflect.DeepEqual(got, attrs) {
+			t.Fatalf("%s: got %v, want %v", typ, got, attrs)
+		}
+	}
+	if _, ok := idx.ResourceAttrs["random_id"]; ok {
+		t.Fatalf("malformed schema should be skipped, got %v", idx.ResourceAttrs["random_id"])
+	}
+	if got := idx.DataAttrs["aws_ami"]; !reflect.DeepEqual(got, []string{"owners"}) {
+		t.Fatalf("aws_ami: got %v", got)
+	}
+}
+
+func TestSymbolIndexSummary_FixtureCounts(t *testing.T) {
+	dir := filepath.Join(repoRoot(t), "test", "fixtures", "basic_console_refresh")
+	idx, err := BuildSymbolIndex(dir)
+	if err != nil {
+		t.Fatalf("BuildSymbolIndex error: %v", err)
+	}
+	// Provider schemas need terraform and an initialized directory; pin the
+	// outcome so the expected text does not depend on the environment.
+	idx.SchemaProviders = nil
+	want := "indexed 2 resources, 0 data sources, 0 modules; schema: not loaded\n1 variable, 1 local, 1 output"
+	if got := idx.Summary(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	idx.SchemaProviders = []string{"null", "time"}
+	if got := idx.Summary(); !strings.Contains(got, "schema: loaded (null, time)") {
+		t.Fatalf("expected loaded schema providers, got %q", got)
+	}
+}
+
+func TestProviderFunctions_FromSchemaAndCompletion(t *testing.T) {
+	doc := `{"provider_schemas": {"registry.terraform.io/hashicorp/aws": {
+  "resource_schemas": {},
+  "functions": {"arn_parse": {"return_type": "dynamic"}, "arn_build": {"return_type": "string"}}
+}}}`
+	idx := &SymbolIndex{ResourceAttrs: map[string][]string{}, DataAttrs: map[string][]string{}}
+	if err := applyProviderSchemas([]byte(doc), idx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"provider::aws::arn_build", "provider::aws::arn_parse"}
+	if got := uniqueSorted(idx.ProviderFunctions); !reflect.DeepEqual(got, want) {
+		t.Fatalf("provider functions: got %v, want %v", got, want)
+	}
+	idx.Functions = append([]string{"abs"}, idx.ProviderFunctions...)
+	line := "provider::aws::arn_p"
+	cands, _, _ := idx.CompletionCandidatesDetailed(line, len(line))
+	if len(cands) != 1 || cands[0].Text != "provider::aws::arn_parse" || cands[0].Kind != KindFunction {
+		t.Fatalf("unexpected candidates %+v", cands)
+	}
+}
+
+func TestCompletionCandidates_RankByModuleOrigin(t *testing.T) {
+	root := writeModuleTree(t, map[string]string{
+		"main.tf":     "variable \"reg_z\" {}\nmodule \"a\" {\n  source = \"./a\"\n}\n",
+		"a/main.tf":   "module \"b\" {\n  source = \"./b\"\n}\n",
+		"a/b/main.tf": "variable \"reg_a\" {}\n",
+	})
+	idx, err := BuildSymbolIndex(root)
+	if err != nil {
+		t.Fatalf("BuildSymbolIndex error: %v", err)
+	}
+	line := "var.reg"
+	got, _, _ := idx.CompletionCandidates(line, len(line))
+	want := []string{"var.reg_z", "var.reg_a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestCompletionCandidates_BareResourceReference(t *testing.T) {
+	idx := &SymbolIndex{Resource: map[string][]string{"aws_instance": {"web", "web_backup"}}}
+	line := "aws_instance.web"
+	cands, _, _ := idx.CompletionCandidates(line, len(line))
+	if len(cands) == 0 || cands[0] != "aws_instance.web" {
+		t.Fatalf("expected the bare reference first, got %#v", cands)
+	}
+}
+
+func TestCompletionCandidates_OverlongTokenIsNoOp(t *testing.T) {
+	long := strings.Repeat("x", maxCompletionTokenLen-len("var."))
+	idx := &SymbolIndex{Variables: []string{long}}
+	// A pasted base64 blob is one token character run with no symbol in it
+	line := "var." + strings.Repeat("QUJD", 1<<18)
+	for _, cursor := range []int{len(line), len(line) / 2} {
+		cands, start, end := idx.CompletionCandidates(line, cursor)
+		if cands != nil || start != cursor || end != cursor {
+			t.Fatalf("cursor %d: got %d candidates in [%d,%d), want none at the cursor", cursor, len(cands), start, end)
+		}
+	}
+	// A token of exactly the cap still completes
+	line = "var." + long
+	if cands, _, _ := idx.CompletionCandidates(line, len(line)); !reflect.DeepEqual(cands, []string{line}) {
+		t.Fatalf("token at the cap: got %d candidates, want 1", len(cands))
+	}
+}
+
+func TestCompletionCandidates_ComparedAttributeValues(t *testing.T) {
+	idx := &SymbolIndex{
+		Resource:      map[string][]string{"aws_instance": {"web"}},
+		ResourceAttrs: map[string][]string{"aws_instance": {"monitoring", "tenancy"}},
+		ResourceSchemas: map[string][]SchemaAttribute{"aws_instance": {
+			{Name: "monitoring", Type: "bool", Optional: true},
+			{Name: "tenancy", Type: "string", Optional: true, Description: "Tenancy of the instance. Valid values are `default`, `dedicated` and `host`."},
+		}},
+		DataSchemas: map[string][]SchemaAttribute{"aws_ami": {{Name: "most_recent", Type: "bool"}}},
+		Variables:   []string{"region"},
+	}
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{"aws_instance.web.monitoring == ", []string{"true", "false"}},
+		{"aws_instance.web[0].monitoring != f", []string{"false"}},
+		{"data.aws_ami.ubuntu.most_recent == ", []string{"true", "false"}},
+		{"aws_instance.web.tenancy == ", []string{`"default"`, `"dedicated"`, `"host"`}},
+		// Other references still complete in a value position
+		{"aws_instance.web.monitoring == var.r", []string{"var.region"}},
+	}
+	for _, tc := range cases {
+		cands, start, _ := idx.CompletionCandidatesDetailed(tc.line, len(tc.line))
+		var got []string
+		for _, c := range cands {
+			got = append(got, c.Text)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.line, got, tc.want)
+		}
+		if len(cands) > 0 && cands[0].Kind == KindValue && start != strings.LastIndex(tc.line, " ")+1 {
+			t.Errorf("%q: replacement starts at %d", tc.line, start)
+		}
+	}
+}
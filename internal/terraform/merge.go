@@ -0,0 +1,126 @@
+package terraform
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/flowave-io/terraflow/internal/encoding/jsonx"
+)
+
+// MergeStateSource is an additional state file whose resources are unioned into
+// the synthesized state, optionally nested under a module address.
+type MergeStateSource struct {
+	Module string
+	Path   string
+}
+
+// ParseMergeState parses -merge-state values of the form "path" or
+// "module.name=path". The module prefix is prepended to the module address of
+// every resource in that state.
+func ParseMergeState(specs []string) ([]MergeStateSource, error) {
+	out := make([]MergeStateSource, 0, len(specs))
+	for _, spec := range specs {
+		src := MergeStateSource{Path: strings.TrimSpace(spec)}
+		if prefix, path, ok := strings.Cut(spec, "="); ok && strings.HasPrefix(prefix, "module.") {
+			parts := strings.Split(prefix, ".")
+			if len(parts)%2 != 0 {
+				return nil, fmt.Errorf("invalid -merge-state module prefix %q", prefix)
+			}
+			for i := 0; i < len(parts); i += 2 {
+				if parts[i] != "module" || parts[i+1] == "" {
+					return nil, fmt.Errorf("invalid -merge-state module prefix %q", prefix)
+				}
+			}
+			src = MergeStateSource{Module: prefix, Path: strings.TrimSpace(path)}
+		}
+		if src.Path == "" {
+			return nil, fmt.Errorf("invalid -merge-state %q: missing path", spec)
+		}
+		out = append(out, src)
+	}
+	return out, nil
+}
+
+// MergeStates unions the resources of each source into the state at statePath.
+// Resources are deduplicated by address; when an address is present more than
+// once, the later source wins and a warning is logged.
+func MergeStates(statePath string, sources []MergeStateSource) error {
+	if strings.TrimSpace(statePath) == "" {
+		return errors.New("state path is empty")
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	unlock := lockState(statePath)
+	defer unlock()
+	st, b, _, err := readStateCached(statePath)
+	if err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+	resources, _ := st["resources"].([]any)
+	// origin of each address, for conflict warnings
+	origin := map[string]string{}
+	pos := map[string]int{}
+	for i, r := range resources {
+		if key, ok := mergeKey(r); ok {
+			origin[key] = statePath
+			pos[key] = i
+		}
+	}
+	for _, src := range sources {
+		raw, err := os.ReadFile(src.Path)
+		if err != nil {
+			return fmt.Errorf("read merge state %s: %w", src.Path, err)
+		}
+		var other map[string]any
+		if err := jsonx.Unmarshal(raw, &other); err != nil {
+			return fmt.Errorf("parse merge state %s: %w", src.Path, err)
+		}
+		extra, _ := other["resources"].([]any)
+		for _, r := range extra {
+			m, ok := r.(map[string]any)
+			if !ok {
+				continue
+			}
+			if src.Module != "" {
+				if mod, _ := m["module"].(string); mod != "" {
+					m["module"] = src.Module + "." + mod
+				} else {
+					m["module"] = src.Module
+				}
+			}
+			key, ok := mergeKey(m)
+			if !ok {
+				continue
+			}
+			if i, dup := pos[key]; dup {
+				currentLogger().Printf("[warn] merge state: %s from %s replaces the entry from %s\n", strings.ReplaceAll(key, "|", "."), src.Path, origin[key])
+				resources[i] = m
+			} else {
+				pos[key] = len(resources)
+				resources = append(resources, m)
+			}
+			origin[key] = src.Path
+		}
+	}
+	st["resources"] = resources
+	return writeStateBump(statePath, st, b)
+}
+
+// mergeKey returns the address used to deduplicate a state resource entry.
+func mergeKey(r any) (string, bool) {
+	m, ok := r.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	rType, _ := m["type"].(string)
+	rName, _ := m["name"].(string)
+	if rType == "" || rName == "" {
+		return "", false
+	}
+	mode, _ := m["mode"].(string)
+	mod, _ := m["module"].(string)
+	return stateKey(mode, mod, rType, rName), true
+}
@@ -0,0 +1,84 @@
+package terraform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMergeState(t *testing.T) {
+	got, err := ParseMergeState([]string{"a.tfstate", "module.net=b.tfstate", "module.a.module.b=c.tfstate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MergeStateSource{{Path: "a.tfstate"}, {Module: "module.net", Path: "b.tfstate"}, {Module: "module.a.module.b", Path: "c.tfstate"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for _, bad := range []string{"", "module.=x.tfstate", "module.a.b=x.tfstate", "module.net="} {
+		if _, err := ParseMergeState([]string{bad}); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestMergeStates_ResolvesCrossStateReference(t *testing.T) {
+	dir := writeEvalFixture(t, `
+locals {
+  app = "web"
+}
+`)
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := EnsureStateInitialized(statePath); err != nil {
+		t.Fatal(err)
+	}
+	fixtures := filepath.Join(repoRoot(t), "test", "fixtures", "merge_state")
+	sources := []MergeStateSource{
+		{Path: filepath.Join(fixtures, "network.tfstate")},
+		{Path: filepath.Join(fixtures, "shared.tfstate")},
+		{Module: "module.net", Path: filepath.Join(fixtures, "network.tfstate")},
+	}
+	if err := MergeStates(statePath, sources); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+
+	b, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st map[string]any
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, r := range st["resources"].([]any) {
+		k, _ := mergeKey(r)
+		keys = append(keys, k)
+	}
+	wantKeys := []string{
+		"aws_vpc|main",
+		"aws_subnet|private",
+		"aws_route53_zone|internal",
+		"module.net|aws_vpc|main",
+		"module.net|aws_subnet|private",
+	}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Fatalf("resources: got %v, want %v", keys, wantKeys)
+	}
+
+	cases := map[string]any{
+		// the later state wins for the conflicting address
+		`aws_vpc.main.id`:                                  "vpc-0b2",
+		`aws_subnet.private[*].id`:                         []any{"subnet-0a1", "subnet-0a2"},
+		`"${local.app}.${aws_route53_zone.internal.name}"`: "web.internal.example.com",
+	}
+	for expr, want := range cases {
+		got, ok := TryEvalInProcessWithState(dir, statePath, nil, expr, time.Second)
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v (ok=%v), want %#v", expr, got, ok, want)
+		}
+	}
+}
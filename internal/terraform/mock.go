@@ -0,0 +1,211 @@
+package terraform
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// Mock holds stub attribute values for a resource or data source that only an
+// apply would produce, such as aws_instance.web.id. They are written into the
+// synthesized state so references to them resolve in the console.
+type Mock struct {
+	Address Address
+	Attrs   map[string]any
+}
+
+var mockFileSchema = &hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{{Type: "mock", LabelNames: []string{"address"}}}}
+
+// LoadMocks reads -mock files. Each holds mock blocks labeled with a resource
+// address, whose attributes are the stub values:
+//
+//	mock "aws_instance.web" {
+//	  id = "i-0123456789abcdef0"
+//	}
+//
+// Values are constant expressions; Terraform functions may be used.
+func LoadMocks(paths []string) ([]Mock, error) {
+	var out []Mock
+	p := hclparse.NewParser()
+	ctx := &hcl.EvalContext{Functions: terraformFunctions()}
+	for _, path := range paths {
+		src, err := readConfigFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read mock file: %w", err)
+		}
+		f, diags := p.ParseHCL(src, path)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("parse mock file: %s", diags.Error())
+		}
+		content, diags := f.Body.Content(mockFileSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("parse mock file: %s", diags.Error())
+		}
+		for _, b := range content.Blocks {
+			addr, err := ParseAddress(b.Labels[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", b.DefRange, err)
+			}
+			if addr.IsModule() {
+				return nil, fmt.Errorf("%s: mock %q must address a resource or data source", b.DefRange, b.Labels[0])
+			}
+			attrs, diags := b.Body.JustAttributes()
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("parse mock file: %s", diags.Error())
+			}
+			m := Mock{Address: addr, Attrs: map[string]any{}}
+			for name, a := range attrs {
+				v, diags := a.Expr.Value(ctx)
+				if diags.HasErrors() {
+					return nil, fmt.Errorf("mock %s.%s: %s", addr, name, diags.Error())
+				}
+				// State holds the actual data of sensitive values
+				v, _ = v.UnmarkDeep()
+				goV, ok := convertCtyToGo(v)
+				if !ok {
+					return nil, fmt.Errorf("mock %s.%s: value cannot be stored in state", addr, name)
+				}
+				m.Attrs[name] = goV
+			}
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// ApplyMocks writes the mocked attributes into the state at statePath, on top
+// of what configuration patching wrote, so it runs after every patch that may
+// overwrite them. Resources and instances missing from the state are added. A
+// mock without an instance key applies to every instance of its resource.
+func ApplyMocks(statePath string, mocks []Mock) error {
+	if strings.TrimSpace(statePath) == "" {
+		return errors.New("state path is empty")
+	}
+	if len(mocks) == 0 {
+		return nil
+	}
+	unlock := lockState(statePath)
+	defer unlock()
+	st, b, _, err := readStateCached(statePath)
+	if err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+	resources, _ := st["resources"].([]any)
+	changed := false
+	for _, m := range mocks {
+		mod := Address{Module: m.Address.Module}.String()
+		res := findStateResource(resources, m.Address.Mode, mod, m.Address.Type, m.Address.Name)
+		if res == nil {
+			res = map[string]any{
+				"mode":      m.Address.Mode,
+				"type":      m.Address.Type,
+				"name":      m.Address.Name,
+				"provider":  providerAddress(m.Address.Type, ""),
+				"instances": []any{},
+			}
+			if mod != "" {
+				res["module"] = mod
+			}
+			resources = append(resources, res)
+			changed = true
+		}
+		insts, _ := res["instances"].([]any)
+		key := m.Address.Key
+		if key != nil && len(insts) > 0 && !hasIndexKeys(insts) {
+			// count is synthesized as one instance without a key
+			currentLogger().Printf("[warn] mock %s: the state has a single instance of %s; applying the mock to it\n", m.Address, Address{Module: m.Address.Module, Mode: m.Address.Mode, Type: m.Address.Type, Name: m.Address.Name})
+			key = nil
+		}
+		matched := false
+		for _, raw := range insts {
+			im, ok := raw.(map[string]any)
+			if !ok || (key != nil && !sameIndexKey(im["index_key"], key)) {
+				continue
+			}
+			matched = true
+			if mergeMockAttrs(im, m.Attrs) {
+				changed = true
+			}
+		}
+		if !matched {
+			im := map[string]any{"schema_version": 0, "attributes": map[string]any{}}
+			if key != nil {
+				im["index_key"] = key
+			}
+			mergeMockAttrs(im, m.Attrs)
+			res["instances"] = append(insts, im)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	st["resources"] = resources
+	return writeStateBump(statePath, st, b)
+}
+
+// findStateResource returns the state entry of a resource, or nil.
+func findStateResource(resources []any, mode, module, rType, name string) map[string]any {
+	for _, r := range resources {
+		m, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		if m["type"] == rType && m["name"] == name && m["mode"] == mode {
+			if mod, _ := m["module"].(string); mod == module {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// hasIndexKeys reports whether the state instances carry count or for_each
+// keys.
+func hasIndexKeys(insts []any) bool {
+	for _, raw := range insts {
+		if im, ok := raw.(map[string]any); ok && im["index_key"] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// sameIndexKey compares a state index_key, a float64 for count after decoding,
+// with an address key.
+func sameIndexKey(indexKey, key any) bool {
+	switch k := key.(type) {
+	case int:
+		switch s := indexKey.(type) {
+		case float64:
+			return s == float64(k)
+		case int:
+			return s == k
+		}
+	case string:
+		s, ok := indexKey.(string)
+		return ok && s == k
+	}
+	return false
+}
+
+// mergeMockAttrs sets attrs on a state instance, reporting whether anything
+// changed.
+func mergeMockAttrs(inst map[string]any, attrs map[string]any) bool {
+	cur, _ := inst["attributes"].(map[string]any)
+	if cur == nil {
+		cur = map[string]any{}
+		inst["attributes"] = cur
+	}
+	changed := false
+	for k, v := range attrs {
+		if ov, ok := cur[k]; !ok || !deepEqualJSONish(ov, v) {
+			cur[k] = v
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,93 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplyMocks_ResolvesComputedAttribute(t *testing.T) {
+	// Without terraform on PATH only the in-process evaluator can resolve
+	t.Setenv("PATH", t.TempDir())
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.tf": `
+resource "aws_instance" "web" {
+  ami = "ami-1"
+}
+resource "aws_instance" "db" {
+  for_each = toset(["a", "b"])
+  ami      = "ami-2"
+}
+`,
+		"mocks.hcl": `
+mock "aws_instance.web" {
+  id         = "i-0123456789abcdef0"
+  private_ip = cidrhost("10.0.0.0/24", 12)
+}
+mock "aws_instance.db[\"b\"]" {
+  id = "i-db1"
+}
+mock "data.aws_caller_identity.current" {
+  account_id = "123456789012"
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statePath := filepath.Join(dir, "terraform.tfstate")
+	if err := PatchStateFromConfig(dir, statePath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := TryEvalInProcessWithState(dir, statePath, nil, "aws_instance.web.id", time.Second); ok {
+		t.Fatal("id must not resolve before it is mocked")
+	}
+	mocks, err := LoadMocks([]string{filepath.Join(dir, "mocks.hcl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyMocks(statePath, mocks); err != nil {
+		t.Fatal(err)
+	}
+	// Patching from configuration again keeps the mocked values
+	if err := PatchStateFromConfig(dir, statePath, nil); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]any{
+		`"${aws_instance.web.id}-${aws_instance.web.ami}"`: "i-0123456789abcdef0-ami-1",
+		"aws_instance.web.private_ip":                      "10.0.0.12",
+		`aws_instance.db["b"].id`:                          "i-db1",
+		"data.aws_caller_identity.current.account_id":      "123456789012",
+	}
+	for expr, want := range cases {
+		got, ok := TryEvalInProcessWithState(dir, statePath, nil, expr, time.Second)
+		if !ok || got != want {
+			t.Errorf("%s: got %#v (ok=%v), want %#v", expr, got, ok, want)
+		}
+	}
+	if got, ok := TryEvalInProcessWithState(dir, statePath, nil, `aws_instance.db["a"].id`, time.Second); ok {
+		t.Errorf("aws_instance.db[\"a\"].id is not mocked, got %#v", got)
+	}
+}
+
+func TestLoadMocks_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"module.hcl":    `mock "module.db" { id = "x" }`,
+		"address.hcl":   `mock "aws_instance" { id = "x" }`,
+		"reference.hcl": `mock "aws_instance.web" { id = var.id }`,
+		"block.hcl":     `resource "aws_instance" "web" {}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadMocks([]string{path}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
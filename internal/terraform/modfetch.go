@@ -4,15 +4,21 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/go-cleanhttp"
 	"github.com/hashicorp/go-getter"
 	"github.com/hashicorp/go-safetemp"
+	gv "github.com/hashicorp/go-version"
 )
 
 // ResolveOrFetchModuleSource returns a local filesystem path for a module source.
@@ -50,16 +56,25 @@ func ResolveOrFetchModuleSource(ctx context.Context, source string, cacheDir str
 	if fi, err := os.Stat(dest); err == nil && fi.IsDir() {
 		return dest, nil
 	}
+	if err := fetchInto(ctx, s, cacheDir, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// fetchInto downloads a go-getter source into dest through a temporary
+// directory in cacheDir, so dest appears only once complete.
+func fetchInto(ctx context.Context, src, cacheDir, dest string) error {
 	// Create a temporary directory within cacheDir to allow atomic rename
 	tmpDir, cleanup, err := safetemp.Dir(cacheDir, "modfetch-")
 	if err != nil {
-		return "", fmt.Errorf("temp dir: %w", err)
+		return fmt.Errorf("temp dir: %w", err)
 	}
 	defer func() { _ = cleanup.Close() }()
 
 	client := &getter.Client{
 		Ctx:  ctx,
-		Src:  s,
+		Src:  src,
 		Dst:  tmpDir,
 		Mode: getter.ClientModeAny,
 		// Ensure standard HTTP behaviors (proxies, certs, etc.)
@@ -71,15 +86,14 @@ func ResolveOrFetchModuleSource(ctx context.Context, source string, cacheDir str
 		},
 	}
 	if err := client.Get(); err != nil {
-		return "", fmt.Errorf("fetch module source: %w", err)
+		return fmt.Errorf("fetch module source: %w", err)
 	}
-	// Move into deterministic cache path
+	// Move into deterministic cache path; cleanup then only removes the
+	// emptied temporary parent
 	if err := os.Rename(tmpDir, dest); err != nil {
-		return "", fmt.Errorf("cache move: %w", err)
+		return fmt.Errorf("cache move: %w", err)
 	}
-	// Prevent cleanup from removing the renamed directory
-	cleanup = nil
-	return dest, nil
+	return nil
 }
 
 func defaultHTTPClient() *http.Client {
@@ -103,12 +117,258 @@ func isLikelyLocalPath(s string) bool {
 }
 
 func isRegistryAddress(s string) bool {
-	if strings.HasPrefix(s, "registry.terraform.io/") {
-		return true
+	_, ok := parseRegistrySource(s)
+	return ok
+}
+
+// registrySource is a module registry address: [host/]namespace/name/provider,
+// optionally followed by //subdir.
+type registrySource struct {
+	host, namespace, name, provider string
+	subdir                          string
+}
+
+// defaultRegistryHost serves registry addresses without a host.
+const defaultRegistryHost = "registry.terraform.io"
+
+// parseRegistrySource parses a registry module address. A three-part source
+// whose first part looks like a hostname (github.com/org/repo) is a VCS
+// shorthand rather than a registry address, as in Terraform.
+func parseRegistrySource(s string) (registrySource, bool) {
+	if strings.Contains(s, "://") || strings.Contains(s, "::") || isLikelyLocalPath(s) {
+		return registrySource{}, false
 	}
-	// Common shorthand source forms (namespace/name/provider)
-	if !strings.Contains(s, "://") && strings.Count(s, "/") == 2 {
-		return true
+	addr, subdir, _ := strings.Cut(s, "//")
+	parts := strings.Split(addr, "/")
+	src := registrySource{host: defaultRegistryHost, subdir: subdir}
+	switch {
+	case len(parts) == 4 && strings.ContainsAny(parts[0], ".:"):
+		src.host, parts = parts[0], parts[1:]
+	case len(parts) == 3 && !strings.ContainsAny(parts[0], ".:"):
+	default:
+		return registrySource{}, false
 	}
-	return false
+	for _, p := range parts {
+		if p == "" {
+			return registrySource{}, false
+		}
+	}
+	src.namespace, src.name, src.provider = parts[0], parts[1], parts[2]
+	return src, true
+}
+
+// registryModulesURL returns the base URL of the modules API of a registry
+// host; replaced in tests to point at a local server.
+var registryModulesURL = func(host string) string {
+	return "https://" + host + "/v1/modules/"
+}
+
+// registryFetchTimeout bounds resolving and downloading one registry module.
+const registryFetchTimeout = 15 * time.Second
+
+var (
+	registryFetchMu sync.Mutex
+	// registryFetched memoizes fetch results, including failures, per source and
+	// version constraint for the life of the process, so index rebuilds on every
+	// configuration change do not hit the network again.
+	registryFetched = map[string]registryFetchResult{}
+	// registryFetching holds the keys being downloaded in the background
+	registryFetching = map[string]bool{}
+	registryFetchOn  = true
+	// registryFetchDone is signalled after each background download
+	registryFetchDone = make(chan struct{}, 1)
+)
+
+type registryFetchResult struct {
+	dir string
+	err error
+}
+
+// SetRegistryFetch turns downloading registry modules for completion on or
+// off for the rest of the process. It is on by default.
+func SetRegistryFetch(on bool) {
+	registryFetchMu.Lock()
+	registryFetchOn = on
+	registryFetchMu.Unlock()
+}
+
+// RegistryFetch reports whether registry modules are downloaded for
+// completion.
+func RegistryFetch() bool {
+	registryFetchMu.Lock()
+	defer registryFetchMu.Unlock()
+	return registryFetchOn
+}
+
+// RegistryModuleFetched receives a value after a background download started
+// by BuildSymbolIndex finishes, successfully or not; rebuilding the index then
+// picks up the outputs of the module.
+func RegistryModuleFetched() <-chan struct{} {
+	return registryFetchDone
+}
+
+// registryModule returns the directory of a registry module matching the
+// version constraint, downloaded into cacheDir for completion only: evaluation
+// still needs the modules installed by terraform init. A module not yet on
+// disk is downloaded in the background and "" is returned meanwhile, so index
+// builds never wait on the network. Results are cached per source and
+// constraint, on disk and in memory, and a failed download is warned about
+// once.
+func registryModule(source, constraint, cacheDir string) string {
+	key := source + "@" + constraint
+	dest := filepath.Join(cacheDir, fingerprint(key))
+	registryFetchMu.Lock()
+	if r, ok := registryFetched[key]; ok {
+		registryFetchMu.Unlock()
+		return r.dir
+	}
+	if registryFetching[key] {
+		registryFetchMu.Unlock()
+		return ""
+	}
+	if fi, err := os.Stat(dest); err == nil && fi.IsDir() {
+		registryFetchMu.Unlock()
+		// Already downloaded by an earlier run; no network access
+		dir, err := fetchRegistryModuleUncached(context.Background(), source, constraint, dest)
+		registryFetchMu.Lock()
+		registryFetched[key] = registryFetchResult{dir: dir, err: err}
+		registryFetchMu.Unlock()
+		return dir
+	}
+	registryFetching[key] = true
+	registryFetchMu.Unlock()
+	go func() {
+		dir, err := fetchRegistryModuleUncached(context.Background(), source, constraint, dest)
+		if err != nil {
+			currentLogger().Printf("[warn] unable to fetch %s for completion: %v\n", source, err)
+		}
+		registryFetchMu.Lock()
+		registryFetched[key] = registryFetchResult{dir: dir, err: err}
+		delete(registryFetching, key)
+		registryFetchMu.Unlock()
+		select {
+		case registryFetchDone <- struct{}{}:
+		default:
+		}
+	}()
+	return ""
+}
+
+func fetchRegistryModuleUncached(ctx context.Context, source, constraint, dest string) (string, error) {
+	src, ok := parseRegistrySource(source)
+	if !ok {
+		return "", fmt.Errorf("not a registry module source: %s", source)
+	}
+	withSubdir := func(dir string) string {
+		if src.subdir == "" {
+			return dir
+		}
+		return filepath.Join(dir, filepath.FromSlash(src.subdir))
+	}
+	if fi, err := os.Stat(dest); err == nil && fi.IsDir() {
+		return withSubdir(dest), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, registryFetchTimeout)
+	defer cancel()
+	base := registryModulesURL(src.host) + src.namespace + "/" + src.name + "/" + src.provider + "/"
+	version, err := registryModuleVersion(ctx, base, constraint)
+	if err != nil {
+		return "", err
+	}
+	getURL, err := registryDownloadURL(ctx, base+version+"/download")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+		return "", fmt.Errorf("create cache dir: %w", err)
+	}
+	if err := fetchInto(ctx, getURL, filepath.Dir(dest), dest); err != nil {
+		return "", err
+	}
+	return withSubdir(dest), nil
+}
+
+// registryModuleVersion returns the newest available version satisfying
+// constraint; an empty constraint accepts any version.
+func registryModuleVersion(ctx context.Context, base, constraint string) (string, error) {
+	var cons gv.Constraints
+	if strings.TrimSpace(constraint) != "" {
+		c, err := gv.NewConstraint(constraint)
+		if err != nil {
+			return "", fmt.Errorf("module version constraint %q: %w", constraint, err)
+		}
+		cons = c
+	}
+	resp, err := registryGet(ctx, base+"versions")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var body struct {
+		Modules []struct {
+			Versions []struct {
+				Version string `json:"version"`
+			} `json:"versions"`
+		} `json:"modules"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("module versions: %w", err)
+	}
+	var best *gv.Version
+	for _, m := range body.Modules {
+		for _, mv := range m.Versions {
+			v, err := gv.NewVersion(mv.Version)
+			if err != nil || v.Prerelease() != "" || (cons != nil && !cons.Check(v)) {
+				continue
+			}
+			if best == nil || v.GreaterThan(best) {
+				best = v
+			}
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("no module version matches %q", constraint)
+	}
+	return best.Original(), nil
+}
+
+// registryDownloadURL asks the registry where a module version is stored,
+// resolving a relative location against the download endpoint.
+func registryDownloadURL(ctx context.Context, endpoint string) (string, error) {
+	resp, err := registryGet(ctx, endpoint)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	loc := resp.Header.Get("X-Terraform-Get")
+	if loc == "" {
+		return "", fmt.Errorf("registry returned no download location for %s", endpoint)
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	// Only plain relative references are resolved; go-getter sources such as
+	// git::https://... are used as given
+	if ref, err := url.Parse(loc); err == nil && ref.Scheme == "" && !strings.Contains(loc, "::") {
+		return base.ResolveReference(ref).String(), nil
+	}
+	return loc, nil
+}
+
+func registryGet(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "terraflow/console")
+	resp, err := defaultHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("registry request %s: %s", u, resp.Status)
+	}
+	return resp, nil
 }
@@ -0,0 +1,138 @@
+package terraform
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// moduleTarball returns a gzipped tar holding the given files.
+func moduleTarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBuildSymbolIndex_RegistryModuleOutputs(t *testing.T) {
+	archive := moduleTarball(t, map[string]string{
+		"outputs.tf": "output \"vpc_id\" {\n  value       = \"vpc-1\"\n  description = \"ID of the VPC\"\n}\noutput \"subnet_ids\" {\n  value = []\n}\n",
+	})
+	var downloaded string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/modules/acme/network/aws/versions", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"modules":[{"versions":[{"version":"0.9.0"},{"version":"1.2.0"},{"version":"1.3.0-beta1"},{"version":"2.0.0"}]}]}`))
+	})
+	mux.HandleFunc("/v1/modules/acme/network/aws/", func(w http.ResponseWriter, r *http.Request) {
+		downloaded = r.URL.Path
+		w.Header().Set("X-Terraform-Get", "/archives/network.tar.gz")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/archives/network.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	origURL, origFetched := registryModulesURL, registryFetched
+	registryModulesURL = func(string) string { return srv.URL + "/v1/modules/" }
+	registryFetched = map[string]registryFetchResult{}
+	defer func() { registryModulesURL, registryFetched = origURL, origFetched }()
+
+	root := writeModuleTree(t, map[string]string{
+		"main.tf": "module \"net\" {\n  source  = \"example.com/acme/network/aws\"\n  version = \"~> 1.0\"\n}\n",
+	})
+	// The download runs in the background; the first index lacks the outputs
+	idx, err := BuildSymbolIndex(root)
+	if err != nil {
+		t.Fatalf("BuildSymbolIndex error: %v", err)
+	}
+	if outs := idx.ModuleOutputs["module.net"]; len(outs) != 0 {
+		t.Fatalf("outputs before the download finished: %v", outs)
+	}
+	select {
+	case <-RegistryModuleFetched():
+	case <-time.After(10 * time.Second):
+		t.Fatal("registry module download did not finish")
+	}
+	if idx, err = BuildSymbolIndex(root); err != nil {
+		t.Fatalf("BuildSymbolIndex error: %v", err)
+	}
+	if downloaded != "/v1/modules/acme/network/aws/1.2.0/download" {
+		t.Fatalf("downloaded %q, want the newest release matching ~> 1.0", downloaded)
+	}
+	line := "module.net."
+	got, _, _ := idx.CompletionCandidates(line, len(line))
+	want := []string{"module.net.subnet_ids", "module.net.vpc_id"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if got := idx.OutputDescriptions["module.net.vpc_id"]; got != "ID of the VPC" {
+		t.Fatalf("output description = %q", got)
+	}
+}
+
+func TestBuildSymbolIndex_RegistryFetchDisabled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("registry requested %s with fetching disabled", r.URL.Path)
+	}))
+	defer srv.Close()
+
+	origURL, origFetched := registryModulesURL, registryFetched
+	registryModulesURL = func(string) string { return srv.URL + "/v1/modules/" }
+	registryFetched = map[string]registryFetchResult{}
+	defer func() { registryModulesURL, registryFetched = origURL, origFetched }()
+	SetRegistryFetch(false)
+	defer SetRegistryFetch(true)
+
+	root := writeModuleTree(t, map[string]string{
+		"main.tf": "module \"net\" {\n  source = \"example.com/acme/network/aws\"\n}\n",
+	})
+	if _, err := BuildSymbolIndex(root); err != nil {
+		t.Fatalf("BuildSymbolIndex error: %v", err)
+	}
+	registryFetchMu.Lock()
+	defer registryFetchMu.Unlock()
+	if len(registryFetching) != 0 || len(registryFetched) != 0 {
+		t.Fatalf("registry module fetched with fetching disabled")
+	}
+}
+
+func TestParseRegistrySource(t *testing.T) {
+	cases := map[string]registrySource{
+		"hashicorp/consul/aws":                 {host: defaultRegistryHost, namespace: "hashicorp", name: "consul", provider: "aws"},
+		"app.terraform.io/acme/vpc/aws":        {host: "app.terraform.io", namespace: "acme", name: "vpc", provider: "aws"},
+		"hashicorp/consul/aws//modules/server": {host: defaultRegistryHost, namespace: "hashicorp", name: "consul", provider: "aws", subdir: "modules/server"},
+	}
+	for in, want := range cases {
+		got, ok := parseRegistrySource(in)
+		if !ok || got != want {
+			t.Errorf("parseRegistrySource(%q) = %#v, %v; want %#v", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"./local", "git::https://example.com/x.git", "github.com/acme/vpc", "a/b"} {
+		if _, ok := parseRegistrySource(in); ok {
+			t.Errorf("parseRegistrySource(%q) accepted a non-registry source", in)
+		}
+	}
+}
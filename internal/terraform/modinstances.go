@@ -0,0 +1,355 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/encoding/jsonx"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// moduleCall is a module block as far as instance expansion needs it.
+type moduleCall struct {
+	name    string
+	source  string
+	forEach string            // source of for_each; empty without one
+	count   string            // source of count; empty without one
+	args    map[string]string // input variable name -> expression source
+}
+
+// moduleInstance is one instance of a module path: the instance key of each
+// call along the path (nil for a call without count or for_each) and an
+// expression evaluating to the instance's input variables. vars is empty for
+// modules outside any call with count or for_each, whose attributes are
+// evaluated as they always were.
+type moduleInstance struct {
+	keys []any
+	vars string
+}
+
+// moduleCallMetaArgs are the module block attributes that are not inputs.
+var moduleCallMetaArgs = map[string]bool{"source": true, "version": true, "count": true, "for_each": true, "providers": true, "depends_on": true}
+
+// skippedModuleInstances remembers module paths whose instances could not be
+// evaluated, so each is warned about once.
+var skippedModuleInstances sync.Map
+
+// parseModuleCalls returns the module blocks of the module in dir, by name.
+func parseModuleCalls(dir string) []moduleCall {
+	var out []moduleCall
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.ToLower(filepath.Ext(e.Name())) != ".tf" {
+			continue
+		}
+		src, f, ok := getSyntaxFileCached(filepath.Join(dir, e.Name()))
+		if !ok || f == nil {
+			continue
+		}
+		body, ok := f.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, blk := range body.Blocks {
+			if blk.Type != "module" || len(blk.Labels) != 1 {
+				continue
+			}
+			call := moduleCall{name: blk.Labels[0], args: map[string]string{}}
+			for k, a := range blk.Body.Attributes {
+				s := exprSource(src, a.Expr)
+				switch {
+				case k == "source":
+					if v, ok := constValue(a.Expr); ok {
+						call.source, _ = v.(string)
+					}
+				case k == "for_each":
+					call.forEach = s
+				case k == "count":
+					call.count = s
+				case !moduleCallMetaArgs[k]:
+					call.args[k] = s
+				}
+			}
+			out = append(out, call)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// resolveModuleInstances expands the module calls under rootDir that use count
+// or for_each, and the modules below them, into their instances, keyed by the
+// module path joined with dots as in modules.json. Modules outside such calls
+// are absent. eval evaluates count and for_each in the root module; a nil eval
+// or a failed evaluation leaves the module with no instances.
+func resolveModuleInstances(rootDir string, eval func(expr string) (any, bool)) map[string][]moduleInstance {
+	abs, _ := filepath.Abs(rootDir)
+	modMap, _ := resolveModuleDirs(abs)
+	out := map[string][]moduleInstance{}
+	maxDepth := currentMaxModuleDepth()
+	ancestors := map[string]bool{}
+	var walk func(dir string, path []string, parents []moduleInstance)
+	walk = func(dir string, path []string, parents []moduleInstance) {
+		dir = canonicalModuleDir(dir)
+		if ancestors[dir] || len(path) > maxDepth {
+			return
+		}
+		ancestors[dir] = true
+		defer delete(ancestors, dir)
+		for _, call := range parseModuleCalls(dir) {
+			childPath := append(slices.Clone(path), call.name)
+			childKey := strings.Join(childPath, ".")
+			childDir, ok := modMap[childKey]
+			if !ok {
+				if !strings.HasPrefix(call.source, "./") && !strings.HasPrefix(call.source, "../") && !filepath.IsAbs(call.source) {
+					continue
+				}
+				childDir = call.source
+				if !filepath.IsAbs(childDir) {
+					childDir = filepath.Join(dir, childDir)
+				}
+			}
+			if fi, err := os.Stat(childDir); err != nil || !fi.IsDir() {
+				continue
+			}
+			inputs := call.inputs(childDir)
+			var insts []moduleInstance
+			_, parentExpanded := out[strings.Join(path, ".")]
+			expanded := call.forEach != "" || call.count != "" || parentExpanded
+			for _, p := range parents {
+				ci, ok := call.instances(p, inputs, eval)
+				if !ok {
+					if eval != nil {
+						if _, warned := skippedModuleInstances.LoadOrStore(childKey, true); !warned {
+							currentLogger().Printf("[warn] cannot evaluate count or for_each of %s; its resources are left out of the state\n", modulePathToString(childPath))
+						}
+					}
+					continue
+				}
+				insts = append(insts, ci...)
+			}
+			if expanded {
+				if insts == nil {
+					insts = []moduleInstance{}
+				}
+				out[childKey] = insts
+			}
+			walk(childDir, childPath, insts)
+		}
+	}
+	walk(abs, nil, []moduleInstance{{}})
+	return out
+}
+
+// evaluatedModuleInstances resolves module instances evaluating count and
+// for_each the way attributes are evaluated.
+func evaluatedModuleInstances(rootDir, workDir, statePath string, varFiles []string) map[string][]moduleInstance {
+	return resolveModuleInstances(rootDir, func(expr string) (any, bool) {
+		v, _, ok := evalJSONSource(workDir, statePath, varFiles, expr, 3*time.Second)
+		return v, ok
+	})
+}
+
+// inputs builds an object constructor of the input variables the module in
+// childDir declares: the call's argument when given, else the default.
+func (c moduleCall) inputs(childDir string) string {
+	mod, diags := loadModule(childDir)
+	if mod == nil || (diags != nil && diags.HasErrors()) {
+		return "{}"
+	}
+	names := make([]string, 0, len(mod.Variables))
+	for name := range mod.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteString(" = ")
+		if expr, ok := c.args[name]; ok {
+			b.WriteString("(" + expr + ")")
+		} else {
+			b.WriteString(hclLiteral(mod.Variables[name].Default))
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// instances returns the instances of the call within the parent instance,
+// evaluating count or for_each. each and count are bound by single-element for
+// expressions, the way forEachInstancesExpr binds each.
+func (c moduleCall) instances(parent moduleInstance, inputs string, eval func(string) (any, bool)) ([]moduleInstance, bool) {
+	keyed := func(k any, vars string) moduleInstance {
+		return moduleInstance{keys: append(slices.Clone(parent.keys), k), vars: bindModuleVars(parent.vars, vars)}
+	}
+	switch {
+	case c.forEach != "":
+		if eval == nil {
+			return nil, false
+		}
+		v, ok := eval(bindModuleVars(parent.vars, "[for key, value in ("+c.forEach+") : key]"))
+		keys, isList := v.([]any)
+		if !ok || !isList {
+			return nil, false
+		}
+		var out []moduleInstance
+		for _, k := range keys {
+			ks, ok := k.(string)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, keyed(ks, "[for key, value in ("+c.forEach+") : [for each in [{ key = key, value = value }] : "+inputs+"][0] if key == "+hclString(ks)+"][0]"))
+		}
+		return out, true
+	case c.count != "":
+		if eval == nil {
+			return nil, false
+		}
+		v, ok := eval(bindModuleVars(parent.vars, "("+c.count+")"))
+		n, isNum := v.(float64)
+		if !ok || !isNum || n < 0 || n != float64(int(n)) {
+			return nil, false
+		}
+		var out []moduleInstance
+		for i := range int(n) {
+			out = append(out, keyed(i, "[for count in [{ index = "+strconv.Itoa(i)+" }] : "+inputs+"][0]"))
+		}
+		return out, true
+	case parent.vars != "":
+		return []moduleInstance{keyed(nil, inputs)}, true
+	default:
+		return []moduleInstance{{keys: append(slices.Clone(parent.keys), nil)}}, true
+	}
+}
+
+// bindModuleVars wraps expr so that var refers to the input variables vars
+// evaluates to. Without vars, expr is returned unchanged.
+func bindModuleVars(vars, expr string) string {
+	if vars == "" {
+		return expr
+	}
+	return "[for var in [" + vars + "] : (" + expr + ")][0]"
+}
+
+// hclString quotes s as an HCL string literal, escaping template sequences.
+func hclString(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(strconv.Quote(s))
+}
+
+// hclLiteral formats a variable default as an HCL expression; JSON syntax is
+// valid HCL once template sequences are escaped.
+func hclLiteral(v any) string {
+	b, err := jsonx.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(string(b))
+}
+
+// moduleInstanceAddress formats a module path with the instance keys of its
+// calls, as in module.envs["prod"].module.dns. keys may be nil.
+func moduleInstanceAddress(path []string, keys []any) string {
+	var a Address
+	for i, p := range path {
+		step := ModuleStep{Name: p}
+		if i < len(keys) {
+			step.Key = keys[i]
+		}
+		a.Module = append(a.Module, step)
+	}
+	return a.String()
+}
+
+// expandScanInstances replaces each resource of a module below a call with
+// count or for_each by one copy per module instance.
+func expandScanInstances(collected []scanResInfo, insts map[string][]moduleInstance) []scanResInfo {
+	if len(insts) == 0 {
+		return collected
+	}
+	out := make([]scanResInfo, 0, len(collected))
+	for _, ri := range collected {
+		list, ok := insts[strings.Join(ri.modulePath, ".")]
+		if !ok {
+			out = append(out, ri)
+			continue
+		}
+		for _, in := range list {
+			c := ri
+			c.moduleKeys, c.vars = in.keys, in.vars
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// expandResourceInstances is expandScanInstances for scans that do not
+// evaluate per instance: every instance gets the same attributes.
+func expandResourceInstances(cfgs []ResourceConfig, insts map[string][]moduleInstance) []ResourceConfig {
+	if len(insts) == 0 {
+		return cfgs
+	}
+	out := make([]ResourceConfig, 0, len(cfgs))
+	for _, rc := range cfgs {
+		list, ok := insts[strings.Join(rc.ModulePath, ".")]
+		if !ok {
+			out = append(out, rc)
+			continue
+		}
+		for _, in := range list {
+			c := rc
+			c.ModuleKeys = in.keys
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// stateModuleInstances fills the module paths of insts with the instances the
+// state holds resources for, for scans that cannot evaluate count and
+// for_each.
+func stateModuleInstances(resources []any, insts map[string][]moduleInstance) map[string][]moduleInstance {
+	out := make(map[string][]moduleInstance, len(insts))
+	seen := map[string]bool{}
+	for k := range insts {
+		out[k] = []moduleInstance{}
+	}
+	for _, r := range resources {
+		m, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		mod, _ := m["module"].(string)
+		if mod == "" || seen[mod] {
+			continue
+		}
+		a, err := ParseAddress(mod)
+		if err != nil {
+			continue
+		}
+		key := strings.Join(a.ModulePath(), ".")
+		if _, ok := out[key]; !ok {
+			continue
+		}
+		seen[mod] = true
+		var keys []any
+		for _, s := range a.Module {
+			keys = append(keys, s.Key)
+		}
+		out[key] = append(out[key], moduleInstance{keys: keys})
+	}
+	return out
+}
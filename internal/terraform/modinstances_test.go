@@ -0,0 +1,70 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPatchStateEvaluatedFast_ModuleInstances(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	root := t.TempDir()
+	if err := os.CopyFS(root, os.DirFS(filepath.Join(repoRoot(t), "test", "fixtures", "module_for_each"))); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(root, ".terraflow", "terraform.tfstate")
+	readTriggers := func() map[string]any {
+		t.Helper()
+		b, err := os.ReadFile(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var st map[string]any
+		if err := json.Unmarshal(b, &st); err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]any{}
+		for _, r := range st["resources"].([]any) {
+			m := r.(map[string]any)
+			for _, in := range m["instances"].([]any) {
+				attrs := in.(map[string]any)["attributes"].(map[string]any)
+				got[fmt.Sprintf("%v.%v.%v", m["module"], m["type"], m["name"])] = attrs["triggers"]
+			}
+		}
+		return got
+	}
+	want := map[string]any{
+		`module.envs["prod"].null_resource.web`:               map[string]any{"name": "prod", "type": "t3.large"},
+		`module.envs["staging"].null_resource.web`:            map[string]any{"name": "staging", "type": "t3.micro"},
+		`module.envs["prod"].module.dns.null_resource.record`: map[string]any{"zone": "prod.example.com", "ttl": float64(300)},
+		`module.envs["staging"].module.dns.null_resource.record`: map[string]any{
+			"zone": "staging.example.com", "ttl": float64(300),
+		},
+		`module.workers[0].null_resource.worker`: map[string]any{"name": "worker-0"},
+		`module.workers[1].null_resource.worker`: map[string]any{"name": "worker-1"},
+	}
+
+	if err := PatchStateFromConfigEvaluatedFast(root, root, statePath, nil); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	if got := readTriggers(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resources:\n got %#v\nwant %#v", got, want)
+	}
+	// The literal refresh cannot evaluate for_each and keeps the instances
+	if err := PatchStateFromConfigLiterals(root, statePath); err != nil {
+		t.Fatalf("literal patch: %v", err)
+	}
+	if got := readTriggers(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resources after literal patch:\n got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestModuleStringToPath_InstanceKeys(t *testing.T) {
+	got := moduleStringToPath(`module.envs["a.b"].module.dns`)
+	if want := []string{"envs", "dns"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	cty "github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// modulePathRel returns moduleDir relative to rootDir with forward slashes,
+// the way path.module reports it: "." for the root module and, for instance,
+// "modules/vpc" for a module it calls.
+func modulePathRel(rootDir, moduleDir string) string {
+	absRoot, _ := filepath.Abs(rootDir)
+	absMod, _ := filepath.Abs(moduleDir)
+	rel, err := filepath.Rel(absRoot, absMod)
+	if err != nil {
+		return "."
+	}
+	return filepath.ToSlash(rel)
+}
+
+// pathObject is the value of path for expressions of the root module in
+// rootDir: path.module and path.root are ".", path.cwd is the configuration
+// directory, which for a scratch directory is the one it is synced from.
+func pathObject(rootDir string) cty.Value {
+	abs := sourceDir(rootDir)
+	return cty.ObjectVal(map[string]cty.Value{
+		"module": cty.StringVal("."),
+		"root":   cty.StringVal("."),
+		"cwd":    cty.StringVal(abs),
+	})
+}
+
+// bindModulePath wraps expr, an expression of the module at moduleRel, so
+// path.module refers to that module while it is evaluated at the root module,
+// in-process and in terraform console alike. Expressions of the root module
+// and those not mentioning path are returned unchanged.
+func bindModulePath(rootDir, moduleRel, expr string) string {
+	if moduleRel == "." || !strings.Contains(expr, "path.") {
+		return expr
+	}
+	abs := sourceDir(rootDir)
+	return "[for path in [{ module = " + hclString(moduleRel) + ", root = \".\", cwd = " + hclString(abs) + " }] : (" + expr + ")][0]"
+}
+
+// workDirFunctions returns the in-process functions with file and fileexists
+// reading from the configuration directory of workDir. A scratch directory
+// holds only copies of the .tf and .tfvars files, so relative paths such as
+// "${path.module}/greeting.txt" resolve against the directory it is synced
+// from.
+func workDirFunctions(workDir string) map[string]function.Function {
+	funcs := terraformFunctions()
+	for name, fn := range fileFunctions(sourceDir(workDir)) {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// fileFunctions returns file and fileexists resolving relative paths from
+// baseDir, the directory terraform console runs in.
+func fileFunctions(baseDir string) map[string]function.Function {
+	resolve := func(p string) string {
+		if filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(baseDir, p)
+	}
+	return map[string]function.Function{
+		"file": function.New(&function.Spec{
+			Params: []function.Parameter{{Name: "path", Type: cty.String}},
+			Type:   function.StaticReturnType(cty.String),
+			Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+				b, err := os.ReadFile(resolve(args[0].AsString()))
+				if err != nil {
+					return cty.UnknownVal(cty.String), function.NewArgError(0, err)
+				}
+				if !utf8.Valid(b) {
+					return cty.UnknownVal(cty.String), function.NewArgErrorf(0, "contents of %s are not valid UTF-8; use filebase64 to read binary files", args[0].AsString())
+				}
+				return cty.StringVal(string(b)), nil
+			},
+		}),
+		"fileexists": function.New(&function.Spec{
+			Params: []function.Parameter{{Name: "path", Type: cty.String}},
+			Type:   function.StaticReturnType(cty.Bool),
+			Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+				fi, err := os.Stat(resolve(args[0].AsString()))
+				if os.IsNotExist(err) {
+					return cty.False, nil
+				}
+				if err != nil {
+					return cty.UnknownVal(cty.Bool), function.NewArgError(0, err)
+				}
+				if !fi.Mode().IsRegular() {
+					return cty.UnknownVal(cty.Bool), function.NewArgErrorf(0, "%s is not a regular file", args[0].AsString())
+				}
+				return cty.True, nil
+			},
+		}),
+	}
+}
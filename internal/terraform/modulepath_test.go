@@ -0,0 +1,111 @@
+package terraform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildResourceConfigsEvaluatedGlobal_PathModulePerResource(t *testing.T) {
+	// Without terraform on PATH only the in-process evaluator can resolve
+	t.Setenv("PATH", t.TempDir())
+	defer ResetAllPersistentEvaluators()
+	dir := filepath.Join(repoRoot(t), "test", "fixtures", "module_path")
+
+	cfgs, err := BuildResourceConfigsEvaluatedGlobal(dir, dir, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"null_resource.root": map[string]any{"greeting": "hello from the root module"},
+		"module.vpc.null_resource.vpc": map[string]any{
+			"greeting": "hello from modules/vpc",
+			"module":   "modules/vpc",
+		},
+	}
+	got := map[string]any{}
+	for _, rc := range cfgs {
+		addr := batchAddr(rc.mode(), rc.Type, rc.Name)
+		if mod := rc.moduleAddress(); mod != "" {
+			addr = mod + "." + addr
+		}
+		got[addr] = rc.Attrs["triggers"]
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("triggers = %#v, want %#v", got, want)
+	}
+}
+
+func TestBuildResourceConfigsEvaluatedGlobal_FilesReadFromSyncedSource(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	defer ResetAllPersistentEvaluators()
+	src := filepath.Join(repoRoot(t), "test", "fixtures", "module_path")
+	// The console evaluates in a scratch directory holding only .tf copies
+	scratch := t.TempDir()
+	if _, _, err := SyncToScratch(src, scratch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(scratch, "greeting.txt")); !os.IsNotExist(err) {
+		t.Fatalf("greeting.txt should not be copied to scratch: %v", err)
+	}
+
+	cfgs, err := BuildResourceConfigsEvaluatedGlobal(scratch, scratch, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]any{}
+	for _, rc := range cfgs {
+		addr := batchAddr(rc.mode(), rc.Type, rc.Name)
+		if mod := rc.moduleAddress(); mod != "" {
+			addr = mod + "." + addr
+		}
+		got[addr] = rc.Attrs["triggers"]
+	}
+	want := map[string]any{
+		"null_resource.root": map[string]any{"greeting": "hello from the root module"},
+		"module.vpc.null_resource.vpc": map[string]any{
+			"greeting": "hello from modules/vpc",
+			"module":   "modules/vpc",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("triggers = %#v, want %#v", got, want)
+	}
+}
+
+func TestPatchTargetedExactByFiles_PathModuleOfChildModule(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	defer ResetAllPersistentEvaluators()
+	dir := filepath.Join(repoRoot(t), "test", "fixtures", "module_path")
+	statePath := filepath.Join(t.TempDir(), "terraform.tfstate")
+	if err := os.WriteFile(statePath, []byte(`{"version":4,"serial":1,"resources":[
+  {"module":"module.vpc","mode":"managed","type":"null_resource","name":"vpc","instances":[{"attributes":{}}]}
+]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PatchTargetedExactByFiles(dir, dir, statePath, nil, []string{filepath.Join(dir, "modules", "vpc", "main.tf")}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st struct {
+		Resources []struct {
+			Instances []struct {
+				Attributes map[string]any `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatal(err)
+	}
+	got := st.Resources[0].Instances[0].Attributes["triggers"]
+	want := map[string]any{"greeting": "hello from modules/vpc", "module": "modules/vpc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("triggers = %#v, want %#v", got, want)
+	}
+}
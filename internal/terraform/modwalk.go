@@ -0,0 +1,136 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxModuleDepth is the module nesting depth walked when none is configured.
+const DefaultMaxModuleDepth = 32
+
+var (
+	moduleDepthMu  sync.RWMutex
+	maxModuleDepth = DefaultMaxModuleDepth
+)
+
+// SetMaxModuleDepth limits how deeply nested module calls are followed for the
+// rest of the process. Values below 1 restore the default.
+func SetMaxModuleDepth(n int) {
+	if n < 1 {
+		n = DefaultMaxModuleDepth
+	}
+	moduleDepthMu.Lock()
+	maxModuleDepth = n
+	moduleDepthMu.Unlock()
+}
+
+func currentMaxModuleDepth() int {
+	moduleDepthMu.RLock()
+	defer moduleDepthMu.RUnlock()
+	return maxModuleDepth
+}
+
+// canonicalModuleDir returns an absolute, symlink-free path for dir so that the
+// same module reached through different spellings is recognized.
+func canonicalModuleDir(dir string) string {
+	abs, _ := filepath.Abs(dir)
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	return abs
+}
+
+// moduleWalkGuard tracks the modules on the current recursion path and those
+// already visited, so walkers stop on cycles and at the depth limit with a
+// warning instead of looping or silently truncating.
+type moduleWalkGuard struct {
+	maxDepth  int
+	visited   map[string]struct{}
+	ancestors map[string]struct{}
+}
+
+func newModuleWalkGuard() *moduleWalkGuard {
+	return &moduleWalkGuard{
+		maxDepth:  currentMaxModuleDepth(),
+		visited:   map[string]struct{}{},
+		ancestors: map[string]struct{}{},
+	}
+}
+
+// enter reports whether the module at dir, depth levels below the root, should
+// be walked. The caller must call leave(dir) once done with an entered module.
+// Modules shared by several calls are walked once.
+func (g *moduleWalkGuard) enter(dir string, depth int, modulePath []string) bool {
+	if _, ok := g.ancestors[dir]; ok {
+		currentLogger().Printf("[warn] module cycle at %s (%s); not following it again\n", moduleAddrForLog(modulePath), dir)
+		return false
+	}
+	if _, ok := g.visited[dir]; ok {
+		return false
+	}
+	if depth > g.maxDepth {
+		currentLogger().Printf("[warn] module nesting deeper than %d at %s; skipping %s and below\n", g.maxDepth, moduleAddrForLog(modulePath), dir)
+		return false
+	}
+	g.visited[dir] = struct{}{}
+	g.ancestors[dir] = struct{}{}
+	return true
+}
+
+func (g *moduleWalkGuard) leave(dir string) {
+	delete(g.ancestors, dir)
+}
+
+func moduleAddrForLog(modulePath []string) string {
+	if len(modulePath) == 0 {
+		return "root module"
+	}
+	return modulePathToString(modulePath)
+}
+
+// walkLocalModules calls visit for the module at rootDir and every module it
+// calls through a local path, depth-first. modulePath holds the module call
+// names leading to each module.
+func walkLocalModules(rootDir string, visit func(absMod string, modulePath []string) error) error {
+	g := newModuleWalkGuard()
+	var walk func(moduleDir string, modulePath []string) error
+	walk = func(moduleDir string, modulePath []string) error {
+		absMod := canonicalModuleDir(moduleDir)
+		if !g.enter(absMod, len(modulePath), modulePath) {
+			return nil
+		}
+		defer g.leave(absMod)
+		if err := visit(absMod, modulePath); err != nil {
+			return err
+		}
+		mod, diags := loadModule(absMod)
+		if diags != nil && diags.HasErrors() {
+			return fmt.Errorf("%s: %s", absMod, diags.Error())
+		}
+		if mod == nil {
+			return nil
+		}
+		for name, call := range mod.ModuleCalls {
+			if call == nil || strings.TrimSpace(call.Source) == "" {
+				continue
+			}
+			src := call.Source
+			if strings.HasPrefix(src, "./") || strings.HasPrefix(src, "../") || filepath.IsAbs(src) {
+				next := src
+				if !filepath.IsAbs(next) {
+					next = filepath.Join(absMod, src)
+				}
+				if fi, err := os.Stat(next); err == nil && fi.IsDir() {
+					if err := walk(next, append(append([]string{}, modulePath...), name)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	return walk(rootDir, nil)
+}
@@ -0,0 +1,99 @@
+package terraform
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureLog returns what fn logs through the standard logger.
+func captureLog(t *testing.T, fn func()) string {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	fn()
+	return buf.String()
+}
+
+func writeModuleTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, src := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestModuleWalkers_SelfSourcingModuleTerminates(t *testing.T) {
+	root := writeModuleTree(t, map[string]string{
+		"main.tf": `module "net" {
+  source = "./net"
+}
+`,
+		"net/main.tf": `module "again" {
+  source = "../net"
+}
+resource "aws_vpc" "main" {
+  cidr_block = "10.0.0.0/16"
+}
+`,
+	})
+	var cfgs []ResourceConfig
+	logged := captureLog(t, func() {
+		var err error
+		cfgs, err = BuildResourceConfigs(root)
+		if err != nil {
+			t.Fatalf("BuildResourceConfigs: %v", err)
+		}
+	})
+	if len(cfgs) != 1 || cfgs[0].Type != "aws_vpc" {
+		t.Fatalf("unexpected resources %+v", cfgs)
+	}
+	if !strings.Contains(logged, "[warn] module cycle at module.net.module.again") {
+		t.Fatalf("expected cycle warning, got %q", logged)
+	}
+
+	logged = captureLog(t, func() {
+		idx, _ := BuildSymbolIndex(root)
+		if got := idx.Resource["aws_vpc"]; len(got) != 1 {
+			t.Fatalf("index resources: %v", got)
+		}
+	})
+	if !strings.Contains(logged, "[warn] module cycle") {
+		t.Fatalf("expected cycle warning from indexer, got %q", logged)
+	}
+}
+
+func TestModuleWalkers_DepthLimit(t *testing.T) {
+	root := writeModuleTree(t, map[string]string{
+		"main.tf":     "module \"a\" {\n  source = \"./a\"\n}\n",
+		"a/main.tf":   "module \"b\" {\n  source = \"./b\"\n}\nresource \"null_resource\" \"a\" {}\n",
+		"a/b/main.tf": "resource \"null_resource\" \"b\" {}\n",
+	})
+	SetMaxModuleDepth(1)
+	defer SetMaxModuleDepth(0)
+	var cfgs []ResourceConfig
+	logged := captureLog(t, func() {
+		var err error
+		cfgs, err = BuildResourceConfigs(root)
+		if err != nil {
+			t.Fatalf("BuildResourceConfigs: %v", err)
+		}
+	})
+	if len(cfgs) != 1 || cfgs[0].Name != "a" {
+		t.Fatalf("expected only module.a resources, got %+v", cfgs)
+	}
+	if !strings.Contains(logged, "[warn] module nesting deeper than 1 at module.a.module.b") {
+		t.Fatalf("expected depth warning, got %q", logged)
+	}
+}
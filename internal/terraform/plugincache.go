@@ -0,0 +1,88 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	cty "github.com/zclconf/go-cty/cty"
+)
+
+// pluginCacheEnvVar points terraform at a directory of downloaded providers it
+// links into each .terraform instead of downloading them again.
+const pluginCacheEnvVar = "TF_PLUGIN_CACHE_DIR"
+
+// PluginCacheDir returns the provider plugin cache terraform invocations use:
+// the one the user configured through TF_PLUGIN_CACHE_DIR or plugin_cache_dir
+// in the CLI configuration, else ~/.terraflow/plugin-cache, shared by every
+// scratch directory and project. It is empty when no cache can be used.
+func PluginCacheDir() string {
+	dir, _ := pluginCache()
+	return dir
+}
+
+// pluginCache resolves the plugin cache; managed reports that terraflow chose
+// it and must pass it to terraform.
+func pluginCache() (dir string, managed bool) {
+	if dir := strings.TrimSpace(os.Getenv(pluginCacheEnvVar)); dir != "" {
+		return dir, false
+	}
+	if dir := cliConfigPluginCacheDir(); dir != "" {
+		return dir, false
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(home, ".terraflow", "plugin-cache"), true
+}
+
+// cliConfigPluginCacheDir returns plugin_cache_dir from the terraform CLI
+// configuration file, which TF_CLI_CONFIG_FILE names and defaults to
+// ~/.terraformrc (%APPDATA%\terraform.rc on Windows).
+func cliConfigPluginCacheDir() string {
+	path := strings.TrimSpace(os.Getenv("TF_CLI_CONFIG_FILE"))
+	if path == "" {
+		if runtime.GOOS == "windows" {
+			path = filepath.Join(os.Getenv("APPDATA"), "terraform.rc")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".terraformrc")
+		}
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	f, diags := hclsyntax.ParseConfig(src, path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return ""
+	}
+	attr, ok := f.Body.(*hclsyntax.Body).Attributes["plugin_cache_dir"]
+	if !ok {
+		return ""
+	}
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || !v.IsKnown() || v.IsNull() || v.Type() != cty.String {
+		return ""
+	}
+	return os.ExpandEnv(v.AsString())
+}
+
+// terraformEnv returns the environment for terraform commands terraflow runs:
+// its own, plus the plugin cache unless the user configured one. The cache is
+// created first, as terraform ignores a cache directory that does not exist.
+func terraformEnv() []string {
+	env := os.Environ()
+	dir, managed := pluginCache()
+	if !managed {
+		return env
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		debugf("plugin cache: %v", err)
+		return env
+	}
+	return append(env, pluginCacheEnvVar+"="+dir)
+}
@@ -0,0 +1,130 @@
+package terraform
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxTerraformProcsEnv overrides how many one-shot terraform console
+// processes may run at once.
+const maxTerraformProcsEnv = "TERRAFLOW_MAX_TF_PROCS"
+
+// terraformProcs bounds the one-shot terraform console processes started by
+// ConsoleSession.Evaluate across scanners and targeted patch workers. The
+// persistent evaluator is a single long-lived process and does not take a slot.
+var terraformProcs = make(chan struct{}, maxTerraformProcs())
+
+// maxTerraformProcs returns the limit from TERRAFLOW_MAX_TF_PROCS, or the
+// number of CPUs (at least 2) when it is unset or not a positive integer.
+func maxTerraformProcs() int {
+	def := max(runtime.NumCPU(), 2)
+	v := strings.TrimSpace(os.Getenv(maxTerraformProcsEnv))
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return def
+	}
+	return n
+}
+
+// warnInvalidMaxTerraformProcs logs, once, that TERRAFLOW_MAX_TF_PROCS was
+// ignored. It runs when the limit is first used rather than when the package
+// initializes, so the logger set up for -quiet is already in place.
+var warnInvalidMaxTerraformProcs = sync.OnceFunc(func() {
+	v := strings.TrimSpace(os.Getenv(maxTerraformProcsEnv))
+	if n, err := strconv.Atoi(v); v != "" && (err != nil || n < 1) {
+		currentLogger().Printf("[warn] %s=%q is not a positive integer; using %d\n", maxTerraformProcsEnv, v, cap(terraformProcs))
+	}
+})
+
+// MaxTerraformProcs returns how many one-shot terraform console processes may
+// run at once.
+func MaxTerraformProcs() int {
+	warnInvalidMaxTerraformProcs()
+	return cap(terraformProcs)
+}
+
+// acquireTerraformProc waits for a free process slot. It returns the function
+// releasing the slot, or ctx's error when ctx ends first.
+func acquireTerraformProc(ctx context.Context) (func(), error) {
+	warnInvalidMaxTerraformProcs()
+	select {
+	case terraformProcs <- struct{}{}:
+		return func() { <-terraformProcs }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// parallelismEnv sets how many files or modules the configuration scans
+// process at once when -parallelism is not given.
+const parallelismEnv = "TERRAFLOW_PARALLELISM"
+
+// defaultParallelism is the number of scan workers when none is configured,
+// capped at the number of CPUs.
+const defaultParallelism = 3
+
+var (
+	parallelismMu sync.RWMutex
+	parallelism   int // set by SetParallelism; 0 falls back to the environment
+)
+
+// SetParallelism sets the number of workers of the configuration scans for
+// the rest of the process. Values below 1 restore TERRAFLOW_PARALLELISM or
+// the default.
+func SetParallelism(n int) {
+	parallelismMu.Lock()
+	parallelism = max(n, 0)
+	parallelismMu.Unlock()
+}
+
+// Parallelism returns the number of scan workers in effect: the value given to
+// SetParallelism, TERRAFLOW_PARALLELISM or the default.
+func Parallelism() int {
+	return currentParallelism()
+}
+
+// currentParallelism returns the configured number of scan workers.
+func currentParallelism() int {
+	parallelismMu.RLock()
+	n := parallelism
+	parallelismMu.RUnlock()
+	if n > 0 {
+		return n
+	}
+	if v := strings.TrimSpace(os.Getenv(parallelismEnv)); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+		currentLogger().Printf("[warn] %s=%q is not a positive integer; using the default\n", parallelismEnv, v)
+	}
+	return min(defaultParallelism, max(runtime.NumCPU(), 1))
+}
+
+// forEachParallel calls fn with every index below n on at most
+// currentParallelism() goroutines and waits for them to finish.
+func forEachParallel(n int, fn func(i int)) {
+	workers := min(currentParallelism(), n)
+	next := make(chan int, n)
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
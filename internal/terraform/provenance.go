@@ -0,0 +1,114 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Sources a synthesized attribute value can come from.
+const (
+	provenanceLiteral    = "literal"
+	provenanceInProcess  = "in-process"
+	provenancePersistent = "persistent"
+	provenanceSubprocess = "subprocess"
+)
+
+// stateProvenanceFileName is written next to the synthesized state.
+const stateProvenanceFileName = "state-provenance.json"
+
+// recordProvenance makes full state synthesis write state-provenance.json.
+var recordProvenance bool
+
+// EnableStateProvenance makes every full synthesis of the state (at startup and
+// on :reset-state) also write state-provenance.json next to it, recording where
+// each attribute value came from. Attributes patched on refresh are not
+// recorded.
+func EnableStateProvenance() {
+	recordProvenance = true
+}
+
+// AttrProvenance records how a synthesized attribute value was obtained.
+type AttrProvenance struct {
+	Source     string `json:"source"`
+	Expression string `json:"expression"`
+}
+
+// attrProvenance returns the provenance of the literal attributes, whose source
+// is in litSrc, and of the attributes of exprs found in sources, which maps each
+// evaluated attribute to the evaluator that produced it. It returns nil unless
+// provenance is being recorded.
+func attrProvenance(litSrc, exprs, sources map[string]string) map[string]AttrProvenance {
+	if !recordProvenance {
+		return nil
+	}
+	out := make(map[string]AttrProvenance, len(litSrc)+len(exprs))
+	for k, src := range litSrc {
+		out[k] = AttrProvenance{Source: provenanceLiteral, Expression: src}
+	}
+	for k, expr := range exprs {
+		if source, ok := sources[k]; ok {
+			out[k] = AttrProvenance{Source: source, Expression: expr}
+		}
+	}
+	return out
+}
+
+// attrSources maps each attribute of m to source.
+func attrSources(m map[string]any, source string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k := range m {
+		out[k] = source
+	}
+	return out
+}
+
+// instanceAttrSources maps each attribute evaluated for any instance of insts
+// to source.
+func instanceAttrSources(insts map[string]any, source string) map[string]string {
+	out := map[string]string{}
+	for _, v := range insts {
+		if m, ok := v.(map[string]any); ok {
+			for k := range m {
+				out[k] = source
+			}
+		}
+	}
+	return out
+}
+
+// writeStateProvenance writes the provenance of the attributes of cfgs to
+// state-provenance.json in the directory of statePath.
+func writeStateProvenance(statePath string, cfgs []ResourceConfig) error {
+	type resourceProvenance struct {
+		Address    string                    `json:"address"`
+		Attributes map[string]AttrProvenance `json:"attributes"`
+	}
+	out := struct {
+		Resources []resourceProvenance `json:"resources"`
+	}{Resources: []resourceProvenance{}}
+	for _, rc := range cfgs {
+		if rc.Provenance == nil {
+			continue
+		}
+		addr := batchAddr(rc.mode(), rc.Type, rc.Name)
+		if mod := rc.moduleAddress(); mod != "" {
+			addr = mod + "." + addr
+		}
+		out.Resources = append(out.Resources, resourceProvenance{Address: addr, Attributes: rc.Provenance})
+	}
+	sort.Slice(out.Resources, func(i, j int) bool { return out.Resources[i].Address < out.Resources[j].Address })
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(filepath.Dir(statePath), stateProvenanceFileName)
+	tmp := path + ".tmp-" + fmt.Sprint(time.Now().UnixNano())
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
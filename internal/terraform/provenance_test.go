@@ -0,0 +1,61 @@
+package terraform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPatchStateEvaluatedFast_WritesProvenance(t *testing.T) {
+	recordProvenance = true
+	defer func() { recordProvenance = false }()
+
+	root := t.TempDir()
+	cfg := "variable \"env\" {\n  default = \"dev\"\n}\n\nresource \"aws_s3_bucket\" \"b\" {\n  acl    = \"private\"\n  bucket = \"${var.env}-logs\"\n}\n"
+	if err := os.WriteFile(filepath.Join(root, "main.tf"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(root, ".terraflow", "terraform.tfstate")
+	if err := PatchStateFromConfigEvaluatedFast(root, root, statePath, nil); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(root, ".terraflow", stateProvenanceFileName))
+	if err != nil {
+		t.Fatalf("read provenance: %v", err)
+	}
+	var got struct {
+		Resources []struct {
+			Address    string                    `json:"address"`
+			Attributes map[string]AttrProvenance `json:"attributes"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Resources) != 1 || got.Resources[0].Address != "aws_s3_bucket.b" {
+		t.Fatalf("unexpected resources %+v", got.Resources)
+	}
+	want := map[string]AttrProvenance{
+		"acl":    {Source: provenanceLiteral, Expression: `"private"`},
+		"bucket": {Source: provenanceInProcess, Expression: `"${var.env}-logs"`},
+	}
+	if !reflect.DeepEqual(got.Resources[0].Attributes, want) {
+		t.Fatalf("got %+v, want %+v", got.Resources[0].Attributes, want)
+	}
+}
+
+func TestPatchStateEvaluatedFast_NoProvenanceByDefault(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.tf"), []byte("resource \"null_resource\" \"a\" {\n  triggers = { k = \"v\" }\n}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(root, ".terraflow", "terraform.tfstate")
+	if err := PatchStateFromConfigEvaluatedFast(root, root, statePath, nil); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".terraflow", stateProvenanceFileName)); !os.IsNotExist(err) {
+		t.Fatalf("provenance written without recording enabled: %v", err)
+	}
+}
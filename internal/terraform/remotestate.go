@@ -0,0 +1,304 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flowave-io/terraflow/internal/encoding/jsonx"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// PullRemoteStateBackendOnly pulls the state of the configuration in workDir
+// without installing its providers or modules. Only the backend (or cloud)
+// block is copied into a throwaway directory, initialized with
+// `-backend=true -get=false` and used for `terraform state pull`.
+func PullRemoteStateBackendOnly(workDir string, backendConfigs []string) ([]byte, error) {
+	block, err := extractBackendBlock(workDir)
+	if err != nil {
+		return nil, err
+	}
+	return pullStateWithBackend(block, absBackendConfigs(workDir, backendConfigs), "")
+}
+
+// pullStateWithBackend initializes the configuration block, holding only a
+// backend, in a throwaway directory and pulls the state of workspace from it
+// (the selected workspace when empty).
+func pullStateWithBackend(block []byte, backendConfigs []string, workspace string) ([]byte, error) {
+	tmp, err := os.MkdirTemp("", "terraflow-backend-")
+	if err != nil {
+		return nil, fmt.Errorf("create backend dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+	if err := os.WriteFile(filepath.Join(tmp, "backend.tf"), block, 0o600); err != nil {
+		return nil, fmt.Errorf("write backend config: %w", err)
+	}
+	env := scratchEnv(terraformEnv())
+	if workspace != "" {
+		env = append(env, "TF_WORKSPACE="+workspace)
+	}
+
+	initCmd := exec.Command("terraform", backendInitArgs(backendConfigs, true)...)
+	initCmd.Dir = tmp
+	initCmd.Env = env
+	if err := runTerraformCommand(initCmd); err != nil {
+		return nil, fmt.Errorf("terraform init (backend only): %w", err)
+	}
+	var out bytes.Buffer
+	pullCmd := exec.Command("terraform", "state", "pull", "-no-color")
+	pullCmd.Dir = tmp
+	pullCmd.Env = env
+	pullCmd.Stdout = &out
+	if err := runTerraformCommand(pullCmd); err != nil {
+		return nil, fmt.Errorf("terraform state pull: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// extractBackendBlock returns a minimal configuration holding only the
+// backend or cloud block found in a terraform block of workDir.
+func extractBackendBlock(workDir string) ([]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(workDir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		src, err := readConfigFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", p, err)
+		}
+		f, diags := hclsyntax.ParseConfig(src, p, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			continue
+		}
+		body, ok := f.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, b := range body.Blocks {
+			if b.Type != "terraform" {
+				continue
+			}
+			for _, inner := range b.Body.Blocks {
+				if inner.Type != "backend" && inner.Type != "cloud" {
+					continue
+				}
+				rng := inner.Range()
+				return []byte("terraform {\n" + string(src[rng.Start.Byte:rng.End.Byte]) + "\n}\n"), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no backend block found under %s", workDir)
+}
+
+// absBackendConfigs resolves relative -backend-config file paths against
+// workDir so they still apply when init runs elsewhere. key=value pairs are
+// passed through unchanged.
+func absBackendConfigs(workDir string, backendConfigs []string) []string {
+	out := make([]string, 0, len(backendConfigs))
+	for _, bc := range backendConfigs {
+		bc = strings.TrimSpace(bc)
+		if bc != "" && !strings.Contains(bc, "=") && !filepath.IsAbs(bc) {
+			bc = filepath.Join(workDir, bc)
+		}
+		out = append(out, bc)
+	}
+	return out
+}
+
+// remoteStateTTL is how long the outputs of a terraform_remote_state data
+// source read through a backend other than local are reused before they are
+// pulled again. Local state files are reread whenever they change.
+const remoteStateTTL = 5 * time.Minute
+
+type remoteStateEntry struct {
+	outputs map[string]any
+	err     error
+	stamp   string    // size and modification time of a local state file
+	fetched time.Time // when a remote state was pulled
+}
+
+var (
+	remoteStateMu    sync.Mutex
+	remoteStateCache = map[string]remoteStateEntry{}
+	// remoteStateWarned remembers the data sources warned about, by address
+	// and error, so each failure is reported once
+	remoteStateWarned sync.Map
+)
+
+// resolveRemoteStates sets the outputs attribute of terraform_remote_state
+// data sources in cfgs to the outputs of the state they read, so references
+// like data.terraform_remote_state.net.outputs.vpc_id resolve. The local and
+// s3 backends are supported; relative local paths are taken from the
+// configuration directory, the parent of a .terraflow scratch directory.
+func resolveRemoteStates(rootDir string, cfgs []ResourceConfig) {
+	base, _ := filepath.Abs(rootDir)
+	if filepath.Base(base) == ".terraflow" {
+		base = filepath.Dir(base)
+	}
+	for i := range cfgs {
+		rc := cfgs[i]
+		if rc.mode() != "data" || rc.Type != "terraform_remote_state" {
+			continue
+		}
+		addr := batchAddr("data", rc.Type, rc.Name)
+		if mod := rc.moduleAddress(); mod != "" {
+			addr = mod + "." + addr
+		}
+		apply := func(attrs map[string]any) {
+			if attrs == nil {
+				return
+			}
+			outputs, err := remoteStateOutputs(base, attrs)
+			if err != nil {
+				if _, warned := remoteStateWarned.LoadOrStore(addr+"|"+err.Error(), true); !warned {
+					currentLogger().Printf("[warn] %s: %v; its outputs are unavailable\n", addr, err)
+				}
+				return
+			}
+			attrs["outputs"] = outputs
+		}
+		apply(rc.Attrs)
+		for _, attrs := range rc.Instances {
+			apply(attrs)
+		}
+	}
+}
+
+// remoteStateOutputs returns the outputs a terraform_remote_state data source
+// with the given attributes reads, over its defaults.
+func remoteStateOutputs(baseDir string, attrs map[string]any) (map[string]any, error) {
+	backend, _ := attrs["backend"].(string)
+	// config is absent both when omitted and when it could not be evaluated;
+	// the latter must not fall back to the default local path
+	config, ok := attrs["config"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("config is not known")
+	}
+	workspace, _ := attrs["workspace"].(string)
+	if workspace == "default" {
+		workspace = ""
+	}
+	var entry remoteStateEntry
+	switch backend {
+	case "local":
+		entry = localRemoteState(baseDir, config, workspace)
+	case "s3":
+		entry = pulledRemoteState(backend, config, workspace)
+	case "":
+		return nil, fmt.Errorf("backend is not known")
+	default:
+		return nil, fmt.Errorf("the %s backend is not supported; only local and s3 are", backend)
+	}
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	out := map[string]any{}
+	if defaults, ok := attrs["defaults"].(map[string]any); ok {
+		for k, v := range defaults {
+			out[k] = v
+		}
+	}
+	for k, v := range entry.outputs {
+		out[k] = v
+	}
+	return out, nil
+}
+
+// localRemoteState reads the outputs of a state file of the local backend.
+func localRemoteState(baseDir string, config map[string]any, workspace string) remoteStateEntry {
+	path, _ := config["path"].(string)
+	if path == "" {
+		path = "terraform.tfstate"
+	}
+	if workspace != "" {
+		dir, _ := config["workspace_dir"].(string)
+		if dir == "" {
+			dir = "terraform.tfstate.d"
+		}
+		path = filepath.Join(dir, workspace, "terraform.tfstate")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return remoteStateEntry{err: fmt.Errorf("read state: %w", err)}
+	}
+	key := "local|" + path
+	stamp := fmt.Sprintf("%d|%d", fi.Size(), fi.ModTime().UnixNano())
+	remoteStateMu.Lock()
+	cached, ok := remoteStateCache[key]
+	remoteStateMu.Unlock()
+	if ok && cached.stamp == stamp {
+		return cached
+	}
+	entry := remoteStateEntry{stamp: stamp}
+	if b, err := os.ReadFile(path); err != nil {
+		entry.err = fmt.Errorf("read state: %w", err)
+	} else {
+		entry.outputs, entry.err = stateOutputs(b)
+	}
+	remoteStateMu.Lock()
+	remoteStateCache[key] = entry
+	remoteStateMu.Unlock()
+	return entry
+}
+
+// pulledRemoteState pulls the state of a remote backend through a throwaway
+// terraform init, reusing the result for remoteStateTTL.
+func pulledRemoteState(backend string, config map[string]any, workspace string) remoteStateEntry {
+	names := make([]string, 0, len(config))
+	for k := range config {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("terraform {\n  backend " + hclString(backend) + " {\n")
+	for _, k := range names {
+		b.WriteString("    " + k + " = " + hclLiteral(config[k]) + "\n")
+	}
+	b.WriteString("  }\n}\n")
+	block := b.String()
+	key := backend + "|" + workspace + "|" + block
+	remoteStateMu.Lock()
+	cached, ok := remoteStateCache[key]
+	remoteStateMu.Unlock()
+	if ok && time.Since(cached.fetched) < remoteStateTTL {
+		return cached
+	}
+	entry := remoteStateEntry{fetched: time.Now()}
+	if out, err := pullStateWithBackend([]byte(block), nil, workspace); err != nil {
+		entry.err = err
+	} else {
+		entry.outputs, entry.err = stateOutputs(out)
+	}
+	remoteStateMu.Lock()
+	remoteStateCache[key] = entry
+	remoteStateMu.Unlock()
+	return entry
+}
+
+// stateOutputs returns the root module output values of a state document.
+func stateOutputs(b []byte) (map[string]any, error) {
+	var st struct {
+		Outputs map[string]struct {
+			Value any `json:"value"`
+		} `json:"outputs"`
+	}
+	if err := jsonx.Unmarshal(b, &st); err != nil {
+		return nil, fmt.Errorf("parse state: %w", err)
+	}
+	out := make(map[string]any, len(st.Outputs))
+	for k, o := range st.Outputs {
+		out[k] = o.Value
+	}
+	return out, nil
+}
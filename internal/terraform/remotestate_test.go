@@ -0,0 +1,47 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPatchStateEvaluatedFast_ResolvesLocalRemoteState(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	root := t.TempDir()
+	if err := os.CopyFS(root, os.DirFS(filepath.Join(repoRoot(t), "test", "fixtures", "remote_state"))); err != nil {
+		t.Fatal(err)
+	}
+	// The console evaluates in a .terraflow copy of the configuration; the
+	// state path stays relative to the configuration itself
+	scratch := filepath.Join(root, ".terraflow")
+	if _, _, err := SyncToScratch(root, scratch); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(scratch, "terraform.tfstate")
+	if err := PatchStateFromConfigEvaluatedFast(scratch, scratch, statePath, nil); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	cases := map[string]any{
+		`data.terraform_remote_state.network.outputs.vpc_id`:        "vpc-0a1b2c3d",
+		`data.terraform_remote_state.network.outputs.subnet_ids[1]`: "subnet-b",
+		`data.terraform_remote_state.network.outputs.region`:        "eu-west-1",
+	}
+	for expr, want := range cases {
+		got, ok := TryEvalInProcessWithState(scratch, statePath, nil, expr, time.Second)
+		if !ok || got != want {
+			t.Errorf("%s: got %#v (ok=%v), want %#v", expr, got, ok, want)
+		}
+	}
+}
+
+func TestRemoteStateOutputs_UnsupportedBackend(t *testing.T) {
+	_, err := remoteStateOutputs(t.TempDir(), map[string]any{"backend": "consul", "config": map[string]any{}})
+	if err == nil {
+		t.Fatal("expected an error for an unsupported backend")
+	}
+	if _, err := remoteStateOutputs(t.TempDir(), map[string]any{"backend": "local"}); err == nil {
+		t.Fatal("expected an error without a known config")
+	}
+}
@@ -0,0 +1,136 @@
+package terraform
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// SchemaAttribute is an attribute or nested block of a resource or data source
+// schema, as reported by `terraform providers schema -json`.
+type SchemaAttribute struct {
+	Name        string
+	Type        string // type constraint such as "list(string)", or "block" for nested blocks
+	Required    bool
+	Optional    bool
+	Computed    bool
+	Description string
+}
+
+// schemaBlock is the subset of a provider schema block terraflow reads.
+// Entries are decoded one at a time so a malformed one does not hide the
+// names of the others.
+type schemaBlock struct {
+	Attributes map[string]json.RawMessage `json:"attributes"`
+	BlockTypes map[string]json.RawMessage `json:"block_types"`
+}
+
+type schemaAttr struct {
+	Type        json.RawMessage `json:"type"`
+	NestedType  *schemaNested   `json:"nested_type"`
+	Required    bool            `json:"required"`
+	Optional    bool            `json:"optional"`
+	Computed    bool            `json:"computed"`
+	Description string          `json:"description"`
+}
+
+type schemaBlockType struct {
+	NestingMode string `json:"nesting_mode"`
+	MinItems    int    `json:"min_items"`
+	Block       struct {
+		Description string `json:"description"`
+	} `json:"block"`
+}
+
+// schemaNested describes an attribute with nested attributes (protocol 6).
+type schemaNested struct {
+	NestingMode string `json:"nesting_mode"`
+}
+
+// attributes flattens b into SchemaAttributes: required first, then optional,
+// then computed-only, each sorted by name.
+func (b schemaBlock) attributes() []SchemaAttribute {
+	out := make([]SchemaAttribute, 0, len(b.Attributes)+len(b.BlockTypes))
+	for name, raw := range b.Attributes {
+		var a schemaAttr
+		if json.Unmarshal(raw, &a) != nil {
+			continue
+		}
+		out = append(out, SchemaAttribute{
+			Name:        name,
+			Type:        schemaTypeString(a.Type, a.NestedType),
+			Required:    a.Required,
+			Optional:    a.Optional,
+			Computed:    a.Computed,
+			Description: a.Description,
+		})
+	}
+	for name, raw := range b.BlockTypes {
+		var bt schemaBlockType
+		if json.Unmarshal(raw, &bt) != nil {
+			continue
+		}
+		typ := "block"
+		if bt.NestingMode != "" && bt.NestingMode != "single" {
+			typ += " " + bt.NestingMode
+		}
+		out = append(out, SchemaAttribute{
+			Name:        name,
+			Type:        typ,
+			Required:    bt.MinItems > 0,
+			Optional:    bt.MinItems == 0,
+			Description: bt.Block.Description,
+		})
+	}
+	rank := func(a SchemaAttribute) int {
+		switch {
+		case a.Required:
+			return 0
+		case a.Optional:
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if ri, rj := rank(out[i]), rank(out[j]); ri != rj {
+			return ri < rj
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Usage describes how an attribute is set: "required", "optional",
+// "optional, computed" or "computed".
+func (a SchemaAttribute) Usage() string {
+	switch {
+	case a.Required:
+		return "required"
+	case a.Optional && a.Computed:
+		return "optional, computed"
+	case a.Optional:
+		return "optional"
+	}
+	return "computed"
+}
+
+// schemaTypeString renders a JSON-encoded cty type the way it is written in
+// configuration. Nested attribute types are shown by their nesting mode.
+func schemaTypeString(raw json.RawMessage, nested *schemaNested) string {
+	if nested != nil {
+		if nested.NestingMode == "" || nested.NestingMode == "single" {
+			return "object"
+		}
+		return nested.NestingMode + "(object)"
+	}
+	if len(raw) == 0 {
+		return ""
+	}
+	ty, err := ctyjson.UnmarshalType(raw)
+	if err != nil {
+		return ""
+	}
+	return typeexpr.TypeString(ty)
+}
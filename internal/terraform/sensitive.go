@@ -0,0 +1,127 @@
+package terraform
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	cty "github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// sensitiveMark is the cty mark Terraform attaches to sensitive values. It
+// propagates through operators and function calls on its own.
+const sensitiveMark = "sensitive"
+
+// SensitiveRedacted is shown instead of a sensitive value, matching terraform console.
+const SensitiveRedacted = "(sensitive value)"
+
+// Sensitive holds a value derived from a sensitive one so it prints redacted.
+// State patching unwraps it, keeping the actual data as Terraform's state does.
+type Sensitive struct {
+	Value any
+}
+
+// String returns the redacted placeholder.
+func (s Sensitive) String() string { return SensitiveRedacted }
+
+// Redacted returns v with every Sensitive value replaced by SensitiveRedacted,
+// for printing a value from EvalJSON as JSON.
+func Redacted(v any) any {
+	switch t := v.(type) {
+	case Sensitive:
+		return SensitiveRedacted
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = Redacted(e)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, e := range t {
+			out[k] = Redacted(e)
+		}
+		return out
+	}
+	return v
+}
+
+var sensitiveFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{
+		Name:             "value",
+		Type:             cty.DynamicPseudoType,
+		AllowUnknown:     true,
+		AllowNull:        true,
+		AllowMarked:      true,
+		AllowDynamicType: true,
+	}},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		return args[0].Type(), nil
+	},
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		return args[0].Mark(sensitiveMark), nil
+	},
+})
+
+// nonsensitiveFunc removes the sensitive mark from the top level of its argument;
+// sensitive values nested inside a collection keep their marks, as in Terraform.
+var nonsensitiveFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{
+		Name:             "value",
+		Type:             cty.DynamicPseudoType,
+		AllowUnknown:     true,
+		AllowNull:        true,
+		AllowMarked:      true,
+		AllowDynamicType: true,
+	}},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		return args[0].Type(), nil
+	},
+	Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+		v, marks := args[0].Unmark()
+		delete(marks, sensitiveMark)
+		return v.WithMarks(marks), nil
+	},
+})
+
+// RevealJSON evaluates expr like EvalJSON but with every sensitive mark
+// removed, for the console's explicit :reveal. Nothing is cached or logged.
+// Terraform is asked for nonsensitive(jsonencode(expr)) when the in-process
+// evaluator cannot answer, since jsonencode marks its whole result sensitive
+// when any part of the value is.
+func RevealJSON(workDir, statePath string, varFiles []string, expr string, timeout time.Duration) (any, error) {
+	e := strings.TrimSpace(expr)
+	if e == "" {
+		return nil, errors.New("no expression to reveal")
+	}
+	if !impureSource(e) {
+		v, diags := evalInProcessDiags(workDir, varFiles, stateResourceValues(statePath), e)
+		if !diags.HasErrors() {
+			unmarked, _ := v.UnmarkDeep()
+			if goV, ok := convertCtyToGo(unmarked); ok {
+				return goV, nil
+			}
+		}
+	}
+	s := StartConsoleSession(workDir, statePath, varFiles)
+	line := "jsonencode(" + singleLineExpr(e) + ")"
+	stdout, stderr, err := s.Evaluate(line, timeout)
+	if err == nil && strings.TrimSpace(stdout) == SensitiveRedacted {
+		// Older Terraform rejects nonsensitive() of a value that is not
+		// sensitive, so it is only added when needed
+		stdout, stderr, err = s.Evaluate("nonsensitive("+line+")", timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return nil, errors.New(msg)
+	}
+	var v any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(stdout)), &v); err != nil {
+		return nil, errors.New("terraform console returned no value")
+	}
+	return v, nil
+}
@@ -0,0 +1,54 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// evalSnapshotPrefix starts the names of the state copies evaluations read
+// instead of the live state: one per one-shot console and
+// .tfstate-eval-snapshot.json for the persistent one.
+const evalSnapshotPrefix = ".tfstate-eval-"
+
+// staleEvalSnapshotAge is how old a snapshot must be before startup removes
+// it. Younger ones may belong to another terraflow process on the project.
+const staleEvalSnapshotAge = time.Hour
+
+// evalSnapshotDir returns the directory holding the evaluation snapshots of
+// the state at statePath, .terraflow/tmp for the console state, creating it.
+// Keeping them apart from the state means they are not taken for Terraform's
+// own state or backup files.
+func evalSnapshotDir(statePath string) (string, error) {
+	dir := filepath.Join(filepath.Dir(statePath), "tmp")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// RemoveStaleEvalSnapshots deletes evaluation snapshots older than an hour
+// from scratchDir and its tmp directory. They are normally removed after use,
+// but remain when terraflow is killed. Snapshots directly in scratchDir were
+// written by earlier versions.
+func RemoveStaleEvalSnapshots(scratchDir string) {
+	cutoff := time.Now().Add(-staleEvalSnapshotAge)
+	for _, dir := range []string{scratchDir, filepath.Join(scratchDir, "tmp")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasPrefix(e.Name(), evalSnapshotPrefix) {
+				continue
+			}
+			if fi, err := e.Info(); err != nil || fi.ModTime().After(cutoff) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, e.Name())); err == nil {
+				debugf("removed stale evaluation snapshot %s", filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+}
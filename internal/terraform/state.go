@@ -1,15 +1,18 @@
 package terraform
 
 import (
-	"encoding/json"
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/flowave-io/terraflow/internal/encoding/jsonx"
 	"github.com/google/uuid"
 )
 
@@ -17,6 +20,57 @@ import (
 // This is intentionally minimal; unknown fields are ignored by json package.
 // legacy struct types retained earlier are no longer used; operate on raw JSON
 
+var (
+	reproducibleMu sync.RWMutex
+	reproducible   bool
+)
+
+// SetReproducibleState makes synthesized state deterministic for the rest of
+// the process: a new state file gets a lineage derived from its directory
+// instead of a random one, and writes keep its serial, so the same
+// configuration yields byte-identical state. Evaluators still pick up each
+// write, as every write refreshes their snapshots.
+func SetReproducibleState(on bool) {
+	reproducibleMu.Lock()
+	reproducible = on
+	reproducibleMu.Unlock()
+}
+
+// ReproducibleState reports whether SetReproducibleState turned it on.
+func ReproducibleState() bool {
+	reproducibleMu.RLock()
+	defer reproducibleMu.RUnlock()
+	return reproducible
+}
+
+// newLineage returns the lineage of a state file created at statePath: random,
+// or in reproducible mode a UUID derived from the absolute directory.
+func newLineage(statePath string) string {
+	if !ReproducibleState() {
+		return uuid.NewString()
+	}
+	abs, _ := filepath.Abs(filepath.Dir(statePath))
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("terraflow:"+filepath.ToSlash(abs))).String()
+}
+
+// bumpSerial increments the serial of st as Terraform does on every write. In
+// reproducible mode it only repairs a missing or invalid serial.
+func bumpSerial(st map[string]any) {
+	n := 0
+	switch s := st["serial"].(type) {
+	case float64:
+		n = int(s)
+	case int:
+		n = s
+	}
+	switch {
+	case n <= 0:
+		st["serial"] = 1
+	case !ReproducibleState():
+		st["serial"] = n + 1
+	}
+}
+
 // EnsureStateInitialized creates a minimal local state file if it does not exist.
 // The directory is created with 0700 and the state file with 0600 permissions.
 func EnsureStateInitialized(statePath string) error {
@@ -32,15 +86,45 @@ func EnsureStateInitialized(statePath string) error {
 	st := map[string]any{
 		"version":   4,
 		"serial":    1,
-		"lineage":   uuid.NewString(),
+		"lineage":   newLineage(statePath),
 		"outputs":   map[string]any{},
 		"resources": []any{},
 	}
 	return writeStateAtomicRaw(statePath, st)
 }
 
+// ResetState discards all resources and outputs from the state at statePath while
+// keeping its lineage, then re-hydrates it from configuration under rootDir so the
+// result reflects exactly what is currently configured. A state file that cannot be
+// parsed is replaced with a freshly initialized one.
+func ResetState(rootDir, workDir, statePath string, varFiles []string) error {
+	if strings.TrimSpace(statePath) == "" {
+		return errors.New("state path is empty")
+	}
+	if err := EnsureStateInitialized(statePath); err != nil {
+		return err
+	}
+	st, b, _, err := readStateCached(statePath)
+	if err != nil {
+		// Unreadable state: start over with a new lineage
+		if rmErr := os.Remove(statePath); rmErr != nil {
+			return fmt.Errorf("remove state: %w", rmErr)
+		}
+		if err := EnsureStateInitialized(statePath); err != nil {
+			return err
+		}
+	} else {
+		st["resources"] = []any{}
+		st["outputs"] = map[string]any{}
+		if err := writeStateBump(statePath, st, b); err != nil {
+			return err
+		}
+	}
+	return PatchStateFromConfigEvaluatedFast(rootDir, workDir, statePath, varFiles)
+}
+
 // PatchStateFromConfig scans Terraform configuration under rootDir and merges
-// discovered managed resources into the local state at statePath. Existing
+// discovered managed resources and data sources into the local state at statePath. Existing
 // resources have their attributes updated for keys present in configuration;
 // new resources are added with minimal instances containing literal attributes.
 func PatchStateFromConfig(rootDir, statePath string, varFiles []string) error {
@@ -68,6 +152,7 @@ func PatchStateFromConfig(rootDir, statePath string, varFiles []string) error {
 		// Non-fatal: still write back state to ensure file presence
 		return fmt.Errorf("scan config: %w", err)
 	}
+	resolveRemoteStates(rootDir, cfgs)
 	// Build index for quick lookup by module|type|name
 	type resRef struct {
 		idx int
@@ -79,23 +164,32 @@ func PatchStateFromConfig(rootDir, statePath string, varFiles []string) error {
 			rType, _ := m["type"].(string)
 			rName, _ := m["name"].(string)
 			mode, _ := m["mode"].(string)
-			if mode != "managed" {
+			if mode != "managed" && mode != "data" {
 				continue
 			}
 			mod, _ := m["module"].(string)
-			key := resourceKey(mod, rType, rName)
+			key := stateKey(mode, mod, rType, rName)
 			index[key] = resRef{idx: i, obj: m}
 		}
 	}
 
 	changed := false
 	for _, rc := range cfgs {
-		mod := modulePathToString(rc.ModulePath)
-		key := resourceKey(mod, rc.Type, rc.Name)
+		mod := rc.moduleAddress()
+		key := stateKey(rc.mode(), mod, rc.Type, rc.Name)
 		if ref, ok := index[key]; ok {
-			// Ensure provider is set for existing resources
-			if _, hasProv := ref.obj["provider"]; !hasProv {
-				ref.obj["provider"] = providerAddressForType(rc.Type)
+			// Ensure provider is set for existing resources; an explicit provider
+			// meta-argument decides the alias
+			if prov := providerAddressForResource(ref.obj["provider"], rc.Type, rc.Provider); prov != ref.obj["provider"] {
+				ref.obj["provider"] = prov
+				changed = true
+			}
+			if rc.Instances != nil {
+				if patchForEachInstances(ref.obj, rc.Instances) {
+					changed = true
+				}
+				resources[ref.idx] = ref.obj
+				continue
 			}
 			// Update all instances' attributes with keys from config
 			instRaw, _ := ref.obj["instances"].([]any)
@@ -140,17 +234,20 @@ func PatchStateFromConfig(rootDir, statePath string, varFiles []string) error {
 			resources[ref.idx] = ref.obj
 			continue
 		}
-		// Not found: add new minimal managed resource entry
+		// Not found: add new minimal resource entry
 		newRes := map[string]any{
-			"mode":     "managed",
+			"mode":     rc.mode(),
 			"type":     rc.Type,
 			"name":     rc.Name,
-			"provider": providerAddressForType(rc.Type),
+			"provider": providerAddress(rc.Type, rc.Provider),
 			"instances": []any{map[string]any{
 				"attributes":     sanitizeMap(rc.Attrs),
 				"schema_version": 0,
 			}},
 		}
+		if rc.Instances != nil {
+			patchForEachInstances(newRes, rc.Instances)
+		}
 		if mod != "" {
 			newRes["module"] = mod
 		}
@@ -159,6 +256,13 @@ func PatchStateFromConfig(rootDir, statePath string, varFiles []string) error {
 		changed = true
 	}
 
+	if pruned, ok := pruneRemovedResources(rootDir, statePath, resources, cfgs); ok {
+		resources = pruned
+		changed = true
+	}
+	if seedComputedAttributes(resources) {
+		changed = true
+	}
 	st["resources"] = resources
 
 	// If nothing changed, avoid bumping serial or rewriting the file
@@ -179,25 +283,10 @@ func PatchStateFromConfig(rootDir, statePath string, varFiles []string) error {
 	default:
 		st["version"] = 4
 	}
-	switch s := st["serial"].(type) {
-	case float64:
-		if s <= 0 {
-			st["serial"] = 1
-		} else {
-			st["serial"] = int(s) + 1
-		}
-	case int:
-		if s <= 0 {
-			st["serial"] = 1
-		} else {
-			st["serial"] = s + 1
-		}
-	default:
-		st["serial"] = 1
-	}
+	bumpSerial(st)
 
 	// Serialize once and skip write if identical to original bytes
-	newBytes, mErr := json.Marshal(st)
+	newBytes, mErr := jsonx.Marshal(st)
 	if mErr != nil {
 		return mErr
 	}
@@ -234,6 +323,9 @@ func PatchStateFromConfigLiterals(rootDir, statePath string) error {
 	if err != nil {
 		return fmt.Errorf("scan config: %w", err)
 	}
+	// Without evaluation, modules with count or for_each keep the instances
+	// the evaluated patch wrote
+	cfgs = expandResourceInstances(cfgs, stateModuleInstances(resources, resolveModuleInstances(rootDir, nil)))
 
 	// Build index for quick lookup by module|type|name
 	type resRef struct {
@@ -246,23 +338,25 @@ func PatchStateFromConfigLiterals(rootDir, statePath string) error {
 			rType, _ := m["type"].(string)
 			rName, _ := m["name"].(string)
 			mode, _ := m["mode"].(string)
-			if mode != "managed" {
+			if mode != "managed" && mode != "data" {
 				continue
 			}
 			mod, _ := m["module"].(string)
-			key := resourceKey(mod, rType, rName)
+			key := stateKey(mode, mod, rType, rName)
 			index[key] = resRef{idx: i, obj: m}
 		}
 	}
 
 	changed := false
 	for _, rc := range cfgs {
-		mod := modulePathToString(rc.ModulePath)
-		key := resourceKey(mod, rc.Type, rc.Name)
+		mod := rc.moduleAddress()
+		key := stateKey(rc.mode(), mod, rc.Type, rc.Name)
 		if ref, ok := index[key]; ok {
-			// Ensure provider is set for existing resources
-			if _, hasProv := ref.obj["provider"]; !hasProv {
-				ref.obj["provider"] = providerAddressForType(rc.Type)
+			// Ensure provider is set for existing resources; an explicit provider
+			// meta-argument decides the alias
+			if prov := providerAddressForResource(ref.obj["provider"], rc.Type, rc.Provider); prov != ref.obj["provider"] {
+				ref.obj["provider"] = prov
+				changed = true
 			}
 			instRaw, _ := ref.obj["instances"].([]any)
 			if instRaw == nil {
@@ -300,12 +394,12 @@ func PatchStateFromConfigLiterals(rootDir, statePath string) error {
 			resources[ref.idx] = ref.obj
 			continue
 		}
-		// Not found: add new minimal managed resource entry
+		// Not found: add new minimal resource entry
 		newRes := map[string]any{
-			"mode":     "managed",
+			"mode":     rc.mode(),
 			"type":     rc.Type,
 			"name":     rc.Name,
-			"provider": providerAddressForType(rc.Type),
+			"provider": providerAddress(rc.Type, rc.Provider),
 			"instances": []any{map[string]any{
 				"attributes":     sanitizeMap(rc.Attrs),
 				"schema_version": 0,
@@ -319,6 +413,13 @@ func PatchStateFromConfigLiterals(rootDir, statePath string) error {
 		changed = true
 	}
 
+	if pruned, ok := pruneRemovedResources(rootDir, statePath, resources, cfgs); ok {
+		resources = pruned
+		changed = true
+	}
+	if seedComputedAttributes(resources) {
+		changed = true
+	}
 	st["resources"] = resources
 	if !changed {
 		return nil
@@ -337,22 +438,7 @@ func PatchStateFromConfigLiterals(rootDir, statePath string) error {
 	default:
 		st["version"] = 4
 	}
-	switch s := st["serial"].(type) {
-	case float64:
-		if s <= 0 {
-			st["serial"] = 1
-		} else {
-			st["serial"] = int(s) + 1
-		}
-	case int:
-		if s <= 0 {
-			st["serial"] = 1
-		} else {
-			st["serial"] = s + 1
-		}
-	default:
-		st["serial"] = 1
-	}
+	bumpSerial(st)
 	return writeStateAtomicRaw(statePath, st)
 }
 
@@ -366,14 +452,11 @@ func PatchStateFromConfigEvaluatedFast(rootDir, workDir, statePath string, varFi
 	if err := EnsureStateInitialized(statePath); err != nil {
 		return err
 	}
-	b, err := os.ReadFile(statePath)
+	warnDuplicateAddresses(rootDir)
+	st, _, _, err := readStateCached(statePath)
 	if err != nil {
 		return fmt.Errorf("read state: %w", err)
 	}
-	var st map[string]any
-	if err := json.Unmarshal(b, &st); err != nil {
-		return fmt.Errorf("parse state: %w", err)
-	}
 	if st["outputs"] == nil {
 		st["outputs"] = map[string]any{}
 	}
@@ -392,6 +475,12 @@ func PatchStateFromConfigEvaluatedFast(rootDir, workDir, statePath string, varFi
 			return fmt.Errorf("scan config: %w", perr)
 		}
 	}
+	resolveRemoteStates(rootDir, cfgs)
+	if recordProvenance {
+		if err := writeStateProvenance(statePath, cfgs); err != nil {
+			debugf("write state provenance: %v", err)
+		}
+	}
 
 	type resRef struct {
 		idx int
@@ -403,23 +492,32 @@ func PatchStateFromConfigEvaluatedFast(rootDir, workDir, statePath string, varFi
 			rType, _ := m["type"].(string)
 			rName, _ := m["name"].(string)
 			mode, _ := m["mode"].(string)
-			if mode != "managed" {
+			if mode != "managed" && mode != "data" {
 				continue
 			}
 			mod, _ := m["module"].(string)
-			key := resourceKey(mod, rType, rName)
+			key := stateKey(mode, mod, rType, rName)
 			index[key] = resRef{idx: i, obj: m}
 		}
 	}
 
 	changed := false
 	for _, rc := range cfgs {
-		mod := modulePathToString(rc.ModulePath)
-		key := resourceKey(mod, rc.Type, rc.Name)
+		mod := rc.moduleAddress()
+		key := stateKey(rc.mode(), mod, rc.Type, rc.Name)
 		if ref, ok := index[key]; ok {
-			// Ensure provider is set for existing resources
-			if _, hasProv := ref.obj["provider"]; !hasProv {
-				ref.obj["provider"] = providerAddressForType(rc.Type)
+			// Ensure provider is set for existing resources; an explicit provider
+			// meta-argument decides the alias
+			if prov := providerAddressForResource(ref.obj["provider"], rc.Type, rc.Provider); prov != ref.obj["provider"] {
+				ref.obj["provider"] = prov
+				changed = true
+			}
+			if rc.Instances != nil {
+				if patchForEachInstances(ref.obj, rc.Instances) {
+					changed = true
+				}
+				resources[ref.idx] = ref.obj
+				continue
 			}
 			instRaw, _ := ref.obj["instances"].([]any)
 			if instRaw == nil {
@@ -458,15 +556,18 @@ func PatchStateFromConfigEvaluatedFast(rootDir, workDir, statePath string, varFi
 			continue
 		}
 		newRes := map[string]any{
-			"mode":     "managed",
+			"mode":     rc.mode(),
 			"type":     rc.Type,
 			"name":     rc.Name,
-			"provider": providerAddressForType(rc.Type),
+			"provider": providerAddress(rc.Type, rc.Provider),
 			"instances": []any{map[string]any{
 				"attributes":     sanitizeMap(rc.Attrs),
 				"schema_version": 0,
 			}},
 		}
+		if rc.Instances != nil {
+			patchForEachInstances(newRes, rc.Instances)
+		}
 		if mod != "" {
 			newRes["module"] = mod
 		}
@@ -475,6 +576,13 @@ func PatchStateFromConfigEvaluatedFast(rootDir, workDir, statePath string, varFi
 		changed = true
 	}
 
+	if pruned, ok := pruneRemovedResources(rootDir, statePath, resources, cfgs); ok {
+		resources = pruned
+		changed = true
+	}
+	if seedComputedAttributes(resources) {
+		changed = true
+	}
 	st["resources"] = resources
 	if !changed {
 		return nil
@@ -492,34 +600,169 @@ func PatchStateFromConfigEvaluatedFast(rootDir, workDir, statePath string, varFi
 	default:
 		st["version"] = 4
 	}
-	switch s := st["serial"].(type) {
-	case float64:
-		if s <= 0 {
-			st["serial"] = 1
-		} else {
-			st["serial"] = int(s) + 1
+	bumpSerial(st)
+	return writeStateAtomicRaw(statePath, st)
+}
+
+// patchForEachInstances replaces the instances of the state resource res with
+// one per key of insts, ordered by key and carrying it as index_key. Attributes
+// of an existing instance with the same key that configuration does not set are
+// kept. Reports whether anything changed.
+func patchForEachInstances(res map[string]any, insts map[string]map[string]any) bool {
+	existing := map[string]map[string]any{}
+	old, _ := res["instances"].([]any)
+	for _, it := range old {
+		if im, ok := it.(map[string]any); ok {
+			if k, ok := im["index_key"].(string); ok {
+				existing[k] = im
+			}
 		}
-	case int:
-		if s <= 0 {
-			st["serial"] = 1
-		} else {
-			st["serial"] = s + 1
+	}
+	keys := make([]string, 0, len(insts))
+	for k := range insts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	changed := len(old) != len(keys)
+	out := make([]any, 0, len(keys))
+	for _, k := range keys {
+		im, ok := existing[k]
+		if !ok {
+			im = map[string]any{"index_key": k, "schema_version": 0, "attributes": map[string]any{}}
+			changed = true
+		}
+		attrs, _ := im["attributes"].(map[string]any)
+		if attrs == nil {
+			attrs = map[string]any{}
+			im["attributes"] = attrs
+		}
+		for a, v := range insts[k] {
+			nv := sanitizeValue(v)
+			if ov, exists := attrs[a]; !exists || !deepEqualJSONish(ov, nv) {
+				attrs[a] = nv
+				changed = true
+			}
 		}
-	default:
-		st["serial"] = 1
+		out = append(out, im)
 	}
-	return writeStateAtomicRaw(statePath, st)
+	res["instances"] = out
+	return changed
 }
 
-func writeStateAtomicRaw(path string, st map[string]any) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
-		return err
+// pruneRemovedResources drops resources and data sources whose address was present in
+// configuration during the previous full patch but no longer is. Addresses never
+// seen in configuration (e.g. pulled from remote state) are left untouched. The
+// current address set is persisted next to the state for the following patch.
+// Pruning is skipped while any configuration file fails to parse, since the scan
+// would then be missing resources that still exist. Returns (resources, true) only
+// when something was removed.
+func pruneRemovedResources(rootDir, statePath string, resources []any, cfgs []ResourceConfig) ([]any, bool) {
+	if !configParsesCleanly(rootDir) {
+		return resources, false
+	}
+	current := map[string]struct{}{}
+	for _, rc := range cfgs {
+		current[stateKey(rc.mode(), rc.moduleAddress(), rc.Type, rc.Name)] = struct{}{}
+	}
+	focus := currentFocus()
+	addrsPath := filepath.Join(filepath.Dir(statePath), ".tf-config-addresses.json")
+	previous := map[string]struct{}{}
+	if b, err := os.ReadFile(addrsPath); err == nil {
+		var keys []string
+		if jsonx.Unmarshal(b, &keys) == nil {
+			for _, k := range keys {
+				previous[k] = struct{}{}
+			}
+		}
 	}
+	keys := make([]string, 0, len(current))
+	for k := range current {
+		keys = append(keys, k)
+	}
+	// with a focus filter the scan only sees part of the configuration; remember
+	// out-of-focus addresses so an unfocused session can still prune them later
+	for k := range previous {
+		if _, ok := current[k]; !ok && !focusMatchesKey(focus, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if b, err := jsonx.Marshal(keys); err == nil {
+		tmp := fmt.Sprintf("%s.tmp-%d", addrsPath, time.Now().UnixNano())
+		if os.WriteFile(tmp, b, 0o600) == nil {
+			_ = os.Rename(tmp, addrsPath)
+		}
+	}
+	if len(previous) == 0 {
+		return resources, false
+	}
+	out := make([]any, 0, len(resources))
+	removed := false
+	for _, r := range resources {
+		if m, ok := r.(map[string]any); ok {
+			if mode, _ := m["mode"].(string); mode == "managed" || mode == "data" {
+				rType, _ := m["type"].(string)
+				rName, _ := m["name"].(string)
+				mod, _ := m["module"].(string)
+				key := stateKey(mode, mod, rType, rName)
+				_, wasConfigured := previous[key]
+				_, isConfigured := current[key]
+				if wasConfigured && !isConfigured && focus.Matches(moduleStringToPath(mod), rType, rName) {
+					removed = true
+					continue
+				}
+			}
+		}
+		out = append(out, r)
+	}
+	if !removed {
+		return resources, false
+	}
+	return out, true
+}
+
+// configParsesCleanly reports whether every .tf file under rootDir parses without errors.
+func configParsesCleanly(rootDir string) bool {
+	clean := true
+	_ = filepath.Walk(rootDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			base := filepath.Base(p)
+			rel, _ := filepath.Rel(rootDir, p)
+			if (isDataDir(rel) || base == ".terraflow" || strings.HasPrefix(base, ".git")) && p != rootDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.ToLower(filepath.Ext(p)) != ".tf" {
+			return nil
+		}
+		if _, _, ok := getSyntaxFileCached(p); !ok {
+			clean = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return clean
+}
+
+func writeStateAtomicRaw(path string, st map[string]any) error {
 	// Use compact JSON to minimize bytes written and speed up comparisons
-	b, err := json.Marshal(st)
+	b, err := jsonx.Marshal(st)
 	if err != nil {
 		return err
 	}
+	return writeStateAtomicBytes(path, st, b)
+}
+
+// writeStateAtomicBytes writes b, the encoding of st, and hands st to the state
+// cache so the next patch can skip re-parsing. st must not be modified afterwards.
+func writeStateAtomicBytes(path string, st map[string]any, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
 	tmp := fmt.Sprintf("%s.tmp-%d", path, time.Now().UnixNano())
 	if err := os.WriteFile(tmp, b, 0o600); err != nil {
 		return err
@@ -527,25 +770,68 @@ func writeStateAtomicRaw(path string, st map[string]any) error {
 	if err := os.Rename(tmp, path); err != nil {
 		return err
 	}
+	stateCacheMu.Lock()
+	stateCache[path] = cachedState{st: st, raw: b}
+	stateCacheMu.Unlock()
 	// State changed; update evaluator snapshots to avoid restarts and lock contention
 	UpdatePersistentEvaluatorSnapshots(path, b)
 	return nil
 }
 
-// readStateCached is a lightweight helper that reads and parses the state file.
-// For now it does no real caching; it returns cacheHit=false.
+// cachedState is the last state written by this process, kept parsed so that
+// consecutive patches of large states avoid re-parsing the whole file.
+type cachedState struct {
+	st  map[string]any
+	raw []byte
+}
+
+var (
+	stateCacheMu sync.Mutex
+	stateCache   = map[string]cachedState{}
+	stateLocksMu sync.Mutex
+	stateLocks   = map[string]*sync.Mutex{}
+)
+
+// readStateCached reads and parses the state file. When its content is the
+// same as this process last wrote, the parsed state is handed over from the
+// cache (cacheHit=true) instead of being re-parsed; the content is compared
+// rather than the modification time, which a quick rewrite of the same size
+// can leave unchanged. Ownership moves to the caller:
+// the entry is dropped, so a caller that mutates st without writing it back
+// cannot leak those changes to later readers.
 func readStateCached(path string) (map[string]any, []byte, bool, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, nil, false, err
 	}
+	stateCacheMu.Lock()
+	c, ok := stateCache[path]
+	delete(stateCache, path)
+	stateCacheMu.Unlock()
+	if ok && bytes.Equal(c.raw, b) {
+		return c.st, c.raw, true, nil
+	}
 	var st map[string]any
-	if err := json.Unmarshal(b, &st); err != nil {
+	if err := jsonx.Unmarshal(b, &st); err != nil {
 		return nil, nil, false, err
 	}
 	return st, b, false, nil
 }
 
+// lockState serializes read-modify-write cycles on one state file within the
+// process; concurrent patchers would otherwise overwrite each other's changes.
+func lockState(path string) func() {
+	stateLocksMu.Lock()
+	mu := stateLocks[path]
+	if mu == nil {
+		mu = &sync.Mutex{}
+		stateLocks[path] = mu
+	}
+	stateLocksMu.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
 func resourceKey(module, rType, name string) string {
 	if module == "" {
 		return rType + "|" + name
@@ -553,19 +839,19 @@ func resourceKey(module, rType, name string) string {
 	return module + "|" + rType + "|" + name
 }
 
-func modulePathToString(path []string) string {
-	if len(path) == 0 {
-		return ""
+// stateKey is resourceKey for a state entry of the given mode; data sources are
+// keyed as data.<type> so they never collide with a managed resource.
+func stateKey(mode, module, rType, name string) string {
+	if mode == "data" {
+		rType = "data." + rType
 	}
-	// Terraform state uses module path like: module.a.module.b
-	s := ""
-	for i, p := range path {
-		if i > 0 {
-			s += "."
-		}
-		s += "module." + p
-	}
-	return s
+	return resourceKey(module, rType, name)
+}
+
+// modulePathToString formats a module path the way Terraform state does:
+// module.a.module.b.
+func modulePathToString(path []string) string {
+	return moduleInstanceAddress(path, nil)
 }
 
 // cloneMap was used in earlier versions; replaced by sanitizeMap
@@ -594,7 +880,7 @@ func sanitizeValue(v any) any {
 		// If looks like JSON object/array/primitive, try to parse
 		if len(s) > 0 && (s[0] == '{' || s[0] == '[' || s[0] == '"' || s[0] == 't' || s[0] == 'f' || s[0] == 'n' || s[0] == '-' || (s[0] >= '0' && s[0] <= '9')) {
 			var parsed any
-			if json.Unmarshal([]byte(s), &parsed) == nil {
+			if jsonx.Unmarshal([]byte(s), &parsed) == nil {
 				return sanitizeValue(parsed)
 			}
 		}
@@ -607,6 +893,8 @@ func sanitizeValue(v any) any {
 		return out
 	case map[string]any:
 		return sanitizeMap(t)
+	case Sensitive:
+		return sanitizeValue(t.Value)
 	default:
 		return v
 	}
@@ -671,6 +959,43 @@ func deepEqualJSONish(a, b any) bool {
 
 // stringsTrim no longer needed; using strings.TrimSpace directly
 
+// providerAddress returns the state provider address for a resource whose
+// provider meta-argument is providerRef ("aws.west" -> provider["…/aws"].west).
+// An empty providerRef falls back to the type-derived default.
+func providerAddress(resourceType, providerRef string) string {
+	if providerRef == "" {
+		return providerAddressForType(resourceType)
+	}
+	local, alias, _ := strings.Cut(providerRef, ".")
+	addr := fmt.Sprintf("provider[\"registry.terraform.io/hashicorp/%s\"]", local)
+	if alias != "" {
+		addr += "." + alias
+	}
+	return addr
+}
+
+// providerAddressForResource reconciles an existing state provider address with
+// the configuration. Existing addresses (e.g. from pulled remote state) keep their
+// source address, which may carry a non-hashicorp namespace; only the alias is
+// adjusted to match an explicit provider meta-argument.
+func providerAddressForResource(existing any, resourceType, providerRef string) string {
+	cur, _ := existing.(string)
+	if cur == "" {
+		return providerAddress(resourceType, providerRef)
+	}
+	if providerRef == "" {
+		return cur
+	}
+	base := cur
+	if i := strings.LastIndex(cur, "]"); i >= 0 {
+		base = cur[:i+1]
+	}
+	if _, alias, ok := strings.Cut(providerRef, "."); ok {
+		return base + "." + alias
+	}
+	return base
+}
+
 // providerAddressForType derives a Terraform provider address for a given resource type.
 // Example: "azurerm_kubernetes_cluster" -> "provider[\"registry.terraform.io/hashicorp/azurerm\"]"
 func providerAddressForType(resourceType string) string {
@@ -0,0 +1,48 @@
+package terraform
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// writeLargeState writes a synthetic state with n managed resources of a few
+// attributes each, roughly the shape of a pulled remote state.
+func writeLargeState(b *testing.B, n int) string {
+	b.Helper()
+	resources := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		resources = append(resources, map[string]any{
+			"mode":     "managed",
+			"type":     "aws_instance",
+			"name":     fmt.Sprintf("r%d", i),
+			"provider": providerAddressForType("aws_instance"),
+			"instances": []any{map[string]any{
+				"schema_version": 1,
+				"attributes": map[string]any{
+					"id":            fmt.Sprintf("i-%08d", i),
+					"ami":           "ami-0123456789abcdef0",
+					"instance_type": "t3.micro",
+					"tags":          map[string]any{"Name": fmt.Sprintf("node-%d", i), "env": "prod"},
+				},
+			}},
+		})
+	}
+	statePath := filepath.Join(b.TempDir(), "terraform.tfstate")
+	st := map[string]any{"version": 4, "serial": 1, "lineage": "bench", "resources": resources, "outputs": map[string]any{}}
+	if err := writeStateAtomicRaw(statePath, st); err != nil {
+		b.Fatal(err)
+	}
+	return statePath
+}
+
+func BenchmarkPatchAttrWrite_LargeState(b *testing.B) {
+	statePath := writeLargeState(b, 5000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := patchAttrWrite(statePath, "aws_instance", "r42", "instance_type", fmt.Sprintf("t3.%d", i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package terraform
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func extractSerialFromMap(t *testing.T, st map[string]any) int {
@@ -135,3 +139,300 @@ resource "null_resource" "root_ex" {
 		t.Fatalf("expected updated attribute a=z, got %v", got)
 	}
 }
+
+func TestResetState_DropsResourcesRemovedFromConfig(t *testing.T) {
+	root := t.TempDir()
+	mainTF := filepath.Join(root, "main.tf")
+	if err := os.WriteFile(mainTF, []byte(`
+resource "null_resource" "keep" {
+  triggers = { a = "x" }
+}
+resource "null_resource" "gone" {
+  triggers = { b = "y" }
+}
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(root, ".terraflow", "terraform.tfstate")
+	if err := PatchStateFromConfig(root, statePath, nil); err != nil {
+		t.Fatalf("patch state: %v", err)
+	}
+	// Rename/remove a resource in config; plain patching would keep the old entry
+	if err := os.WriteFile(mainTF, []byte(`
+resource "null_resource" "keep" {
+  triggers = { a = "x" }
+}
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResetState(root, root, statePath, nil); err != nil {
+		t.Fatalf("reset state: %v", err)
+	}
+	b, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+	var st map[string]any
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	res, _ := st["resources"].([]any)
+	if len(res) != 1 {
+		t.Fatalf("expected 1 resource after reset, got %d", len(res))
+	}
+	if name, _ := res[0].(map[string]any)["name"].(string); name != "keep" {
+		t.Fatalf("expected remaining resource keep, got %q", name)
+	}
+}
+
+func TestPatchState_PrunesResourcesRemovedFromConfig(t *testing.T) {
+	root := t.TempDir()
+	mainTF := filepath.Join(root, "main.tf")
+	write := func(src string) {
+		t.Helper()
+		if err := os.WriteFile(mainTF, []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func(statePath string) []string {
+		t.Helper()
+		b, err := os.ReadFile(statePath)
+		if err != nil {
+			t.Fatalf("read state: %v", err)
+		}
+		var st map[string]any
+		if err := json.Unmarshal(b, &st); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		var out []string
+		res, _ := st["resources"].([]any)
+		for _, r := range res {
+			name, _ := r.(map[string]any)["name"].(string)
+			out = append(out, name)
+		}
+		return out
+	}
+	write(`
+resource "null_resource" "keep" {
+  triggers = { a = "x" }
+}
+resource "null_resource" "gone" {
+  triggers = { b = "y" }
+}
+`)
+	statePath := filepath.Join(root, ".terraflow", "terraform.tfstate")
+	if err := PatchStateFromConfig(root, statePath, nil); err != nil {
+		t.Fatalf("first patch: %v", err)
+	}
+	if got := names(statePath); len(got) != 2 {
+		t.Fatalf("expected 2 resources, got %v", got)
+	}
+
+	// A syntax error must not be mistaken for a removal
+	write(`
+resource "null_resource" "keep" {
+  triggers = { a = "x" }
+`)
+	// The scan may report the syntax error; either way nothing should be pruned
+	_ = PatchStateFromConfig(root, statePath, nil)
+	if got := names(statePath); len(got) != 2 {
+		t.Fatalf("expected no pruning while config is broken, got %v", got)
+	}
+
+	write(`
+resource "null_resource" "keep" {
+  triggers = { a = "x" }
+}
+`)
+	if err := PatchStateFromConfig(root, statePath, nil); err != nil {
+		t.Fatalf("second patch: %v", err)
+	}
+	if got := names(statePath); len(got) != 1 || got[0] != "keep" {
+		t.Fatalf("expected only keep to remain, got %v", got)
+	}
+}
+
+func TestReadStateCached_InvalidatedByExternalWrite(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "terraform.tfstate")
+	if err := writeStateAtomicRaw(statePath, map[string]any{"version": 4, "serial": 1}); err != nil {
+		t.Fatal(err)
+	}
+	st, _, hit, err := readStateCached(statePath)
+	if err != nil || !hit {
+		t.Fatalf("expected cache hit after own write, hit=%v err=%v", hit, err)
+	}
+	// Ownership moved to the caller; mutations must not be visible to the next reader
+	st["serial"] = 99
+	if st2, _, hit, _ := readStateCached(statePath); hit || st2["serial"] != float64(1) {
+		t.Fatalf("expected fresh read from disk, hit=%v serial=%v", hit, st2["serial"])
+	}
+
+	if err := writeStateAtomicRaw(statePath, map[string]any{"version": 4, "serial": 2}); err != nil {
+		t.Fatal(err)
+	}
+	// e.g. terraform state pull replacing the file behind our back
+	if err := os.WriteFile(statePath, []byte(`{"version":4,"serial":7,"lineage":"remote"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	st3, _, hit, err := readStateCached(statePath)
+	if err != nil || hit || st3["serial"] != float64(7) {
+		t.Fatalf("expected external write to win, hit=%v serial=%v err=%v", hit, st3["serial"], err)
+	}
+
+	// A rewrite keeping the size and modification time is noticed too
+	if err := writeStateAtomicRaw(statePath, map[string]any{"version": 4, "serial": 3}); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(statePath)
+	if err := os.WriteFile(statePath, bytes.Replace(b, []byte("3"), []byte("8"), 1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(statePath, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if st4, _, hit, _ := readStateCached(statePath); hit || st4["serial"] != float64(8) {
+		t.Fatalf("expected same-size rewrite to win, hit=%v serial=%v", hit, st4["serial"])
+	}
+}
+
+func TestPatchState_ProviderAliasFromMetaArgument(t *testing.T) {
+	// Copy the fixture so the scan does not leave state next to the sources
+	root := t.TempDir()
+	src, err := os.ReadFile(filepath.Join(repoRoot(t), "test", "fixtures", "provider_alias", "main.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "main.tf"), src, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(root, ".terraflow", "terraform.tfstate")
+	if err := PatchStateFromConfig(root, statePath, nil); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	b, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st map[string]any
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatal(err)
+	}
+	// Data sources honor the provider meta-argument the same way
+	want := map[string]string{
+		"managed.east": `provider["registry.terraform.io/hashicorp/aws"]`,
+		"managed.west": `provider["registry.terraform.io/hashicorp/aws"].west`,
+		"data.current": `provider["registry.terraform.io/hashicorp/aws"]`,
+		"data.west":    `provider["registry.terraform.io/hashicorp/aws"].west`,
+	}
+	res, _ := st["resources"].([]any)
+	if len(res) != len(want) {
+		t.Fatalf("expected %d resources, got %d", len(want), len(res))
+	}
+	for _, r := range res {
+		m := r.(map[string]any)
+		key := fmt.Sprintf("%v.%v", m["mode"], m["name"])
+		if got := m["provider"]; got != want[key] {
+			t.Fatalf("%s: provider = %v, want %s", key, got, want[key])
+		}
+	}
+	v, ok := TryEvalInProcessWithState(root, statePath, nil, `data.aws_region.west.name`, time.Second)
+	if !ok || v != "us-west-2" {
+		t.Fatalf("data source reference: got %#v (ok=%v)", v, ok)
+	}
+}
+
+func TestPatchStateEvaluatedFast_ForEachInstances(t *testing.T) {
+	root := t.TempDir()
+	src, err := os.ReadFile(filepath.Join(repoRoot(t), "test", "fixtures", "for_each", "main.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "main.tf"), src, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(root, ".terraflow", "terraform.tfstate")
+	if err := PatchStateFromConfigEvaluatedFast(root, root, statePath, nil); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	b, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st map[string]any
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]any{}
+	for _, r := range st["resources"].([]any) {
+		m := r.(map[string]any)
+		for _, in := range m["instances"].([]any) {
+			im := in.(map[string]any)
+			got[fmt.Sprintf("%v.%v[%v]", m["type"], m["name"], im["index_key"])] = im["attributes"]
+		}
+	}
+	want := map[string]any{
+		"aws_s3_bucket.b[assets]": map[string]any{"bucket": "assets-bucket", "region": "eu-west-1", "acl": "private"},
+		"aws_s3_bucket.b[logs]":   map[string]any{"bucket": "logs-bucket", "region": "us-east-1", "acl": "private"},
+		"aws_iam_user.u[alice]":   map[string]any{"name": "ALICE"},
+		"aws_iam_user.u[bob]":     map[string]any{"name": "BOB"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("instances:\n got %#v\nwant %#v", got, want)
+	}
+	v, ok := TryEvalInProcessWithState(root, statePath, nil, `aws_s3_bucket.b["logs"].region`, time.Second)
+	if !ok || v != "us-east-1" {
+		t.Fatalf("instance reference: got %#v (ok=%v)", v, ok)
+	}
+}
+
+func TestPatchStateEvaluatedFast_ReproducibleStateIsByteIdentical(t *testing.T) {
+	root := t.TempDir()
+	src, err := os.ReadFile(filepath.Join(repoRoot(t), "test", "fixtures", "for_each", "main.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "main.tf"), src, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(root, ".terraflow", "terraform.tfstate")
+	synthesize := func() []byte {
+		t.Helper()
+		if err := os.RemoveAll(filepath.Dir(statePath)); err != nil {
+			t.Fatal(err)
+		}
+		if err := PatchStateFromConfigEvaluatedFast(root, root, statePath, nil); err != nil {
+			t.Fatalf("patch: %v", err)
+		}
+		// A refresh with nothing changed must not touch the file either
+		if err := PatchStateFromConfigEvaluatedFast(root, root, statePath, nil); err != nil {
+			t.Fatalf("second patch: %v", err)
+		}
+		b, err := os.ReadFile(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	if bytes.Equal(synthesize(), synthesize()) {
+		t.Fatal("default mode should pick a new lineage for each state file")
+	}
+
+	SetReproducibleState(true)
+	defer SetReproducibleState(false)
+	first, second := synthesize(), synthesize()
+	if !bytes.Equal(first, second) {
+		t.Fatalf("reproducible state differs between runs:\n%s\n%s", first, second)
+	}
+	var st map[string]any
+	if err := json.Unmarshal(first, &st); err != nil {
+		t.Fatal(err)
+	}
+	if serial := extractSerial(t, st); serial != 1 {
+		t.Fatalf("serial = %d, want 1 without bumps", serial)
+	}
+}
@@ -3,11 +3,13 @@ package terraform
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
@@ -21,6 +23,9 @@ func SyncToScratch(srcDir, scratchDir string) (changed bool, changedTF bool, err
 	if err := os.MkdirAll(scratchDir, 0o700); err != nil {
 		return false, false, fmt.Errorf("make scratch: %w", err)
 	}
+	if err := writeSourceMarker(srcDir, scratchDir); err != nil {
+		return false, false, fmt.Errorf("write source marker: %w", err)
+	}
 	manifestPath := filepath.Join(scratchDir, ".tf-manifest.json")
 	oldManifest, _ := readManifest(manifestPath)
 	newManifest := map[string]manifestEntry{}
@@ -37,14 +42,11 @@ func SyncToScratch(srcDir, scratchDir string) (changed bool, changedTF bool, err
 			return nil
 		}
 		// Skip scratch and terraform dirs
-		parts := strings.Split(rel, string(filepath.Separator))
-		for _, p := range parts {
-			if p == ".terraform" || p == ".terraflow" {
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
+		if inDataDir(rel) || slices.Contains(strings.Split(rel, string(filepath.Separator)), ".terraflow") {
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 		if info.IsDir() {
 			return nil
@@ -119,6 +121,122 @@ func SyncToScratch(srcDir, scratchDir string) (changed bool, changedTF bool, err
 	return changed, changedTF, nil
 }
 
+// SyncPathsToScratch is SyncToScratch restricted to the given paths (absolute or
+// relative to srcDir), as reported by the file watcher. It avoids walking the
+// whole tree on every refresh; files whose content is unchanged (e.g. an editor
+// only touched the modification time) are not reported as changes. An empty
+// paths list falls back to a full SyncToScratch.
+func SyncPathsToScratch(srcDir, scratchDir string, paths []string) (changed bool, changedTF bool, err error) {
+	if len(paths) == 0 {
+		return SyncToScratch(srcDir, scratchDir)
+	}
+	if err := os.MkdirAll(scratchDir, 0o700); err != nil {
+		return false, false, fmt.Errorf("make scratch: %w", err)
+	}
+	if err := writeSourceMarker(srcDir, scratchDir); err != nil {
+		return false, false, fmt.Errorf("write source marker: %w", err)
+	}
+	manifestPath := filepath.Join(scratchDir, ".tf-manifest.json")
+	manifest, _ := readManifest(manifestPath)
+	manifestChanged := false
+	absSrc, _ := filepath.Abs(srcDir)
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(absSrc, p)
+		}
+		rel, rerr := filepath.Rel(absSrc, p)
+		if rerr != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		skip := inDataDir(rel) || slices.Contains(strings.Split(rel, string(filepath.Separator)), ".terraflow")
+		lower := strings.ToLower(p)
+		isTF := strings.HasSuffix(lower, ".tf")
+		if skip || (!isTF && !strings.HasSuffix(lower, ".tfvars") && !strings.HasSuffix(lower, ".tf.json")) {
+			continue
+		}
+		relKey := filepath.ToSlash(rel)
+		dstPath := filepath.Join(scratchDir, rel)
+		info, serr := os.Stat(p)
+		if serr != nil || info.IsDir() || (isTF && hasBackendBlock(p)) {
+			// Deleted (or now excluded): drop the scratch copy like the full walk does
+			if _, tracked := manifest[relKey]; tracked {
+				delete(manifest, relKey)
+				manifestChanged = true
+				if err := os.Remove(dstPath); err == nil {
+					changed = true
+					changedTF = changedTF || isTF
+				}
+			}
+			continue
+		}
+		entry := manifestEntry{ModUnixNano: info.ModTime().UnixNano(), Size: info.Size()}
+		if prev, ok := manifest[relKey]; ok && prev == entry {
+			continue
+		}
+		manifest[relKey] = entry
+		manifestChanged = true
+		if sameFileContent(p, dstPath) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dstPath), 0o700); err != nil {
+			return changed, changedTF, err
+		}
+		if err := copyFile(p, dstPath, 0o600); err != nil {
+			return changed, changedTF, err
+		}
+		changed = true
+		changedTF = changedTF || isTF
+	}
+	if manifestChanged {
+		if err := writeManifest(manifestPath, manifest); err != nil {
+			return changed, changedTF, fmt.Errorf("write manifest: %w", err)
+		}
+	}
+	return changed, changedTF, nil
+}
+
+// sameFileContent reports whether both files exist with identical bytes.
+func sameFileContent(a, b string) bool {
+	ab, err := os.ReadFile(a)
+	if err != nil {
+		return false
+	}
+	bb, err := os.ReadFile(b)
+	if err != nil {
+		return false
+	}
+	return string(ab) == string(bb)
+}
+
+// sourceMarkerName is the file in a scratch directory recording the
+// configuration directory it is synced from. Files the configuration reads,
+// such as those passed to file(), are not copied and are read from there.
+const sourceMarkerName = ".tf-source"
+
+// writeSourceMarker records srcDir as the source of scratchDir unless it
+// already is.
+func writeSourceMarker(srcDir, scratchDir string) error {
+	abs, err := filepath.Abs(srcDir)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(scratchDir, sourceMarkerName)
+	if b, err := os.ReadFile(path); err == nil && string(b) == abs {
+		return nil
+	}
+	return os.WriteFile(path, []byte(abs), 0o600)
+}
+
+// sourceDir returns the absolute configuration directory dir was synced from
+// when dir is a scratch directory, else dir itself.
+func sourceDir(dir string) string {
+	if b, err := os.ReadFile(filepath.Join(dir, sourceMarkerName)); err == nil && len(b) > 0 {
+		return string(b)
+	}
+	abs, _ := filepath.Abs(dir)
+	return abs
+}
+
 type manifestEntry struct {
 	ModUnixNano int64 `json:"mod_unix_nano"`
 	Size        int64 `json:"size"`
@@ -160,6 +278,85 @@ func WriteLocalBackendFile(scratchDir string) error {
 	return os.WriteFile(backendPath, []byte(content), 0o600)
 }
 
+// runTerraformCommand runs the setup commands terraflow issues (init, providers
+// lock, state pull), discarding any output the caller does not capture. Tests
+// replace it to observe them without a terraform binary.
+var runTerraformCommand = func(cmd *exec.Cmd) error {
+	if cmd.Stdout == nil {
+		cmd.Stdout = io.Discard
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = io.Discard
+	}
+	done := TraceCommand(cmd)
+	err := cmd.Run()
+	done(err)
+	return err
+}
+
+// initStampFile records, inside the scratch directory, which state of the
+// project's .terraform directory the scratch copy was initialized from.
+const initStampFile = ".tf-init-stamp"
+
+// initStamp summarizes the project's terraform initialization: the .terraform
+// directory, its module manifest and the dependency lock file. Any provider or
+// module (re)install changes at least one of them.
+func initStamp(srcDir string) string {
+	parts := make([]string, 0, 3)
+	for _, p := range []string{
+		DataDir(srcDir),
+		filepath.Join(DataDir(srcDir), "modules", "modules.json"),
+		filepath.Join(srcDir, ".terraform.lock.hcl"),
+	} {
+		var mod, size int64
+		if fi, err := os.Stat(p); err == nil {
+			mod, size = fi.ModTime().UnixNano(), fi.Size()
+		}
+		parts = append(parts, fmt.Sprintf("%d:%d", mod, size))
+	}
+	return strings.Join(parts, " ")
+}
+
+// scratchIsWarm reports whether scratchDir was initialized from the current
+// state of srcDir's .terraform and still has its provider lock file, so
+// re-initializing it would be a no-op.
+func scratchIsWarm(srcDir, scratchDir string) bool {
+	b, err := os.ReadFile(filepath.Join(scratchDir, initStampFile))
+	if err != nil || string(b) != initStamp(srcDir) {
+		return false
+	}
+	if fi, err := os.Stat(DataDir(srcDir)); err == nil && fi.IsDir() {
+		if _, err := os.Stat(filepath.Join(scratchDir, ".terraform.lock.hcl")); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// PrepareScratch syncs srcDir into scratchDir and initializes it. With
+// keepWarm, initialization is skipped when the sync found no changes and the
+// scratch directory is already initialized from the current .terraform, which
+// avoids re-mirroring providers and running terraform on every startup.
+// Evaluation snapshots left behind by a killed process are removed first.
+// Returns whether initialization was skipped.
+func PrepareScratch(srcDir, scratchDir string, keepWarm bool) (bool, error) {
+	RemoveStaleEvalSnapshots(scratchDir)
+	changed, _, syncErr := SyncToScratch(srcDir, scratchDir)
+	if syncErr != nil {
+		syncErr = fmt.Errorf("sync to scratch: %w", syncErr)
+	}
+	if keepWarm && syncErr == nil && !changed && scratchIsWarm(srcDir, scratchDir) {
+		return true, nil
+	}
+	if err := initTerraformFrom(srcDir, scratchDir); err != nil {
+		return false, errors.Join(syncErr, fmt.Errorf("terraform init in scratch: %w", err))
+	}
+	if err := os.WriteFile(filepath.Join(scratchDir, initStampFile), []byte(initStamp(srcDir)), 0o600); err != nil {
+		return false, errors.Join(syncErr, fmt.Errorf("write init stamp: %w", err))
+	}
+	return false, syncErr
+}
+
 // InitTerraformInDir mirrors the project's .terraform directory into the
 // provided directory's .terraform, excluding any terraform.tfstate file.
 func InitTerraformInDir(dir string) error {
@@ -167,13 +364,21 @@ func InitTerraformInDir(dir string) error {
 	if err != nil {
 		return fmt.Errorf("get working dir: %w", err)
 	}
-	src := filepath.Join(workDir, ".terraform")
+	return initTerraformFrom(workDir, dir)
+}
+
+// initTerraformFrom is InitTerraformInDir for an explicit project directory.
+func initTerraformFrom(workDir, dir string) error {
+	src := DataDir(workDir)
 	info, statErr := os.Stat(src)
 	if statErr != nil || !info.IsDir() {
 		// Nothing to mirror; treat as no-op
 		return nil
 	}
-	dst := filepath.Join(dir, ".terraform")
+	dst := scratchDataDir(dir)
+	if dst == src {
+		return fmt.Errorf("scratch directory %s would share the data directory %s", dir, src)
+	}
 	if remErr := os.RemoveAll(dst); remErr != nil {
 		return fmt.Errorf("remove existing scratch .terraform: %w", remErr)
 	}
@@ -209,30 +414,49 @@ func InitTerraformInDir(dir string) error {
 	// Generate provider lock file once if missing in scratch directory
 	lockPath := filepath.Join(dir, ".terraform.lock.hcl")
 	if _, err := os.Stat(lockPath); os.IsNotExist(err) {
-		cmd := exec.Command("terraform", "providers", "lock", "-fs-mirror", ".terraform/providers")
-		cmd.Dir = dir
-		cmd.Stdout = io.Discard
-		cmd.Stderr = io.Discard
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("terraform providers lock: %w", err)
-		}
+		lockProviders(dir)
 	} else if err != nil {
 		return fmt.Errorf("stat lock file: %w", err)
 	}
 	// If modules directory is missing, hydrate via a lightweight init to fetch modules only
-	modulesDir := filepath.Join(dir, ".terraform", "modules")
+	modulesDir := filepath.Join(dst, "modules")
 	if _, err := os.Stat(modulesDir); os.IsNotExist(err) {
 		initCmd := exec.Command("terraform", "init", "-get", "-backend=false", "-input=false", "-no-color")
 		initCmd.Dir = dir
-		initCmd.Stdout = io.Discard
-		initCmd.Stderr = io.Discard
-		if err := initCmd.Run(); err != nil {
+		initCmd.Env = scratchEnv(terraformEnv())
+		if err := runTerraformCommand(initCmd); err != nil {
 			return fmt.Errorf("terraform init (modules only): %w", err)
 		}
 	}
 	return nil
 }
 
+// lockProviders writes the scratch lock file, preferring the providers mirrored
+// into .terraform/providers and falling back to a plain `terraform providers
+// lock` for providers installed from a network mirror or plugin cache. Failure
+// is not fatal: the console still works without a lock file.
+func lockProviders(dir string) {
+	var errs []error
+	if fi, err := os.Stat(filepath.Join(scratchDataDir(dir), "providers")); err == nil && fi.IsDir() {
+		rel, _ := filepath.Rel(dir, filepath.Join(scratchDataDir(dir), "providers"))
+		cmd := exec.Command("terraform", "providers", "lock", "-fs-mirror", filepath.ToSlash(rel))
+		cmd.Dir = dir
+		cmd.Env = scratchEnv(terraformEnv())
+		err := runTerraformCommand(cmd)
+		if err == nil {
+			return
+		}
+		errs = append(errs, fmt.Errorf("with -fs-mirror: %w", err))
+	}
+	cmd := exec.Command("terraform", "providers", "lock")
+	cmd.Dir = dir
+	cmd.Env = scratchEnv(terraformEnv())
+	if err := runTerraformCommand(cmd); err != nil {
+		errs = append(errs, err)
+		currentLogger().Printf("[warn] terraform providers lock: %v; continuing without a lock file\n", errors.Join(errs...))
+	}
+}
+
 func hasBackendBlock(path string) bool {
 	f, err := os.Open(path)
 	if err != nil {
@@ -285,7 +509,27 @@ func copyFile(src, dst string, perm os.FileMode) error {
 // partial backend configuration values as repeated -backend-config flags. Values
 // may be KEY=VALUE pairs or paths to *.tfbackend files, matching Terraform's semantics.
 func InitWithBackendConfig(workDir string, backendConfigs []string) error {
+	cmd := exec.Command("terraform", backendInitArgs(backendConfigs, false)...)
+	cmd.Dir = workDir
+	cmd.Env = terraformEnv()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	done := TraceCommand(cmd)
+	err := cmd.Run()
+	done(err)
+	if err != nil {
+		return fmt.Errorf("terraform init: %w", err)
+	}
+	return nil
+}
+
+// backendInitArgs builds `terraform init` arguments forwarding backendConfigs.
+// backendOnly skips module installation for inits that only need the backend.
+func backendInitArgs(backendConfigs []string, backendOnly bool) []string {
 	args := []string{"init", "-input=false", "-no-color"}
+	if backendOnly {
+		args = append(args, "-backend=true", "-get=false")
+	}
 	for _, bc := range backendConfigs {
 		bc = strings.TrimSpace(bc)
 		if bc == "" {
@@ -293,12 +537,5 @@ func InitWithBackendConfig(workDir string, backendConfigs []string) error {
 		}
 		args = append(args, "-backend-config="+bc)
 	}
-	cmd := exec.Command("terraform", args...)
-	cmd.Dir = workDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("terraform init: %w", err)
-	}
-	return nil
+	return args
 }
@@ -0,0 +1,358 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncPathsToScratch_TargetedChanges(t *testing.T) {
+	src := t.TempDir()
+	scratch := filepath.Join(src, ".terraflow")
+	mainTF := filepath.Join(src, "main.tf")
+	if err := os.WriteFile(mainTF, []byte(`locals { a = 1 }`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := SyncToScratch(src, scratch); err != nil {
+		t.Fatal(err)
+	}
+
+	// Touching the file without changing its content is not a change
+	later := time.Now().Add(2 * time.Second)
+	if err := os.Chtimes(mainTF, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _, err := SyncPathsToScratch(src, scratch, []string{"main.tf"}); err != nil || changed {
+		t.Fatalf("touch: changed=%v err=%v", changed, err)
+	}
+
+	if err := os.WriteFile(mainTF, []byte(`locals { a = 2 }`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	changed, changedTF, err := SyncPathsToScratch(src, scratch, []string{"main.tf"})
+	if err != nil || !changed || !changedTF {
+		t.Fatalf("edit: changed=%v changedTF=%v err=%v", changed, changedTF, err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(scratch, "main.tf")); string(b) != `locals { a = 2 }` {
+		t.Fatalf("scratch copy not updated: %q", b)
+	}
+
+	if err := os.Remove(mainTF); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _, err := SyncPathsToScratch(src, scratch, []string{mainTF}); err != nil || !changed {
+		t.Fatalf("delete: changed=%v err=%v", changed, err)
+	}
+	if _, err := os.Stat(filepath.Join(scratch, "main.tf")); !os.IsNotExist(err) {
+		t.Fatalf("expected scratch copy to be removed, stat err=%v", err)
+	}
+}
+
+// writeLargeTree creates n small .tf files spread across module directories.
+func writeLargeTree(b *testing.B, n int) (src, scratch string) {
+	b.Helper()
+	src = b.TempDir()
+	for i := 0; i < n; i++ {
+		dir := filepath.Join(src, "modules", fmt.Sprintf("m%d", i%50))
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			b.Fatal(err)
+		}
+		body := fmt.Sprintf("resource \"null_resource\" \"r%d\" {}\n", i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.tf", i)), []byte(body), 0o600); err != nil {
+			b.Fatal(err)
+		}
+	}
+	scratch = filepath.Join(src, ".terraflow")
+	if _, _, err := SyncToScratch(src, scratch); err != nil {
+		b.Fatal(err)
+	}
+	return src, scratch
+}
+
+func BenchmarkSyncToScratch_FullWalk(b *testing.B) {
+	src, scratch := writeLargeTree(b, 2000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := SyncToScratch(src, scratch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSyncPathsToScratch_SingleFile(b *testing.B) {
+	src, scratch := writeLargeTree(b, 2000)
+	paths := []string{filepath.Join("modules", "m7", "f7.tf")}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := SyncPathsToScratch(src, scratch, paths); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPrepareScratch_KeepWarmSkipsInit(t *testing.T) {
+	src := t.TempDir()
+	scratch := filepath.Join(src, ".terraflow")
+	if err := os.WriteFile(filepath.Join(src, "main.tf"), []byte(`locals { a = 1 }`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(src, ".terraform", "providers"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	var ran []string
+	orig := runTerraformCommand
+	runTerraformCommand = func(cmd *exec.Cmd) error {
+		ran = append(ran, strings.Join(cmd.Args[1:3], " "))
+		if cmd.Args[1] == "providers" {
+			return os.WriteFile(filepath.Join(cmd.Dir, ".terraform.lock.hcl"), nil, 0o600)
+		}
+		return os.MkdirAll(filepath.Join(cmd.Dir, ".terraform", "modules"), 0o700)
+	}
+	defer func() { runTerraformCommand = orig }()
+
+	skipped, err := PrepareScratch(src, scratch, true)
+	if err != nil || skipped {
+		t.Fatalf("first startup: skipped=%v err=%v", skipped, err)
+	}
+	if len(ran) != 2 {
+		t.Fatalf("first startup should initialize, ran %q", ran)
+	}
+
+	ran = nil
+	skipped, err = PrepareScratch(src, scratch, true)
+	if err != nil || !skipped || len(ran) != 0 {
+		t.Fatalf("second startup: skipped=%v err=%v ran=%q", skipped, err, ran)
+	}
+
+	// Without -keep-warm the scratch directory is always re-initialized
+	if skipped, err := PrepareScratch(src, scratch, false); err != nil || skipped {
+		t.Fatalf("keep-warm off: skipped=%v err=%v", skipped, err)
+	}
+
+	// A configuration change also re-initializes
+	if err := os.WriteFile(filepath.Join(src, "main.tf"), []byte(`locals { a = 2 }`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if skipped, err := PrepareScratch(src, scratch, true); err != nil || skipped {
+		t.Fatalf("after edit: skipped=%v err=%v", skipped, err)
+	}
+}
+
+func TestPrepareScratch_RemovesStaleEvalSnapshots(t *testing.T) {
+	src := t.TempDir()
+	scratch := filepath.Join(src, ".terraflow")
+	if err := os.MkdirAll(filepath.Join(scratch, "tmp"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	files := map[string]bool{ // path -> kept
+		".tfstate-eval-20240101T000000.000000000":     false, // written beside the state by earlier versions
+		"tmp/.tfstate-eval-20240101T000000.000000000": false,
+		"tmp/.tfstate-eval-snapshot.json":             false,
+		"terraform.tfstate":                           true,
+		"terraform.tfstate.backup":                    true,
+	}
+	for name := range files {
+		p := filepath.Join(scratch, name)
+		if err := os.WriteFile(p, []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A recent snapshot may belong to another running process
+	fresh := filepath.Join(scratch, "tmp", ".tfstate-eval-snapshot.json.tmp-1")
+	if err := os.WriteFile(fresh, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	files["tmp/.tfstate-eval-snapshot.json.tmp-1"] = true
+
+	if _, err := PrepareScratch(src, scratch, false); err != nil {
+		t.Fatal(err)
+	}
+	for name, kept := range files {
+		_, err := os.Stat(filepath.Join(scratch, name))
+		if exists := err == nil; exists != kept {
+			t.Errorf("%s: exists=%v, want %v", name, exists, kept)
+		}
+	}
+}
+
+func TestPrepareScratch_ProviderLockFailureIsNotFatal(t *testing.T) {
+	src := t.TempDir()
+	scratch := filepath.Join(src, ".terraflow")
+	if err := os.WriteFile(filepath.Join(src, "main.tf"), []byte(`locals { a = 1 }`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(src, ".terraform", "providers"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	var ran []string
+	plainLockWorks := false
+	orig := runTerraformCommand
+	runTerraformCommand = func(cmd *exec.Cmd) error {
+		ran = append(ran, strings.Join(cmd.Args[1:], " "))
+		switch {
+		case cmd.Args[1] != "providers":
+			return os.MkdirAll(filepath.Join(cmd.Dir, ".terraform", "modules"), 0o700)
+		case len(cmd.Args) == 3 && plainLockWorks:
+			return os.WriteFile(filepath.Join(cmd.Dir, ".terraform.lock.hcl"), nil, 0o600)
+		default:
+			return fmt.Errorf("exit status 1")
+		}
+	}
+	defer func() { runTerraformCommand = orig }()
+
+	logged := captureLog(t, func() {
+		if _, err := PrepareScratch(src, scratch, false); err != nil {
+			t.Fatalf("setup should complete without a lock file: %v", err)
+		}
+	})
+	want := []string{"providers lock -fs-mirror .terraform/providers", "providers lock", "init -get -backend=false -input=false -no-color"}
+	if strings.Join(ran, "|") != strings.Join(want, "|") {
+		t.Fatalf("ran %q, want %q", ran, want)
+	}
+	if !strings.Contains(logged, "[warn] terraform providers lock") {
+		t.Fatalf("expected a warning, got %q", logged)
+	}
+
+	// The plain lock fallback is used when the mirror lock fails
+	ran = nil
+	plainLockWorks = true
+	if _, err := PrepareScratch(src, scratch, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(scratch, ".terraform.lock.hcl")); err != nil {
+		t.Fatalf("expected lock file from fallback: %v", err)
+	}
+}
+
+func TestPullRemoteStateBackendOnly_SkipsProvidersAndModules(t *testing.T) {
+	src := t.TempDir()
+	mainTF := `terraform {
+  backend "s3" {
+    bucket = "state"
+  }
+  required_providers {
+    aws = { source = "hashicorp/aws" }
+  }
+}
+
+module "net" {
+  source = "./modules/net"
+}
+`
+	if err := os.WriteFile(filepath.Join(src, "main.tf"), []byte(mainTF), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var initArgs []string
+	var backendSrc string
+	orig := runTerraformCommand
+	runTerraformCommand = func(cmd *exec.Cmd) error {
+		switch cmd.Args[1] {
+		case "init":
+			initArgs = cmd.Args[1:]
+			entries, _ := os.ReadDir(cmd.Dir)
+			if len(entries) != 1 || entries[0].Name() != "backend.tf" {
+				t.Errorf("init dir should only hold backend.tf, got %v", entries)
+			}
+			b, _ := os.ReadFile(filepath.Join(cmd.Dir, "backend.tf"))
+			backendSrc = string(b)
+			return nil
+		case "state":
+			_, err := cmd.Stdout.Write([]byte(`{"version":4}`))
+			return err
+		}
+		return fmt.Errorf("unexpected command %q", cmd.Args)
+	}
+	defer func() { runTerraformCommand = orig }()
+
+	out, err := PullRemoteStateBackendOnly(src, []string{"backend.hcl", "key=env/dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"version":4}` {
+		t.Fatalf("pulled state = %q", out)
+	}
+	want := []string{"init", "-input=false", "-no-color", "-backend=true", "-get=false",
+		"-backend-config=" + filepath.Join(src, "backend.hcl"), "-backend-config=key=env/dev"}
+	if strings.Join(initArgs, " ") != strings.Join(want, " ") {
+		t.Fatalf("init args = %q, want %q", initArgs, want)
+	}
+	if !strings.Contains(backendSrc, `backend "s3"`) || strings.Contains(backendSrc, "required_providers") || strings.Contains(backendSrc, "module") {
+		t.Fatalf("backend.tf should only hold the backend block:\n%s", backendSrc)
+	}
+}
+
+func TestPrepareScratch_InitUsesPluginCache(t *testing.T) {
+	src := t.TempDir()
+	scratch := filepath.Join(src, ".terraflow")
+	if err := os.WriteFile(filepath.Join(src, "main.tf"), []byte(`locals { a = 1 }`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(src, ".terraform"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("TF_CLI_CONFIG_FILE", filepath.Join(home, "missing.tfrc"))
+	t.Setenv(pluginCacheEnvVar, "")
+	initEnv := map[string]string{}
+	orig := runTerraformCommand
+	runTerraformCommand = func(cmd *exec.Cmd) error {
+		if cmd.Args[1] == "init" {
+			for _, kv := range cmd.Env {
+				if k, v, ok := strings.Cut(kv, "="); ok {
+					initEnv[k] = v
+				}
+			}
+			return os.MkdirAll(filepath.Join(cmd.Dir, ".terraform", "modules"), 0o700)
+		}
+		return os.WriteFile(filepath.Join(cmd.Dir, ".terraform.lock.hcl"), nil, 0o600)
+	}
+	defer func() { runTerraformCommand = orig }()
+
+	if _, err := PrepareScratch(src, scratch, false); err != nil {
+		t.Fatal(err)
+	}
+	cache := filepath.Join(home, ".terraflow", "plugin-cache")
+	if initEnv[pluginCacheEnvVar] != cache {
+		t.Fatalf("init %s = %q, want %q", pluginCacheEnvVar, initEnv[pluginCacheEnvVar], cache)
+	}
+	if fi, err := os.Stat(cache); err != nil || !fi.IsDir() {
+		t.Fatalf("plugin cache should exist: %v", err)
+	}
+
+	// A cache the user configured is left to terraform
+	own := t.TempDir()
+	t.Setenv(pluginCacheEnvVar, own)
+	if _, err := PrepareScratch(src, scratch, false); err != nil {
+		t.Fatal(err)
+	}
+	if initEnv[pluginCacheEnvVar] != own {
+		t.Fatalf("init %s = %q, want the user's %q", pluginCacheEnvVar, initEnv[pluginCacheEnvVar], own)
+	}
+	if got := PluginCacheDir(); got != own {
+		t.Fatalf("PluginCacheDir() = %q, want %q", got, own)
+	}
+
+	os.Unsetenv(pluginCacheEnvVar)
+	rc := filepath.Join(home, "terraform.rc")
+	if err := os.WriteFile(rc, []byte(`plugin_cache_dir = "$HOME/.terraform.d/plugin-cache"`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TF_CLI_CONFIG_FILE", rc)
+	if got, want := PluginCacheDir(), filepath.Join(home, ".terraform.d", "plugin-cache"); got != want {
+		t.Fatalf("PluginCacheDir() = %q, want the CLI configuration's %q", got, want)
+	}
+	if env := strings.Join(terraformEnv(), "\n"); strings.Contains(env, pluginCacheEnvVar+"="+cache) {
+		t.Fatal("terraflow's cache should not override plugin_cache_dir")
+	}
+}
@@ -1,7 +1,6 @@
 package terraform
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -12,6 +11,7 @@ import (
 
 	"sync"
 
+	"github.com/flowave-io/terraflow/internal/encoding/jsonx"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	cty "github.com/zclconf/go-cty/cty"
@@ -60,7 +60,8 @@ func collectInDirForType(dir string, modulePath []string, rType, attr string, ou
 		if err != nil || info.IsDir() {
 			if info != nil && info.IsDir() {
 				base := filepath.Base(p)
-				if (base == ".terraform" || base == ".terraflow" || strings.HasPrefix(base, ".git")) && p != dir {
+				rel, _ := filepath.Rel(dir, p)
+				if (isDataDir(rel) || base == ".terraflow" || strings.HasPrefix(base, ".git")) && p != dir {
 					return filepath.SkipDir
 				}
 			}
@@ -134,14 +135,10 @@ func PatchSpecificResourceAttr(rootDir, workDir, statePath string, varFiles []st
 	if err != nil {
 		return err
 	}
-	b, err := os.ReadFile(statePath)
+	st, b, _, err := readStateCached(statePath)
 	if err != nil {
 		return err
 	}
-	var st map[string]any
-	if err := json.Unmarshal(b, &st); err != nil {
-		return err
-	}
 	resources, _ := st["resources"].([]any)
 	if resources == nil {
 		resources = []any{}
@@ -179,7 +176,7 @@ func PatchSpecificResourceAttr(rootDir, workDir, statePath string, varFiles []st
 		} else if strings.TrimSpace(it.Expr) != "" {
 			if v, ok := TryEvalInProcess(workDir, varFiles, it.Expr, 1*time.Second); ok {
 				val = v
-			} else if v, ok := EvalJSON(workDir, statePath, varFiles, it.Expr, 3*time.Second); ok {
+			} else if v, err := EvalJSON(workDir, statePath, varFiles, it.Expr, 3*time.Second); err == nil {
 				val = v
 			}
 		}
@@ -228,14 +225,11 @@ func PatchTargetedByFiles(rootDir, workDir, statePath string, varFiles []string,
 	if err := EnsureStateInitialized(statePath); err != nil {
 		return err
 	}
-	b, err := os.ReadFile(statePath)
+	warnDuplicateAddresses(rootDir)
+	st, _, _, err := readStateCached(statePath)
 	if err != nil {
 		return err
 	}
-	var st map[string]any
-	if err := json.Unmarshal(b, &st); err != nil {
-		return err
-	}
 	resources, _ := st["resources"].([]any)
 	if resources == nil {
 		resources = []any{}
@@ -256,6 +250,7 @@ func PatchTargetedByFiles(rootDir, workDir, statePath string, varFiles []string,
 			index[resourceKey(mod, rt, name)] = resRef{idx: i, obj: m}
 		}
 	}
+	focus := currentFocus()
 	// Walk provided files
 	changed := false
 	for _, p := range files {
@@ -269,6 +264,9 @@ func PatchTargetedByFiles(rootDir, workDir, statePath string, varFiles []string,
 					continue
 				}
 				rType, rName := blk.Labels[0], blk.Labels[1]
+				if !focus.matchesResource(rType, rName) {
+					continue
+				}
 				modKey := resourceKey("", rType, rName)
 				// locate actual key including module path by scanning existing index too
 				// try plain first
@@ -289,7 +287,7 @@ func PatchTargetedByFiles(rootDir, workDir, statePath string, varFiles []string,
 						"mode":     "managed",
 						"type":     rType,
 						"name":     rName,
-						"provider": providerAddressForType(rType),
+						"provider": providerAddress(rType, providerRefFromBody(blk.Body)),
 						"instances": []any{map[string]any{
 							"attributes":     map[string]any{},
 							"schema_version": 0,
@@ -299,10 +297,9 @@ func PatchTargetedByFiles(rootDir, workDir, statePath string, varFiles []string,
 					ref = resRef{idx: len(resources) - 1, obj: newRes}
 					index[modKey] = ref
 					changed = true
-				} else {
-					if _, hasProv := ref.obj["provider"]; !hasProv {
-						ref.obj["provider"] = providerAddressForType(rType)
-					}
+				} else if prov := providerAddressForResource(ref.obj["provider"], rType, providerRefFromBody(blk.Body)); prov != ref.obj["provider"] {
+					ref.obj["provider"] = prov
+					changed = true
 				}
 				// eval attributes (batch unresolved into one terraform console call)
 				// 1) Gather literal or in-process values
@@ -347,7 +344,7 @@ func PatchTargetedByFiles(rootDir, workDir, statePath string, varFiles []string,
 						bb.WriteString(")")
 					}
 					bb.WriteByte('}')
-					if v, ok := EvalJSON(workDir, statePath, varFiles, bb.String(), 100*time.Millisecond); ok {
+					if v, err := EvalJSON(workDir, statePath, varFiles, bb.String(), 100*time.Millisecond); err == nil {
 						if m, ok := v.(map[string]any); ok {
 							for k, val := range m {
 								resolved[k] = val
@@ -414,22 +411,7 @@ func PatchTargetedByFiles(rootDir, workDir, statePath string, varFiles []string,
 	default:
 		st["version"] = 4
 	}
-	switch s := st["serial"].(type) {
-	case float64:
-		if s <= 0 {
-			st["serial"] = 1
-		} else {
-			st["serial"] = int(s) + 1
-		}
-	case int:
-		if s <= 0 {
-			st["serial"] = 1
-		} else {
-			st["serial"] = s + 1
-		}
-	default:
-		st["serial"] = 1
-	}
+	bumpSerial(st)
 	return writeStateAtomicRaw(statePath, st)
 }
 
@@ -439,67 +421,58 @@ func PatchTargetedExactByFiles(rootDir, workDir, statePath string, varFiles []st
 	if len(files) == 0 {
 		return nil
 	}
+	warnDuplicateAddresses(rootDir)
 	// Build evaluation context once per batch for fast in-process evaluation
 	vars, locals := loadVarsAndLocals(workDir, varFiles)
-	ctx := &hcl.EvalContext{Variables: map[string]cty.Value{"var": ctyObjectFromMap(vars), "local": ctyObjectFromMap(locals)}, Functions: terraformFunctions()}
+	ctx := &hcl.EvalContext{Variables: map[string]cty.Value{"var": ctyObjectFromMap(vars), "local": ctyObjectFromMap(locals), "path": pathObject(workDir)}, Functions: workDirFunctions(workDir)}
 	varsStamp := computeVarsStamp(varFiles)
+	focus := currentFocus()
 
-	// Bounded parallelism over files
-	type job struct{ path string }
-	jobs := make(chan job, len(files))
-	const maxWorkers = 3
-	var wg sync.WaitGroup
-	worker := func() {
-		defer wg.Done()
-		for jb := range jobs {
-			p := jb.path
-			src, f, ok := getSyntaxFileCached(p)
-			if !ok || f == nil || len(src) == 0 {
+	// Files are patched by a bounded pool of workers (-parallelism)
+	forEachParallel(len(files), func(i int) {
+		p := files[i]
+		src, f, ok := getSyntaxFileCached(p)
+		if !ok || f == nil || len(src) == 0 {
+			return
+		}
+		// path.module of the file's own module, which may be a child of rootDir
+		moduleRel := modulePathRel(rootDir, filepath.Dir(p))
+		body, ok := f.Body.(*hclsyntax.Body)
+		if !ok {
+			return
+		}
+		for _, blk := range body.Blocks {
+			if blk == nil || blk.Type != "resource" || len(blk.Labels) < 2 {
 				continue
 			}
-			body, ok := f.Body.(*hclsyntax.Body)
-			if !ok {
+			rType, rName := blk.Labels[0], blk.Labels[1]
+			if !focus.matchesResource(rType, rName) {
 				continue
 			}
-			for _, blk := range body.Blocks {
-				if blk == nil || blk.Type != "resource" || len(blk.Labels) < 2 {
+			// For each non-meta attribute in the changed block, patch exactly that attribute
+			for attrName, a := range blk.Body.Attributes {
+				if isMetaArg(attrName) {
 					continue
 				}
-				rType, rName := blk.Labels[0], blk.Labels[1]
-				// For each non-meta attribute in the changed block, patch exactly that attribute
-				for attrName, a := range blk.Body.Attributes {
-					if isMetaArg(attrName) {
-						continue
+				isLit := false
+				var litVal any
+				var expr string
+				if v, ok := constValue(a.Expr); ok {
+					isLit = true
+					litVal = v
+				} else {
+					r := a.Expr.Range()
+					if call, ok := a.Expr.(*hclsyntax.FunctionCallExpr); ok && strings.EqualFold(call.Name, "jsonencode") && len(call.Args) == 1 {
+						r = call.Args[0].Range()
 					}
-					isLit := false
-					var litVal any
-					var expr string
-					if v, ok := constValue(a.Expr); ok {
-						isLit = true
-						litVal = v
-					} else {
-						r := a.Expr.Range()
-						if call, ok := a.Expr.(*hclsyntax.FunctionCallExpr); ok && strings.EqualFold(call.Name, "jsonencode") && len(call.Args) == 1 {
-							r = call.Args[0].Range()
-						}
-						if int(r.Start.Byte) >= 0 && int(r.End.Byte) <= len(src) && r.End.Byte >= r.Start.Byte {
-							expr = string(src[r.Start.Byte:r.End.Byte])
-						}
+					if int(r.Start.Byte) >= 0 && int(r.End.Byte) <= len(src) && r.End.Byte >= r.Start.Byte {
+						expr = bindModulePath(rootDir, moduleRel, string(src[r.Start.Byte:r.End.Byte]))
 					}
-					_ = patchAttrValueExactWithCtx(ctx, varsStamp, workDir, statePath, varFiles, rType, rName, attrName, isLit, litVal, expr)
 				}
+				_ = patchAttrValueExactWithCtx(ctx, varsStamp, workDir, statePath, varFiles, rType, rName, attrName, isLit, litVal, expr)
 			}
 		}
-	}
-	for i := 0; i < maxWorkers; i++ {
-		wg.Add(1)
-		go worker()
-	}
-	for _, p := range files {
-		jobs <- job{path: p}
-	}
-	close(jobs)
-	wg.Wait()
+	})
 	return nil
 }
 
@@ -531,6 +504,12 @@ func patchAttrValueExactWithCtx(ctx *hcl.EvalContext, varsStamp, workDir, stateP
 	var val any
 	if isLiteral {
 		val = lit
+	} else if impureSource(expr) {
+		// timestamp() and the like are answered by terraform on every refresh
+		// and never memoized, so their value does not freeze in state
+		if v, err := EvalJSON(workDir, statePath, varFiles, expr, 100*time.Millisecond); err == nil {
+			val = v
+		}
 	} else if strings.TrimSpace(expr) != "" {
 		key := workDir + "|" + varsStamp + "|" + rType + "|" + rName + "|" + attr + "|" + expr
 		evalMemoMu.Lock()
@@ -543,7 +522,7 @@ func patchAttrValueExactWithCtx(ctx *hcl.EvalContext, varsStamp, workDir, stateP
 		if val == nil {
 			if v, ok := evalExprWithCtx(ctx, expr); ok {
 				val = v
-			} else if v, ok := EvalJSON(workDir, statePath, varFiles, expr, 100*time.Millisecond); ok {
+			} else if v, err := EvalJSON(workDir, statePath, varFiles, expr, 100*time.Millisecond); err == nil {
 				val = v
 			}
 			if val != nil {
@@ -576,14 +555,12 @@ func evalExprWithCtx(ctx *hcl.EvalContext, expr string) (any, bool) {
 }
 
 func patchAttrWrite(statePath, rType, rName, attr string, val any) error {
-	b, err := os.ReadFile(statePath)
+	unlock := lockState(statePath)
+	defer unlock()
+	st, b, _, err := readStateCached(statePath)
 	if err != nil {
 		return err
 	}
-	var st map[string]any
-	if err := json.Unmarshal(b, &st); err != nil {
-		return err
-	}
 	resources, _ := st["resources"].([]any)
 	if resources == nil {
 		resources = []any{}
@@ -707,7 +684,7 @@ func PatchSpecificResourceAttrExact(rootDir, workDir, statePath string, varFiles
 	} else if strings.TrimSpace(found.Expr) != "" {
 		if v, ok := TryEvalInProcess(workDir, varFiles, found.Expr, 1*time.Second); ok {
 			val = v
-		} else if v, ok := EvalJSON(workDir, statePath, varFiles, found.Expr, 3*time.Second); ok {
+		} else if v, err := EvalJSON(workDir, statePath, varFiles, found.Expr, 3*time.Second); err == nil {
 			val = v
 		}
 	}
@@ -715,14 +692,10 @@ func PatchSpecificResourceAttrExact(rootDir, workDir, statePath string, varFiles
 		return nil
 	}
 	// Patch state for only this resource name
-	b, err := os.ReadFile(statePath)
+	st, b, _, err := readStateCached(statePath)
 	if err != nil {
 		return err
 	}
-	var st map[string]any
-	if err := json.Unmarshal(b, &st); err != nil {
-		return err
-	}
 	resources, _ := st["resources"].([]any)
 	if resources == nil {
 		resources = []any{}
@@ -802,25 +775,10 @@ func writeStateBump(path string, st map[string]any, old []byte) error {
 	default:
 		st["version"] = 4
 	}
-	switch s := st["serial"].(type) {
-	case float64:
-		if s <= 0 {
-			st["serial"] = 1
-		} else {
-			st["serial"] = int(s) + 1
-		}
-	case int:
-		if s <= 0 {
-			st["serial"] = 1
-		} else {
-			st["serial"] = s + 1
-		}
-	default:
-		st["serial"] = 1
-	}
-	nb, _ := json.Marshal(st)
+	bumpSerial(st)
+	nb, _ := jsonx.Marshal(st)
 	if len(old) == len(nb) && string(old) == string(nb) {
 		return nil
 	}
-	return writeStateAtomicRaw(path, st)
+	return writeStateAtomicBytes(path, st, nb)
 }
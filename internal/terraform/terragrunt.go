@@ -0,0 +1,110 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	cty "github.com/zclconf/go-cty/cty"
+)
+
+// TerragruntConfigFile is the Terragrunt configuration read by -terragrunt-inputs.
+const TerragruntConfigFile = "terragrunt.hcl"
+
+// terragruntVarFile is the tfvars file inputs are written to inside the scratch dir.
+const terragruntVarFile = ".terragrunt-inputs.tfvars"
+
+// TerragruntInputs reads the top-level inputs attribute of terragrunt.hcl in dir.
+// This is best-effort: Terragrunt functions, dependency outputs and locals are
+// not available, so inputs that need them are skipped and returned by name.
+func TerragruntInputs(dir string) (map[string]cty.Value, []string, error) {
+	path := filepath.Join(dir, TerragruntConfigFile)
+	src, err := readConfigFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, nil, fmt.Errorf("parse %s: %s", TerragruntConfigFile, diags.Error())
+	}
+	body, ok := f.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, nil, nil
+	}
+	attr, ok := body.Attributes["inputs"]
+	if !ok {
+		return nil, nil, nil
+	}
+	ctx := &hcl.EvalContext{Functions: terraformFunctions()}
+	obj, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		// inputs = merge(...) and the like: all or nothing
+		v, diags := attr.Expr.Value(ctx)
+		if diags.HasErrors() || !v.IsWhollyKnown() || v.IsNull() || !(v.Type().IsObjectType() || v.Type().IsMapType()) {
+			return nil, []string{"inputs"}, nil
+		}
+		v, _ = v.UnmarkDeep()
+		inputs := map[string]cty.Value{}
+		var skipped []string
+		for name, iv := range v.AsValueMap() {
+			if hclsyntax.ValidIdentifier(name) {
+				inputs[name] = iv
+			} else {
+				skipped = append(skipped, name)
+			}
+		}
+		sort.Strings(skipped)
+		return inputs, skipped, nil
+	}
+	inputs := map[string]cty.Value{}
+	var skipped []string
+	for _, item := range obj.Items {
+		key, diags := item.KeyExpr.Value(ctx)
+		if diags.HasErrors() || !key.IsKnown() || key.IsNull() || key.Type() != cty.String {
+			continue
+		}
+		name := key.AsString()
+		v, diags := item.ValueExpr.Value(ctx)
+		if diags.HasErrors() || !v.IsWhollyKnown() || !hclsyntax.ValidIdentifier(name) {
+			skipped = append(skipped, name)
+			continue
+		}
+		inputs[name], _ = v.UnmarkDeep()
+	}
+	sort.Strings(skipped)
+	return inputs, skipped, nil
+}
+
+// WriteTerragruntVarFile writes the inputs of terragrunt.hcl in srcDir as a tfvars
+// file under scratchDir and returns its path, so they are applied like any
+// other -var-file. Inputs that could not be evaluated are logged and skipped.
+func WriteTerragruntVarFile(srcDir, scratchDir string) (string, error) {
+	inputs, skipped, err := TerragruntInputs(srcDir)
+	if err != nil {
+		return "", err
+	}
+	if len(skipped) > 0 {
+		currentLogger().Printf("[warn] terragrunt inputs not evaluated: %v\n", skipped)
+	}
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := hclwrite.NewEmptyFile()
+	for _, name := range names {
+		out.Body().SetAttributeValue(name, inputs[name])
+	}
+	if err := os.MkdirAll(scratchDir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(scratchDir, terragruntVarFile)
+	if err := os.WriteFile(path, out.Bytes(), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
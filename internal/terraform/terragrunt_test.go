@@ -0,0 +1,36 @@
+package terraform
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteTerragruntVarFile_InputsReachInProcessEval(t *testing.T) {
+	dir := filepath.Join(repoRoot(t), "test", "fixtures", "terragrunt_inputs")
+	_, skipped, err := TerragruntInputs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dependency outputs only exist when Terragrunt runs
+	if !reflect.DeepEqual(skipped, []string{"vpc_id"}) {
+		t.Fatalf("skipped = %v, want [vpc_id]", skipped)
+	}
+	varFile, err := WriteTerragruntVarFile(dir, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]any{
+		`var.region`:     "eu-west-1",
+		`var.tags.team`:  "platform",
+		`local.name_tag`: "WEB-dev",
+		`var.vpc_id`:     "vpc-local",
+	}
+	for expr, want := range cases {
+		got, ok := TryEvalInProcess(dir, []string{varFile}, expr, time.Second)
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: got %#v (ok=%v), want %#v", expr, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package terraform
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	traceMu  sync.Mutex
+	traceOut io.Writer // nil while tracing is off
+)
+
+// SetTrace writes a line to w for every subprocess terraflow runs, with its
+// arguments, directory, duration and outcome. A nil w turns tracing off.
+func SetTrace(w io.Writer) {
+	traceMu.Lock()
+	traceOut = w
+	traceMu.Unlock()
+}
+
+// TraceCommand starts timing cmd and returns the function to call with its
+// result once it exits, which writes the trace line. It does nothing while
+// tracing is off.
+func TraceCommand(cmd *exec.Cmd) func(err error) {
+	traceMu.Lock()
+	on := traceOut != nil
+	traceMu.Unlock()
+	if !on {
+		return func(error) {}
+	}
+	start := time.Now()
+	return func(err error) {
+		status := "ok"
+		if err != nil {
+			status = err.Error()
+		}
+		line := "[trace] " + tracedCommandLine(cmd.Args)
+		if cmd.Dir != "" {
+			line += " (in " + cmd.Dir + ")"
+		}
+		line += fmt.Sprintf(": %s, %s\n", time.Since(start).Round(time.Millisecond), status)
+		traceMu.Lock()
+		defer traceMu.Unlock()
+		if traceOut != nil {
+			_, _ = io.WriteString(traceOut, line)
+		}
+	}
+}
+
+// tracedCommandLine formats args for the trace, quoting those with spaces.
+// Values of -backend-config=KEY=VALUE may hold credentials and are redacted;
+// paths to backend config files are kept.
+func tracedCommandLine(args []string) string {
+	out := make([]string, 0, len(args))
+	for _, a := range args {
+		if v, ok := strings.CutPrefix(a, "-backend-config="); ok {
+			if key, _, isPair := strings.Cut(v, "="); isPair {
+				out = append(out, "-backend-config="+key+"="+SensitiveRedacted)
+				continue
+			}
+		}
+		if a == "" || strings.ContainsAny(a, " \t\"'") {
+			a = strconv.Quote(a)
+		}
+		out = append(out, a)
+	}
+	return strings.Join(out, " ")
+}
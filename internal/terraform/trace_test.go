@@ -0,0 +1,45 @@
+package terraform
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestTraceCommand_RedactsBackendConfigValues(t *testing.T) {
+	fakeTerraform(t, "1.9.0")
+	var buf bytes.Buffer
+	SetTrace(&buf)
+	t.Cleanup(func() { SetTrace(nil) })
+
+	cmd := exec.Command("terraform", backendInitArgs([]string{"access_key=s3cr3t", "backend.hcl"}, true)...)
+	cmd.Dir = t.TempDir()
+	if err := runTerraformCommand(cmd); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"[trace] terraform init -input=false -no-color",
+		"-backend-config=access_key=" + SensitiveRedacted,
+		"-backend-config=backend.hcl",
+		"(in " + cmd.Dir + "): ",
+		", ok\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("trace %q lacks %q", out, want)
+		}
+	}
+	if strings.Contains(out, "s3cr3t") {
+		t.Fatalf("trace leaks a backend config value: %q", out)
+	}
+
+	SetTrace(nil)
+	buf.Reset()
+	if err := runTerraformCommand(exec.Command("terraform", "version")); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("traced with tracing off: %q", buf.String())
+	}
+}
@@ -2,55 +2,89 @@ package terraform
 
 import (
 	"bytes"
-	"encoding/json"
-	"log"
+	"fmt"
 	"os/exec"
 	"regexp"
+	"strings"
+	"sync"
 
 	gv "github.com/hashicorp/go-version"
 )
 
 const minTerraformVersion = "0.13.0"
 
-type tfVersionJSON struct {
-	TerraformVersion string `json:"terraform_version"`
+// hardMinTerraformVersion is the oldest release terraflow runs against at all:
+// state format version 4 and `terraform console -state` first shipped in 0.12.
+const hardMinTerraformVersion = "0.12.0"
+
+// Provider-defined functions (provider::<name>::<function>) first shipped in
+// these releases.
+const (
+	minProviderFuncsTerraform = "1.8.0"
+	minProviderFuncsOpenTofu  = "1.7.0"
+)
+
+// binaryVersion is the product and version reported by a terraform binary.
+type binaryVersion struct {
+	openTofu bool
+	version  *gv.Version
 }
 
-// CheckVersionWarn attempts to read the installed Terraform/OpenTofu version and
-// logs a warning if it is older than the recommended minimum. It never exits.
-func CheckVersionWarn() {
-	// Try JSON first (Terraform >= 0.15)
+var (
+	versionRe     = regexp.MustCompile(`v([0-9]+\.[0-9]+\.[0-9]+)`) // v1.5.7
+	bareVersionRe = regexp.MustCompile(`\b([0-9]+\.[0-9]+\.[0-9]+)\b`)
+
+	versionsMu sync.Mutex
+	versions   = map[string]binaryVersion{}
+)
+
+// parseVersionOutput extracts the product and version from `terraform version`
+// output such as "Terraform v1.5.7" or "OpenTofu v1.8.0".
+func parseVersionOutput(out []byte) binaryVersion {
+	var bv binaryVersion
+	bv.openTofu = bytes.Contains(out, []byte("OpenTofu"))
 	var versionStr string
-	if out, err := exec.Command("terraform", "version", "-json").Output(); err == nil {
-		var v tfVersionJSON
-		if json.Unmarshal(out, &v) == nil && v.TerraformVersion != "" {
-			versionStr = v.TerraformVersion
-		}
+	if m := versionRe.FindSubmatch(out); len(m) == 2 {
+		versionStr = string(m[1])
+	} else if m := bareVersionRe.FindSubmatch(out); len(m) == 2 {
+		// Some distros print without v prefix
+		versionStr = string(m[1])
+	}
+	if v, err := gv.NewVersion(versionStr); err == nil && versionStr != "" {
+		bv.version = v
+	}
+	return bv
+}
+
+// installedVersion runs `bin version` once per binary and caches the result.
+// The version is nil when it cannot be determined.
+func installedVersion(bin string) binaryVersion {
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+	if bv, ok := versions[bin]; ok {
+		return bv
 	}
-	if versionStr == "" {
-		// Fallback to parsing plain text: "Terraform v1.5.7" or "OpenTofu v1.8.0"
-		if out, err := exec.Command("terraform", "version").Output(); err == nil {
-			// Extract first semantic version
-			re := regexp.MustCompile(`v([0-9]+\.[0-9]+\.[0-9]+)`) // v1.5.7
-			m := re.FindSubmatch(out)
-			if len(m) == 2 {
-				versionStr = string(m[1])
-			} else {
-				// Some distros print without v prefix
-				re2 := regexp.MustCompile(`\b([0-9]+\.[0-9]+\.[0-9]+)\b`)
-				m2 := re2.FindSubmatch(out)
-				if len(m2) == 2 {
-					versionStr = string(m2[1])
-				}
-			}
-		}
+	var bv binaryVersion
+	cmd := exec.Command(bin, "version")
+	done := TraceCommand(cmd)
+	out, err := cmd.Output()
+	done(err)
+	if err == nil {
+		bv = parseVersionOutput(out)
 	}
-	if versionStr == "" {
+	versions[bin] = bv
+	return bv
+}
+
+// CheckVersionWarn attempts to read the installed Terraform/OpenTofu version and
+// logs a warning if it is older than the recommended minimum. It never exits.
+func CheckVersionWarn() {
+	curV := installedVersion("terraform").version
+	if curV == nil {
 		return
 	}
-	minV, err1 := gv.NewVersion(minTerraformVersion)
-	curV, err2 := gv.NewVersion(versionStr)
-	if err1 != nil || err2 != nil {
+	minV, err := gv.NewVersion(minTerraformVersion)
+	if err != nil {
 		return
 	}
 	if curV.LessThan(minV) {
@@ -60,6 +94,44 @@ func CheckVersionWarn() {
 		buf.WriteString(" is older than recommended minimum ")
 		buf.WriteString(minV.String())
 		buf.WriteString(". Some features may be limited.")
-		log.Print(buf.String())
+		currentLogger().Print(buf.String())
+	}
+}
+
+// CheckVersionFloor returns an error when the installed Terraform/OpenTofu
+// version is older than the hard minimum terraflow supports. A version that
+// cannot be determined passes, as with CheckVersionWarn.
+func CheckVersionFloor() error {
+	return versionBelowFloor(installedVersion("terraform"))
+}
+
+func versionBelowFloor(bv binaryVersion) error {
+	if bv.version == nil {
+		return nil
+	}
+	if bv.version.LessThan(gv.Must(gv.NewVersion(hardMinTerraformVersion))) {
+		return fmt.Errorf("unsupported Terraform/OpenTofu %s: terraflow requires %s or newer, %s recommended", bv.version, hardMinTerraformVersion, minTerraformVersion)
 	}
+	return nil
+}
+
+// providerFuncsUnsupported returns an explanatory error when bv is known to
+// predate provider-defined functions, and nil otherwise.
+func providerFuncsUnsupported(bv binaryVersion) error {
+	if bv.version == nil {
+		return nil
+	}
+	product, minStr := "Terraform", minProviderFuncsTerraform
+	if bv.openTofu {
+		product, minStr = "OpenTofu", minProviderFuncsOpenTofu
+	}
+	if bv.version.LessThan(gv.Must(gv.NewVersion(minStr))) {
+		return fmt.Errorf("provider functions require Terraform 1.8+/OpenTofu 1.7+ (found %s %s)", product, bv.version)
+	}
+	return nil
+}
+
+// usesProviderFunctions reports whether expr calls a provider-defined function.
+func usesProviderFunctions(expr string) bool {
+	return strings.Contains(expr, "provider::")
 }
@@ -0,0 +1,20 @@
+variable "env" {
+  default = "dev"
+}
+
+locals {
+  name = "app-${var.env}"
+}
+
+resource "null_resource" "named" {
+  triggers = {
+    name = local.name
+    kind = "static"
+  }
+}
+
+resource "null_resource" "broken" {
+  triggers = {
+    owner = local.owner
+  }
+}
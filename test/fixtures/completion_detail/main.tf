@@ -0,0 +1,14 @@
+variable "region" {
+  type        = string
+  description = "Region to deploy into"
+  default     = "eu-west-1"
+}
+
+output "region_upper" {
+  description = "region in upper case"
+  value       = upper(var.region)
+}
+
+module "net" {
+  source = "./modules/net"
+}
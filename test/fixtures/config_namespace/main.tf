@@ -0,0 +1,31 @@
+locals {
+  common_tags = {
+    team = "platform"
+  }
+}
+
+resource "aws_instance" "web" {
+  ami           = "ami-123"
+  instance_type = "t3.micro"
+  subnet_id     = aws_subnet.main.id
+
+  tags = merge(local.common_tags, {
+    Name = "web"
+  })
+
+  root_block_device {
+    volume_size = 20
+  }
+}
+
+resource "aws_instance" "workers" {
+  count = 2
+
+  ami  = "ami-123"
+  tags = { Name = "worker-${count.index}" }
+}
+
+data "aws_ami" "ubuntu" {
+  most_recent = true
+  owners      = ["099720109477"]
+}
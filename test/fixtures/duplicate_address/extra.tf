@@ -0,0 +1,17 @@
+locals {
+  suffix = "extra"
+}
+
+resource "null_resource" "ex" {
+  triggers = {
+    source = local.suffix
+  }
+}
+
+data "null_data_source" "lookup" {
+  inputs = {
+    name = "second"
+  }
+}
+
+resource "null_resource" "unique" {}
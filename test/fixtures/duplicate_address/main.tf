@@ -0,0 +1,11 @@
+resource "null_resource" "ex" {
+  triggers = {
+    source = "main"
+  }
+}
+
+data "null_data_source" "lookup" {
+  inputs = {
+    name = "first"
+  }
+}
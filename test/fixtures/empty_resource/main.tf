@@ -0,0 +1,5 @@
+resource "random_pet" "p" {}
+
+output "pet" {
+  value = random_pet.p.id
+}
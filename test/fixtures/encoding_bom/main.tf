@@ -0,0 +1,10 @@
+﻿variable "region" {
+  type    = string
+  default = "eu-west-1"
+}
+
+resource "null_resource" "bom" {
+  triggers = {
+    region = var.region
+  }
+}
@@ -0,0 +1,20 @@
+variable "buckets" {
+  default = {
+    logs   = "us-east-1"
+    assets = "eu-west-1"
+  }
+}
+
+resource "aws_s3_bucket" "b" {
+  for_each = var.buckets
+
+  bucket = "${each.key}-bucket"
+  region = each.value
+  acl    = "private"
+}
+
+resource "aws_iam_user" "u" {
+  for_each = toset(["alice", "bob"])
+
+  name = upper(each.value)
+}
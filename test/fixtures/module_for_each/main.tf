@@ -0,0 +1,21 @@
+variable "envs" {
+  default = {
+    prod    = "t3.large"
+    staging = "t3.micro"
+  }
+}
+
+module "envs" {
+  source   = "./modules/env"
+  for_each = var.envs
+
+  name          = each.key
+  instance_type = each.value
+}
+
+module "workers" {
+  source = "./modules/worker"
+  count  = 2
+
+  name = "worker-${count.index}"
+}
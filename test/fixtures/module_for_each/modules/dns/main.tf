@@ -0,0 +1,12 @@
+variable "zone" {}
+
+variable "ttl" {
+  default = 300
+}
+
+resource "null_resource" "record" {
+  triggers = {
+    zone = var.zone
+    ttl  = var.ttl
+  }
+}
@@ -0,0 +1,18 @@
+variable "name" {}
+
+variable "instance_type" {
+  default = "t3.nano"
+}
+
+resource "null_resource" "web" {
+  triggers = {
+    name = var.name
+    type = var.instance_type
+  }
+}
+
+module "dns" {
+  source = "../dns"
+
+  zone = "${var.name}.example.com"
+}
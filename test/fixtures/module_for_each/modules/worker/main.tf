@@ -0,0 +1,7 @@
+variable "name" {}
+
+resource "null_resource" "worker" {
+  triggers = {
+    name = var.name
+  }
+}
@@ -0,0 +1,9 @@
+module "vpc" {
+  source = "./modules/vpc"
+}
+
+resource "null_resource" "root" {
+  triggers = {
+    greeting = file("${path.module}/greeting.txt")
+  }
+}
@@ -0,0 +1,6 @@
+resource "null_resource" "vpc" {
+  triggers = {
+    greeting = file("${path.module}/greeting.txt")
+    module   = path.module
+  }
+}
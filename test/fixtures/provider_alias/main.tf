@@ -0,0 +1,24 @@
+provider "aws" {
+  region = "us-east-1"
+}
+
+provider "aws" {
+  alias  = "west"
+  region = "us-west-2"
+}
+
+resource "aws_s3_bucket" "east" {
+  bucket = "logs-east"
+}
+
+resource "aws_s3_bucket" "west" {
+  provider = aws.west
+  bucket   = "logs-west"
+}
+
+data "aws_caller_identity" "current" {}
+
+data "aws_region" "west" {
+  provider = aws.west
+  name     = "us-west-2"
+}
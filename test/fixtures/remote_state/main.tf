@@ -0,0 +1,17 @@
+data "terraform_remote_state" "network" {
+  backend = "local"
+
+  config = {
+    path = "network.tfstate"
+  }
+
+  defaults = {
+    region = "eu-west-1"
+  }
+}
+
+resource "null_resource" "app" {
+  triggers = {
+    vpc_id = data.terraform_remote_state.network.outputs.vpc_id
+  }
+}
@@ -0,0 +1,21 @@
+variable "region" {
+  type = string
+}
+
+variable "instance_name" {
+  type = string
+}
+
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+
+variable "vpc_id" {
+  type    = string
+  default = "vpc-local"
+}
+
+locals {
+  name_tag = "${var.instance_name}-${var.tags["env"]}"
+}
@@ -0,0 +1,18 @@
+include "root" {
+  path = find_in_parent_folders()
+}
+
+terraform {
+  source = "../modules//app"
+}
+
+dependency "vpc" {
+  config_path = "../vpc"
+}
+
+inputs = {
+  region        = "eu-west-1"
+  instance_name = upper("web")
+  tags          = { team = "platform", env = "dev" }
+  vpc_id        = dependency.vpc.outputs.vpc_id
+}